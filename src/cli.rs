@@ -51,15 +51,17 @@ pub fn header(title: &str) {
 
 pub fn rule_table_header() {
     println!(
-        "{} | {} | {}",
+        "{} | {} | {} | {} | {}",
         "Rule ID".bright_cyan().bold(),
         "Name".bright_cyan().bold(),
-        "Enabled".bright_cyan().bold()
+        "Enabled".bright_cyan().bold(),
+        "Actions".bright_cyan().bold(),
+        "Matches".bright_cyan().bold()
     );
-    println!("{}", "─".repeat(80).bright_black());
+    println!("{}", "─".repeat(120).bright_black());
 }
 
-pub fn rule_table_row(id: &str, name: &str, enabled: bool) {
+pub fn rule_table_row(id: &str, name: &str, enabled: bool, actions: usize, matches: &str) {
     let status = if enabled {
         "✓ Enabled".green()
     } else {
@@ -67,10 +69,12 @@ pub fn rule_table_row(id: &str, name: &str, enabled: bool) {
     };
 
     println!(
-        "{:<30} | {:<30} | {}",
+        "{:<30} | {:<30} | {:<10} | {:>7} | {}",
         id.bright_white(),
         name.white(),
-        status
+        status,
+        actions,
+        matches.bright_black()
     );
 }
 
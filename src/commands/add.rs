@@ -1,44 +1,80 @@
 use crate::cli;
 use crate::core::context;
+use crate::rules::{
+    remote::{fetch_rule_snippet, is_url},
+    rules_file::{ImportSummary, RulesFile},
+};
 use anyhow::Result;
 use clap::Args;
 use std::fs;
 use std::path::Path;
 
 #[derive(Args)]
-#[command(about = "📝 Add a new rule by importing a YAML file or scanning a directory")]
+#[command(about = "📝 Add a new rule by importing a YAML file or URL, or scanning a directory")]
 pub struct AddArgs {
-    /// Path to the rule YAML file or directory containing YAML files
+    /// Path to the rule YAML file or directory containing YAML files, or an https:// URL
     #[arg(
         value_name = "PATH",
-        help = "Path to the YAML file or directory containing YAML files with rule definitions"
+        help = "Path to the YAML file or directory containing YAML files with rule definitions, or an https:// URL of a YAML file"
     )]
     pub path: String,
 
-    /// Optional flag to overwrite existing rules
+    /// Optional flag to replace existing rules with the same ID
     #[arg(
         long,
+        alias = "overwrite",
         default_value_t = false,
-        help = "Overwrite existing rule if it already exists"
+        help = "Replace an existing rule with the same ID instead of failing"
     )]
-    pub overwrite: bool,
+    pub replace: bool,
+
+    /// Allow downloading rules over plain HTTP
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Allow an http:// URL; the rules could be tampered with on the way"
+    )]
+    pub insecure: bool,
 }
 
 pub fn run(args: &AddArgs) -> Result<()> {
     let path = Path::new(&args.path);
 
-    if path.is_file() {
+    if is_url(&args.path) {
+        cli::info(&format!("🌐 Adding rule from URL: {}", args.path));
+        log::info!("Adding rule from URL: {}", args.path);
+
+        let content = fetch_rule_snippet(&args.path, args.insecure)?;
+        let mut rf = context::get_locked_rules_file()?;
+        let summary = rf
+            .add_rules_from_str(&content, args.replace)
+            .map_err(|e| anyhow::anyhow!("Failed to add rule from URL: {}: {}", args.path, e))?;
+
+        report_import(&rf, &summary);
+        log::info!(
+            "Rules imported from URL: {} (added: {:?}, replaced: {:?})",
+            args.path,
+            summary.added,
+            summary.replaced
+        );
+    } else if path.is_file() {
         // Handle single file
         cli::info(&format!("📝 Adding rule from file: {}", args.path));
         log::info!("Adding rule from file: {}", args.path);
 
         let mut rf = context::get_locked_rules_file()?;
 
-        rf.add_rule_from_file(&args.path, args.overwrite)
+        let summary = rf
+            .add_rule_from_file(&args.path, args.replace)
             .map_err(|e| anyhow::anyhow!("Failed to add rule from file: {}: {}", args.path, e))?;
 
-        cli::success("Rule added successfully!");
-        log::info!("Rule added successfully from file: {}", args.path);
+        report_import(&rf, &summary);
+        log::info!(
+            "Rules imported from file: {} (added: {:?}, replaced: {:?})",
+            args.path,
+            summary.added,
+            summary.replaced
+        );
     } else if path.is_dir() {
         // Handle directory
         cli::info(&format!(
@@ -72,14 +108,21 @@ pub fn run(args: &AddArgs) -> Result<()> {
             let file_name = file_path.file_name().unwrap().to_string_lossy();
             log::info!("Processing file: {file_path_str}");
 
-            match rf.add_rule_from_file(&file_path_str, args.overwrite) {
-                Ok(()) => {
-                    cli::success(&format!("  ✅ Added rules from: {file_name}"));
+            match rf.add_rule_from_file(&file_path_str, args.replace) {
+                Ok(summary) => {
+                    if summary.replaced.is_empty() {
+                        cli::success(&format!("  ✅ Added rules from: {file_name}"));
+                    } else {
+                        cli::success(&format!(
+                            "  ✅ Added rules from: {file_name} (replaced: {})",
+                            summary.replaced.join(", ")
+                        ));
+                    }
                     log::info!("Successfully added rules from: {file_path_str}");
                     added_count += 1;
                 }
                 Err(e) => {
-                    if e.to_string().contains("already exists") && !args.overwrite {
+                    if e.to_string().contains("already exists") && !args.replace {
                         cli::warning(&format!("  ⚠️  Skipped (rule exists): {file_name}"));
                         log::warn!("Skipped file due to existing rule: {file_path_str}");
                         skipped_count += 1;
@@ -113,6 +156,20 @@ pub fn run(args: &AddArgs) -> Result<()> {
     Ok(())
 }
 
+/// Prints which rules were newly added and which replaced existing ones
+fn report_import(rf: &RulesFile, summary: &ImportSummary) {
+    let name = |id: &str| rf.find_rule(id).map(|rule| rule.name).unwrap_or_default();
+    for id in &summary.added {
+        cli::success(&format!("Rule '{id}' ({}) added successfully!", name(id)));
+    }
+    for id in &summary.replaced {
+        cli::success(&format!(
+            "Rule '{id}' ({}) replaced the existing rule with the same ID.",
+            name(id)
+        ));
+    }
+}
+
 /// Find all YAML files in a directory (non-recursive)
 fn find_yaml_files(dir: &Path) -> Result<Vec<std::path::PathBuf>> {
     let mut yaml_files = Vec::new();
@@ -0,0 +1,111 @@
+use std::path::PathBuf;
+
+use crate::cli;
+use crate::common::config::Config;
+use crate::core::{profiler, sorter};
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rules_file::RulesFile;
+use anyhow::Result;
+use clap::Args;
+use colored::Colorize;
+
+/// Number of slowest rules shown in the report
+const SLOWEST_RULES_SHOWN: usize = 5;
+
+#[derive(Args)]
+#[command(about = "⏱️  Benchmark rule evaluation against a folder without running actions")]
+pub struct BenchArgs {
+    /// Folder to evaluate the rules against
+    #[arg(long, help = "Folder whose files the rules are evaluated against")]
+    pub dir: String,
+
+    /// Comma-separated rule IDs to benchmark
+    #[arg(
+        long,
+        help = "Comma-separated list of rule IDs to benchmark (defaults to all enabled rules)"
+    )]
+    pub rules: Option<String>,
+}
+
+pub fn run(args: &BenchArgs) -> Result<()> {
+    cli::info(&format!("⏱️ Benchmarking rules against: {}", args.dir));
+    log::info!(
+        "Running bench with dir: {}, rules: {:?}",
+        args.dir,
+        args.rules
+    );
+
+    let rule_filter = args.rules.as_ref().map(|r| {
+        r.split(',')
+            .map(|s| s.trim().to_string())
+            .collect::<Vec<_>>()
+    });
+
+    let config = Config::load()?;
+    let rules_file = RulesFile::load()?.optimized_with_filter(rule_filter.as_deref())?;
+    let files = sorter::collect_files(&PathBuf::from(&args.dir))?;
+
+    let report = profiler::profile_rules(
+        &files,
+        &rules_file.rules,
+        &ExtensionLists::from_config(&config),
+    );
+    log::info!(
+        "Bench finished: {} files in {:?}",
+        report.files_scanned,
+        report.total_time
+    );
+
+    cli::header("⏱️ Rule Evaluation Benchmark");
+    println!(
+        "{} {}",
+        "Files scanned:".bright_white(),
+        report.files_scanned.to_string().green()
+    );
+    println!(
+        "{} {}",
+        "Files matched:".bright_white(),
+        report.files_matched.to_string().green()
+    );
+    println!("{} {:.2?}", "Total time:".bright_white(), report.total_time);
+    println!(
+        "{} {:.1}",
+        "Files/second:".bright_white(),
+        report.files_per_second()
+    );
+    println!(
+        "{} {:.2?}",
+        "Metadata reading:".bright_white(),
+        report.metadata_time
+    );
+    println!(
+        "{} {:.2?}",
+        "Rule matching:".bright_white(),
+        report.matching_time
+    );
+
+    cli::header("🐢 Slowest Rules");
+    println!(
+        "{} | {} | {} | {}",
+        "Rule ID".bright_cyan().bold(),
+        "Matches".bright_cyan().bold(),
+        "Total".bright_cyan().bold(),
+        "Avg/file".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(80).bright_black());
+
+    for profile in report.slowest_rules(SLOWEST_RULES_SHOWN) {
+        println!(
+            "{:<30} | {:<10} | {:<12} | {:.2?}",
+            profile.rule_id.bright_white(),
+            profile.matches,
+            format!("{:.2?}", profile.total_time),
+            profile.average_time()
+        );
+    }
+
+    println!();
+    cli::success("Benchmark completed successfully!");
+
+    Ok(())
+}
@@ -0,0 +1,56 @@
+use crate::cli;
+use crate::rules::category::CATEGORIES;
+use anyhow::Result;
+use clap::Args;
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "🗂️ List the built-in file categories usable in rule conditions")]
+pub struct CategoriesArgs {
+    /// Also list the MIME types of each category
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Also show the MIME types each category matches when the extension is unknown"
+    )]
+    pub mime_types: bool,
+}
+
+pub fn run(args: &CategoriesArgs) -> Result<()> {
+    log::info!("Listing built-in categories...");
+
+    cli::header(&format!("🗂️ {} built-in categories", CATEGORIES.len()));
+    println!(
+        "{} | {}",
+        "Category".bright_cyan().bold(),
+        "Covers".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(80).bright_black());
+
+    for category in CATEGORIES {
+        println!(
+            "{:<10} | {}",
+            category.name.bright_white(),
+            category.description
+        );
+        println!(
+            "{:<10} | {} {}",
+            "",
+            "extensions:".bright_black(),
+            category.extensions.join(", ")
+        );
+        if args.mime_types {
+            println!(
+                "{:<10} | {} {}",
+                "",
+                "mime types:".bright_black(),
+                category.mime_types.join(", ")
+            );
+        }
+    }
+
+    println!();
+    cli::info("Use a category in a rule with `category: <name>` under `when`.");
+
+    Ok(())
+}
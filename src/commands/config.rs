@@ -1,7 +1,9 @@
-use crate::core::context;
+use crate::core::{confirm, context};
 use crate::{cli, common::config::Config};
 use anyhow::{Context, Result, anyhow};
 use clap::Args;
+use std::fs;
+use std::io::{self, IsTerminal};
 
 #[derive(Args)]
 #[command(about = "⚙️ Manage the Tooka configuration file")]
@@ -10,33 +12,62 @@ pub struct ConfigArgs {
     #[arg(long, help = "Show the path to the configuration file")]
     pub locate: bool,
 
+    /// Flag to set up the configuration, rules file and data folders
+    #[arg(
+        long,
+        help = "Create the configuration, rules file and logs folder if they are missing"
+    )]
+    pub init: bool,
+
     /// Flag to reset the configuration file to default values
-    #[arg(long, help = "Reset configuration to default values")]
+    #[arg(
+        long,
+        help = "Reset configuration to default values, keeping the source folder"
+    )]
     pub reset: bool,
 
+    /// Also reset the source folder
+    #[arg(
+        long,
+        requires = "reset",
+        help = "With --reset, also reset the source folder to its default"
+    )]
+    pub hard: bool,
+
+    /// Reset without asking for confirmation
+    #[arg(
+        long,
+        short = 'y',
+        requires = "reset",
+        help = "With --reset, reset without asking for confirmation"
+    )]
+    pub yes: bool,
+
     /// Flag to show the current configuration
     #[arg(long, help = "Display the current configuration")]
     pub show: bool,
 }
 
 pub fn run(args: &ConfigArgs) -> Result<()> {
-    let flag_count = [args.locate, args.reset, args.show]
+    let flag_count = [args.locate, args.init, args.reset, args.show]
         .iter()
         .filter(|&&x| x)
         .count();
 
     log::info!(
-        "Running config command with flags: locate={}, reset={}, show={}",
+        "Running config command with flags: locate={}, init={}, reset={}, hard={}, show={}",
         args.locate,
+        args.init,
         args.reset,
+        args.hard,
         args.show
     );
 
     if flag_count == 0 {
-        cli::warning("No action specified. Use one of: --locate, --reset, --show");
-        log::warn!("No action specified. Use one of: --locate, --reset, --show");
+        cli::warning("No action specified. Use one of: --locate, --init, --reset, --show");
+        log::warn!("No action specified. Use one of: --locate, --init, --reset, --show");
         return Err(anyhow!(
-            "No action specified. Use one of: --locate, --reset, --show"
+            "No action specified. Use one of: --locate, --init, --reset, --show"
         ));
     }
 
@@ -44,7 +75,7 @@ pub fn run(args: &ConfigArgs) -> Result<()> {
         cli::error("Only one flag can be used at a time.");
         log::warn!("Multiple flags used. Only one flag can be used at a time.");
         return Err(anyhow!(
-            "Only one flag can be used at a time. Please choose one of: --locate, --reset, --show"
+            "Only one flag can be used at a time. Please choose one of: --locate, --init, --reset, --show"
         ));
     }
 
@@ -56,12 +87,49 @@ pub fn run(args: &ConfigArgs) -> Result<()> {
         let path = Config::locate_config_file().context("Failed to locate config file")?;
         cli::success(&format!("Config file found at: {}", path.display()));
         log::info!("Config file found at: {}", path.display());
+    } else if args.init {
+        cli::info("🛠️ Setting up Tooka...");
+        log::info!("Initializing config, rules file and data folders...");
+        // The config and rules file are created on startup when missing
+        let path = Config::locate_config_file().context("Failed to locate config file")?;
+        fs::create_dir_all(&conf.logs_folder).with_context(|| {
+            format!(
+                "Failed to create logs folder: {}",
+                conf.logs_folder.display()
+            )
+        })?;
+        cli::success(&format!("Config file: {}", path.display()));
+        cli::success(&format!("Rules file: {}", conf.rules_file.display()));
+        cli::success(&format!("Logs folder: {}", conf.logs_folder.display()));
+        log::info!("Initialization complete.");
     } else if args.reset {
-        cli::warning("🔄 Resetting config to default...");
-        log::info!("Resetting config to default...");
-        conf.reset_config()
+        let question = if args.hard {
+            "🔄 Reset the whole configuration, including the source folder, to default values?"
+        } else {
+            "🔄 Reset the configuration to default values, keeping the source folder?"
+        };
+        if !args.yes {
+            if !io::stdin().is_terminal() {
+                return Err(anyhow!(
+                    "Cannot ask to confirm the reset without a terminal; pass --yes to reset"
+                ));
+            }
+            if !confirm::ask(question, io::stdin().lock(), io::stdout())? {
+                cli::warning("Reset cancelled, the configuration was kept");
+                return Ok(());
+            }
+        }
+
+        log::info!("Resetting config to default (hard: {})...", args.hard);
+        conf.reset_config(args.hard)
             .context("Failed to reset config to default")?;
         cli::success("Config reset to default values.");
+        if !args.hard {
+            cli::info(&format!(
+                "Kept source folder: {}",
+                conf.source_folder.display()
+            ));
+        }
         log::info!("Config reset complete.");
     } else if args.show {
         cli::header("📋 Current Configuration");
@@ -0,0 +1,116 @@
+use std::path::PathBuf;
+
+use crate::cli;
+use crate::common::config::Config;
+use crate::core::{coverage, sorter};
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rules_file::RulesFile;
+use anyhow::Result;
+use clap::Args;
+use colored::Colorize;
+
+/// Number of unhandled file types highlighted in the report
+const UNHANDLED_TYPES_SHOWN: usize = 5;
+
+#[derive(Args)]
+#[command(about = "📊 Report how many files in a folder the enabled rules handle")]
+pub struct CoverageArgs {
+    /// Folder to evaluate the rules against
+    #[arg(long, help = "Folder whose files the rules are evaluated against")]
+    pub dir: String,
+
+    /// Comma-separated rule IDs to evaluate
+    #[arg(
+        long,
+        help = "Comma-separated list of rule IDs to evaluate (defaults to all enabled rules)"
+    )]
+    pub rules: Option<String>,
+}
+
+pub fn run(args: &CoverageArgs) -> Result<()> {
+    cli::info(&format!("📊 Computing rule coverage for: {}", args.dir));
+    log::info!(
+        "Running coverage with dir: {}, rules: {:?}",
+        args.dir,
+        args.rules
+    );
+
+    let rule_filter = args.rules.as_ref().map(|r| {
+        r.split(',')
+            .map(|s| s.trim().to_string())
+            .collect::<Vec<_>>()
+    });
+
+    let config = Config::load()?;
+    let rules_file = RulesFile::load()?.optimized_with_filter(rule_filter.as_deref())?;
+    let source_path = PathBuf::from(&args.dir);
+    let files = sorter::collect_files(&source_path)?;
+
+    let report = coverage::compute_coverage(
+        &files,
+        &source_path,
+        &rules_file,
+        config.tie_break,
+        ExtensionLists::from_config(&config),
+    )?;
+    log::info!(
+        "Coverage finished: {} of {} files handled",
+        report.handled,
+        report.total
+    );
+
+    cli::header("📊 Rule Coverage");
+    println!(
+        "{} {}",
+        "Files scanned:".bright_white(),
+        report.total.to_string().green()
+    );
+    println!(
+        "{} {}",
+        "Files handled:".bright_white(),
+        report.handled.to_string().green()
+    );
+    println!("{} {:.1}%", "Coverage:".bright_white(), report.percentage());
+
+    cli::header("📁 Coverage by Extension");
+    println!(
+        "{} | {} | {} | {}",
+        "Extension".bright_cyan().bold(),
+        "Files".bright_cyan().bold(),
+        "Handled".bright_cyan().bold(),
+        "Coverage".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(80).bright_black());
+
+    for extension in &report.extensions {
+        println!(
+            "{:<20} | {:<10} | {:<10} | {:.1}%",
+            extension.extension.bright_white(),
+            extension.total,
+            extension.handled,
+            extension.percentage()
+        );
+    }
+
+    let unhandled = report.most_unhandled(UNHANDLED_TYPES_SHOWN);
+    println!();
+    if unhandled.is_empty() {
+        cli::success("Every file is handled by at least one rule!");
+    } else {
+        cli::header("⚠️ Most Common Unhandled Types");
+        for extension in unhandled {
+            println!(
+                "{:<20} {} unhandled",
+                extension.extension.yellow(),
+                extension.unhandled()
+            );
+        }
+        println!();
+        cli::warning(&format!(
+            "{} files are not handled by any rule",
+            report.total - report.handled
+        ));
+    }
+
+    Ok(())
+}
@@ -0,0 +1,24 @@
+use super::enable::set_enabled;
+use anyhow::Result;
+use clap::Args;
+
+#[derive(Args)]
+#[command(about = "⏸️ Disable a rule by its ID, or all rules")]
+pub struct DisableArgs {
+    /// ID of the rule to disable
+    #[arg(
+        value_name = "ID",
+        required_unless_present = "all",
+        conflicts_with = "all",
+        help = "The unique identifier of the rule to disable"
+    )]
+    pub rule_id: Option<String>,
+
+    /// Disable every rule
+    #[arg(long, default_value_t = false, help = "Disable every rule at once")]
+    pub all: bool,
+}
+
+pub fn run(args: &DisableArgs) -> Result<()> {
+    set_enabled(args.rule_id.as_deref(), false)
+}
@@ -0,0 +1,126 @@
+use crate::cli;
+use crate::core::context;
+use crate::rules::{
+    rule::Rule,
+    validation::{Severity, validate_content},
+};
+use crate::utils::line_diff::{DiffLine, diff_lines, has_changes};
+use anyhow::{Result, anyhow};
+use clap::Args;
+use colored::Colorize;
+use std::{env, fs, path::Path, process::Command};
+
+/// Editor used when neither `$VISUAL` nor `$EDITOR` is set
+#[cfg(windows)]
+const DEFAULT_EDITOR: &str = "notepad";
+#[cfg(not(windows))]
+const DEFAULT_EDITOR: &str = "vi";
+
+#[derive(Args)]
+#[command(about = "✏️ Edit a rule in your editor")]
+pub struct EditArgs {
+    /// ID of the rule to edit
+    #[arg(value_name = "ID", help = "The unique identifier of the rule to edit")]
+    pub rule_id: String,
+}
+
+pub fn run(args: &EditArgs) -> Result<()> {
+    log::info!("Editing rule with ID: {}", args.rule_id);
+
+    let mut rf = context::get_locked_rules_file()?;
+    let Some(rule) = rf.find_rule(&args.rule_id) else {
+        let error_msg = format!("Rule with ID '{}' not found.", args.rule_id);
+        cli::error(&error_msg);
+        log::warn!("{error_msg}");
+        return Err(anyhow!(error_msg));
+    };
+
+    let original = serde_yaml::to_string(&rule)?;
+    let path = env::temp_dir().join(format!(
+        "tooka-edit-{}-{}.yaml",
+        args.rule_id,
+        std::process::id()
+    ));
+    fs::write(&path, &original)?;
+    open_editor(&path)?;
+    let edited = fs::read_to_string(&path)?;
+
+    if edited == original {
+        fs::remove_file(&path)?;
+        cli::info(&format!("No changes to rule '{}'", args.rule_id));
+        return Ok(());
+    }
+
+    // Edits that don't validate are kept, so they can be fixed up
+    let errors: Vec<_> = validate_content(&edited, true)
+        .into_iter()
+        .filter(|p| p.severity == Severity::Error)
+        .collect();
+    let updated = match serde_yaml::from_str::<Rule>(&edited) {
+        Ok(updated) if errors.is_empty() => updated,
+        parsed => {
+            for problem in &errors {
+                let line = problem
+                    .line
+                    .map_or_else(String::new, |line| format!(" (line {line})"));
+                cli::error(&format!("{}{line}", problem.message));
+            }
+            if let Err(e) = parsed {
+                cli::error(&format!("Not a single rule: {e}"));
+            }
+            cli::warning(&format!(
+                "Kept the original rule; your edits are in {}",
+                path.display()
+            ));
+            return Err(anyhow!("The edited rule '{}' is invalid", args.rule_id));
+        }
+    };
+
+    let updated_yaml = serde_yaml::to_string(&updated)?;
+    rf.replace_rule(&args.rule_id, updated)
+        .map_err(|e| anyhow!("Failed to save rule '{}': {}", args.rule_id, e))?;
+    fs::remove_file(&path)?;
+
+    let diff = diff_lines(&original, &updated_yaml);
+    if has_changes(&diff) {
+        cli::header(&format!("✏️ Changes to rule '{}'", args.rule_id));
+        print_diff(&diff);
+    }
+    cli::success(&format!("Saved rule '{}'", args.rule_id));
+    Ok(())
+}
+
+/// Opens `path` in `$VISUAL` or `$EDITOR` and waits for the editor to exit.
+///
+/// The editor setting may carry arguments, e.g. `code --wait`.
+fn open_editor(path: &Path) -> Result<()> {
+    let editor = env::var("VISUAL")
+        .or_else(|_| env::var("EDITOR"))
+        .ok()
+        .filter(|editor| !editor.trim().is_empty())
+        .unwrap_or_else(|| DEFAULT_EDITOR.to_string());
+    let mut parts = editor.split_whitespace();
+    let program = parts.next().unwrap_or(DEFAULT_EDITOR);
+
+    log::debug!("Opening {} with {editor}", path.display());
+    let status = Command::new(program)
+        .args(parts)
+        .arg(path)
+        .status()
+        .map_err(|e| anyhow!("Failed to start editor '{editor}': {e}"))?;
+    if !status.success() {
+        return Err(anyhow!("Editor '{editor}' exited with {status}"));
+    }
+    Ok(())
+}
+
+/// Prints a diff with removed lines in red and added lines in green
+fn print_diff(diff: &[DiffLine]) {
+    for line in diff {
+        match line {
+            DiffLine::Same(text) => println!("  {}", text.bright_black()),
+            DiffLine::Removed(text) => println!("{}", format!("- {text}").red()),
+            DiffLine::Added(text) => println!("{}", format!("+ {text}").green()),
+        }
+    }
+}
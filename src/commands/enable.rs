@@ -0,0 +1,59 @@
+use crate::cli;
+use crate::core::context;
+use anyhow::{Result, anyhow};
+use clap::Args;
+
+#[derive(Args)]
+#[command(about = "▶️ Enable a rule by its ID, or all rules")]
+pub struct EnableArgs {
+    /// ID of the rule to enable
+    #[arg(
+        value_name = "ID",
+        required_unless_present = "all",
+        conflicts_with = "all",
+        help = "The unique identifier of the rule to enable"
+    )]
+    pub rule_id: Option<String>,
+
+    /// Enable every rule
+    #[arg(long, default_value_t = false, help = "Enable every rule at once")]
+    pub all: bool,
+}
+
+pub fn run(args: &EnableArgs) -> Result<()> {
+    set_enabled(args.rule_id.as_deref(), true)
+}
+
+/// Enables or disables the rule with ID `rule_id`, or every rule without one
+pub(crate) fn set_enabled(rule_id: Option<&str>, enabled: bool) -> Result<()> {
+    let state = if enabled { "enabled" } else { "disabled" };
+    let mut rf = context::get_locked_rules_file()?;
+
+    let Some(rule_id) = rule_id else {
+        log::info!("Setting all rules {state}");
+        let changed = rf
+            .set_all_enabled(enabled)
+            .map_err(|e| anyhow!("Failed to update the rules: {}", e))?;
+        if changed.is_empty() {
+            cli::info(&format!("All rules are already {state}."));
+        } else {
+            cli::success(&format!(
+                "{} rules are now {state}: {}",
+                changed.len(),
+                changed.join(", ")
+            ));
+        }
+        return Ok(());
+    };
+
+    log::info!("Setting rule with ID '{rule_id}' {state}");
+    let changed = rf
+        .set_enabled(rule_id, enabled)
+        .map_err(|e| anyhow!("Failed to update rule with ID '{}': {}", rule_id, e))?;
+    if changed {
+        cli::success(&format!("Rule with ID '{rule_id}' is now {state}."));
+    } else {
+        cli::info(&format!("Rule with ID '{rule_id}' is already {state}."));
+    }
+    Ok(())
+}
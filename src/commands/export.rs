@@ -3,35 +3,66 @@ use anyhow::{Result, anyhow};
 use clap::Args;
 
 #[derive(Args)]
-#[command(about = "📤 Export a rule to a YAML file")]
+#[command(about = "📤 Export a rule or all rules to a YAML or JSON file")]
 pub struct ExportArgs {
     /// ID of the rule to export
     #[arg(
         value_name = "ID",
+        required_unless_present = "all",
+        conflicts_with = "all",
         help = "The unique identifier of the rule to export"
     )]
-    pub id: String,
+    pub id: Option<String>,
+
+    /// Export every rule as a rules file
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Export all rules as a complete rules file"
+    )]
+    pub all: bool,
 
     /// Output file path, optional; defaults to stdout
-    #[arg(long, help = "Output file path (defaults to stdout if not specified)")]
+    #[arg(
+        long,
+        help = "Output file path (defaults to stdout if not specified or `-`)"
+    )]
     pub output: Option<String>,
+
+    /// Format of the export
+    #[arg(
+        long,
+        default_value = "yaml",
+        value_parser = ["yaml", "json"],
+        help = "Format of the export: yaml, or indented json"
+    )]
+    pub format: String,
 }
 
 pub fn run(args: ExportArgs) -> Result<()> {
-    let output_path = args.output;
-
-    log::info!("Exporting rule with ID: {}", args.id);
+    let output_path = args.output.filter(|path| path != "-");
 
     let rf = context::get_locked_rules_file()?;
 
-    rf.export_rule(&args.id, output_path.as_deref())
-        .map_err(|e| anyhow!("Failed to export rule with ID {}: {}", args.id, e))?;
+    match &args.id {
+        Some(id) => {
+            log::info!("Exporting rule with ID: {id}");
+            rf.export_rule(id, output_path.as_deref(), &args.format)
+                .map_err(|e| anyhow!("Failed to export rule with ID {}: {}", id, e))?;
+        }
+        None => {
+            log::info!("Exporting all {} rules", rf.rules.len());
+            rf.export_all(output_path.as_deref(), &args.format)
+                .map_err(|e| anyhow!("Failed to export rules: {}", e))?;
+        }
+    }
 
     if output_path.is_some() {
-        println!("Rule exported successfully!");
-        log::info!("Rule exported successfully to: {output_path:?}");
+        let exported = if args.all { "Rules" } else { "Rule" };
+        println!("{exported} exported successfully!");
+        log::info!("{exported} exported successfully to: {output_path:?}");
     } else {
-        log::info!("Rule exported successfully to stdout");
+        log::info!("Export written to stdout");
     }
 
     Ok(())
@@ -0,0 +1,50 @@
+use crate::cli;
+use crate::core::context;
+use crate::rules::template::starter_rules;
+use anyhow::{Result, anyhow};
+use clap::Args;
+
+#[derive(Args)]
+#[command(about = "🌱 Fill the rules file with starter rules to build on")]
+pub struct InitRulesArgs {
+    /// Replace existing rules
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Replace the rules already in the rules file with the starter rules"
+    )]
+    pub force: bool,
+}
+
+pub fn run(args: &InitRulesArgs) -> Result<()> {
+    let mut rf = context::get_locked_rules_file()?;
+    if !rf.rules.is_empty() && !args.force {
+        return Err(anyhow!(
+            "The rules file already has {} rules; use --force to replace them with the starter rules",
+            rf.rules.len()
+        ));
+    }
+
+    let previous = std::mem::replace(&mut rf.rules, starter_rules());
+    if let Err(e) = rf.save() {
+        rf.rules = previous;
+        return Err(anyhow!("Failed to write the starter rules: {}", e));
+    }
+    log::info!(
+        "Wrote {} starter rules, replacing {} rules",
+        rf.rules.len(),
+        previous.len()
+    );
+
+    cli::header("🌱 Starter rules");
+    for rule in &rf.rules {
+        let status = if rule.enabled { "enabled" } else { "disabled" };
+        cli::info(&format!("{} ({}): {}", rule.id, status, rule.name));
+    }
+    cli::success(&format!(
+        "Wrote {} starter rules. Review them with `tooka list` and tweak them to your folders.",
+        rf.rules.len()
+    ));
+
+    Ok(())
+}
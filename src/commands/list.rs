@@ -1,35 +1,113 @@
 use crate::cli;
 use crate::core::context;
+use crate::core::rule_stats::RuleStatsStore;
+use crate::rules::rules_file::RulesFile;
 use anyhow::Result;
 use clap::Args;
+use colored::Colorize;
 
 #[derive(Args)]
 #[command(about = "📋 List all current rules with their metadata")]
-pub struct ListArgs;
+pub struct ListArgs {
+    /// Show how active each rule has been
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Show how many files each rule has matched and acted on across runs, and when it last fired"
+    )]
+    pub stats: bool,
 
-pub fn run(_args: ListArgs) -> Result<()> {
+    /// Print the rules as JSON
+    #[arg(
+        long,
+        default_value_t = false,
+        conflicts_with = "stats",
+        help = "Print the parsed rules file as JSON for scripting"
+    )]
+    pub json: bool,
+
+    /// Only list enabled rules
+    #[arg(long, default_value_t = false, help = "Leave out disabled rules")]
+    pub enabled_only: bool,
+}
+
+/// Longest condition summary shown in the rules table
+const MAX_SUMMARY_LEN: usize = 60;
+
+pub fn run(args: ListArgs) -> Result<()> {
     log::info!("Listing all rules...");
 
     let rf = context::get_locked_rules_file()?;
-    let rules_list = rf.list_rules();
+    let mut rules_list = rf.list_rules();
+    if args.enabled_only {
+        rules_list.retain(|rule| rule.enabled);
+    }
+
+    if args.json {
+        let rules_file = RulesFile { rules: rules_list };
+        println!("{}", serde_json::to_string_pretty(&rules_file)?);
+        return Ok(());
+    }
 
     if rules_list.is_empty() {
-        cli::warning("No rules found.");
-        cli::info("Use `tooka add` to create your first rule.");
+        if args.enabled_only && !rf.rules.is_empty() {
+            cli::warning("No enabled rules.");
+            cli::info("Use `tooka toggle` to enable a rule.");
+        } else {
+            cli::warning("No rules defined yet.");
+            cli::info("Use `tooka add` to create your first rule.");
+        }
         return Ok(());
     }
 
     cli::header(&format!("📋 Found {} rules", rules_list.len()));
-    cli::rule_table_header();
-
-    for rule in &rules_list {
-        log::debug!(
-            "Rule ID: {}, Name: {}, Enabled: {}",
-            rule.id,
-            rule.name,
-            rule.enabled
+
+    if args.stats {
+        let stats = RuleStatsStore::from_config(&*context::get_locked_config()?).load()?;
+        println!(
+            "{} | {} | {} | {} | {}",
+            "Rule ID".bright_cyan().bold(),
+            "Enabled".bright_cyan().bold(),
+            "Matched".bright_cyan().bold(),
+            "Actions".bright_cyan().bold(),
+            "Last Fired".bright_cyan().bold()
         );
-        cli::rule_table_row(&rule.id, &rule.name, rule.enabled);
+        println!("{}", "─".repeat(100).bright_black());
+
+        for rule in &rules_list {
+            let rule_stats = stats.get(&rule.id).cloned().unwrap_or_default();
+            let status = if rule.enabled {
+                "✓".green()
+            } else {
+                "✗".red()
+            };
+            println!(
+                "{:<30} | {:<7} | {:>9} | {:>9} | {}",
+                rule.id.bright_white(),
+                status,
+                rule_stats.files_matched,
+                rule_stats.actions_applied,
+                rule_stats.last_fired.as_deref().unwrap_or("never").yellow()
+            );
+        }
+    } else {
+        cli::rule_table_header();
+
+        for rule in &rules_list {
+            log::debug!(
+                "Rule ID: {}, Name: {}, Enabled: {}",
+                rule.id,
+                rule.name,
+                rule.enabled
+            );
+            cli::rule_table_row(
+                &rule.id,
+                &rule.name,
+                rule.enabled,
+                rule.then.len(),
+                &truncate(&rule.when.summary(), MAX_SUMMARY_LEN),
+            );
+        }
     }
 
     println!();
@@ -37,3 +115,13 @@ pub fn run(_args: ListArgs) -> Result<()> {
 
     Ok(())
 }
+
+/// Shortens `text` to at most `max` characters, marking cut text with `…`
+fn truncate(text: &str, max: usize) -> String {
+    if text.chars().count() <= max {
+        return text.to_string();
+    }
+    let mut short: String = text.chars().take(max - 1).collect();
+    short.push('…');
+    short
+}
@@ -1,9 +1,21 @@
 pub mod add;
+pub mod bench;
+pub mod categories;
 pub mod config;
+pub mod coverage;
+pub mod disable;
+pub mod edit;
+pub mod enable;
 pub mod export;
+pub mod init_rules;
 pub mod list;
+pub mod quarantine;
 pub mod remove;
+pub mod rules;
+pub mod simulate;
 pub mod sort;
 pub mod template;
 pub mod toggle;
+pub mod trace;
+pub mod undo;
 pub mod validate;
@@ -0,0 +1,96 @@
+use crate::cli;
+use crate::core::context;
+use crate::file::quarantine::Quarantine;
+use anyhow::Result;
+use clap::{Args, Subcommand};
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "🧪 Manage files held in quarantine")]
+pub struct QuarantineArgs {
+    #[command(subcommand)]
+    pub command: QuarantineCommand,
+}
+
+#[derive(Subcommand)]
+pub enum QuarantineCommand {
+    /// List the quarantined files and when they expire
+    List,
+    Purge(PurgeArgs),
+}
+
+#[derive(Args)]
+#[command(about = "🗑️ Delete quarantined files whose expiry has passed")]
+pub struct PurgeArgs {
+    /// Only list the files that would be purged
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Show which files would be purged without deleting them"
+    )]
+    pub dry_run: bool,
+}
+
+pub fn run(args: &QuarantineArgs) -> Result<()> {
+    let quarantine = Quarantine::from_config(&*context::get_locked_config()?);
+    match &args.command {
+        QuarantineCommand::List => list(&quarantine),
+        QuarantineCommand::Purge(purge) => run_purge(&quarantine, purge),
+    }
+}
+
+fn list(quarantine: &Quarantine) -> Result<()> {
+    let entries = quarantine.entries()?;
+    if entries.is_empty() {
+        cli::info("No files in quarantine.");
+        return Ok(());
+    }
+
+    cli::header("🧪 Quarantined Files");
+    println!(
+        "{} | {} | {}",
+        "Expires".bright_cyan().bold(),
+        "Original Path".bright_cyan().bold(),
+        "Quarantined Path".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(120).bright_black());
+    for entry in &entries {
+        println!(
+            "{:<25} | {:<50} | {}",
+            entry.expires_at.yellow(),
+            entry.original_path.display().to_string().bright_white(),
+            entry.quarantined_path.display().to_string().blue()
+        );
+    }
+    Ok(())
+}
+
+fn run_purge(quarantine: &Quarantine, args: &PurgeArgs) -> Result<()> {
+    let purged = quarantine.purge(chrono::Local::now(), args.dry_run)?;
+    log::info!(
+        "Purged {} expired quarantine entries (dry_run: {})",
+        purged.len(),
+        args.dry_run
+    );
+
+    if purged.is_empty() {
+        cli::info("No quarantined files have expired.");
+        return Ok(());
+    }
+    for entry in &purged {
+        println!(
+            "{} {}",
+            "🗑️".red(),
+            entry.original_path.display().to_string().bright_white()
+        );
+    }
+    if args.dry_run {
+        cli::warning(&format!(
+            "{} expired files would be purged (dry run)",
+            purged.len()
+        ));
+    } else {
+        cli::success(&format!("Purged {} expired files", purged.len()));
+    }
+    Ok(())
+}
@@ -1,7 +1,8 @@
 use crate::cli;
-use crate::core::context;
+use crate::core::{confirm, context};
 use anyhow::{Result, anyhow};
 use clap::Args;
+use std::io::{self, IsTerminal};
 
 #[derive(Args)]
 #[command(about = "🗑️  Remove a rule by its ID")]
@@ -12,34 +13,52 @@ pub struct RemoveArgs {
         help = "The unique identifier of the rule to remove"
     )]
     pub rule_id: String,
+
+    /// Remove without asking for confirmation
+    #[arg(
+        long,
+        short = 'y',
+        default_value_t = false,
+        help = "Remove the rule without asking for confirmation"
+    )]
+    pub yes: bool,
 }
 
 pub fn run(args: &RemoveArgs) -> Result<()> {
-    cli::info(&format!("🗑️ Removing rule with ID: {}", args.rule_id));
     log::info!("Removing rule with ID: {}", args.rule_id);
 
     let mut rf = context::get_locked_rules_file()?;
 
-    if let Some(rule) = rf.find_rule(&args.rule_id) {
-        log::debug!(
-            "Found rule: ID={}, Name={}, Enabled={}",
-            rule.id,
-            rule.name,
-            rule.enabled
-        );
-
-        rf.remove_rule(&args.rule_id)
-            .map_err(|e| anyhow!("Failed to remove rule with ID '{}': {}", args.rule_id, e))?;
-
-        cli::success(&format!(
-            "Rule with ID '{}' removed successfully.",
-            args.rule_id
-        ));
-        Ok(())
-    } else {
+    let Some(rule) = rf.find_rule(&args.rule_id) else {
         let error_msg = format!("Rule with ID '{}' not found.", args.rule_id);
         cli::error(&error_msg);
         log::warn!("{error_msg}");
-        Err(anyhow!(error_msg))
+        return Err(anyhow!(error_msg));
+    };
+    log::debug!(
+        "Found rule: ID={}, Name={}, Enabled={}",
+        rule.id,
+        rule.name,
+        rule.enabled
+    );
+
+    if !args.yes {
+        if !io::stdin().is_terminal() {
+            return Err(anyhow!(
+                "Cannot ask to confirm removing rule '{}' without a terminal; pass --yes to remove it",
+                args.rule_id
+            ));
+        }
+        let question = format!("🗑️ Remove rule '{}' ({})?", rule.id, rule.name);
+        if !confirm::ask(&question, io::stdin().lock(), io::stdout())? {
+            cli::warning("Removal cancelled, the rule was kept");
+            return Ok(());
+        }
     }
+
+    rf.remove_rule(&args.rule_id)
+        .map_err(|e| anyhow!("Failed to remove rule with ID '{}': {}", args.rule_id, e))?;
+
+    cli::success(&format!("Removed rule '{}'", args.rule_id));
+    Ok(())
 }
@@ -0,0 +1,110 @@
+use crate::cli;
+use crate::common::config::Config;
+use crate::core::context;
+use crate::rules::remote::RemoteRules;
+use crate::rules::rules_file::RulesFile;
+use anyhow::Result;
+use clap::{Args, Subcommand};
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "📚 Inspect or repair the ruleset in effect")]
+pub struct RulesArgs {
+    #[command(subcommand)]
+    pub command: RulesCommand,
+}
+
+#[derive(Subcommand)]
+pub enum RulesCommand {
+    Dump(DumpArgs),
+    /// Salvage the valid rules of a corrupted rules file, keeping a backup
+    Repair,
+}
+
+impl RulesArgs {
+    /// Returns true if the command must run without loading the rules file,
+    /// because loading is what fails on a corrupted file.
+    pub fn skips_rules_loading(&self) -> bool {
+        matches!(self.command, RulesCommand::Repair)
+    }
+}
+
+#[derive(Args)]
+#[command(about = "📜 Print the ruleset as a single YAML document")]
+pub struct DumpArgs {
+    /// Print the ruleset as sorting applies it
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Print the effective ruleset: validated, enabled rules only, in priority order, with defaults filled in"
+    )]
+    pub resolved: bool,
+}
+
+pub fn run(args: &RulesArgs) -> Result<()> {
+    match &args.command {
+        RulesCommand::Dump(dump) => run_dump(dump),
+        RulesCommand::Repair => run_repair(),
+    }
+}
+
+fn run_dump(args: &DumpArgs) -> Result<()> {
+    let rules_url = context::get_locked_config()?.rules_url.clone();
+    let rules_file = if let Some(url) = rules_url {
+        log::info!("Dumping rules fetched from {url}");
+        RemoteRules::new(&url, Config::config_dir())
+            .fetch()?
+            .rules_file
+    } else {
+        context::get_locked_rules_file()?.clone()
+    };
+
+    let rules_file = if args.resolved {
+        rules_file.resolved()?
+    } else {
+        rules_file
+    };
+    log::info!(
+        "Dumping {} rules (resolved: {})",
+        rules_file.rules.len(),
+        args.resolved
+    );
+
+    print!("{}", serde_yaml::to_string(&rules_file)?);
+    Ok(())
+}
+
+fn run_repair() -> Result<()> {
+    let config = context::get_locked_config()?.clone();
+    RulesFile::ensure_writable(&config)?;
+
+    let report = RulesFile::repair(&config.rules_file)?;
+    let Some(backup) = &report.backup else {
+        cli::success(&format!(
+            "Rules file is intact: all {} rules are valid",
+            report.recovered.len()
+        ));
+        return Ok(());
+    };
+
+    cli::header("🩹 Rules Repair");
+    for id in &report.recovered {
+        println!("{} {}", "✔".green(), id.bright_white());
+    }
+    for (name, reason) in &report.broken {
+        println!("{} {}: {}", "✘".red(), name.bright_white(), reason.dimmed());
+    }
+    if report.discarded_lines > 0 {
+        cli::warning(&format!(
+            "Dropped {} unreadable trailing lines",
+            report.discarded_lines
+        ));
+    }
+    cli::success(&format!(
+        "Kept {} rules, dropped {}. Original saved to {}",
+        report.recovered.len(),
+        report.broken.len(),
+        backup.display()
+    ));
+    Ok(())
+}
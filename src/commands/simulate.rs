@@ -0,0 +1,142 @@
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use crate::cli;
+use crate::common::config::Config;
+use crate::core::simulate;
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rules_file::RulesFile;
+use anyhow::Result;
+use chrono::Local;
+use clap::Args;
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "🎲 Simulate the rules against a synthetic file set without touching disk")]
+pub struct SimulateArgs {
+    /// Number of synthetic files to generate
+    #[arg(
+        long,
+        default_value_t = 10_000,
+        help = "Number of synthetic files to generate"
+    )]
+    pub count: usize,
+
+    /// Seed of the synthetic file set
+    #[arg(
+        long,
+        help = "Seed for generating the files; the same seed gives the same files (defaults to a random seed)"
+    )]
+    pub seed: Option<u64>,
+
+    /// Comma-separated rule IDs to simulate
+    #[arg(
+        long,
+        help = "Comma-separated list of rule IDs to simulate (defaults to all enabled rules)"
+    )]
+    pub rules: Option<String>,
+}
+
+pub fn run(args: &SimulateArgs) -> Result<()> {
+    let seed = args.seed.unwrap_or_else(|| {
+        SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map_or(0, |d| d.as_nanos() as u64)
+    });
+    cli::info(&format!(
+        "🎲 Simulating rules against {} synthetic files (seed {seed})",
+        args.count
+    ));
+    log::info!(
+        "Running simulate with count: {}, seed: {seed}, rules: {:?}",
+        args.count,
+        args.rules
+    );
+
+    let rule_filter = args.rules.as_ref().map(|r| {
+        r.split(',')
+            .map(|s| s.trim().to_string())
+            .collect::<Vec<_>>()
+    });
+
+    let config = Config::load()?;
+    let rules_file = RulesFile::load()?.optimized_with_filter(rule_filter.as_deref())?;
+    let now = Local::now();
+    let files = simulate::generate_files(args.count, seed, now);
+
+    let report = simulate::simulate(
+        &files,
+        &rules_file,
+        now,
+        &ExtensionLists::from_config(&config),
+    );
+    log::info!(
+        "Simulation finished: {} files in {:?}, {} unmatched",
+        report.files,
+        report.elapsed,
+        report.unmatched
+    );
+
+    cli::header("🎲 Rule Simulation");
+    println!(
+        "{} {}",
+        "Files simulated:".bright_white(),
+        report.files.to_string().green()
+    );
+    println!(
+        "{} {}",
+        "Files unmatched:".bright_white(),
+        report.unmatched.to_string().green()
+    );
+    println!("{} {:.2?}", "Total time:".bright_white(), report.elapsed);
+    println!(
+        "{} {:.1}",
+        "Files/second:".bright_white(),
+        report.files_per_second()
+    );
+
+    cli::header("📈 Match Distribution");
+    println!(
+        "{} | {} | {}",
+        "Rule ID".bright_cyan().bold(),
+        "Matches".bright_cyan().bold(),
+        "Share".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(80).bright_black());
+
+    for rule in &report.rules {
+        let share = if report.files > 0 {
+            rule.matches as f64 / report.files as f64 * 100.0
+        } else {
+            0.0
+        };
+        println!(
+            "{:<30} | {:<10} | {:.1}%",
+            rule.rule_id.bright_white(),
+            rule.matches,
+            share
+        );
+    }
+
+    let unsupported: Vec<_> = report
+        .rules
+        .iter()
+        .filter(|rule| !rule.unsupported.is_empty())
+        .collect();
+    println!();
+    if !unsupported.is_empty() {
+        cli::header("⚠️ Conditions That Cannot Be Simulated");
+        for rule in unsupported {
+            println!(
+                "{:<30} {}",
+                rule.rule_id.yellow(),
+                rule.unsupported.join(", ")
+            );
+        }
+        println!();
+        cli::warning("These conditions need real files and never match in a simulation");
+    }
+
+    cli::success("Simulation completed successfully!");
+
+    Ok(())
+}
@@ -1,13 +1,43 @@
-use std::path::PathBuf;
+use std::io::{self, IsTerminal};
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::{Mutex, PoisonError};
+use std::time::{Duration, Instant};
 
 use crate::cli;
-use crate::common::config::Config;
-use crate::core::{report, sorter};
-use crate::rules::rules_file::RulesFile;
-use anyhow::Result;
+use crate::common::{config::Config, environment::expand_path};
+use crate::core::{
+    confirm::{
+        ConfirmPolicy, affects_file, confirm_destructive, confirm_run, destructive_counts,
+        write_destructive_summary,
+    },
+    journal::RunJournal,
+    manifest::Manifest,
+    network, plan,
+    report::{self, RUN_REPORT_FORMATS, RunReport},
+    rule_stats::RuleStatsStore,
+    sorter, tree,
+    undo::UndoJournal,
+};
+use crate::file::{
+    backup::{self, DeleteBackup},
+    file_match::ExtensionLists,
+};
+use crate::rules::{
+    remote::{FetchStatus, RemoteRules},
+    rules_file::RulesFile,
+};
+use crate::utils::date_parser::parse_duration;
+use anyhow::{Result, anyhow};
 use clap::Args;
 use colored::Colorize;
-use indicatif::ProgressBar;
+use indicatif::{HumanBytes, ProgressBar};
+
+/// File name of the plan written by `--plan-format`
+const PLAN_FILE_NAME: &str = "tooka_plan.yaml";
+
+/// Values of `--report` naming a report format rather than a run report file
+const REPORT_TYPES: &[&str] = &["pdf", "csv", "json"];
 
 #[derive(Args)]
 #[command(about = "🚀 Sort files in the source folder using defined rules")]
@@ -21,14 +51,24 @@ pub struct SortArgs {
         help = "Comma-separated list of rule IDs to execute (use '<all>' for all rules)"
     )]
     pub rules: Option<String>,
-    /// Output report format: pdf, csv, json
+    /// Output report format: pdf, csv, json; or the file of a run report
     #[arg(
         long,
-        help = "Generate a report in the specified format (pdf, csv, json)"
+        value_name = "FORMAT|FILE",
+        help = "Generate a report in the specified format (pdf, csv, json) in --output, or write a run report of every processed file to the given file"
     )]
     pub report: Option<String>,
-    /// Output directory for the report
-    #[arg(long, help = "Directory where the report will be saved")]
+    /// Format of the run report written to a file
+    #[arg(
+        long,
+        value_name = "FORMAT",
+        value_parser = ["json", "csv"],
+        requires = "report",
+        help = "Format of the run report written by --report <FILE> (defaults to the file extension, else json)"
+    )]
+    pub report_format: Option<String>,
+    /// Output directory for the report or plan
+    #[arg(long, help = "Directory where the report or plan will be saved")]
     pub output: Option<String>,
     /// Simulate the sorting without making changes
     #[arg(
@@ -37,9 +77,157 @@ pub struct SortArgs {
         help = "Preview what would happen without actually moving files"
     )]
     pub dry_run: bool,
+    /// Show the projected destination folder tree of a dry run
+    #[arg(
+        long,
+        default_value_t = false,
+        requires = "dry_run",
+        help = "With --dry-run, show the destination folders and files as a tree"
+    )]
+    pub tree: bool,
+    /// Only list the files delete and quarantine actions would remove
+    #[arg(
+        long,
+        default_value_t = false,
+        conflicts_with_all = ["tree", "plan_format", "report"],
+        help = "Preview only the files that delete or quarantine actions would remove, with their total size (implies --dry-run)"
+    )]
+    pub list_deletes: bool,
+    /// Write the dry-run plan in a stable format
+    #[arg(
+        long,
+        value_name = "FORMAT",
+        value_parser = ["stable-yaml"],
+        requires = "dry_run",
+        help = "With --dry-run, save the plan as deterministic YAML (stable-yaml) for review in version control"
+    )]
+    pub plan_format: Option<String>,
+    /// URL of a remote rules file to use instead of the local one
+    #[arg(
+        long,
+        value_name = "URL",
+        help = "Fetch the rules from a URL (cached, only re-downloaded when changed)"
+    )]
+    pub rules_from_url: Option<String>,
+    /// Maximum concurrent writes per destination filesystem
+    #[arg(
+        long,
+        value_name = "N",
+        value_parser = clap::builder::RangedU64ValueParser::<usize>::new().range(1..),
+        help = "Limit how many files are written to the same destination disk at once"
+    )]
+    pub concurrency_per_destination: Option<usize>,
+    /// Number of files processed in parallel
+    #[arg(
+        long,
+        value_name = "N",
+        value_parser = clap::builder::RangedU64ValueParser::<usize>::new().range(1..),
+        help = "Number of files to process in parallel (defaults to the number of CPUs)"
+    )]
+    pub workers: Option<usize>,
+    /// Maximum depth of subfolders to sort
+    #[arg(
+        long,
+        value_name = "N",
+        allow_negative_numbers = true,
+        help = "Only sort files up to N levels of subfolders deep (0 = top-level folder only, negative = unlimited)"
+    )]
+    pub max_depth: Option<i64>,
+    /// Create the source folder if it does not exist
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Create the source folder if it is missing instead of failing"
+    )]
+    pub create_source: bool,
+    /// Continue the last interrupted run
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Resume the last interrupted run, skipping files it already processed"
+    )]
+    pub resume: bool,
+    /// Time budget for the run
+    #[arg(
+        long,
+        value_name = "DURATION",
+        value_parser = parse_duration,
+        help = "Stop starting new files after this long, e.g. 30m or 2h (resume later with --resume)"
+    )]
+    pub max_runtime: Option<Duration>,
+    /// Glob patterns narrowing the files the rules are applied to
+    #[arg(
+        long = "filter",
+        value_name = "GLOB",
+        help = "Only apply the rules to files whose name or relative path matches this glob, e.g. '*.pdf' (repeatable)"
+    )]
+    pub filters: Vec<String>,
+    /// Maximum age of the files the rules are applied to
+    #[arg(
+        long,
+        value_name = "DURATION",
+        value_parser = parse_duration,
+        help = "Only apply the rules to files modified within this duration, e.g. 7d or 12h"
+    )]
+    pub filter_newer_than: Option<Duration>,
+    /// Glob patterns of the file names to sort
+    #[arg(
+        long,
+        value_name = "GLOBS",
+        value_delimiter = ',',
+        help = "Only apply the rules to files whose name matches one of these comma-separated globs, e.g. '*.pdf,*.docx'"
+    )]
+    pub include: Vec<String>,
+    /// Glob patterns of the file names to leave alone
+    #[arg(
+        long,
+        value_name = "GLOBS",
+        value_delimiter = ',',
+        help = "Leave out files whose name matches one of these comma-separated globs, even if included"
+    )]
+    pub exclude: Vec<String>,
+    /// Ask before runs that change more files than this
+    #[arg(
+        long,
+        value_name = "N",
+        help = "Ask for confirmation if the run would change more than N files (runs without asking otherwise)"
+    )]
+    pub confirm_threshold: Option<usize>,
+    /// Confirm large runs up front
+    #[arg(
+        long,
+        short = 'y',
+        default_value_t = false,
+        help = "Run without asking, even above --confirm-threshold"
+    )]
+    pub yes: bool,
+    /// Ask before deleting or overwriting files
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Show how many files each delete, trash, quarantine or overwrite would affect and ask for 'yes' first (with --dry-run, only show them)"
+    )]
+    pub interactive: bool,
+    /// Move sidecar files together with the file they belong to
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Move and copy sidecars (e.g. movie.srt, movie.nfo) together with the file of the same base name"
+    )]
+    pub group_sidecars: bool,
+    /// Leave out the per-file output, set by the global `--quiet` flag
+    #[arg(skip)]
+    pub quiet: bool,
 }
 
-pub fn run(args: SortArgs) -> Result<()> {
+pub fn run(mut args: SortArgs) -> Result<()> {
+    let started = Instant::now();
+    args.dry_run |= args.list_deletes;
+    if args.interactive && !args.dry_run && !io::stdin().is_terminal() {
+        return Err(anyhow!(
+            "--interactive needs a terminal to ask for confirmation; review the run with --dry-run instead"
+        ));
+    }
     if args.dry_run {
         cli::warning("🔍 Running in dry-run mode - no files will be moved");
     } else {
@@ -47,25 +235,42 @@ pub fn run(args: SortArgs) -> Result<()> {
     }
 
     log::info!(
-        "Running sort with source: {:?}, rules: {:?}, dry_run: {}",
+        "Running sort with source: {:?}, rules: {:?}, dry_run: {}, workers: {:?}",
         args.source,
         args.rules,
-        args.dry_run
+        args.dry_run,
+        args.workers
     );
 
+    let run_report_target = run_report_target(&args);
     // Load config and rules directly instead of using global context
     let config = Config::load()?;
     let source_path = if let Some(source) = args.source {
         if source == "<default>" {
             config.source_folder.clone()
         } else {
-            PathBuf::from(source)
+            PathBuf::from(expand_path(&source))
         }
     } else {
         config.source_folder.clone()
     };
 
-    let rules_file = RulesFile::load()?;
+    let rules_url = args.rules_from_url.as_ref().or(config.rules_url.as_ref());
+    let rules_file = if let Some(url) = rules_url {
+        cli::info(&format!("🌐 Using rules from: {url}"));
+        let fetched = RemoteRules::new(url, Config::config_dir()).fetch()?;
+        log::debug!(
+            "Remote rules {:?}, cached at {}",
+            fetched.status,
+            fetched.path.display()
+        );
+        if fetched.status == FetchStatus::Cached {
+            cli::warning("Could not reach the rules server, using the cached rules");
+        }
+        fetched.rules_file
+    } else {
+        RulesFile::load()?
+    };
 
     // Parse rule filter
     let rule_filter = args.rules.as_ref().and_then(|r| {
@@ -80,31 +285,263 @@ pub fn run(args: SortArgs) -> Result<()> {
         }
     });
 
-    let optimized_rules = rules_file.optimized_with_filter(rule_filter.as_deref())?;
+    let mut optimized_rules = rules_file.optimized_with_filter(rule_filter.as_deref())?;
+
+    // Dry runs write nothing, so unreachable destinations do not matter yet
+    if !args.dry_run {
+        let (reachable, skipped) =
+            network::rules_with_reachable_destinations(&optimized_rules, &network::MountProbe);
+        for rule in &skipped {
+            cli::warning(&format!(
+                "Skipping rule '{}': network destination '{}' is unreachable ({})",
+                rule.rule_id,
+                rule.destination.display(),
+                rule.reason
+            ));
+        }
+        optimized_rules = reachable;
+    }
+
+    sorter::prepare_source(&source_path, args.create_source)?;
 
     // Collect files first to show progress bar
-    let files = sorter::collect_files(&source_path)?;
+    // A negative depth does not fit a usize and means no limit
+    let max_depth = args.max_depth.and_then(|depth| usize::try_from(depth).ok());
+    let mut files = sorter::collect_files_to_depth(&source_path, max_depth)?;
+    let file_filter = sorter::FileFilter::new(&args.filters, args.filter_newer_than)?
+        .with_names(&args.include, &args.exclude)?;
+    if !file_filter.is_empty() {
+        let total = files.len();
+        file_filter.apply(&mut files, &source_path);
+        cli::info(&format!(
+            "🔎 Filter matched {} of {} files",
+            files.len(),
+            total
+        ));
+    }
+
+    let journal = RunJournal::from_config(&config);
+    let resume_state = if args.resume {
+        journal.resume_state(&source_path)?
+    } else {
+        None
+    };
+    let mut results = Vec::new();
+    let resuming = resume_state.is_some();
+    if let Some(state) = resume_state {
+        let total = files.len();
+        files.retain(|f| !state.is_done(f));
+        cli::info(&format!(
+            "⏩ Resuming interrupted run: {} files already processed, {} skipped now",
+            state.processed_count(),
+            total - files.len()
+        ));
+        results = state.results;
+    } else if args.resume {
+        cli::info("No interrupted run found for this folder, processing all files");
+    }
+
+    let extension_lists = ExtensionLists::from_config(&config);
+    let sidecar_extensions = if args.group_sidecars || config.group_sidecars {
+        config.sidecar_extensions.clone()
+    } else {
+        Vec::new()
+    };
+
+    if !args.dry_run && (args.confirm_threshold.is_some() || args.interactive) {
+        let policy = args.confirm_threshold.map(|threshold| ConfirmPolicy {
+            threshold,
+            assume_yes: args.yes,
+            interactive: io::stdin().is_terminal(),
+        });
+        let options = sorter::SortOptions {
+            dry_run: true,
+            tie_break: config.tie_break,
+            sidecar_extensions: sidecar_extensions.clone(),
+            workers: args.workers,
+            extension_lists: extension_lists.clone(),
+            ..Default::default()
+        };
+        let confirmed = confirm_planned_run(
+            &files,
+            &source_path,
+            &optimized_rules,
+            &options,
+            policy.as_ref(),
+            args.interactive,
+        )?;
+        if !confirmed {
+            cli::warning("Sorting cancelled, no files were changed");
+            return Ok(());
+        }
+    }
+    if !resuming && !args.dry_run {
+        journal.start(&source_path)?;
+    }
+    if !args.dry_run {
+        prune_backups(&config);
+    }
+    let undo_journal = if args.dry_run {
+        None
+    } else {
+        Some(UndoJournal::start(
+            &config.logs_folder,
+            &source_path,
+            chrono::Local::now(),
+        )?)
+    };
+
+    let mut run_report = run_report_target
+        .as_ref()
+        .map(|_| RunReport::new(&source_path, args.dry_run, chrono::Local::now()));
+    if let Some(run_report) = &mut run_report {
+        run_report.record_results(&results);
+    }
+    // Results of the files processed so far, to report on a failing run
+    let reported = Mutex::new(Vec::new());
 
+    let deadline = args.max_runtime.map(|budget| Instant::now() + budget);
+    let processed = AtomicUsize::new(0);
     let pb = ProgressBar::new(files.len() as u64);
     pb.set_style(cli::progress_style());
 
-    // Use the main sort_files function with optimized rules
-    let results = sorter::sort_files(
+    let new_results = sorter::sort_files(
         &files,
         &source_path,
         &optimized_rules,
-        args.dry_run,
-        Some(|| {
+        &sorter::SortOptions {
+            dry_run: args.dry_run,
+            tie_break: config.tie_break,
+            concurrency_per_destination: args.concurrency_per_destination,
+            deadline,
+            sidecar_extensions,
+            workers: args.workers,
+            extension_lists,
+        },
+        |file_path, file_results| {
             pb.inc(1);
-        }),
-    )?;
+            processed.fetch_add(1, Ordering::Relaxed);
+            reported
+                .lock()
+                .unwrap_or_else(PoisonError::into_inner)
+                .extend_from_slice(file_results);
+            // Failed files stay unjournaled, so --resume retries them
+            let failed = file_results
+                .iter()
+                .any(|r| r.action == sorter::FAILED_ACTION);
+            if args.dry_run || failed {
+                return;
+            }
+            if let Err(e) = journal.record_processed(file_path, file_results) {
+                log::warn!("Failed to journal '{}': {}", file_path.display(), e);
+            }
+            let undo_recorded = undo_journal
+                .as_ref()
+                .map_or(Ok(()), |undo_journal| undo_journal.record(file_results));
+            if let Err(e) = undo_recorded {
+                log::warn!("Failed to record '{}' for undo: {}", file_path.display(), e);
+            }
+        },
+    );
+    let new_results = match new_results {
+        Ok(new_results) => new_results,
+        Err(e) => {
+            pb.abandon();
+            let reported = reported
+                .into_inner()
+                .unwrap_or_else(PoisonError::into_inner);
+            if let (Some(run_report), Some(target)) = (&mut run_report, &run_report_target) {
+                run_report.record_results(&reported);
+                run_report.record_error(&e);
+                write_run_report(run_report, target);
+            }
+            print_summary(&sorter::SortSummary {
+                scanned: files.len(),
+                errors: 1,
+                elapsed: started.elapsed(),
+                ..sorter::SortSummary::from_results(&reported)
+            });
+            return Err(e.into());
+        }
+    };
+    // Results restored from an interrupted run were already counted by that run
+    let resumed_count = results.len();
+    let failed = new_results
+        .iter()
+        .filter(|r| r.action == sorter::FAILED_ACTION)
+        .count();
+    results.extend(new_results);
 
-    pb.finish_with_message("✅ Sorting complete");
+    let processed = processed.into_inner();
+    if processed < files.len() {
+        // The journal stays incomplete, so --resume picks up the remaining files
+        pb.abandon_with_message("⏱️ Time budget exhausted");
+        let hint = if args.dry_run {
+            ""
+        } else {
+            ", run again with --resume to continue"
+        };
+        cli::warning(&format!(
+            "⏱️ Stopped after the max runtime: processed {processed} of {} files{hint}",
+            files.len()
+        ));
+    } else {
+        if !args.dry_run {
+            journal.complete()?;
+        }
+        if failed > 0 {
+            pb.finish_with_message("⚠️ Sorting finished with errors");
+            cli::warning(&format!(
+                "⚠️ {failed} files could not be sorted, see the log for details"
+            ));
+        } else {
+            pb.finish_with_message("✅ Sorting complete");
+            cli::success("Sorting completed successfully!");
+        }
+    }
 
-    cli::success("Sorting completed successfully!");
+    let summary = sorter::SortSummary {
+        scanned: files.len(),
+        elapsed: started.elapsed(),
+        ..sorter::SortSummary::from_results(&results[resumed_count..])
+    };
     log::info!("Sorting completed, found {} matches", results.len());
 
-    if args.report.is_none() && !results.is_empty() {
+    if !args.dry_run {
+        let recorded = Manifest::from_config(&config).record(&results)?;
+        log::debug!("Recorded {recorded} actions in the manifest");
+        RuleStatsStore::from_config(&config)
+            .record(&results[resumed_count..], chrono::Local::now())?;
+    }
+    if let Some(undo_journal) = &undo_journal {
+        cli::info(&format!(
+            "↩️ Undo this run with: tooka undo {}",
+            undo_journal.id()
+        ));
+    }
+
+    if args.list_deletes {
+        print_deletions(&results);
+        print_summary(&summary);
+        return run_outcome(&summary);
+    }
+    if args.interactive && args.dry_run {
+        let counts = destructive_counts(&results);
+        if counts.is_empty() {
+            cli::info("The run would not delete or overwrite any files.");
+        } else {
+            cli::warning("The run would delete or overwrite files:");
+            write_destructive_summary(&counts, io::stdout())?;
+        }
+    }
+
+    if args.tree && args.report.is_none() {
+        cli::header("🌳 Destination Tree");
+        match tree::render_destination_tree(&results) {
+            Some(rendered) => print!("{rendered}"),
+            None => cli::info("No files would be moved, copied or renamed."),
+        }
+    } else if args.report.is_none() && !args.quiet && !results.is_empty() {
         cli::header("📁 Sorted Files");
 
         println!(
@@ -117,20 +554,46 @@ pub fn run(args: SortArgs) -> Result<()> {
         println!("{}", "─".repeat(120).bright_black());
 
         for result in &results {
+            let new_path = match (&result.error, result.conflict) {
+                (Some(error), _) => format!("failed: {error}"),
+                (None, Some(strategy)) => format!(
+                    "{} (exists, on_conflict: {strategy})",
+                    result.new_path.display()
+                ),
+                (None, None) => result.new_path.display().to_string(),
+            };
             println!(
                 "{:<40} | {:<30} | {:<40} | {}",
                 result.file_name.bright_white(),
                 result.matched_rule_id.green(),
                 result.current_path.display().to_string().yellow(),
-                result.new_path.display().to_string().blue()
+                new_path.blue()
             );
         }
     } else if results.is_empty() {
         cli::info("No files matched the sorting rules.");
     }
 
+    if args.plan_format.is_some() {
+        let output_dir = args.output.as_ref().map_or_else(
+            || std::env::current_dir().expect("Cannot get current working directory"),
+            PathBuf::from,
+        );
+        let rendered =
+            plan::render_stable_plan(&results, &source_path, std::env::home_dir().as_deref())?;
+        std::fs::create_dir_all(&output_dir)?;
+        let plan_path = output_dir.join(PLAN_FILE_NAME);
+        std::fs::write(&plan_path, rendered)?;
+        cli::success(&format!("Plan written to {}", plan_path.display()));
+    }
+
+    if let (Some(run_report), Some(target)) = (&mut run_report, &run_report_target) {
+        run_report.record_results(&results[resumed_count..]);
+        write_run_report(run_report, target);
+    }
+
     // Handle report generation
-    if let Some(report_type) = &args.report {
+    if let Some(report_type) = args.report.as_ref().filter(|_| run_report_target.is_none()) {
         log::info!("Generating report of type: {report_type}");
         let output_dir = args.output.as_ref().map_or_else(
             || std::env::current_dir().expect("Cannot get current working directory"),
@@ -144,5 +607,153 @@ pub fn run(args: SortArgs) -> Result<()> {
         ));
     }
 
+    print_summary(&summary);
+
+    run_outcome(&summary)
+}
+
+/// Fails a run that finished with files that could not be sorted, so it
+/// exits with a non-zero status.
+fn run_outcome(summary: &sorter::SortSummary) -> Result<()> {
+    if summary.errors > 0 {
+        return Err(anyhow!("{} files could not be sorted", summary.errors));
+    }
     Ok(())
 }
+
+/// Prints the summary of a run, pointing out deferred files
+fn print_summary(summary: &sorter::SortSummary) {
+    log::info!("Run summary: {summary}");
+    cli::info(&format!("📊 {summary}"));
+    if summary.deferred > 0 {
+        cli::info(&format!(
+            "⏸️ {} files were deferred to a later run by rules with max_per_run",
+            summary.deferred
+        ));
+    }
+}
+
+/// Returns the file and format of the run report requested with `--report`,
+/// or `None` if `--report` names a report format, or is not given.
+///
+/// Without `--report-format`, the format is taken from the file extension.
+fn run_report_target(args: &SortArgs) -> Option<(PathBuf, String)> {
+    let report = args.report.as_deref()?;
+    if args.report_format.is_none() && REPORT_TYPES.contains(&report.to_lowercase().as_str()) {
+        return None;
+    }
+    let path = PathBuf::from(expand_path(report));
+    let format = args.report_format.clone().unwrap_or_else(|| {
+        path.extension()
+            .map(|ext| ext.to_string_lossy().to_lowercase())
+            .filter(|ext| RUN_REPORT_FORMATS.contains(&ext.as_str()))
+            .unwrap_or_else(|| "json".to_string())
+    });
+    Some((path, format))
+}
+
+/// Writes the run report to its target, printing an error instead of failing
+/// if it cannot be written, so the outcome of the run is still reported.
+fn write_run_report(run_report: &mut RunReport, (path, format): &(PathBuf, String)) {
+    match run_report.write(path, format, chrono::Local::now()) {
+        Ok(()) => cli::success(&format!(
+            "Run report of {} entries written to {}",
+            run_report.entries.len(),
+            path.display()
+        )),
+        Err(e) => cli::error(&format!(
+            "Failed to write the run report to {}: {e}",
+            path.display()
+        )),
+    }
+}
+
+/// Plans the run as a dry run with `options` and asks for confirmation if it
+/// changes more files than the threshold of `policy`, or, if `interactive`,
+/// if it deletes or overwrites any files.
+fn confirm_planned_run(
+    files: &[PathBuf],
+    source_path: &Path,
+    rules: &RulesFile,
+    options: &sorter::SortOptions,
+    policy: Option<&ConfirmPolicy>,
+    interactive: bool,
+) -> Result<bool> {
+    let affected = AtomicUsize::new(0);
+    let planned = sorter::sort_files(files, source_path, rules, options, |_, file_results| {
+        if affects_file(file_results) {
+            affected.fetch_add(1, Ordering::Relaxed);
+        }
+    })?;
+    let affected = affected.into_inner();
+    log::info!("Planned run changes {affected} files");
+
+    if let Some(policy) = policy {
+        if !confirm_run(affected, policy, io::stdin().lock(), io::stdout())? {
+            return Ok(false);
+        }
+    }
+    if interactive {
+        let counts = destructive_counts(&planned);
+        log::info!("Planned run deletes or overwrites: {counts:?}");
+        return Ok(confirm_destructive(
+            &counts,
+            io::stdin().lock(),
+            io::stdout(),
+        )?);
+    }
+    Ok(true)
+}
+
+/// Removes the delete backups of old runs that exceed the retention policy,
+/// warning instead of failing the run if they cannot be removed.
+fn prune_backups(config: &Config) {
+    let Some(backup) = DeleteBackup::from_config(config) else {
+        return;
+    };
+    match backup.prune(backup::run_started()) {
+        Ok(removed) if !removed.is_empty() => cli::info(&format!(
+            "🧹 Removed the delete backups of {} old run(s)",
+            removed.len()
+        )),
+        Ok(_) => {}
+        Err(e) => cli::warning(&format!("Failed to prune old delete backups: {e}")),
+    }
+}
+
+/// Prints the files delete and quarantine actions would remove, with their total size
+fn print_deletions(results: &[sorter::MatchResult]) {
+    let deletions = sorter::destructive_results(results);
+    if deletions.is_empty() {
+        cli::info("No files would be deleted or quarantined.");
+        return;
+    }
+
+    cli::header("🗑️ Files That Would Be Removed");
+    println!(
+        "{} | {} | {} | {}",
+        "Action".bright_cyan().bold(),
+        "Matched Rule".bright_cyan().bold(),
+        "Size".bright_cyan().bold(),
+        "Path".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(120).bright_black());
+
+    let mut total_size = 0;
+    for result in &deletions {
+        let size = std::fs::metadata(&result.current_path).map_or(0, |m| m.len());
+        total_size += size;
+        println!(
+            "{:<12} | {:<30} | {:>12} | {}",
+            result.action.red(),
+            result.matched_rule_id.green(),
+            HumanBytes(size).to_string(),
+            result.current_path.display().to_string().yellow()
+        );
+    }
+    cli::warning(&format!(
+        "{} files ({}) would be removed",
+        deletions.len(),
+        HumanBytes(total_size)
+    ));
+}
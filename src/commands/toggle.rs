@@ -27,7 +27,7 @@ pub fn run(args: &ToggleArgs) -> Result<()> {
 
     let was_enabled = rule.enabled;
 
-    rf.toggle_rule(&args.rule_id)
+    rf.set_enabled(&args.rule_id, !was_enabled)
         .map_err(|e| anyhow!("Failed to toggle rule with ID '{}': {}", args.rule_id, e))?;
 
     let status = if was_enabled { "disabled" } else { "enabled" };
@@ -0,0 +1,64 @@
+use crate::cli;
+use crate::core::{context, manifest::Manifest};
+use anyhow::Result;
+use clap::Args;
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "🧭 Show the files a rule has acted on and where they are now")]
+pub struct TraceArgs {
+    /// ID of the rule to trace
+    #[arg(long, help = "The unique identifier of the rule to trace")]
+    pub rule: String,
+}
+
+pub fn run(args: &TraceArgs) -> Result<()> {
+    cli::info(&format!("🧭 Tracing rule with ID: {}", args.rule));
+    log::info!("Tracing rule with ID: {}", args.rule);
+
+    let manifest = Manifest::from_config(&*context::get_locked_config()?);
+    log::debug!("Reading manifest from {}", manifest.path().display());
+    let traced = manifest.trace_rule(&args.rule)?;
+
+    if traced.is_empty() {
+        cli::warning(&format!(
+            "No recorded actions found for rule '{}'.",
+            args.rule
+        ));
+        return Ok(());
+    }
+
+    cli::header(&format!(
+        "🧭 Rule '{}' acted on {} files",
+        args.rule,
+        traced.len()
+    ));
+    println!(
+        "{} | {} | {} | {}",
+        "Date".bright_cyan().bold(),
+        "Action".bright_cyan().bold(),
+        "Original Path".bright_cyan().bold(),
+        "Current Location".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(120).bright_black());
+
+    for file in &traced {
+        let location = match &file.current_path {
+            Some(path) if file.exists() => path.display().to_string().blue(),
+            Some(path) => format!("{} (missing)", path.display()).red(),
+            None => "[deleted]".bright_black(),
+        };
+        println!(
+            "{:<25} | {:<8} | {:<40} | {}",
+            file.timestamp.bright_white(),
+            file.action.green(),
+            file.original_path.display().to_string().yellow(),
+            location
+        );
+    }
+
+    println!();
+    cli::success("Trace completed successfully!");
+
+    Ok(())
+}
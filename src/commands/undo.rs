@@ -0,0 +1,114 @@
+use crate::cli;
+use crate::core::{context, undo::UndoJournal};
+use anyhow::Result;
+use clap::Args;
+use colored::Colorize;
+
+#[derive(Args)]
+#[command(about = "↩️ Reverse the actions of a sorting run")]
+pub struct UndoArgs {
+    /// ID of the run to undo
+    #[arg(help = "ID of the run to undo (defaults to the most recent run not yet undone)")]
+    pub run_id: Option<String>,
+
+    /// List the recorded runs instead of undoing one
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "List the runs that can be undone"
+    )]
+    pub list: bool,
+}
+
+pub fn run(args: &UndoArgs) -> Result<()> {
+    let logs_folder = context::get_locked_config()?.logs_folder.clone();
+    if args.list {
+        return list(&logs_folder);
+    }
+
+    let journal = match &args.run_id {
+        Some(id) => UndoJournal::open(&logs_folder, id)?,
+        None => {
+            let Some(journal) = UndoJournal::latest(&logs_folder)? else {
+                cli::info("No runs to undo.");
+                return Ok(());
+            };
+            journal
+        }
+    };
+    cli::info(&format!("↩️ Undoing run: {}", journal.id()));
+    log::info!("Undoing run from journal {}", journal.path().display());
+
+    let report = journal.undo()?;
+    log::info!(
+        "Undo finished: {} reverted, {} non-reversible, {} failed",
+        report.reverted.len(),
+        report.non_reversible.len(),
+        report.failed.len()
+    );
+
+    if !report.non_reversible.is_empty() {
+        cli::header("🗑️ Deleted Without Backup");
+        for entry in &report.non_reversible {
+            println!("{}", entry.source.display().to_string().yellow());
+        }
+        println!();
+        cli::warning(
+            "These files were deleted without a backup and cannot be restored; enable backup_before_delete to make deletes reversible",
+        );
+    }
+    if !report.failed.is_empty() {
+        cli::header("⚠️ Not Reverted");
+        for (entry, reason) in &report.failed {
+            println!(
+                "{:<10} {:<50} {}",
+                entry.action.bright_white(),
+                entry.source.display().to_string().yellow(),
+                reason.red()
+            );
+        }
+        println!();
+    }
+
+    cli::success(&format!(
+        "Reverted {} of {} actions",
+        report.reverted.len(),
+        report.reverted.len() + report.non_reversible.len() + report.failed.len()
+    ));
+    Ok(())
+}
+
+fn list(logs_folder: &std::path::Path) -> Result<()> {
+    let journals = UndoJournal::list(logs_folder)?;
+    if journals.is_empty() {
+        cli::info("No recorded runs.");
+        return Ok(());
+    }
+
+    cli::header("↩️ Recorded Runs");
+    println!(
+        "{} | {} | {} | {}",
+        "Run ID".bright_cyan().bold(),
+        "Actions".bright_cyan().bold(),
+        "Status".bright_cyan().bold(),
+        "Source".bright_cyan().bold()
+    );
+    println!("{}", "─".repeat(100).bright_black());
+    for info in journals.iter().rev() {
+        let status = if info.undone {
+            "undone".bright_black()
+        } else {
+            "active".green()
+        };
+        println!(
+            "{:<24} | {:<8} | {:<8} | {}",
+            info.id.bright_white(),
+            info.actions,
+            status,
+            info.source
+                .as_ref()
+                .map_or_else(String::new, |source| source.display().to_string())
+        );
+    }
+    Ok(())
+}
@@ -1,54 +1,57 @@
-use crate::rules::rule::Rule;
+use crate::cli;
+use crate::core::context;
+use crate::rules::validation::{Severity, ValidationProblem, validate_file};
 use anyhow::Result;
 use clap::Args;
+use std::path::PathBuf;
 
 #[derive(Args)]
 #[command(about = "✅ Validate a rule YAML file against the schema")]
 pub struct ValidateArgs {
-    /// Path to the rule YAML file
-    #[arg(value_name = "FILE", help = "Path to the YAML file to validate")]
-    pub file: String,
+    /// Path to the rule YAML file, the configured rules file if omitted
+    #[arg(
+        value_name = "FILE",
+        help = "Path to the YAML file to validate (defaults to the rules file from the config)"
+    )]
+    pub file: Option<String>,
 
     /// Optional flag to do a full validation, including value limits
     #[arg(
         long,
         default_value_t = false,
-        help = "Perform deep validation including value limits"
+        help = "Perform deep validation including value limits, regexes, date ranges and destinations"
     )]
     pub deep: bool,
+
+    /// Print the problems found as JSON instead of text
+    #[arg(
+        long,
+        default_value_t = false,
+        help = "Print problems as a JSON array (rule_id, field, severity, message, line, column) for editors and CI"
+    )]
+    pub json: bool,
 }
 
 pub fn run(args: &ValidateArgs) -> Result<()> {
-    log::info!("Validating rule from file: {}", args.file);
-
-    // Deserialize the file (already validates structure)
-    let rules = Rule::new_from_file(&args.file)
-        .map_err(|e| anyhow::anyhow!("Failed to load rule from file: {}: {}", args.file, e))?;
-
-    log::info!("Loaded {} rules from file: {}", rules.len(), args.file);
-    println!("Loaded {} rules from file: {}", rules.len(), args.file);
-
-    if !args.deep {
-        println!("✅ File is structurally valid (schema match)");
-        return Ok(());
-    }
+    let path = match &args.file {
+        Some(file) => PathBuf::from(file),
+        None => context::get_locked_config()?.rules_file.clone(),
+    };
+    log::info!("Validating rules from file: {}", path.display());
 
-    // Only validate rule content when deep is true
-    let mut err_count = 0;
-    for rule in rules {
-        if let Err(e) = rule.validate(true) {
-            log::error!("Rule '{}' is invalid: {}", rule.name, e);
-            println!("❌ Rule '{}' is invalid: {}", rule.name, e);
-            err_count += 1;
-        } else {
-            log::info!("Rule '{}' is valid", rule.name);
-            println!("✅ Rule '{}' is valid", rule.name);
-        }
+    let problems = validate_file(&path, args.deep);
+    if args.json {
+        println!("{}", serde_json::to_string_pretty(&problems)?);
+    } else {
+        print_problems(&problems);
     }
 
+    let err_count = problems
+        .iter()
+        .filter(|p| p.severity == Severity::Error)
+        .count();
     if err_count > 0 {
         log::error!("Validation completed with {err_count} errors");
-        println!("Validation completed with {err_count} errors");
         return Err(anyhow::anyhow!(
             "Validation failed with {} errors",
             err_count
@@ -56,7 +59,31 @@ pub fn run(args: &ValidateArgs) -> Result<()> {
     }
 
     log::info!("All rules are valid");
-    println!("✅ All rules are valid");
-
+    if !args.json {
+        let checked = if args.deep {
+            "All rules are valid"
+        } else {
+            "File is structurally valid (schema match); use --deep to check the rule contents"
+        };
+        cli::success(checked);
+    }
     Ok(())
 }
+
+/// Prints every problem with the rule, field and line it was found at
+fn print_problems(problems: &[ValidationProblem]) {
+    for problem in problems {
+        let mut location = problem.rule_id.as_deref().unwrap_or("file").to_string();
+        if let Some(field) = &problem.field {
+            location.push_str(&format!(" {field}"));
+        }
+        if let Some(line) = problem.line {
+            location.push_str(&format!(" (line {line})"));
+        }
+        let message = format!("{location}: {}", problem.message);
+        match problem.severity {
+            Severity::Error => cli::error(&message),
+            Severity::Warning => cli::warning(&message),
+        }
+    }
+}
@@ -0,0 +1,67 @@
+//! Atomic file writes for the configuration and rules files.
+//!
+//! The new content is written to a temporary file next to the target, which
+//! is then renamed over the target. A crash or failed write leaves either the
+//! old or the new file behind, never a truncated one.
+
+use std::{
+    fs::{self, File},
+    io::{self, Write},
+    path::{Path, PathBuf},
+};
+
+/// Replaces the file at `path` with `content` atomically.
+///
+/// # Errors
+/// Returns an error if the temporary file cannot be written or renamed; the
+/// file at `path` is unchanged then.
+pub fn write_atomic(path: &Path, content: impl AsRef<[u8]>) -> io::Result<()> {
+    write_atomic_with(path, |file| file.write_all(content.as_ref()))
+}
+
+/// Replaces the file at `path` with what `write` writes, atomically.
+///
+/// The temporary file gets the permissions of the file it replaces, and is
+/// removed again if anything fails. The rename replaces an existing file on
+/// Windows as well.
+///
+/// # Errors
+/// Returns an error if `write` fails or the temporary file cannot be created,
+/// synced or renamed; the file at `path` is unchanged then.
+pub fn write_atomic_with(
+    path: &Path,
+    write: impl FnOnce(&mut File) -> io::Result<()>,
+) -> io::Result<()> {
+    let temp_path = temp_path(path)?;
+    let result = File::create(&temp_path)
+        .and_then(|mut file| {
+            write(&mut file)?;
+            file.sync_all()
+        })
+        .and_then(|()| match fs::metadata(path) {
+            Ok(existing) => fs::set_permissions(&temp_path, existing.permissions()),
+            Err(_) => Ok(()),
+        })
+        .and_then(|()| fs::rename(&temp_path, path));
+
+    if result.is_err() {
+        let _ = fs::remove_file(&temp_path);
+    }
+    result
+}
+
+/// Returns the path of the temporary file written before replacing `path`
+fn temp_path(path: &Path) -> io::Result<PathBuf> {
+    let name = path.file_name().ok_or_else(|| {
+        io::Error::new(
+            io::ErrorKind::InvalidInput,
+            format!("Not a file path: {}", path.display()),
+        )
+    })?;
+    // Same folder, so the rename never crosses filesystems
+    Ok(path.with_file_name(format!(
+        ".{}.{}.tmp",
+        name.to_string_lossy(),
+        std::process::id()
+    )))
+}
@@ -0,0 +1,49 @@
+use super::atomic_write::{write_atomic, write_atomic_with};
+use std::{fs, io, io::Write};
+use tempfile::tempdir;
+
+#[test]
+fn test_write_atomic_replaces_file() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("tooka.yaml");
+
+    write_atomic(&path, "version: 1\n").unwrap();
+    assert_eq!(fs::read_to_string(&path).unwrap(), "version: 1\n");
+    write_atomic(&path, "version: 2\n").unwrap();
+    assert_eq!(fs::read_to_string(&path).unwrap(), "version: 2\n");
+    assert_eq!(fs::read_dir(dir.path()).unwrap().count(), 1);
+}
+
+#[test]
+fn test_failed_write_leaves_original_intact() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    fs::write(&path, "rules: []\n").unwrap();
+
+    // Fails halfway, like a full disk
+    let err = write_atomic_with(&path, |file| {
+        file.write_all(b"rules:\n  - id: ha")?;
+        Err(io::Error::other("disk full"))
+    })
+    .unwrap_err();
+
+    assert_eq!(err.to_string(), "disk full");
+    assert_eq!(fs::read_to_string(&path).unwrap(), "rules: []\n");
+    // The temporary file is cleaned up
+    assert_eq!(fs::read_dir(dir.path()).unwrap().count(), 1);
+}
+
+#[cfg(unix)]
+#[test]
+fn test_write_atomic_keeps_permissions() {
+    use std::os::unix::fs::PermissionsExt;
+
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("tooka.yaml");
+    fs::write(&path, "version: 1\n").unwrap();
+    fs::set_permissions(&path, fs::Permissions::from_mode(0o600)).unwrap();
+
+    write_atomic(&path, "version: 2\n").unwrap();
+    let mode = fs::metadata(&path).unwrap().permissions().mode();
+    assert_eq!(mode & 0o777, 0o600);
+}
@@ -5,15 +5,109 @@
 //!
 //! It provides functionality to load, save, reset, and display configuration
 //! settings from a user-specific file (typically stored in `$HOME/.config/tooka/config.yml`).
+//! The file may be written in TOML instead, with a `.toml` extension.
 
-use super::environment::{get_dir_with_env, get_source_folder};
+use super::atomic_write::write_atomic;
+use super::environment::{expand_path, get_dir_with_env, get_source_folder};
+use super::file_format::FileFormat;
 use crate::{
-    core::context::{CONFIG_FILE_NAME, CONFIG_VERSION, DEFAULT_LOGS_FOLDER, RULES_FILE_NAME},
+    core::context::{
+        self, CONFIG_FILE_NAME, CONFIG_VERSION, DEFAULT_BACKUP_FOLDER, DEFAULT_LOGS_FOLDER,
+        DEFAULT_QUARANTINE_FOLDER, RULES_FILE_NAME,
+    },
     core::error::TookaError,
+    core::migrate::migrate_config,
+    core::sidecar::DEFAULT_SIDECAR_EXTENSIONS,
 };
 use anyhow::Result;
 use serde::{Deserialize, Serialize};
-use std::{env, fs, path::PathBuf};
+use std::{
+    env, fs,
+    path::{Path, PathBuf},
+};
+
+/// Extensions considered safe by default, used by the `in_allowlist` condition
+const DEFAULT_EXTENSION_ALLOWLIST: &[&str] = &[
+    "txt", "md", "pdf", "csv", "json", "xml", "doc", "docx", "odt", "xls", "xlsx", "ods", "ppt",
+    "pptx", "odp", "jpg", "jpeg", "png", "gif", "webp", "heic", "svg", "mp3", "flac", "wav", "ogg",
+    "mp4", "mkv", "mov", "webm", "zip", "tar", "gz", "7z",
+];
+
+/// Extensions of executables and scripts considered dangerous by default,
+/// used by the `in_denylist` condition
+const DEFAULT_EXTENSION_DENYLIST: &[&str] = &[
+    "exe", "msi", "bat", "cmd", "com", "scr", "pif", "cpl", "ps1", "psm1", "vbs", "vbe", "js",
+    "jse", "wsf", "wsh", "hta", "jar", "lnk", "reg", "sh", "bash", "zsh", "run", "bin", "app",
+    "dmg", "pkg", "deb", "rpm", "appimage", "apk", "docm", "xlsm", "pptm",
+];
+
+/// Size in KB up to which `content_regex` conditions search a file's content
+const DEFAULT_CONTENT_MAX_SIZE_KB: u64 = 1024;
+
+/// How ties between matching rules of equal priority are resolved.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum TieBreak {
+    /// Apply the rule that comes first in the rules file.
+    #[default]
+    First,
+    /// Apply the rule that comes last in the rules file.
+    Last,
+    /// Abort the run, so that the rules can be disambiguated.
+    Error,
+}
+
+/// How records are written to the log files.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LogFormat {
+    /// One human-readable line per record.
+    #[default]
+    Text,
+    /// One JSON object per line, for log shippers.
+    Json,
+}
+
+/// Where log records are written.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LogSink {
+    /// Rotated files in the logs folder.
+    #[default]
+    File,
+    /// The local syslog daemon; falls back to files where syslog is unavailable.
+    Syslog,
+    /// Standard error, with the full detail of the log files.
+    Stderr,
+}
+
+/// When log files are rotated and how many rotated files are kept.
+///
+/// The fields are unsigned, so a negative value fails to load.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct LoggingConfig {
+    /// A log file is rotated once it reaches this many MB (0 for no size limit)
+    pub max_size_mb: u64,
+    /// Number of rotated log files kept per log
+    pub max_backups: usize,
+    /// Rotated log files older than this many days are removed (0 to keep them)
+    pub max_age_days: u64,
+    /// Whether rotated log files are gzipped
+    pub compress: bool,
+}
+
+/// Default values for the logging configuration
+impl Default for LoggingConfig {
+    fn default() -> Self {
+        Self {
+            max_size_mb: 10,
+            max_backups: 10,
+            max_age_days: 0,
+            compress: false,
+        }
+    }
+}
 
 /// Represents the user configuration for Tooka.
 ///
@@ -31,6 +125,41 @@ pub struct Config {
     pub rules_file: PathBuf,
     /// Folder where Tooka will store logs
     pub logs_folder: PathBuf,
+    /// Folder where the `quarantine` action keeps files until they expire
+    pub quarantine_folder: PathBuf,
+    /// Whether the `delete` action moves files to the backup folder, so runs can be undone
+    pub backup_before_delete: bool,
+    /// Folder where files are kept when `backup_before_delete` is enabled
+    pub backup_folder: PathBuf,
+    /// Backups of runs older than this many days are removed at the start of each run
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub backup_max_age_days: Option<u64>,
+    /// The oldest backups are removed at the start of each run until they fit in this many MB
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub backup_max_size_mb: Option<u64>,
+    /// Optional URL of a centrally managed rules file used instead of the local one
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub rules_url: Option<String>,
+    /// Whether the rules file is provisioned centrally and must not be changed by Tooka
+    pub rules_read_only: bool,
+    /// Extensions matched by the `in_allowlist` condition
+    pub extension_allowlist: Vec<String>,
+    /// Extensions matched by the `in_denylist` condition
+    pub extension_denylist: Vec<String>,
+    /// Files larger than this many KB are not searched by `content_regex` conditions
+    pub content_max_size_kb: u64,
+    /// How ties between matching rules of equal priority are resolved
+    pub tie_break: TieBreak,
+    /// Whether sidecar files follow the file they belong to in every run
+    pub group_sidecars: bool,
+    /// Extensions of the sidecar files grouped with the file of the same base name
+    pub sidecar_extensions: Vec<String>,
+    /// Rotation and retention of the log files
+    pub logging: LoggingConfig,
+    /// Format of the records in the log files
+    pub log_format: LogFormat,
+    /// Where log records are written
+    pub log_sink: LogSink,
 }
 
 /// Default values for the configuration
@@ -68,6 +197,22 @@ impl Config {
             source_folder,
             rules_file: data_dir.join(RULES_FILE_NAME),
             logs_folder: data_dir.join(DEFAULT_LOGS_FOLDER),
+            quarantine_folder: data_dir.join(DEFAULT_QUARANTINE_FOLDER),
+            backup_before_delete: false,
+            backup_folder: data_dir.join(DEFAULT_BACKUP_FOLDER),
+            backup_max_age_days: None,
+            backup_max_size_mb: None,
+            rules_url: None,
+            rules_read_only: false,
+            extension_allowlist: to_strings(DEFAULT_EXTENSION_ALLOWLIST),
+            extension_denylist: to_strings(DEFAULT_EXTENSION_DENYLIST),
+            content_max_size_kb: DEFAULT_CONTENT_MAX_SIZE_KB,
+            tie_break: TieBreak::default(),
+            group_sidecars: false,
+            sidecar_extensions: to_strings(DEFAULT_SIDECAR_EXTENSIONS),
+            logging: LoggingConfig::default(),
+            log_format: LogFormat::default(),
+            log_sink: LogSink::default(),
         }
     }
 
@@ -83,10 +228,27 @@ impl Config {
         log::debug!("Loading configuration for Tooka");
         let config_path = Self::config_path();
 
+        if !config_path.exists() && context::config_path_override().is_some() {
+            // Only the default location is set up on first run
+            return Err(TookaError::ConfigError(format!(
+                "Config file not found: {}",
+                config_path.display()
+            )));
+        }
+
         if config_path.exists() {
-            let file = fs::File::open(&config_path)?;
-            let reader = std::io::BufReader::new(file);
-            let config: Config = serde_yaml::from_reader(reader)?;
+            let content = fs::read_to_string(&config_path)?;
+            let mut config: Config = FileFormat::from_path(&config_path).parse(&content)?;
+            // Saved before the paths are expanded, so `~` and variables stay in the file
+            if migrate_config(&mut config)? {
+                config.save()?;
+                log::info!("Migrated config file {}", config_path.display());
+            }
+            config.expand_paths();
+            // A config that has drifted still loads; commands report what they can't reach
+            for problem in config.validate() {
+                log::warn!("{problem}");
+            }
             Ok(config)
         } else {
             let config = Config::new_with_fallbacks();
@@ -95,7 +257,8 @@ impl Config {
         }
     }
 
-    /// Saves the current configuration to the default path on disk.
+    /// Saves the current configuration to the default path on disk, in YAML
+    /// or TOML by the file extension.
     ///
     /// # Errors
     /// Returns a [`TookaError`] if the configuration could not be written to disk.
@@ -104,8 +267,8 @@ impl Config {
         if let Some(parent) = config_path.parent() {
             fs::create_dir_all(parent)?;
         }
-        let file = fs::File::create(&config_path)?;
-        serde_yaml::to_writer(file, self)?;
+        let content = FileFormat::from_path(&config_path).to_string(self)?;
+        write_atomic(&config_path, content)?;
         Ok(())
     }
 
@@ -122,26 +285,87 @@ impl Config {
         }
     }
 
+    /// Returns the directory containing the configuration file.
+    pub fn config_dir() -> PathBuf {
+        let config_path = Self::config_path();
+        config_path
+            .parent()
+            .map_or_else(|| PathBuf::from("."), Path::to_path_buf)
+    }
+
+    /// Checks that the folders and files the configuration points at exist.
+    ///
+    /// The source folder must be an existing directory and the rules file must
+    /// exist, unless the rules are fetched from `rules_url`.
+    ///
+    /// # Returns
+    /// All problems found, empty if there are none.
+    pub fn validate(&self) -> Vec<TookaError> {
+        let mut problems = Vec::new();
+        if !self.source_folder.is_dir() {
+            let reason = if self.source_folder.exists() {
+                "is not a directory"
+            } else {
+                "does not exist"
+            };
+            problems.push(TookaError::ConfigError(format!(
+                "Source folder {} {reason}; update `source_folder` in the config file (see `tooka config --locate`)",
+                self.source_folder.display()
+            )));
+        }
+        if self.rules_url.is_none() && !self.rules_file.is_file() {
+            problems.push(TookaError::ConfigError(format!(
+                "Rules file {} does not exist; update `rules_file` in the config file (see `tooka config --locate`)",
+                self.rules_file.display()
+            )));
+        }
+        problems
+    }
+
     /// Resets the configuration to default values and writes it to disk.
     ///
     /// This can be used to discard manual changes or recover from a corrupted config file.
+    /// The source folder is kept unless `hard` is true.
     ///
     /// # Errors
     /// Returns a [`TookaError`] if the default configuration cannot be created or saved.
-    pub fn reset_config(&mut self) -> Result<(), TookaError> {
+    pub fn reset_config(&mut self, hard: bool) -> Result<(), TookaError> {
+        let source_folder = std::mem::take(&mut self.source_folder);
         *self = Config::new_with_fallbacks();
+        if !hard {
+            self.source_folder = source_folder;
+        }
         self.save()
     }
 
-    /// Returns the current configuration as a YAML-formatted string.
+    /// Returns the current configuration as a string, in the format of the config file.
     ///
     /// If serialization fails, a fallback error message is returned.
     pub fn show_config(&self) -> String {
-        serde_yaml::to_string(self).unwrap_or_else(|_| "Failed to serialize config".into())
+        FileFormat::from_path(&Self::config_path())
+            .to_string(self)
+            .unwrap_or_else(|_| "Failed to serialize config".into())
+    }
+
+    /// Expands `~` and environment variables in the configured paths
+    fn expand_paths(&mut self) {
+        for path in [
+            &mut self.source_folder,
+            &mut self.rules_file,
+            &mut self.logs_folder,
+            &mut self.quarantine_folder,
+            &mut self.backup_folder,
+        ] {
+            *path = PathBuf::from(expand_path(&path.to_string_lossy()));
+        }
     }
 
     /// Returns the path to the configuration file, creating it if necessary
     fn config_path() -> std::path::PathBuf {
+        if let Some(path) = context::config_path_override() {
+            return path.to_path_buf();
+        }
+
         let home_dir = env::var("HOME").map_or_else(
             |_| {
                 log::warn!("$HOME not set; using current directory as fallback.");
@@ -153,6 +377,17 @@ impl Config {
         let config_dir =
             get_dir_with_env("TOOKA_CONFIG_DIR", |d| d.config_dir(), &home_dir, ".config");
 
-        config_dir.join(CONFIG_FILE_NAME)
+        // A TOML config is used in the default location if there is no YAML one
+        let config_path = config_dir.join(CONFIG_FILE_NAME);
+        let toml_path = config_path.with_extension("toml");
+        if !config_path.exists() && toml_path.exists() {
+            return toml_path;
+        }
+        config_path
     }
 }
+
+/// Converts a list of default extensions into owned strings
+fn to_strings(list: &[&str]) -> Vec<String> {
+    list.iter().map(|s| (*s).to_string()).collect()
+}
@@ -0,0 +1,41 @@
+use super::config::Config;
+use tempfile::tempdir;
+
+#[test]
+fn test_validate_accepts_existing_paths() {
+    let dir = tempdir().unwrap();
+    let rules_file = dir.path().join("rules.yaml");
+    std::fs::write(&rules_file, "rules: []\n").unwrap();
+
+    let config = Config {
+        source_folder: dir.path().to_path_buf(),
+        rules_file,
+        ..Config::default()
+    };
+    assert!(config.validate().is_empty());
+}
+
+#[test]
+fn test_validate_reports_every_missing_path() {
+    let dir = tempdir().unwrap();
+    let not_a_folder = dir.path().join("file.txt");
+    std::fs::write(&not_a_folder, "").unwrap();
+
+    let config = Config {
+        source_folder: not_a_folder,
+        rules_file: dir.path().join("missing.yaml"),
+        rules_url: None,
+        ..Config::default()
+    };
+    let problems: Vec<String> = config.validate().iter().map(ToString::to_string).collect();
+    assert_eq!(problems.len(), 2);
+    assert!(problems[0].contains("is not a directory"));
+    assert!(problems[1].contains("missing.yaml does not exist"));
+
+    // Fetched rules don't need the rules file
+    let config = Config {
+        rules_url: Some("https://example.com/rules.yaml".into()),
+        ..config
+    };
+    assert_eq!(config.validate().len(), 1);
+}
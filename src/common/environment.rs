@@ -4,7 +4,8 @@
 //! such as config and data paths, using environment variables and system conventions.
 //!
 //! It includes logic to fall back to default locations if environment variables
-//! or system directories are unavailable.
+//! or system directories are unavailable, and to expand environment variables
+//! in configured paths.
 
 use crate::core::context::{APP_NAME, APP_ORG, APP_QUALIFIER};
 use directories_next::{ProjectDirs, UserDirs};
@@ -70,3 +71,60 @@ pub fn get_source_folder(home: &Path) -> std::path::PathBuf {
     );
     fallback
 }
+
+/// Expands a leading `~` to the home directory and `$VAR` and `${VAR}` to the
+/// values of environment variables.
+///
+/// Unset variables expand to an empty string with a warning, so typos show up
+/// in the log. A `$` not followed by a variable name is kept as is.
+pub fn expand_path(path: &str) -> String {
+    let mut expanded = String::with_capacity(path.len());
+    let mut rest = path;
+
+    if let Some(after) = rest.strip_prefix('~') {
+        if after.is_empty() || after.starts_with(['/', '\\']) {
+            match env::home_dir() {
+                Some(home) => expanded.push_str(&home.to_string_lossy()),
+                None => {
+                    log::warn!("Cannot expand '~' in '{path}': home directory unknown");
+                    expanded.push('~');
+                }
+            }
+            rest = after;
+        }
+    }
+
+    while let Some(dollar) = rest.find('$') {
+        expanded.push_str(&rest[..dollar]);
+        let after = &rest[dollar + 1..];
+        let (name, remainder) = match after.strip_prefix('{') {
+            Some(braced) => match braced.find('}') {
+                Some(end) => (&braced[..end], &braced[end + 1..]),
+                None => ("", after),
+            },
+            None => {
+                let end = after
+                    .find(|c: char| !(c.is_ascii_alphanumeric() || c == '_'))
+                    .unwrap_or(after.len());
+                (&after[..end], &after[end..])
+            }
+        };
+
+        if name.is_empty() || name.starts_with(|c: char| c.is_ascii_digit()) {
+            expanded.push('$');
+            rest = after;
+            continue;
+        }
+        match env::var(name) {
+            Ok(value) => expanded.push_str(&value),
+            Err(_) => log::warn!("Environment variable '{name}' in '{path}' is not set"),
+        }
+        rest = remainder;
+    }
+    expanded.push_str(rest);
+
+    if expanded != path {
+        log::debug!("Expanded path '{path}' to '{expanded}'");
+    }
+    expanded
+}
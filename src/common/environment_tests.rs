@@ -0,0 +1,32 @@
+use super::environment::expand_path;
+use std::env;
+
+/// Name of a variable no test environment sets
+const UNSET: &str = "TOOKA_TEST_SURELY_UNSET_VARIABLE";
+
+#[test]
+fn test_expand_path_expands_home_and_variables() {
+    let home = env::home_dir().unwrap().to_string_lossy().to_string();
+    let path = env::var("PATH").unwrap();
+
+    assert_eq!(expand_path("~"), home);
+    assert_eq!(expand_path("~/Sorted"), format!("{home}/Sorted"));
+    assert_eq!(expand_path("$PATH/bin"), format!("{path}/bin"));
+    assert_eq!(expand_path("/x/${PATH}y"), format!("/x/{path}y"));
+}
+
+#[test]
+fn test_expand_path_leaves_other_text_alone() {
+    assert_eq!(expand_path("/plain/path"), "/plain/path");
+    assert_eq!(expand_path("~user/docs"), "~user/docs");
+    assert_eq!(expand_path("/a/~/b"), "/a/~/b");
+    assert_eq!(expand_path("cost$/$5/${}"), "cost$/$5/${}");
+    assert_eq!(expand_path("/a/${unclosed"), "/a/${unclosed");
+    assert_eq!(expand_path("/a/{parent}"), "/a/{parent}");
+}
+
+#[test]
+fn test_expand_path_unset_variables_are_empty() {
+    assert_eq!(expand_path(&format!("/a/${UNSET}/b")), "/a//b");
+    assert_eq!(expand_path(&format!("/a/${{{UNSET}}}b")), "/a/b");
+}
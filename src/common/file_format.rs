@@ -0,0 +1,51 @@
+//! File formats of the configuration and rules files.
+//!
+//! Both files are YAML by default, but may be written in TOML instead; the
+//! format is chosen by the file extension, so each file keeps the format it
+//! was written in.
+
+use crate::core::error::TookaError;
+use serde::{Serialize, de::DeserializeOwned};
+use std::path::Path;
+
+/// Format of a configuration or rules file.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum FileFormat {
+    /// YAML, for `.yaml`, `.yml` and any other extension.
+    #[default]
+    Yaml,
+    /// TOML, for `.toml`.
+    Toml,
+}
+
+impl FileFormat {
+    /// Returns the format of the file at `path` by its extension.
+    pub fn from_path(path: &Path) -> Self {
+        match path.extension().and_then(|e| e.to_str()) {
+            Some(ext) if ext.eq_ignore_ascii_case("toml") => Self::Toml,
+            _ => Self::Yaml,
+        }
+    }
+
+    /// Parses `content` in this format.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the content is not valid in this format.
+    pub fn parse<T: DeserializeOwned>(self, content: &str) -> Result<T, TookaError> {
+        Ok(match self {
+            Self::Yaml => serde_yaml::from_str(content)?,
+            Self::Toml => toml::from_str(content)?,
+        })
+    }
+
+    /// Serializes `value` in this format.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the value cannot be represented in this format.
+    pub fn to_string<T: Serialize>(self, value: &T) -> Result<String, TookaError> {
+        Ok(match self {
+            Self::Yaml => serde_yaml::to_string(value)?,
+            Self::Toml => toml::to_string_pretty(value)?,
+        })
+    }
+}
@@ -0,0 +1,38 @@
+use super::config::{Config, LogSink};
+use super::file_format::FileFormat;
+use std::path::Path;
+
+#[test]
+fn test_format_follows_extension() {
+    assert_eq!(
+        FileFormat::from_path(Path::new("tooka.toml")),
+        FileFormat::Toml
+    );
+    assert_eq!(
+        FileFormat::from_path(Path::new("rules.TOML")),
+        FileFormat::Toml
+    );
+    assert_eq!(
+        FileFormat::from_path(Path::new("tooka.yml")),
+        FileFormat::Yaml
+    );
+    assert_eq!(FileFormat::from_path(Path::new("rules")), FileFormat::Yaml);
+}
+
+#[test]
+fn test_config_in_toml_round_trips() {
+    let mut config = Config::default();
+    config.log_sink = LogSink::Syslog;
+    config.backup_max_age_days = Some(30);
+
+    let toml = FileFormat::Toml.to_string(&config).unwrap();
+    assert!(toml.contains("log_sink = \"syslog\""), "{toml}");
+    assert!(toml.contains("[logging]"), "{toml}");
+
+    let parsed: Config = FileFormat::Toml.parse(&toml).unwrap();
+    assert_eq!(
+        FileFormat::Yaml.to_string(&parsed).unwrap(),
+        FileFormat::Yaml.to_string(&config).unwrap()
+    );
+    assert!(FileFormat::Toml.parse::<Config>("log_sink = 3").is_err());
+}
@@ -1,28 +1,77 @@
 //! Logging utilities for the Tooka application.
 //!
 //! This module provides a custom logger setup using `flexi_logger`.
-//! It supports separate log files for general logs and file operation logs,
-//! with daily log rotation and a maximum number of retained log files.
+//! It supports separate log files for general logs and file operation logs.
+//! Log files are rotated daily (file operations), per session (general logs)
+//! and when they reach a maximum size, and old ones are removed, as set in the
+//! `logging` section of the configuration.
+//! The log files always get full detail; how much is also shown on the
+//! console is chosen with [`ConsoleLevel`].
 
-use crate::{core::context, core::error::TookaError};
+#[cfg(unix)]
+use crate::common::syslog::SyslogWriter;
+use crate::{
+    common::config::{Config, LogFormat, LogSink, LoggingConfig},
+    core::context,
+    core::error::TookaError,
+};
 use chrono::Local;
+use flate2::{Compression, write::GzEncoder};
 use flexi_logger::writers::LogWriter;
-use flexi_logger::{LogSpecification, Logger, Record, WriteMode};
+use flexi_logger::{Duplicate, FormatFunction, LogSpecification, Logger, Record, WriteMode};
 use log::Record as LogRecord;
 use std::path::Path;
 use std::{
-    fs::{OpenOptions, create_dir_all},
+    fs::{File, OpenOptions, create_dir_all},
     io::{self, Write},
     path::PathBuf,
     sync::{Mutex, OnceLock},
+    time::{Duration, SystemTime},
 };
 
 /// Mutex to ensure thread-safe logging
 static LOG_MUTEX: Mutex<()> = Mutex::new(());
 /// Static logger handle to ensure logger is initialized only once
 static LOGGER_HANDLE: OnceLock<flexi_logger::LoggerHandle> = OnceLock::new();
-/// Maximum number of log files to keep
-const MAX_LOG_FILES: usize = 10;
+/// Timestamp in the names of rotated log files
+const ROTATED_FORMAT: &str = "%Y%m%dT%H%M%S";
+/// Bytes in a MB of `max_size_mb`
+const BYTES_PER_MB: u64 = 1024 * 1024;
+/// Seconds in a day of `max_age_days`
+const SECONDS_PER_DAY: u64 = 24 * 60 * 60;
+
+/// How much of the log is shown on the console
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum ConsoleLevel {
+    /// Errors only (`--quiet`)
+    Quiet,
+    /// Warnings and errors
+    #[default]
+    Normal,
+    /// Everything down to debug messages (`--verbose`)
+    Verbose,
+}
+
+impl ConsoleLevel {
+    /// Returns the console level chosen by the `--quiet` and `--verbose` flags
+    pub fn from_flags(quiet: bool, verbose: bool) -> Self {
+        if quiet {
+            Self::Quiet
+        } else if verbose {
+            Self::Verbose
+        } else {
+            Self::Normal
+        }
+    }
+
+    fn duplicate(self) -> Duplicate {
+        match self {
+            Self::Quiet => Duplicate::Error,
+            Self::Normal => Duplicate::Warn,
+            Self::Verbose => Duplicate::Debug,
+        }
+    }
+}
 
 /// Writer that routes logs based on target
 struct DualWriter {
@@ -30,38 +79,95 @@ struct DualWriter {
     main_dir: PathBuf,
     /// Directory for file operation logs
     ops_dir: PathBuf,
+    /// When log files are rotated and how many are kept
+    rotation: LoggingConfig,
+    /// Format of the records in the log files
+    format: LogFormat,
 }
 
 /// Initializes the Tooka logger.
 ///
 /// Sets up logging directories, configures log levels and targets,
-/// and ensures that the logger is only initialized once.
+/// and ensures that the logger is only initialized once. Records go to the
+/// configured `log_sink`; unless that is stderr, messages at `console` level
+/// or above are also printed to stderr.
 ///
 /// # Errors
 /// Returns a [`TookaError`] if initialization fails or config cannot be loaded.
-pub fn init_logger() -> Result<(), TookaError> {
+pub fn init_logger(console: ConsoleLevel) -> Result<(), TookaError> {
     let config = context::get_locked_config()
         .map_err(|e| TookaError::ConfigError(format!("Failed to get config: {e}")))?;
-    let logs_folder = &config.logs_folder;
-
-    // Ensure folders exist
-    create_dir_all(logs_folder.join("ops"))?;
+    let record_format: FormatFunction = match config.log_format {
+        LogFormat::Text => custom_format,
+        LogFormat::Json => json_format,
+    };
 
     let log_spec = LogSpecification::parse("debug, file_ops=info")?;
-
     let logger = Logger::with(log_spec)
-        .log_to_writer(Box::new(DualWriter::new(logs_folder)))
         .write_mode(WriteMode::BufferAndFlush)
-        .format(custom_format)
-        .start()?;
+        .format(record_format);
+
+    let mut fallback = None;
+    let logger = if config.log_sink == LogSink::Stderr {
+        logger.log_to_stderr()
+    } else {
+        let (writer, reason) = sink_writer(&config)?;
+        fallback = reason;
+        logger
+            .log_to_writer(writer)
+            .duplicate_to_stderr(console.duplicate())
+            .format_for_stderr(console_format)
+    };
 
     LOGGER_HANDLE
-        .set(logger)
+        .set(logger.start()?)
         .map_err(|_| TookaError::ConfigError("Logger already initialized".into()))?;
 
+    if let Some(reason) = fallback {
+        log::warn!("{reason}; logging to files instead");
+    }
+
     Ok(())
 }
 
+/// Builds the writer for the file or syslog sink, along with the reason if
+/// syslog was chosen but fell back to files.
+fn sink_writer(config: &Config) -> Result<(Box<dyn LogWriter>, Option<String>), TookaError> {
+    let fallback = if config.log_sink == LogSink::Syslog {
+        match syslog_writer() {
+            Ok(writer) => return Ok((writer, None)),
+            Err(reason) => Some(reason),
+        }
+    } else {
+        None
+    };
+
+    // Ensure folders exist
+    create_dir_all(config.logs_folder.join("ops"))?;
+    let writer = DualWriter::new(&config.logs_folder, config.logging, config.log_format);
+    Ok((Box::new(writer), fallback))
+}
+
+/// Connects the writer for the syslog sink.
+///
+/// # Errors
+/// Returns why syslog can't be used if no syslog daemon accepts the connection.
+#[cfg(unix)]
+fn syslog_writer() -> Result<Box<dyn LogWriter>, String> {
+    SyslogWriter::connect()
+        .map(|writer| Box::new(writer) as Box<dyn LogWriter>)
+        .map_err(|e| format!("Could not connect to syslog: {e}"))
+}
+
+/// Syslog is only supported on Unix.
+///
+/// # Errors
+/// Always returns why syslog can't be used.
+#[cfg(not(unix))]
+fn syslog_writer() -> Result<Box<dyn LogWriter>, String> {
+    Err("Syslog is not available on this platform".to_string())
+}
+
 /// Logs a file operation message.
 ///
 /// Sends the message to the `file_ops` log target for separate logging.
@@ -85,13 +191,44 @@ fn custom_format(
     )
 }
 
+/// JSON formatter: one object per line with the time, level, target and message
+pub(crate) fn json_format(
+    w: &mut dyn Write,
+    now: &mut flexi_logger::DeferredNow,
+    record: &LogRecord,
+) -> io::Result<()> {
+    let line = serde_json::json!({
+        "time": now.now().to_rfc3339(),
+        "level": record.level().as_str(),
+        "target": record.target(),
+        "message": record.args().to_string(),
+    });
+    writeln!(w, "{line}")
+}
+
+/// Console formatter: just the level and the message
+fn console_format(
+    w: &mut dyn Write,
+    _now: &mut flexi_logger::DeferredNow,
+    record: &LogRecord,
+) -> io::Result<()> {
+    write!(
+        w,
+        "{}: {}",
+        record.level().as_str().to_lowercase(),
+        record.args()
+    )
+}
+
 /// Implementation of the `DualWriter`
 impl DualWriter {
-    /// Creates a new `DualWriter` with the specified base path
-    fn new(base: &Path) -> Self {
+    /// Creates a new `DualWriter` with the specified base path, rotation settings and format
+    fn new(base: &Path, rotation: LoggingConfig, format: LogFormat) -> Self {
         Self {
             main_dir: base.to_path_buf(),
             ops_dir: base.join("ops"),
+            rotation,
+            format,
         }
     }
 
@@ -100,27 +237,10 @@ impl DualWriter {
         self.main_dir.join("main.log")
     }
 
-    // Ops log path: figure out today's file, add -1, -2 if needed
-    fn get_ops_log_path(&self) -> std::path::PathBuf {
+    // Ops log path: one file per day
+    fn get_ops_log_path(&self) -> PathBuf {
         let date_str = Local::now().format("%Y-%m-%d").to_string();
-        let base_path = self.ops_dir.join(format!("{date_str}.log"));
-
-        // If base_path does not exist, use it directly
-        if !base_path.exists() {
-            return base_path;
-        }
-
-        // Otherwise, check for -1, -2, ... suffixes, find latest file
-        for i in 1..=MAX_LOG_FILES {
-            let candidate = self.ops_dir.join(format!("{date_str}-{i}.log"));
-            if !candidate.exists() {
-                // Use the first non-existent file
-                return candidate;
-            }
-        }
-
-        // If all numbered files exist, just return the last one
-        self.ops_dir.join(format!("{date_str}-{MAX_LOG_FILES}.log"))
+        self.ops_dir.join(format!("{date_str}.log"))
     }
 
     // Helper: check if file modified less than 1 hour ago
@@ -133,6 +253,90 @@ impl DualWriter {
         let age = Local::now().signed_duration_since(chrono::DateTime::<Local>::from(modified));
         Ok(age.num_minutes() < 60)
     }
+
+    /// Returns true if the log file at `path` reached the maximum size
+    fn is_full(&self, path: &Path) -> bool {
+        let max_size = self.rotation.max_size_mb.saturating_mul(BYTES_PER_MB);
+        max_size > 0 && std::fs::metadata(path).is_ok_and(|m| m.len() >= max_size)
+    }
+
+    /// Appends a record to the log file at `path` in the configured format
+    fn append(
+        &self,
+        path: &Path,
+        now: &mut flexi_logger::DeferredNow,
+        record: &Record,
+    ) -> io::Result<()> {
+        let mut file = OpenOptions::new().create(true).append(true).open(path)?;
+        let mut buf = Vec::new();
+        match self.format {
+            LogFormat::Text => custom_format(&mut buf, now, record)?,
+            LogFormat::Json => json_format(&mut buf, now, record)?,
+        }
+        file.write_all(&buf)
+    }
+}
+
+/// Moves the log file at `path` aside as `<name>-<timestamp>.log`, gzipped
+/// if `compress` is set, so logging continues in a fresh file.
+///
+/// # Returns
+/// The path of the rotated file.
+pub(crate) fn rotate_log(path: &Path, compress: bool) -> io::Result<PathBuf> {
+    let dir = path.parent().unwrap_or(Path::new("."));
+    let stem = path.file_stem().unwrap_or_default().to_string_lossy();
+    let stamp = Local::now().format(ROTATED_FORMAT);
+    let extension = if compress { "log.gz" } else { "log" };
+    let mut rotated = dir.join(format!("{stem}-{stamp}.{extension}"));
+    let mut n = 1;
+    while rotated.exists() {
+        rotated = dir.join(format!("{stem}-{stamp}-{n}.{extension}"));
+        n += 1;
+    }
+
+    if compress {
+        let mut encoder = GzEncoder::new(File::create(&rotated)?, Compression::default());
+        io::copy(&mut File::open(path)?, &mut encoder)?;
+        encoder.finish()?;
+        std::fs::remove_file(path)?;
+    } else {
+        std::fs::rename(path, &rotated)?;
+    }
+    Ok(rotated)
+}
+
+/// Removes the rotated log files in `dir` whose names start with `prefix`
+/// beyond the newest `max_backups`, and those older than `max_age_days` (if
+/// not 0).
+pub(crate) fn prune_logs(
+    dir: &Path,
+    prefix: &str,
+    max_backups: usize,
+    max_age_days: u64,
+) -> io::Result<()> {
+    let mut rotated: Vec<(SystemTime, PathBuf)> = std::fs::read_dir(dir)?
+        .filter_map(|entry| {
+            let entry = entry.ok()?;
+            let name = entry.file_name().to_string_lossy().into_owned();
+            let is_rotated =
+                name.starts_with(prefix) && (name.ends_with(".log") || name.ends_with(".log.gz"));
+            let modified = entry.metadata().and_then(|m| m.modified()).ok()?;
+            is_rotated.then(|| (modified, entry.path()))
+        })
+        .collect();
+    // Newest first
+    rotated.sort_by(|a, b| b.cmp(a));
+
+    let max_age = Duration::from_secs(max_age_days.saturating_mul(SECONDS_PER_DAY));
+    let now = SystemTime::now();
+    for (i, (modified, path)) in rotated.iter().enumerate() {
+        let too_old =
+            max_age_days > 0 && now.duration_since(*modified).unwrap_or_default() > max_age;
+        if i >= max_backups || too_old {
+            let _ = std::fs::remove_file(path);
+        }
+    }
+    Ok(())
 }
 
 /// Implementation of the `LogWriter` trait for `DualWriter`
@@ -150,59 +354,33 @@ impl LogWriter for DualWriter {
             return Ok(());
         };
 
+        let LoggingConfig {
+            max_backups,
+            max_age_days,
+            compress,
+            ..
+        } = self.rotation;
         if record.target() == "file_ops" {
-            // Ops logger: use numbered daily file
+            // Ops logger: one file per day, the files of earlier days count as backups
             let path = self.get_ops_log_path();
-            // Rotate ops logs: keep only MAX_LOG_FILES newest files
-            if let Some(dir) = path.parent() {
-                let mut log_files: Vec<_> = std::fs::read_dir(dir)?
-                    .filter_map(|entry| {
-                        let entry = entry.ok()?;
-                        let path = entry.path();
-                        if path.extension().and_then(|s| s.to_str()) == Some("log") {
-                            Some(path)
-                        } else {
-                            None
-                        }
-                    })
-                    .collect();
-
-                log_files.sort();
-
-                while log_files.len() > MAX_LOG_FILES {
-                    if let Some(oldest) = log_files.first() {
-                        let _ = std::fs::remove_file(oldest);
-                        log_files.remove(0);
-                    }
-                }
+            let full = self.is_full(&path);
+            if full {
+                rotate_log(&path, compress)?;
             }
-
-            let mut file = OpenOptions::new().create(true).append(true).open(&path)?;
-
-            let mut buf = Vec::new();
-            custom_format(&mut buf, now, record)?;
-            file.write_all(&buf)?;
+            if full || !path.exists() {
+                prune_logs(&self.ops_dir, "", max_backups, max_age_days)?;
+            }
+            self.append(&path, now, record)
         } else {
-            // Main logger
+            // Main logger: a log left over from an earlier session is rotated too
             let path = self.get_main_log_path();
-
-            let recent = Self::is_file_recent(&path)?;
-            let mut open_opts = OpenOptions::new();
-            open_opts.create(true);
-            if recent {
-                // append
-                open_opts.append(true);
-            } else {
-                // overwrite
-                open_opts.write(true).truncate(true);
+            let stale = path.exists() && !Self::is_file_recent(&path)?;
+            if stale || self.is_full(&path) {
+                rotate_log(&path, compress)?;
+                prune_logs(&self.main_dir, "main-", max_backups, max_age_days)?;
             }
-
-            let mut file = open_opts.open(&path)?;
-            let mut buf = Vec::new();
-            custom_format(&mut buf, now, record)?;
-            file.write_all(&buf)?;
+            self.append(&path, now, record)
         }
-        Ok(())
     }
 
     /// Flushes the log writer
@@ -0,0 +1,118 @@
+use super::config::{LogFormat, LoggingConfig};
+use super::logger::{json_format, prune_logs, rotate_log};
+use flate2::read::GzDecoder;
+use std::{fs, io::Read};
+use tempfile::tempdir;
+
+#[test]
+fn test_rotate_log_moves_the_file_aside() {
+    let dir = tempdir().unwrap();
+    let log = dir.path().join("main.log");
+    fs::write(&log, "first session").unwrap();
+
+    let rotated = rotate_log(&log, false).unwrap();
+    assert!(!log.exists());
+    let name = rotated.file_name().unwrap().to_string_lossy().to_string();
+    assert!(
+        name.starts_with("main-") && name.ends_with(".log"),
+        "{name}"
+    );
+    assert_eq!(fs::read_to_string(&rotated).unwrap(), "first session");
+
+    fs::write(&log, "second session").unwrap();
+    let compressed = rotate_log(&log, true).unwrap();
+    assert_ne!(compressed, rotated);
+    assert!(compressed.to_string_lossy().ends_with(".log.gz"));
+    let mut content = String::new();
+    GzDecoder::new(fs::File::open(&compressed).unwrap())
+        .read_to_string(&mut content)
+        .unwrap();
+    assert_eq!(content, "second session");
+}
+
+#[test]
+fn test_prune_logs_keeps_the_newest_backups() {
+    let dir = tempdir().unwrap();
+    let mut rotated = Vec::new();
+    for i in 0..4 {
+        let path = dir.path().join(format!("main-2024010{i}T000000.log"));
+        fs::write(&path, "").unwrap();
+        let modified = std::time::SystemTime::now() - std::time::Duration::from_secs(100 - i);
+        fs::File::options()
+            .write(true)
+            .open(&path)
+            .unwrap()
+            .set_modified(modified)
+            .unwrap();
+        rotated.push(path);
+    }
+    let active = dir.path().join("main.log");
+    fs::write(&active, "").unwrap();
+
+    prune_logs(dir.path(), "main-", 2, 0).unwrap();
+    assert!(!rotated[0].exists());
+    assert!(!rotated[1].exists());
+    assert!(rotated[2].exists());
+    assert!(rotated[3].exists());
+    assert!(active.exists());
+}
+
+#[test]
+fn test_logging_config_defaults_and_rejects_negative_values() {
+    let config: LoggingConfig = serde_yaml::from_str("compress: true").unwrap();
+    assert_eq!(
+        config,
+        LoggingConfig {
+            compress: true,
+            ..Default::default()
+        }
+    );
+
+    assert!(serde_yaml::from_str::<LoggingConfig>("max_backups: -1").is_err());
+    assert!(serde_yaml::from_str::<LoggingConfig>("max_size_mb: -5").is_err());
+}
+
+#[test]
+fn test_json_format_writes_one_object_per_line() {
+    let mut buf = Vec::new();
+    // The arguments only live until the end of the statement
+    json_format(
+        &mut buf,
+        &mut flexi_logger::DeferredNow::new(),
+        &log::Record::builder()
+            .args(format_args!("Moved \"a.pdf\""))
+            .level(log::Level::Info)
+            .target("file_ops")
+            .build(),
+    )
+    .unwrap();
+
+    let line = String::from_utf8(buf).unwrap();
+    assert_eq!(line.lines().count(), 1);
+    let value: serde_json::Value = serde_json::from_str(&line).unwrap();
+    assert_eq!(value["level"], "INFO");
+    assert_eq!(value["target"], "file_ops");
+    assert_eq!(value["message"], "Moved \"a.pdf\"");
+    assert!(value["time"].is_string());
+
+    assert_eq!(
+        serde_yaml::from_str::<LogFormat>("json").unwrap(),
+        LogFormat::Json
+    );
+    assert_eq!(LogFormat::default(), LogFormat::Text);
+}
+
+#[cfg(unix)]
+#[test]
+fn test_syslog_message_carries_the_priority() {
+    use super::syslog::format_message;
+
+    assert_eq!(
+        format_message(log::Level::Error, "tooka", "Sort failed", 42),
+        "<11>tooka[42]: tooka - Sort failed"
+    );
+    assert_eq!(
+        format_message(log::Level::Info, "file_ops", "Moved a.pdf", 42),
+        "<14>tooka[42]: file_ops - Moved a.pdf"
+    );
+}
@@ -1,3 +1,18 @@
+pub mod atomic_write;
 pub mod config;
 pub mod environment;
+pub mod file_format;
 pub mod logger;
+#[cfg(unix)]
+pub mod syslog;
+
+#[cfg(test)]
+mod atomic_write_tests;
+#[cfg(test)]
+mod config_tests;
+#[cfg(test)]
+mod environment_tests;
+#[cfg(test)]
+mod file_format_tests;
+#[cfg(test)]
+mod logger_tests;
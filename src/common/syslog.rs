@@ -0,0 +1,79 @@
+//! Syslog output for the Tooka logger.
+//!
+//! Records are sent as RFC 3164 messages to the local syslog socket, where
+//! journald or rsyslog pick them up. Only available on Unix.
+
+use flexi_logger::{DeferredNow, Record, writers::LogWriter};
+use log::Level;
+use std::{io, os::unix::net::UnixDatagram};
+
+/// Sockets of the local syslog daemon, tried in order
+const SOCKET_PATHS: &[&str] = &["/dev/log", "/var/run/syslog", "/var/run/log"];
+/// Syslog facility for user-level messages
+const FACILITY_USER: u8 = 1;
+/// Name the messages are tagged with
+const TAG: &str = "tooka";
+
+/// Writer that sends every record to the local syslog daemon
+pub struct SyslogWriter {
+    /// Socket connected to the syslog daemon
+    socket: UnixDatagram,
+    /// Process ID included in every message
+    pid: u32,
+}
+
+impl SyslogWriter {
+    /// Connects to the first syslog socket found.
+    ///
+    /// # Errors
+    /// Returns an error if no syslog daemon accepts the connection.
+    pub fn connect() -> io::Result<Self> {
+        let socket = UnixDatagram::unbound()?;
+        let mut last_error = io::Error::new(io::ErrorKind::NotFound, "no syslog socket found");
+        for path in SOCKET_PATHS {
+            match socket.connect(path) {
+                Ok(()) => {
+                    return Ok(Self {
+                        socket,
+                        pid: std::process::id(),
+                    });
+                }
+                Err(e) => last_error = e,
+            }
+        }
+        Err(last_error)
+    }
+}
+
+/// Formats a record as an RFC 3164 message, leaving the timestamp and host to the daemon
+pub(crate) fn format_message(level: Level, target: &str, message: &str, pid: u32) -> String {
+    let severity = match level {
+        Level::Error => 3,
+        Level::Warn => 4,
+        Level::Info => 6,
+        Level::Debug | Level::Trace => 7,
+    };
+    format!(
+        "<{}>{TAG}[{pid}]: {target} - {message}",
+        FACILITY_USER * 8 + severity
+    )
+}
+
+/// Implementation of the `LogWriter` trait for `SyslogWriter`
+impl LogWriter for SyslogWriter {
+    /// Sends a log record to syslog
+    fn write(&self, _now: &mut DeferredNow, record: &Record) -> io::Result<()> {
+        let message = format_message(
+            record.level(),
+            record.target(),
+            &record.args().to_string(),
+            self.pid,
+        );
+        self.socket.send(message.as_bytes()).map(|_| ())
+    }
+
+    /// Flushes the log writer
+    fn flush(&self) -> io::Result<()> {
+        Ok(())
+    }
+}
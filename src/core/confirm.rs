@@ -0,0 +1,155 @@
+//! Confirmation of large sorting runs.
+//!
+//! With a confirmation threshold, runs that would change more files than the
+//! threshold stop and ask before touching anything, while smaller runs go
+//! ahead unattended. Without a terminal to ask on, large runs are aborted
+//! unless confirmed up front (`--yes`).
+//!
+//! Interactive runs (`--interactive`) list how many files each destructive
+//! action would affect and only go ahead once `yes` is typed.
+
+use super::error::TookaError;
+use super::sorter::{DEFERRED_ACTION, DESTRUCTIVE_ACTIONS, MatchResult};
+use crate::rules::rule::ConflictStrategy;
+use std::collections::BTreeMap;
+use std::io::{BufRead, Write};
+
+/// Name under which moves replacing an existing file are counted
+pub const OVERWRITE: &str = "overwrite";
+
+/// When and how a run asks for confirmation.
+#[derive(Debug, Clone, Copy)]
+pub struct ConfirmPolicy {
+    /// Largest number of affected files that runs without asking.
+    pub threshold: usize,
+    /// Confirm up front instead of asking.
+    pub assume_yes: bool,
+    /// Whether someone can answer a prompt.
+    pub interactive: bool,
+}
+
+/// Returns true if the results of a file change it, i.e. it is not only skipped, kept or deferred.
+pub fn affects_file(results: &[MatchResult]) -> bool {
+    results
+        .iter()
+        .any(|r| r.action != "skip" && r.action != "keep" && r.action != DEFERRED_ACTION)
+}
+
+/// Decides whether a run that changes `affected` files may proceed, asking on
+/// `input`/`output` if it exceeds the threshold.
+///
+/// Returns `Ok(false)` if the prompt was declined.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the run exceeds the threshold but cannot be
+/// confirmed interactively, or the prompt cannot be written or read.
+pub fn confirm_run(
+    affected: usize,
+    policy: &ConfirmPolicy,
+    input: impl BufRead,
+    output: impl Write,
+) -> Result<bool, TookaError> {
+    if affected <= policy.threshold || policy.assume_yes {
+        log::debug!(
+            "Running without confirmation: {} affected files, threshold {}, assume yes: {}",
+            affected,
+            policy.threshold,
+            policy.assume_yes
+        );
+        return Ok(true);
+    }
+    if !policy.interactive {
+        return Err(TookaError::Other(format!(
+            "The run would change {affected} files, more than the confirmation threshold of {}; pass --yes to run it without a terminal",
+            policy.threshold
+        )));
+    }
+
+    ask(
+        &format!(
+            "The run will change {affected} files (threshold {}). Continue?",
+            policy.threshold
+        ),
+        input,
+        output,
+    )
+}
+
+/// Asks a yes/no `question` on `input`/`output`, defaulting to no.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the prompt cannot be written or read.
+pub fn ask(
+    question: &str,
+    mut input: impl BufRead,
+    mut output: impl Write,
+) -> Result<bool, TookaError> {
+    write!(output, "{question} [y/N] ")?;
+    output.flush()?;
+    let mut answer = String::new();
+    input.read_line(&mut answer)?;
+    Ok(matches!(
+        answer.trim().to_ascii_lowercase().as_str(),
+        "y" | "yes"
+    ))
+}
+
+/// Counts the files each destructive action of the planned `results` affects.
+///
+/// Deletes, trashing and quarantining are counted by action, moves replacing
+/// an existing file as [`OVERWRITE`].
+pub fn destructive_counts(results: &[MatchResult]) -> BTreeMap<&str, usize> {
+    let mut counts = BTreeMap::new();
+    for result in results {
+        let action = if result.conflict == Some(ConflictStrategy::Overwrite) {
+            OVERWRITE
+        } else if DESTRUCTIVE_ACTIONS.contains(&result.action.as_str()) {
+            result.action.as_str()
+        } else {
+            continue;
+        };
+        *counts.entry(action).or_insert(0) += 1;
+    }
+    counts
+}
+
+/// Writes one line per destructive action of `counts` to `output`.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the summary cannot be written.
+pub fn write_destructive_summary(
+    counts: &BTreeMap<&str, usize>,
+    mut output: impl Write,
+) -> Result<(), TookaError> {
+    for (action, count) in counts {
+        writeln!(output, "  {action}: {count} files")?;
+    }
+    Ok(())
+}
+
+/// Shows the destructive `counts` of a planned run on `output` and asks for
+/// `yes` on `input` before going ahead.
+///
+/// Runs without destructive actions go ahead without asking. Any answer but
+/// `yes` declines.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the prompt cannot be written or read.
+pub fn confirm_destructive(
+    counts: &BTreeMap<&str, usize>,
+    mut input: impl BufRead,
+    mut output: impl Write,
+) -> Result<bool, TookaError> {
+    if counts.is_empty() {
+        log::debug!("Running without confirmation: no destructive actions planned");
+        return Ok(true);
+    }
+
+    writeln!(output, "The run will delete or overwrite files:")?;
+    write_destructive_summary(counts, &mut output)?;
+    write!(output, "Type 'yes' to continue: ")?;
+    output.flush()?;
+    let mut answer = String::new();
+    input.read_line(&mut answer)?;
+    Ok(answer.trim().eq_ignore_ascii_case("yes"))
+}
@@ -0,0 +1,141 @@
+use std::io::Cursor;
+use std::path::PathBuf;
+
+use super::confirm::{
+    ConfirmPolicy, OVERWRITE, affects_file, ask, confirm_destructive, confirm_run,
+    destructive_counts,
+};
+use super::sorter::{DEFERRED_ACTION, MatchResult};
+use crate::rules::rule::ConflictStrategy;
+
+fn policy(threshold: usize, assume_yes: bool, interactive: bool) -> ConfirmPolicy {
+    ConfirmPolicy {
+        threshold,
+        assume_yes,
+        interactive,
+    }
+}
+
+/// Runs the confirmation with `answer` as input, returning the decision and the prompt shown
+fn confirm(affected: usize, policy: &ConfirmPolicy, answer: &str) -> (bool, String) {
+    let mut output = Vec::new();
+    let proceed = confirm_run(affected, policy, Cursor::new(answer), &mut output).unwrap();
+    (proceed, String::from_utf8(output).unwrap())
+}
+
+#[test]
+fn test_runs_below_threshold_without_prompt() {
+    for affected in [0, 5, 10] {
+        let (proceed, prompt) = confirm(affected, &policy(10, false, false), "");
+        assert!(proceed);
+        assert!(prompt.is_empty(), "no prompt for {affected} files");
+    }
+}
+
+#[test]
+fn test_prompts_above_threshold() {
+    let interactive = policy(10, false, true);
+
+    let (proceed, prompt) = confirm(11, &interactive, "y\n");
+    assert!(proceed);
+    assert!(prompt.contains("change 11 files"), "{prompt}");
+
+    assert!(confirm(11, &interactive, "YES\n").0);
+    assert!(!confirm(11, &interactive, "\n").0);
+    assert!(!confirm(11, &interactive, "no\n").0);
+    // End of input declines
+    assert!(!confirm(11, &interactive, "").0);
+}
+
+#[test]
+fn test_non_interactive_above_threshold_needs_yes() {
+    let mut output = Vec::new();
+    let err = confirm_run(50, &policy(10, false, false), Cursor::new(""), &mut output).unwrap_err();
+    assert!(err.to_string().contains("--yes"), "{err}");
+    assert!(output.is_empty());
+
+    let (proceed, prompt) = confirm(50, &policy(10, true, false), "");
+    assert!(proceed);
+    assert!(prompt.is_empty());
+}
+
+#[test]
+fn test_skipped_and_deferred_files_are_not_affected() {
+    let result = |action: &str| MatchResult {
+        file_name: "a.txt".to_string(),
+        action: action.to_string(),
+        matched_rule_id: "rule".to_string(),
+        current_path: PathBuf::from("/src/a.txt"),
+        new_path: PathBuf::from("/src/a.txt"),
+        conflict: None,
+        error: None,
+        size: None,
+    };
+
+    assert!(!affects_file(&[result("skip")]));
+    assert!(!affects_file(&[result(DEFERRED_ACTION)]));
+    assert!(affects_file(&[result("copy"), result("skip")]));
+}
+
+#[test]
+fn test_ask_defaults_to_no() {
+    let answer = |input: &str| {
+        let mut output = Vec::new();
+        let yes = ask("Remove rule 'old'?", Cursor::new(input), &mut output).unwrap();
+        (yes, String::from_utf8(output).unwrap())
+    };
+
+    let (yes, prompt) = answer("y\n");
+    assert!(yes);
+    assert_eq!(prompt, "Remove rule 'old'? [y/N] ");
+    assert!(!answer("\n").0);
+    assert!(!answer("").0);
+}
+
+#[test]
+fn test_interactive_run_needs_explicit_yes() {
+    let result = |action: &str, conflict: Option<ConflictStrategy>| MatchResult {
+        file_name: "a.txt".to_string(),
+        action: action.to_string(),
+        matched_rule_id: "rule".to_string(),
+        current_path: PathBuf::from("/src/a.txt"),
+        new_path: PathBuf::from("/dst/a.txt"),
+        conflict,
+        error: None,
+        size: None,
+    };
+    let planned = [
+        result("delete", None),
+        result("delete", None),
+        result("trash", None),
+        result("move", Some(ConflictStrategy::Overwrite)),
+        result("move", Some(ConflictStrategy::Rename)),
+        result("copy", None),
+    ];
+
+    let counts = destructive_counts(&planned);
+    assert_eq!(
+        counts.into_iter().collect::<Vec<_>>(),
+        vec![("delete", 2), (OVERWRITE, 1), ("trash", 1)]
+    );
+
+    let answer = |input: &str| {
+        let mut output = Vec::new();
+        let counts = destructive_counts(&planned);
+        let yes = confirm_destructive(&counts, Cursor::new(input), &mut output).unwrap();
+        (yes, String::from_utf8(output).unwrap())
+    };
+    let (yes, prompt) = answer("yes\n");
+    assert!(yes);
+    assert!(prompt.contains("delete: 2 files"), "{prompt}");
+    assert!(prompt.contains("overwrite: 1 files"), "{prompt}");
+    assert!(answer("YES\n").0);
+    assert!(!answer("y\n").0);
+    assert!(!answer("").0);
+
+    // Runs that remove nothing go ahead without asking
+    let mut output = Vec::new();
+    let harmless = destructive_counts(&planned[4..]);
+    assert!(confirm_destructive(&harmless, Cursor::new(""), &mut output).unwrap());
+    assert!(output.is_empty());
+}
@@ -8,16 +8,27 @@
 
 use crate::{common::config::Config, core::error::TookaError, rules::rules_file::RulesFile};
 use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
 use std::sync::{Arc, Mutex, OnceLock};
 
-/// Configuration version number.
-pub const CONFIG_VERSION: usize = 0;
+/// Configuration version number, raised with a migration step in `core::migrate`.
+pub const CONFIG_VERSION: usize = 1;
 /// Default config file name.
 pub const CONFIG_FILE_NAME: &str = "tooka.yaml";
 /// Default rules file name.
 pub const RULES_FILE_NAME: &str = "rules.yaml";
+/// Default manifest file name.
+pub const MANIFEST_FILE_NAME: &str = "manifest.jsonl";
+/// Default run journal file name.
+pub const JOURNAL_FILE_NAME: &str = "journal.jsonl";
+/// Default per-rule statistics file name.
+pub const RULE_STATS_FILE_NAME: &str = "rule_stats.json";
 /// Default folder for logs.
 pub const DEFAULT_LOGS_FOLDER: &str = "logs";
+/// Default folder for quarantined files.
+pub const DEFAULT_QUARANTINE_FOLDER: &str = "quarantine";
+/// Default folder for files backed up before deletion.
+pub const DEFAULT_BACKUP_FOLDER: &str = "backup";
 
 /// Application qualifier (used for config directory identification).
 pub const APP_QUALIFIER: &str = "io";
@@ -28,9 +39,28 @@ pub const APP_NAME: &str = "tooka";
 
 /// Global, thread-safe storage of the configuration.
 static CONFIG: OnceLock<Arc<Mutex<Config>>> = OnceLock::new();
+/// Configuration file chosen with `--config`, overriding the default location.
+static CONFIG_PATH: OnceLock<PathBuf> = OnceLock::new();
 /// Global, thread-safe storage of the rules file.
 static RULES_FILE: OnceLock<Arc<Mutex<RulesFile>>> = OnceLock::new();
 
+/// Overrides the configuration file path for this run.
+///
+/// Must be called before the configuration is loaded.
+///
+/// # Errors
+/// Returns an error if the path was already overridden.
+pub fn set_config_path(path: PathBuf) -> Result<()> {
+    CONFIG_PATH
+        .set(path)
+        .map_err(|_| anyhow::anyhow!("Config path already set"))
+}
+
+/// Returns the configuration file path chosen with `--config`, if any.
+pub fn config_path_override() -> Option<&'static Path> {
+    CONFIG_PATH.get().map(PathBuf::as_path)
+}
+
 /// Loads and initializes the global configuration.
 ///
 /// # Errors
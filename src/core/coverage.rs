@@ -0,0 +1,148 @@
+//! Rule coverage analysis for Tooka.
+//!
+//! Evaluates a rule set against a folder the way a dry-run sort does and
+//! reports which share of the files at least one enabled rule handles, broken
+//! down by file extension. It backs the `coverage` command and is meant to
+//! show which types of files still need rules before a ruleset is used.
+
+use super::error::TookaError;
+use super::sorter::{SortOptions, sort_files};
+use crate::{
+    common::config::TieBreak, file::file_match::ExtensionLists, rules::rules_file::RulesFile,
+};
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+/// Label used for files without an extension
+pub const NO_EXTENSION: &str = "(none)";
+
+/// Coverage of the files with one extension.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExtensionCoverage {
+    /// Lowercase extension without the dot, or [`NO_EXTENSION`].
+    pub extension: String,
+    /// Number of files with the extension.
+    pub total: usize,
+    /// Number of those files a rule matched.
+    pub handled: usize,
+}
+
+impl ExtensionCoverage {
+    /// Number of files no rule matched.
+    pub fn unhandled(&self) -> usize {
+        self.total - self.handled
+    }
+
+    /// Share of handled files, in percent.
+    pub fn percentage(&self) -> f64 {
+        percentage(self.handled, self.total)
+    }
+}
+
+/// Coverage of a rule set over a folder.
+#[derive(Debug, Clone, Default)]
+pub struct CoverageReport {
+    /// Number of files evaluated.
+    pub total: usize,
+    /// Number of files matched by at least one enabled rule.
+    pub handled: usize,
+    /// Coverage per extension, most common extensions first.
+    pub extensions: Vec<ExtensionCoverage>,
+}
+
+impl CoverageReport {
+    /// Share of handled files, in percent; an empty folder is fully covered.
+    pub fn percentage(&self) -> f64 {
+        percentage(self.handled, self.total)
+    }
+
+    /// Extensions with the most unhandled files, at most `count` of them.
+    pub fn most_unhandled(&self, count: usize) -> Vec<&ExtensionCoverage> {
+        let mut unhandled: Vec<_> = self
+            .extensions
+            .iter()
+            .filter(|e| e.unhandled() > 0)
+            .collect();
+        unhandled.sort_by(|a, b| {
+            b.unhandled()
+                .cmp(&a.unhandled())
+                .then_with(|| a.extension.cmp(&b.extension))
+        });
+        unhandled.truncate(count);
+        unhandled
+    }
+}
+
+fn percentage(part: usize, total: usize) -> f64 {
+    if total == 0 {
+        return 100.0;
+    }
+    part as f64 * 100.0 / total as f64
+}
+
+/// Returns the extension label a file is counted under
+fn extension_label(file_path: &Path) -> String {
+    file_path
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .map_or_else(|| NO_EXTENSION.to_string(), str::to_lowercase)
+}
+
+/// Computes the coverage of `rules_file` over `files` with a dry run.
+///
+/// A file counts as handled if a rule matched it, even if that rule only
+/// skips it or defers it to a later run. Files the dry run cannot sort, e.g.
+/// on a tie between rules with [`TieBreak::Error`], count as unhandled.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the dry run cannot be started.
+pub fn compute_coverage(
+    files: &[PathBuf],
+    source_path: &Path,
+    rules_file: &RulesFile,
+    tie_break: TieBreak,
+    extension_lists: ExtensionLists,
+) -> Result<CoverageReport, TookaError> {
+    let counts: Mutex<HashMap<String, (usize, usize)>> = Mutex::new(HashMap::new());
+    sort_files(
+        files,
+        source_path,
+        rules_file,
+        &SortOptions {
+            dry_run: true,
+            tie_break,
+            extension_lists,
+            ..Default::default()
+        },
+        |file_path, results| {
+            let handled = results.first().is_some_and(|r| r.matched_rule_id != "none");
+            let mut counts = counts.lock().unwrap_or_else(|e| e.into_inner());
+            let entry = counts.entry(extension_label(file_path)).or_default();
+            entry.0 += 1;
+            entry.1 += usize::from(handled);
+        },
+    )?;
+
+    let mut extensions: Vec<ExtensionCoverage> = counts
+        .into_inner()
+        .unwrap_or_else(|e| e.into_inner())
+        .into_iter()
+        .map(|(extension, (total, handled))| ExtensionCoverage {
+            extension,
+            total,
+            handled,
+        })
+        .collect();
+    extensions.sort_by(|a, b| {
+        b.total
+            .cmp(&a.total)
+            .then_with(|| a.extension.cmp(&b.extension))
+    });
+
+    Ok(CoverageReport {
+        total: extensions.iter().map(|e| e.total).sum(),
+        handled: extensions.iter().map(|e| e.handled).sum(),
+        extensions,
+    })
+}
@@ -0,0 +1,97 @@
+use std::fs::File;
+use std::path::PathBuf;
+
+use super::coverage::{NO_EXTENSION, compute_coverage};
+use crate::common::config::TieBreak;
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rule::Rule;
+use crate::rules::rules_file::RulesFile;
+use crate::rules::test_support::extension_rule;
+use tempfile::tempdir;
+
+fn rule(id: &str, enabled: bool, extensions: &[&str]) -> Rule {
+    Rule {
+        enabled,
+        ..extension_rule(id, extensions)
+    }
+}
+
+/// Creates empty files with the given names in `dir`
+fn create_files(dir: &std::path::Path, names: &[&str]) -> Vec<PathBuf> {
+    names
+        .iter()
+        .map(|name| {
+            let path = dir.join(name);
+            File::create(&path).unwrap();
+            path
+        })
+        .collect()
+}
+
+#[test]
+fn test_coverage_counts_handled_files_per_extension() {
+    let temp_dir = tempdir().unwrap();
+    let files = create_files(
+        temp_dir.path(),
+        &[
+            "a.jpg", "b.JPG", "c.jpg", "d.pdf", "e.log", "f.log", "g.log", "README",
+        ],
+    );
+    // The disabled rule must not count towards coverage
+    let rules_file = RulesFile {
+        rules: vec![
+            rule("photos", true, &["jpg"]),
+            rule("logs", false, &["log"]),
+        ],
+    }
+    .optimized_with_filter(None)
+    .unwrap();
+
+    let report = compute_coverage(
+        &files,
+        temp_dir.path(),
+        &rules_file,
+        TieBreak::First,
+        ExtensionLists::default(),
+    )
+    .unwrap();
+
+    assert_eq!(report.total, 8);
+    assert_eq!(report.handled, 3);
+    assert!((report.percentage() - 37.5).abs() < f64::EPSILON);
+
+    let jpg = &report.extensions[0];
+    assert_eq!(
+        (jpg.extension.as_str(), jpg.total, jpg.handled),
+        ("jpg", 3, 3)
+    );
+    assert!((jpg.percentage() - 100.0).abs() < f64::EPSILON);
+
+    let unhandled: Vec<_> = report
+        .most_unhandled(2)
+        .iter()
+        .map(|e| (e.extension.as_str(), e.unhandled()))
+        .collect();
+    assert_eq!(unhandled, vec![("log", 3), (NO_EXTENSION, 1)]);
+}
+
+#[test]
+fn test_coverage_of_empty_folder_is_complete() {
+    let temp_dir = tempdir().unwrap();
+    let rules_file = RulesFile {
+        rules: vec![rule("photos", true, &["jpg"])],
+    };
+
+    let report = compute_coverage(
+        &[],
+        temp_dir.path(),
+        &rules_file,
+        TieBreak::First,
+        ExtensionLists::default(),
+    )
+    .unwrap();
+
+    assert_eq!(report.total, 0);
+    assert!((report.percentage() - 100.0).abs() < f64::EPSILON);
+    assert!(report.most_unhandled(5).is_empty());
+}
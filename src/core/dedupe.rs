@@ -0,0 +1,155 @@
+//! Duplicate detection for the `dedupe` action.
+//!
+//! Files are grouped by size first, and only files sharing a size are hashed
+//! (SHA-256), so unique files are never read. Each group of identical files
+//! keeps one file according to the action's [`KeepPolicy`]; the others are
+//! its duplicates, which are moved, deleted or replaced with links to it.
+
+use super::error::TookaError;
+use crate::rules::rule::KeepPolicy;
+use rayon::prelude::*;
+use sha2::{Digest, Sha256};
+use std::{
+    collections::HashMap,
+    fmt::Write as _,
+    fs::{self, File},
+    io::Read,
+    path::{Path, PathBuf},
+    time::SystemTime,
+};
+
+/// Size of the buffer files are hashed with
+const HASH_BUFFER_SIZE: usize = 64 * 1024;
+
+/// Returns the SHA-256 of the contents of a file as a lowercase hex string.
+///
+/// The file is read in chunks, so large files are not loaded into memory.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the file cannot be read.
+pub fn hash_file(path: &Path) -> Result<String, TookaError> {
+    let mut file = File::open(path)?;
+    let mut hasher = Sha256::new();
+    let mut buffer = vec![0u8; HASH_BUFFER_SIZE];
+    loop {
+        let n = file.read(&mut buffer)?;
+        if n == 0 {
+            break;
+        }
+        hasher.update(&buffer[..n]);
+    }
+
+    let mut hex = String::with_capacity(64);
+    for byte in hasher.finalize() {
+        let _ = write!(hex, "{byte:02x}");
+    }
+    Ok(hex)
+}
+
+/// Finds the groups of identical files among `files` and picks the file each
+/// group keeps according to `keep`.
+///
+/// Symlinks are left out, since a link and its target are the same file, and
+/// so are hard links to the kept file. Files that cannot be read are left out
+/// with a warning.
+///
+/// # Returns
+/// Every duplicate, mapped to the file kept in its place.
+pub fn find_duplicates(files: &[PathBuf], keep: KeepPolicy) -> HashMap<PathBuf, PathBuf> {
+    let mut by_size: HashMap<u64, Vec<&PathBuf>> = HashMap::new();
+    let mut ids: HashMap<&PathBuf, Option<(u64, u64)>> = HashMap::new();
+    for file in files {
+        match fs::symlink_metadata(file) {
+            Ok(metadata) if metadata.file_type().is_symlink() => {
+                log::debug!(
+                    "Skipping symlink '{}' when finding duplicates",
+                    file.display()
+                );
+            }
+            Ok(metadata) => {
+                ids.insert(file, file_id(&metadata));
+                by_size.entry(metadata.len()).or_default().push(file);
+            }
+            Err(e) => log::warn!("Cannot read '{}' to find duplicates: {}", file.display(), e),
+        }
+    }
+
+    let candidates: Vec<&PathBuf> = by_size
+        .into_values()
+        .filter(|group| group.len() > 1)
+        .flatten()
+        .collect();
+    let hashes: Vec<(String, &PathBuf)> = candidates
+        .into_par_iter()
+        .filter_map(|file| match hash_file(file) {
+            Ok(hash) => Some((hash, file)),
+            Err(e) => {
+                log::warn!("Cannot hash '{}' to find duplicates: {}", file.display(), e);
+                None
+            }
+        })
+        .collect();
+
+    let mut by_hash: HashMap<String, Vec<&PathBuf>> = HashMap::new();
+    for (hash, file) in hashes {
+        by_hash.entry(hash).or_default().push(file);
+    }
+
+    let mut duplicates = HashMap::new();
+    for group in by_hash.into_values().filter(|group| group.len() > 1) {
+        let kept = keeper(&group, keep);
+        log::info!(
+            "Found {} identical files, keeping '{}'",
+            group.len(),
+            kept.display()
+        );
+        let kept_id = ids.get(kept).copied().flatten();
+        for file in group.into_iter().filter(|file| *file != kept) {
+            if kept_id.is_some() && ids.get(file).copied().flatten() == kept_id {
+                log::debug!(
+                    "Skipping '{}', a hard link to '{}'",
+                    file.display(),
+                    kept.display()
+                );
+                continue;
+            }
+            duplicates.insert(file.clone(), kept.clone());
+        }
+    }
+    duplicates
+}
+
+/// Returns the device and inode of a file, shared by all hard links to it
+#[cfg(unix)]
+fn file_id(metadata: &fs::Metadata) -> Option<(u64, u64)> {
+    use std::os::unix::fs::MetadataExt;
+    Some((metadata.dev(), metadata.ino()))
+}
+
+/// Returns the device and inode of a file; not available on this platform
+#[cfg(not(unix))]
+fn file_id(_metadata: &fs::Metadata) -> Option<(u64, u64)> {
+    None
+}
+
+/// Returns the file of a group of identical files that `keep` keeps.
+///
+/// Ties are broken by path, so the choice does not depend on the order of `group`.
+fn keeper<'a>(group: &[&'a PathBuf], keep: KeepPolicy) -> &'a PathBuf {
+    let modified = |file: &PathBuf| {
+        fs::metadata(file)
+            .and_then(|m| m.modified())
+            .unwrap_or(SystemTime::UNIX_EPOCH)
+    };
+    let best = match keep {
+        KeepPolicy::Newest => group
+            .iter()
+            .min_by_key(|file| (std::cmp::Reverse(modified(file)), **file)),
+        KeepPolicy::Oldest => group.iter().min_by_key(|file| (modified(file), **file)),
+        KeepPolicy::ShortestPath => group
+            .iter()
+            .min_by_key(|file| (file.as_os_str().len(), **file)),
+    };
+    // Groups of identical files have at least two files
+    best.copied().unwrap_or(group[0])
+}
@@ -0,0 +1,150 @@
+use std::{
+    fs,
+    path::{Path, PathBuf},
+};
+
+use super::dedupe::{find_duplicates, hash_file};
+use super::sorter::{SortOptions, sort_files};
+use crate::rules::{
+    rule::{Action, Conditions, DedupeAction, KeepPolicy, Rule},
+    rules_file::RulesFile,
+};
+use chrono::{Local, TimeZone};
+use tempfile::tempdir;
+
+/// Writes `content` to `path`, last modified in `year`
+fn write_file(path: &Path, content: &str, year: i32) {
+    fs::write(path, content).unwrap();
+    let modified = Local.with_ymd_and_hms(year, 1, 1, 0, 0, 0).unwrap();
+    fs::File::options()
+        .write(true)
+        .open(path)
+        .unwrap()
+        .set_modified(modified.into())
+        .unwrap();
+}
+
+#[test]
+fn test_hash_file() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("abc.txt");
+    fs::write(&file, "abc").unwrap();
+
+    assert_eq!(
+        hash_file(&file).unwrap(),
+        "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+    );
+    assert!(hash_file(&dir.path().join("missing.txt")).is_err());
+}
+
+#[test]
+fn test_find_duplicates_keeps_one_file_per_group() {
+    let dir = tempdir().unwrap();
+    let nested = dir.path().join("nested");
+    fs::create_dir(&nested).unwrap();
+    let old = nested.join("old.jpg");
+    let new = dir.path().join("new.jpg");
+    let unique = dir.path().join("unique.jpg");
+    // Same size as the others, different content
+    let lookalike = dir.path().join("lookalike.jpg");
+    write_file(&old, "photo", 2020);
+    write_file(&new, "photo", 2024);
+    write_file(&unique, "another photo", 2022);
+    write_file(&lookalike, "phot0", 2022);
+    let files = vec![old.clone(), new.clone(), unique, lookalike];
+
+    let oldest = find_duplicates(&files, KeepPolicy::Oldest);
+    assert_eq!(oldest.len(), 1);
+    assert_eq!(oldest.get(&new), Some(&old));
+
+    let newest = find_duplicates(&files, KeepPolicy::Newest);
+    assert_eq!(newest.len(), 1);
+    assert_eq!(newest.get(&old), Some(&new));
+
+    let shortest = find_duplicates(&files, KeepPolicy::ShortestPath);
+    assert_eq!(shortest.get(&old), Some(&new));
+}
+
+#[cfg(unix)]
+#[test]
+fn test_find_duplicates_ignores_symlinks_and_hard_links() {
+    let dir = tempdir().unwrap();
+    let target = dir.path().join("nested").join("photo.jpg");
+    fs::create_dir(target.parent().unwrap()).unwrap();
+    write_file(&target, "photo", 2020);
+    // Shorter paths than the target, so they would be kept by shortest_path
+    let link = dir.path().join("l.jpg");
+    std::os::unix::fs::symlink(&target, &link).unwrap();
+    let hard_link = dir.path().join("h.jpg");
+    fs::hard_link(&target, &hard_link).unwrap();
+    let files = vec![target.clone(), link.clone(), hard_link];
+
+    assert!(find_duplicates(&files, KeepPolicy::ShortestPath).is_empty());
+
+    let copy = dir.path().join("copy.jpg");
+    write_file(&copy, "photo", 2024);
+    let files = vec![target.clone(), link, copy.clone()];
+    let duplicates = find_duplicates(&files, KeepPolicy::ShortestPath);
+    assert_eq!(duplicates.len(), 1);
+    assert_eq!(duplicates.get(&target), Some(&copy));
+}
+
+#[test]
+fn test_dedupe_action_dry_run_shows_kept_files() {
+    let dir = tempdir().unwrap();
+    let source = dir.path().join("source");
+    let duplicates_dir = dir.path().join("duplicates");
+    fs::create_dir(&source).unwrap();
+    let first = source.join("a.jpg");
+    let copy = source.join("b.jpg");
+    write_file(&first, "photo", 2020);
+    write_file(&copy, "photo", 2024);
+
+    let rules_file = RulesFile {
+        rules: vec![Rule {
+            id: "dedupe".to_string(),
+            name: "Dedupe photos".to_string(),
+            enabled: true,
+            description: None,
+            priority: 1,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                extensions: Some(vec!["jpg".to_string()]),
+                ..Default::default()
+            },
+            then: vec![Action::Dedupe(DedupeAction {
+                keep: KeepPolicy::Oldest,
+                to: Some(duplicates_dir.to_string_lossy().to_string()),
+                replace_with: None,
+                duplicates: Default::default(),
+            })],
+        }],
+    };
+    let files = vec![first.clone(), copy.clone()];
+    let actions = |dry_run: bool| -> Vec<(PathBuf, String)> {
+        let options = SortOptions {
+            dry_run,
+            ..Default::default()
+        };
+        let mut results: Vec<_> = sort_files(&files, &source, &rules_file, &options, |_, _| {})
+            .unwrap()
+            .into_iter()
+            .map(|r| (r.current_path, r.action))
+            .collect();
+        results.sort();
+        results
+    };
+
+    let expected = vec![
+        (first.clone(), "keep".to_string()),
+        (copy.clone(), "move".to_string()),
+    ];
+    assert_eq!(actions(true), expected);
+    assert!(copy.exists());
+
+    assert_eq!(actions(false), expected);
+    assert!(first.exists());
+    assert!(!copy.exists());
+    assert!(duplicates_dir.join("b.jpg").exists());
+}
@@ -30,9 +30,21 @@ pub enum TookaError {
     #[error("YAML parse error: {0}")]
     Yaml(#[from] serde_yaml::Error),
 
+    #[error("TOML parse error: {0}")]
+    TomlParse(#[from] toml::de::Error),
+
+    #[error("TOML write error: {0}")]
+    TomlWrite(#[from] toml::ser::Error),
+
+    #[error("HTTP error: {0}")]
+    Http(#[from] reqwest::Error),
+
     #[error("File operation error: {0}")]
     FileOperationError(String),
 
+    #[error("Failed to sort '{}': {1}", .0.display())]
+    FileFailed(path::PathBuf, #[source] Box<TookaError>),
+
     // === Config ===
     #[error("Config error: {0}")]
     ConfigError(String),
@@ -66,6 +78,12 @@ pub enum TookaError {
     #[error("Invalid rule: {0}")]
     InvalidRule(String),
 
+    #[error("Rules are read-only: {0}")]
+    RulesReadOnly(String),
+
+    #[error("Failed to fetch rules: {0}")]
+    FetchError(String),
+
     // === Others ===
     #[error("Failed to generate PDF: {0}")]
     PdfGenerationError(String),
@@ -0,0 +1,177 @@
+//! `.tookaignore` support for Tooka.
+//!
+//! A `.tookaignore` file lists files and folders that sorting must never
+//! touch, using the same syntax as `.gitignore`:
+//!
+//! - blank lines and lines starting with `#` are skipped
+//! - `*`, `?`, `[...]` and `**` are glob wildcards, where only `**` matches `/`
+//! - a pattern without a `/` (other than a trailing one) matches a name at any
+//!   depth, otherwise it is relative to the folder of the `.tookaignore` file
+//! - a trailing `/` only matches folders
+//! - a leading `!` re-includes what an earlier pattern ignored
+//!
+//! Ignore files are read from the source folder and from every subfolder the
+//! walker enters. Patterns of deeper files take precedence, and within a file
+//! later patterns take precedence over earlier ones. Ignored folders are not
+//! walked at all, so a file inside one cannot be re-included.
+
+use crate::core::error::TookaError;
+use glob::{MatchOptions, Pattern};
+use std::{
+    fs, io,
+    path::{Component, Path, PathBuf},
+};
+
+/// File name of ignore files
+pub const IGNORE_FILE_NAME: &str = ".tookaignore";
+
+/// Wildcards never match `/`, except for `**`
+const MATCH_OPTIONS: MatchOptions = MatchOptions {
+    case_sensitive: true,
+    require_literal_separator: true,
+    require_literal_leading_dot: false,
+};
+
+/// A single pattern of an ignore file.
+#[derive(Debug, Clone)]
+struct IgnorePattern {
+    /// Folder of the ignore file the pattern is from
+    base: PathBuf,
+    pattern: Pattern,
+    /// Whether the pattern re-includes matches instead of ignoring them
+    negated: bool,
+    /// Whether the pattern only matches folders
+    dir_only: bool,
+    /// Whether the pattern is matched against the path relative to `base`
+    /// rather than against the name alone
+    anchored: bool,
+}
+
+impl IgnorePattern {
+    /// Parses a line of an ignore file, returning `None` if it holds no pattern
+    fn parse(base: &Path, line: &str) -> Option<Result<Self, TookaError>> {
+        let line = line.trim_end();
+        if line.is_empty() || line.starts_with('#') {
+            return None;
+        }
+
+        let (negated, line) = match line.strip_prefix('!') {
+            Some(rest) => (true, rest),
+            None => (false, line.strip_prefix('\\').unwrap_or(line)),
+        };
+        let (dir_only, line) = match line.strip_suffix('/') {
+            Some(rest) => (true, rest),
+            None => (false, line),
+        };
+        let anchored = line.contains('/');
+        let line = line.strip_prefix('/').unwrap_or(line);
+        if line.is_empty() {
+            return None;
+        }
+
+        Some(
+            Pattern::new(line)
+                .map_err(TookaError::from)
+                .map(|pattern| Self {
+                    base: base.to_path_buf(),
+                    pattern,
+                    negated,
+                    dir_only,
+                    anchored,
+                }),
+        )
+    }
+
+    /// Returns true if the pattern matches `path`
+    fn matches(&self, path: &Path, is_dir: bool) -> bool {
+        if self.dir_only && !is_dir {
+            return false;
+        }
+        let Ok(relative) = path.strip_prefix(&self.base) else {
+            return false;
+        };
+        if self.anchored {
+            self.pattern
+                .matches_with(&slash_path(relative), MATCH_OPTIONS)
+        } else {
+            relative.file_name().is_some_and(|name| {
+                self.pattern
+                    .matches_with(&name.to_string_lossy(), MATCH_OPTIONS)
+            })
+        }
+    }
+}
+
+/// Decides which files and folders are ignored by `.tookaignore` files.
+#[derive(Debug, Clone, Default)]
+pub struct IgnoreMatcher {
+    /// Patterns of all loaded ignore files, shallower folders first
+    patterns: Vec<IgnorePattern>,
+}
+
+impl IgnoreMatcher {
+    /// Loads the ignore file of the folder `root`, if it has one.
+    ///
+    /// Ignore files of subfolders are added with [`IgnoreMatcher::load_dir`]
+    /// as the walker enters them.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the ignore file cannot be read or holds an
+    /// invalid pattern.
+    pub fn load(root: &Path) -> Result<Self, TookaError> {
+        let mut matcher = Self::default();
+        matcher.load_dir(root)?;
+        Ok(matcher)
+    }
+
+    /// Adds the patterns of the ignore file in `dir`, if it has one.
+    ///
+    /// Folders must be loaded parents first, as the walker enters them.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the ignore file cannot be read or holds an
+    /// invalid pattern.
+    pub fn load_dir(&mut self, dir: &Path) -> Result<(), TookaError> {
+        let path = dir.join(IGNORE_FILE_NAME);
+        let content = match fs::read_to_string(&path) {
+            Ok(content) => content,
+            Err(e) if e.kind() == io::ErrorKind::NotFound => return Ok(()),
+            Err(e) => return Err(e.into()),
+        };
+
+        let patterns = content
+            .lines()
+            .filter_map(|line| IgnorePattern::parse(dir, line))
+            .collect::<Result<Vec<_>, _>>()
+            .map_err(|e| {
+                TookaError::ConfigError(format!("Invalid pattern in '{}': {e}", path.display()))
+            })?;
+        log::debug!(
+            "Loaded {} ignore patterns from '{}'",
+            patterns.len(),
+            path.display()
+        );
+        self.patterns.extend(patterns);
+        Ok(())
+    }
+
+    /// Returns true if `path` is ignored; `is_dir` tells whether it is a folder.
+    pub fn is_ignored(&self, path: &Path, is_dir: bool) -> bool {
+        self.patterns
+            .iter()
+            .rev()
+            .find(|pattern| pattern.matches(path, is_dir))
+            .is_some_and(|pattern| !pattern.negated)
+    }
+}
+
+/// Joins the components of a relative path with `/` on every platform
+fn slash_path(path: &Path) -> String {
+    path.components()
+        .filter_map(|component| match component {
+            Component::Normal(part) => Some(part.to_string_lossy()),
+            _ => None,
+        })
+        .collect::<Vec<_>>()
+        .join("/")
+}
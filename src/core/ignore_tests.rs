@@ -0,0 +1,92 @@
+use std::fs;
+use std::path::Path;
+
+use super::ignore::{IGNORE_FILE_NAME, IgnoreMatcher};
+use super::sorter::collect_files;
+use tempfile::tempdir;
+
+fn write_ignore(dir: &Path, content: &str) {
+    fs::create_dir_all(dir).unwrap();
+    fs::write(dir.join(IGNORE_FILE_NAME), content).unwrap();
+}
+
+#[test]
+fn test_gitignore_pattern_semantics() {
+    let root = tempdir().unwrap();
+    let root = root.path();
+    write_ignore(
+        root,
+        "# build output\n\n*.tmp\n!keep.tmp\nbuild/\n/top.log\ndocs/*.md\n\\!bang\n",
+    );
+    let matcher = IgnoreMatcher::load(root).unwrap();
+    let ignored = |path: &str, is_dir| matcher.is_ignored(&root.join(path), is_dir);
+
+    // Names without a slash match at any depth
+    assert!(ignored("a.tmp", false));
+    assert!(ignored("deep/er/a.tmp", false));
+    assert!(!ignored("keep.tmp", false));
+    assert!(!ignored("deep/keep.tmp", false));
+
+    // A trailing slash only matches folders
+    assert!(ignored("build", true));
+    assert!(ignored("src/build", true));
+    assert!(!ignored("build", false));
+
+    // Patterns with a slash are relative to the ignore file's folder
+    assert!(ignored("top.log", false));
+    assert!(!ignored("sub/top.log", false));
+    assert!(ignored("docs/readme.md", false));
+    assert!(!ignored("docs/guide/readme.md", false));
+
+    assert!(ignored("!bang", false));
+    assert!(!ignored("# build output", false));
+    assert!(!ignored("notes.txt", false));
+}
+
+#[test]
+fn test_deeper_ignore_files_take_precedence() {
+    let root = tempdir().unwrap();
+    let root = root.path();
+    let sub = root.join("sub");
+    write_ignore(root, "*.log\n");
+    write_ignore(&sub, "!important.log\n");
+
+    let mut matcher = IgnoreMatcher::load(root).unwrap();
+    matcher.load_dir(&sub).unwrap();
+
+    assert!(matcher.is_ignored(&sub.join("debug.log"), false));
+    assert!(!matcher.is_ignored(&sub.join("important.log"), false));
+    // Patterns only apply below the folder of their ignore file
+    assert!(matcher.is_ignored(&root.join("important.log"), false));
+}
+
+#[test]
+fn test_invalid_pattern_is_an_error() {
+    let root = tempdir().unwrap();
+    write_ignore(root.path(), "[unclosed\n");
+    assert!(IgnoreMatcher::load(root.path()).is_err());
+}
+
+#[test]
+fn test_collect_files_skips_ignored_files_and_folders() {
+    let root = tempdir().unwrap();
+    let root = root.path();
+    write_ignore(root, "node_modules/\n.git/\n");
+    write_ignore(&root.join("photos"), "*.xmp\n");
+    for file in [
+        "notes.txt",
+        "node_modules/pkg/index.js",
+        ".git/HEAD",
+        "photos/cat.jpg",
+        "photos/cat.xmp",
+    ] {
+        let path = root.join(file);
+        fs::create_dir_all(path.parent().unwrap()).unwrap();
+        fs::write(path, "content").unwrap();
+    }
+
+    assert_eq!(
+        collect_files(root).unwrap(),
+        vec![root.join("notes.txt"), root.join("photos/cat.jpg")]
+    );
+}
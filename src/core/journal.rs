@@ -0,0 +1,222 @@
+//! Run journal for Tooka.
+//!
+//! While a sort runs, every successfully processed file is appended to a JSON
+//! Lines journal next to the rules file, and a completion marker is written
+//! once the run finishes. If a run is interrupted (Ctrl-C, crash), the journal
+//! of that incomplete run tells a resumed run which files were already handled.
+//! Only the most recent run is kept; starting a new run replaces the journal.
+
+use crate::{
+    common::config::Config,
+    core::{context::JOURNAL_FILE_NAME, error::TookaError, sorter::MatchResult},
+};
+use chrono::Local;
+use serde::{Deserialize, Serialize};
+use std::{
+    collections::{HashMap, HashSet},
+    fs::{self, OpenOptions},
+    io::{BufRead, BufReader, Write},
+    path::{Path, PathBuf},
+    sync::Mutex,
+    time::UNIX_EPOCH,
+};
+
+/// A single event recorded in the run journal.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(tag = "event", rename_all = "snake_case")]
+pub enum JournalRecord {
+    /// A run over `source` started.
+    Started { source: PathBuf, timestamp: String },
+    /// A file was processed successfully.
+    Processed {
+        path: PathBuf,
+        /// Modification time of the file after it was processed, in milliseconds
+        /// since the epoch, or `None` if it no longer exists at `path`.
+        modified: Option<u64>,
+        results: Vec<MatchResult>,
+    },
+    /// The run finished.
+    Completed { timestamp: String },
+}
+
+/// Progress of an interrupted run, used to resume it.
+#[derive(Debug, Clone, Default)]
+pub struct ResumeState {
+    /// Processed files and their modification time right after processing.
+    processed: HashMap<PathBuf, Option<u64>>,
+    /// Paths files were moved, copied or renamed to during the run.
+    destinations: HashSet<PathBuf>,
+    /// Results of the files processed before the interruption.
+    pub results: Vec<MatchResult>,
+}
+
+impl ResumeState {
+    /// Number of files processed before the interruption.
+    pub fn processed_count(&self) -> usize {
+        self.processed.len()
+    }
+
+    /// Returns true if `path` was already handled by the interrupted run.
+    ///
+    /// A file counts as handled if it was processed and has not changed since,
+    /// or if it was produced by the run (e.g. moved into a folder that is
+    /// itself inside the source folder).
+    pub fn is_done(&self, path: &Path) -> bool {
+        if self.destinations.contains(path) {
+            return true;
+        }
+        self.processed
+            .get(path)
+            .is_some_and(|modified| *modified == modified_millis(path))
+    }
+}
+
+/// Journal of the most recent sorting run.
+#[derive(Debug)]
+pub struct RunJournal {
+    path: PathBuf,
+    // Serializes appends from parallel sorting workers
+    lock: Mutex<()>,
+}
+
+impl RunJournal {
+    /// Creates a journal stored at the given path.
+    pub fn new(path: impl Into<PathBuf>) -> Self {
+        Self {
+            path: path.into(),
+            lock: Mutex::new(()),
+        }
+    }
+
+    /// Creates the journal stored next to the configured rules file.
+    pub fn from_config(config: &Config) -> Self {
+        let dir = config.rules_file.parent().unwrap_or_else(|| Path::new("."));
+        Self::new(dir.join(JOURNAL_FILE_NAME))
+    }
+
+    /// Starts a new run over `source`, replacing the previous journal.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be written.
+    pub fn start(&self, source: &Path) -> Result<(), TookaError> {
+        if let Some(parent) = self.path.parent() {
+            fs::create_dir_all(parent)?;
+        }
+        fs::write(&self.path, "")?;
+        self.append(&JournalRecord::Started {
+            source: source.to_path_buf(),
+            timestamp: Local::now().to_rfc3339(),
+        })
+    }
+
+    /// Records that `path` was processed with the given results.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be written.
+    pub fn record_processed(&self, path: &Path, results: &[MatchResult]) -> Result<(), TookaError> {
+        self.append(&JournalRecord::Processed {
+            path: path.to_path_buf(),
+            modified: modified_millis(path),
+            results: results.to_vec(),
+        })
+    }
+
+    /// Marks the current run as finished.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be written.
+    pub fn complete(&self) -> Result<(), TookaError> {
+        self.append(&JournalRecord::Completed {
+            timestamp: Local::now().to_rfc3339(),
+        })
+    }
+
+    /// Returns the progress of the last run if it was over `source` and did not complete.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal exists but cannot be read.
+    pub fn resume_state(&self, source: &Path) -> Result<Option<ResumeState>, TookaError> {
+        let records = self.records()?;
+        let Some(JournalRecord::Started {
+            source: started, ..
+        }) = records.first()
+        else {
+            return Ok(None);
+        };
+        if started != source {
+            log::info!(
+                "Last run was over '{}', not '{}'; nothing to resume",
+                started.display(),
+                source.display()
+            );
+            return Ok(None);
+        }
+
+        let mut state = ResumeState::default();
+        for record in records {
+            match record {
+                JournalRecord::Started { .. } => {}
+                JournalRecord::Processed {
+                    path,
+                    modified,
+                    results,
+                } => {
+                    state.destinations.extend(
+                        results
+                            .iter()
+                            .filter(|r| r.new_path != r.current_path)
+                            .map(|r| r.new_path.clone()),
+                    );
+                    state.processed.insert(path, modified);
+                    state.results.extend(results);
+                }
+                JournalRecord::Completed { .. } => return Ok(None),
+            }
+        }
+        Ok(Some(state))
+    }
+
+    /// Reads all records of the journal; a missing journal has none.
+    fn records(&self) -> Result<Vec<JournalRecord>, TookaError> {
+        if !self.path.exists() {
+            return Ok(Vec::new());
+        }
+
+        let reader = BufReader::new(fs::File::open(&self.path)?);
+        let mut records = Vec::new();
+        for line in reader.lines() {
+            let line = line?;
+            if line.trim().is_empty() {
+                continue;
+            }
+            // The last line may be cut short if the process was killed mid-write
+            match serde_json::from_str(&line) {
+                Ok(record) => records.push(record),
+                Err(e) => log::warn!("Skipping malformed journal line: {e}"),
+            }
+        }
+        Ok(records)
+    }
+
+    fn append(&self, record: &JournalRecord) -> Result<(), TookaError> {
+        let mut line = serde_json::to_vec(record)?;
+        line.push(b'\n');
+
+        let _guard = self
+            .lock
+            .lock()
+            .map_err(|e| TookaError::Other(format!("Journal lock poisoned: {e}")))?;
+        let mut file = OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&self.path)?;
+        file.write_all(&line)?;
+        Ok(())
+    }
+}
+
+/// Returns the modification time of `path` in milliseconds since the epoch.
+fn modified_millis(path: &Path) -> Option<u64> {
+    let modified = fs::metadata(path).ok()?.modified().ok()?;
+    u64::try_from(modified.duration_since(UNIX_EPOCH).ok()?.as_millis()).ok()
+}
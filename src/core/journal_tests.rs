@@ -0,0 +1,128 @@
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::{Duration, SystemTime};
+
+use super::journal::RunJournal;
+use crate::core::sorter::{SortOptions, collect_files, sort_files};
+use crate::rules::rule::{Action, Conditions, ConflictStrategy, MoveAction, Rule};
+use crate::rules::rules_file::RulesFile;
+use tempfile::tempdir;
+
+fn move_txt_rules(to: &Path) -> RulesFile {
+    RulesFile {
+        rules: vec![Rule {
+            id: "txt_rule".to_string(),
+            name: "Move txt files".to_string(),
+            enabled: true,
+            description: None,
+            priority: 1,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                extensions: Some(vec!["txt".to_string()]),
+                ..Default::default()
+            },
+            then: vec![Action::Move(MoveAction {
+                to: to.to_string_lossy().to_string(),
+                preserve_structure: false,
+                dir_mode: None,
+                path_template: None,
+                on_conflict: ConflictStrategy::default(),
+            })],
+        }],
+    }
+}
+
+/// Sorts `files`, journaling each processed file like the sort command does
+fn journaled_sort(journal: &RunJournal, files: &[PathBuf], source: &Path, rules: &RulesFile) {
+    sort_files(
+        files,
+        source,
+        rules,
+        &SortOptions {
+            dry_run: false,
+            ..Default::default()
+        },
+        |path, results| {
+            journal.record_processed(path, results).unwrap();
+        },
+    )
+    .unwrap();
+}
+
+#[test]
+fn test_resume_interrupted_run_to_completion() {
+    let source = tempdir().unwrap();
+    let data = tempdir().unwrap();
+    // Sorted files land inside the source folder, so a rescan finds them again
+    let sorted = source.path().join("sorted");
+    for i in 0..6 {
+        fs::write(source.path().join(format!("file{i}.txt")), "content").unwrap();
+    }
+    let rules = move_txt_rules(&sorted);
+    let journal = RunJournal::new(data.path().join("journal.jsonl"));
+
+    // First run is interrupted after half of the files
+    let mut files = collect_files(source.path()).unwrap();
+    files.sort();
+    journal.start(source.path()).unwrap();
+    journaled_sort(&journal, &files[..3], source.path(), &rules);
+
+    // Resume: only the files the interrupted run did not reach are left
+    let state = journal.resume_state(source.path()).unwrap().unwrap();
+    assert_eq!(state.processed_count(), 3);
+    assert_eq!(state.results.len(), 3);
+    let mut remaining = collect_files(source.path()).unwrap();
+    remaining.retain(|f| !state.is_done(f));
+    remaining.sort();
+    assert_eq!(remaining, files[3..].to_vec());
+
+    journaled_sort(&journal, &remaining, source.path(), &rules);
+    journal.complete().unwrap();
+
+    for i in 0..6 {
+        assert!(sorted.join(format!("file{i}.txt")).exists());
+    }
+    // A completed run has nothing left to resume
+    assert!(journal.resume_state(source.path()).unwrap().is_none());
+}
+
+#[test]
+fn test_resume_reprocesses_changed_files() {
+    let source = tempdir().unwrap();
+    let data = tempdir().unwrap();
+    let unmatched = source.path().join("notes.log");
+    fs::write(&unmatched, "v1").unwrap();
+    let rules = move_txt_rules(&source.path().join("sorted"));
+    let journal = RunJournal::new(data.path().join("journal.jsonl"));
+
+    journal.start(source.path()).unwrap();
+    journaled_sort(
+        &journal,
+        std::slice::from_ref(&unmatched),
+        source.path(),
+        &rules,
+    );
+    let state = journal.resume_state(source.path()).unwrap().unwrap();
+    assert!(state.is_done(&unmatched));
+
+    // The file changed after it was processed, so it must be looked at again
+    let file = fs::File::options().write(true).open(&unmatched).unwrap();
+    file.set_modified(SystemTime::now() + Duration::from_secs(60))
+        .unwrap();
+    assert!(!state.is_done(&unmatched));
+}
+
+#[test]
+fn test_resume_ignores_other_sources_and_missing_journal() {
+    let source = tempdir().unwrap();
+    let other = tempdir().unwrap();
+    let data = tempdir().unwrap();
+    let journal = RunJournal::new(data.path().join("journal.jsonl"));
+
+    assert!(journal.resume_state(source.path()).unwrap().is_none());
+
+    journal.start(source.path()).unwrap();
+    assert!(journal.resume_state(source.path()).unwrap().is_some());
+    assert!(journal.resume_state(other.path()).unwrap().is_none());
+}
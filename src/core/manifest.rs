@@ -0,0 +1,223 @@
+//! Persistent action manifest for Tooka.
+//!
+//! Every action performed by a (non dry-run) sort is appended to a JSON Lines
+//! file next to the rules file. The manifest is never rewritten, so it keeps a
+//! complete history of what each rule has done, which allows following a file
+//! through later moves and renames to find out where it is now.
+
+use crate::{
+    common::config::Config,
+    core::{
+        context::MANIFEST_FILE_NAME,
+        error::TookaError,
+        sorter::{DEFERRED_ACTION, MatchResult},
+    },
+};
+use chrono::Local;
+use serde::{Deserialize, Serialize};
+use std::{
+    fs::{self, OpenOptions},
+    io::{BufRead, BufReader, Write},
+    path::{Path, PathBuf},
+};
+
+/// A single action recorded in the manifest.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ManifestEntry {
+    /// Time the action was recorded, in RFC 3339 format.
+    pub timestamp: String,
+    /// ID of the rule that performed the action.
+    pub rule_id: String,
+    /// Action performed (e.g., move, copy, rename, delete).
+    pub action: String,
+    /// Path of the file before the action.
+    pub source: PathBuf,
+    /// Path of the file after the action.
+    pub destination: PathBuf,
+}
+
+/// A file a rule has acted on, together with where it is now.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TracedFile {
+    /// Time the rule acted on the file.
+    pub timestamp: String,
+    /// Action the rule performed.
+    pub action: String,
+    /// Path of the file before the rule acted on it.
+    pub original_path: PathBuf,
+    /// Last known location of the file, `None` if it was deleted.
+    pub current_path: Option<PathBuf>,
+}
+
+impl TracedFile {
+    /// Returns true if the file still exists at its last known location.
+    pub fn exists(&self) -> bool {
+        self.current_path.as_ref().is_some_and(|p| p.exists())
+    }
+}
+
+/// Append-only log of the actions performed by sorting runs.
+#[derive(Debug, Clone)]
+pub struct Manifest {
+    path: PathBuf,
+}
+
+impl Manifest {
+    /// Creates a manifest stored at the given path.
+    pub fn new(path: impl Into<PathBuf>) -> Self {
+        Self { path: path.into() }
+    }
+
+    /// Creates the manifest stored next to the configured rules file.
+    pub fn from_config(config: &Config) -> Self {
+        let dir = config.rules_file.parent().unwrap_or_else(|| Path::new("."));
+        Self::new(dir.join(MANIFEST_FILE_NAME))
+    }
+
+    /// Returns the path of the manifest file.
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Appends the actions from a sorting run to the manifest.
+    ///
+    /// Results for unmatched files, skip actions and deferred files are not recorded.
+    ///
+    /// # Returns
+    /// The number of entries written.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the manifest cannot be written.
+    pub fn record(&self, results: &[MatchResult]) -> Result<usize, TookaError> {
+        let timestamp = Local::now().to_rfc3339();
+        let entries: Vec<ManifestEntry> = results
+            .iter()
+            .filter(|r| {
+                r.action != "skip" && r.action != DEFERRED_ACTION && r.matched_rule_id != "none"
+            })
+            .map(|r| ManifestEntry {
+                timestamp: timestamp.clone(),
+                rule_id: r.matched_rule_id.clone(),
+                action: r.action.clone(),
+                source: r.current_path.clone(),
+                destination: r.new_path.clone(),
+            })
+            .collect();
+
+        self.append(&entries)?;
+        Ok(entries.len())
+    }
+
+    /// Appends the given entries to the manifest, creating it if needed.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the manifest cannot be written.
+    pub fn append(&self, entries: &[ManifestEntry]) -> Result<(), TookaError> {
+        if entries.is_empty() {
+            return Ok(());
+        }
+        if let Some(parent) = self.path.parent() {
+            fs::create_dir_all(parent)?;
+        }
+
+        let mut buf = Vec::new();
+        for entry in entries {
+            serde_json::to_writer(&mut buf, entry)?;
+            buf.push(b'\n');
+        }
+
+        let mut file = OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&self.path)?;
+        file.write_all(&buf)?;
+        log::debug!(
+            "Recorded {} entries in manifest '{}'",
+            entries.len(),
+            self.path.display()
+        );
+        Ok(())
+    }
+
+    /// Reads all entries from the manifest, oldest first.
+    ///
+    /// A missing manifest yields no entries. Malformed lines are skipped with a warning.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the manifest exists but cannot be read.
+    pub fn entries(&self) -> Result<Vec<ManifestEntry>, TookaError> {
+        if !self.path.exists() {
+            return Ok(Vec::new());
+        }
+
+        let reader = BufReader::new(fs::File::open(&self.path)?);
+        let mut entries = Vec::new();
+        for (i, line) in reader.lines().enumerate() {
+            let line = line?;
+            if line.trim().is_empty() {
+                continue;
+            }
+            match serde_json::from_str(&line) {
+                Ok(entry) => entries.push(entry),
+                Err(e) => log::warn!(
+                    "Skipping malformed manifest line {} in '{}': {}",
+                    i + 1,
+                    self.path.display(),
+                    e
+                ),
+            }
+        }
+        Ok(entries)
+    }
+
+    /// Lists the files the given rule has acted on and their current locations.
+    ///
+    /// Each file is followed through the actions recorded after it, including
+    /// those of other rules, so a file that was later moved or renamed is
+    /// reported at its latest location.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the manifest cannot be read.
+    pub fn trace_rule(&self, rule_id: &str) -> Result<Vec<TracedFile>, TookaError> {
+        Ok(trace_entries(&self.entries()?, rule_id))
+    }
+}
+
+/// Follows the files acted on by `rule_id` through the given entries.
+fn trace_entries(entries: &[ManifestEntry], rule_id: &str) -> Vec<TracedFile> {
+    let mut traced: Vec<TracedFile> = Vec::new();
+
+    for entry in entries {
+        // A later action on a file that is already being traced moves it along
+        let followed = traced
+            .iter_mut()
+            .find(|t| t.current_path.as_deref() == Some(entry.source.as_path()));
+        if let Some(file) = followed {
+            match entry.action.as_str() {
+                "move" | "rename" | "quarantine" => {
+                    file.current_path = Some(entry.destination.clone());
+                }
+                "delete" | "trash" => file.current_path = None,
+                // Copies and commands leave the traced file where it is
+                _ => {}
+            }
+            continue;
+        }
+
+        if entry.rule_id != rule_id {
+            continue;
+        }
+        let current_path = match entry.action.as_str() {
+            "delete" | "trash" => None,
+            _ => Some(entry.destination.clone()),
+        };
+        traced.push(TracedFile {
+            timestamp: entry.timestamp.clone(),
+            action: entry.action.clone(),
+            original_path: entry.source.clone(),
+            current_path,
+        });
+    }
+
+    traced
+}
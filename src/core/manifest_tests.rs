@@ -0,0 +1,132 @@
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use super::manifest::{Manifest, ManifestEntry};
+use crate::core::sorter::{SortOptions, collect_files, sort_files};
+use crate::rules::rule::{Action, ConflictStrategy, MoveAction, Rule};
+use crate::rules::rules_file::RulesFile;
+use crate::rules::test_support::extension_rule;
+use tempfile::tempdir;
+
+fn move_rule(id: &str, ext: &str, to: &Path) -> Rule {
+    Rule {
+        then: vec![Action::Move(MoveAction {
+            to: to.to_string_lossy().to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            on_conflict: ConflictStrategy::default(),
+        })],
+        ..extension_rule(id, &[ext])
+    }
+}
+
+fn entry(rule_id: &str, action: &str, source: &str, destination: &str) -> ManifestEntry {
+    ManifestEntry {
+        timestamp: "2025-01-01T00:00:00+00:00".to_string(),
+        rule_id: rule_id.to_string(),
+        action: action.to_string(),
+        source: PathBuf::from(source),
+        destination: PathBuf::from(destination),
+    }
+}
+
+#[test]
+fn test_trace_rule_after_sort() {
+    let source = tempdir().unwrap();
+    let dest = tempdir().unwrap();
+    let data = tempdir().unwrap();
+    fs::write(source.path().join("a.txt"), "a").unwrap();
+    fs::write(source.path().join("b.txt"), "b").unwrap();
+    fs::write(source.path().join("c.log"), "c").unwrap();
+
+    let rules_file = RulesFile {
+        rules: vec![move_rule("txt_rule", "txt", dest.path())],
+    };
+    let files = collect_files(source.path()).unwrap();
+    let results = sort_files(
+        &files,
+        source.path(),
+        &rules_file,
+        &SortOptions {
+            dry_run: false,
+            ..Default::default()
+        },
+        |_, _| {},
+    )
+    .unwrap();
+
+    let manifest = Manifest::new(data.path().join("manifest.jsonl"));
+    // The unmatched log file is not recorded
+    assert_eq!(manifest.record(&results).unwrap(), 2);
+
+    let mut traced = manifest.trace_rule("txt_rule").unwrap();
+    traced.sort_by(|a, b| a.original_path.cmp(&b.original_path));
+    assert_eq!(traced.len(), 2);
+    assert_eq!(traced[0].original_path, source.path().join("a.txt"));
+    assert_eq!(traced[0].current_path, Some(dest.path().join("a.txt")));
+    assert!(traced[0].exists());
+    assert_eq!(traced[1].current_path, Some(dest.path().join("b.txt")));
+
+    assert!(manifest.trace_rule("log_rule").unwrap().is_empty());
+}
+
+#[test]
+fn test_trace_rule_follows_later_actions() {
+    let data = tempdir().unwrap();
+    let manifest = Manifest::new(data.path().join("manifest.jsonl"));
+    manifest
+        .append(&[
+            entry("photos", "move", "/dl/a.jpg", "/photos/a.jpg"),
+            entry("photos", "rename", "/photos/a.jpg", "/photos/2025-a.jpg"),
+            entry("photos", "move", "/dl/b.jpg", "/photos/b.jpg"),
+            entry("docs", "move", "/dl/c.pdf", "/docs/c.pdf"),
+        ])
+        .unwrap();
+    // A later run by another rule moves one photo and deletes the other
+    manifest
+        .append(&[
+            entry(
+                "archive",
+                "move",
+                "/photos/2025-a.jpg",
+                "/archive/2025-a.jpg",
+            ),
+            entry("cleanup", "delete", "/photos/b.jpg", "[deleted]"),
+        ])
+        .unwrap();
+
+    let traced = manifest.trace_rule("photos").unwrap();
+    assert_eq!(traced.len(), 2);
+    assert_eq!(traced[0].original_path, PathBuf::from("/dl/a.jpg"));
+    assert_eq!(
+        traced[0].current_path,
+        Some(PathBuf::from("/archive/2025-a.jpg"))
+    );
+    assert_eq!(traced[1].original_path, PathBuf::from("/dl/b.jpg"));
+    assert_eq!(traced[1].current_path, None);
+    assert!(!traced[1].exists());
+
+    assert_eq!(manifest.trace_rule("archive").unwrap().len(), 1);
+}
+
+#[test]
+fn test_manifest_missing_or_malformed() {
+    let data = tempdir().unwrap();
+    let path = data.path().join("manifest.jsonl");
+    let manifest = Manifest::new(&path);
+    assert!(manifest.entries().unwrap().is_empty());
+
+    manifest
+        .append(&[entry("docs", "move", "/dl/c.pdf", "/docs/c.pdf")])
+        .unwrap();
+    let mut content = fs::read_to_string(&path).unwrap();
+    content.push_str("not json\n");
+    fs::write(&path, content).unwrap();
+
+    let entries = manifest.entries().unwrap();
+    assert_eq!(
+        entries,
+        vec![entry("docs", "move", "/dl/c.pdf", "/docs/c.pdf")]
+    );
+}
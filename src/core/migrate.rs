@@ -0,0 +1,51 @@
+//! Migration of configuration files written by older versions of Tooka.
+//!
+//! Every config records the version of its format in `version`. On load,
+//! [`migrate_config`] runs the migration steps from that version up to
+//! [`CONFIG_VERSION`], and the config is saved again if anything changed, so
+//! the file lists the settings added since it was written.
+
+use crate::{common::config::Config, core::context::CONFIG_VERSION, core::error::TookaError};
+
+/// A step migrating a config from one version to the next
+type Migration = fn(&mut Config) -> Result<(), TookaError>;
+
+/// Migration steps, where `MIGRATIONS[i]` migrates a version `i` config to version `i + 1`
+const MIGRATIONS: [Migration; CONFIG_VERSION] = [migrate_v0_to_v1];
+
+/// Migrates `config` to the current [`CONFIG_VERSION`].
+///
+/// A config from a newer version of Tooka is left alone with a warning; its
+/// unknown settings are ignored, and must not be dropped by saving it.
+///
+/// # Returns
+/// Whether the config changed and should be saved.
+///
+/// # Errors
+/// Returns a [`TookaError`] if a migration step fails.
+pub fn migrate_config(config: &mut Config) -> Result<bool, TookaError> {
+    if config.version > CONFIG_VERSION {
+        log::warn!(
+            "Config version {} is newer than this version of Tooka supports ({CONFIG_VERSION}); unknown settings are ignored",
+            config.version
+        );
+        return Ok(false);
+    }
+    if config.version == CONFIG_VERSION {
+        return Ok(false);
+    }
+
+    for (from, step) in MIGRATIONS.iter().enumerate().skip(config.version) {
+        log::info!("Migrating config from version {from} to {}", from + 1);
+        step(config)?;
+        config.version = from + 1;
+    }
+    Ok(true)
+}
+
+/// Version 0 configs predate the logging settings, tie breaking and sidecar
+/// grouping; these already get their defaults when the config is parsed, so
+/// the step only has to record them by bumping the version.
+fn migrate_v0_to_v1(_config: &mut Config) -> Result<(), TookaError> {
+    Ok(())
+}
@@ -0,0 +1,25 @@
+use super::context::CONFIG_VERSION;
+use super::migrate::migrate_config;
+use crate::common::config::{Config, LoggingConfig};
+
+#[test]
+fn test_old_config_is_migrated_with_defaults() {
+    let mut config: Config = serde_yaml::from_str("version: 0\ngroup_sidecars: true\n").unwrap();
+
+    assert!(migrate_config(&mut config).unwrap());
+    assert_eq!(config.version, CONFIG_VERSION);
+    assert!(config.group_sidecars);
+    assert_eq!(config.logging, LoggingConfig::default());
+
+    // Already current, so there is nothing to save
+    assert!(!migrate_config(&mut config).unwrap());
+}
+
+#[test]
+fn test_newer_config_is_left_alone() {
+    let mut config: Config =
+        serde_yaml::from_str("version: 99\nsetting_from_the_future: true\n").unwrap();
+
+    assert!(!migrate_config(&mut config).unwrap());
+    assert_eq!(config.version, 99);
+}
@@ -1,7 +1,57 @@
+pub mod confirm;
 pub mod context;
+pub mod coverage;
+pub mod dedupe;
 pub mod error;
+pub mod ignore;
+pub mod journal;
+pub mod manifest;
+pub mod migrate;
+pub mod network;
+pub mod plan;
+pub mod profiler;
 pub mod report;
+pub mod rule_stats;
+pub mod sidecar;
+pub mod simulate;
 pub mod sorter;
+pub mod throttle;
+pub mod tree;
+pub mod undo;
 
+#[cfg(test)]
+mod confirm_tests;
+#[cfg(test)]
+mod coverage_tests;
+#[cfg(test)]
+mod dedupe_tests;
+#[cfg(test)]
+mod ignore_tests;
+#[cfg(test)]
+mod journal_tests;
+#[cfg(test)]
+mod manifest_tests;
+#[cfg(test)]
+mod migrate_tests;
+#[cfg(test)]
+mod network_tests;
+#[cfg(test)]
+mod plan_tests;
+#[cfg(test)]
+mod profiler_tests;
+#[cfg(test)]
+mod report_tests;
+#[cfg(test)]
+mod rule_stats_tests;
+#[cfg(test)]
+mod sidecar_tests;
+#[cfg(test)]
+mod simulate_tests;
 #[cfg(test)]
 mod sorter_tests;
+#[cfg(test)]
+mod throttle_tests;
+#[cfg(test)]
+mod tree_tests;
+#[cfg(test)]
+mod undo_tests;
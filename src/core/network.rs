@@ -0,0 +1,234 @@
+//! Network destination handling for Tooka.
+//!
+//! Destinations on network mounts (NFS, SMB, ...) can drop out while a run is
+//! in progress or be unreachable before it starts. Before a run, the
+//! destinations of all rules are probed, and rules whose network destination
+//! cannot be written to are left out with a warning instead of failing
+//! partway through. During the run, moves, copies and quarantines failing
+//! with a transient error are retried a few times.
+
+use super::error::TookaError;
+use crate::{
+    file::file_ops,
+    rules::{rule::Action, rules_file::RulesFile},
+};
+use std::collections::HashMap;
+use std::fs::{self, OpenOptions};
+use std::io::{self, ErrorKind};
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+
+/// Number of times a file action failing with a transient error is retried
+pub const TRANSIENT_RETRIES: u32 = 3;
+
+/// Delay before the first retry; each further retry waits one delay longer
+const RETRY_DELAY: Duration = Duration::from_millis(100);
+
+/// Filesystem types, as listed in `/proc/mounts`, that are network mounts
+#[cfg(target_os = "linux")]
+const NETWORK_FILESYSTEMS: &[&str] = &[
+    "nfs",
+    "nfs4",
+    "cifs",
+    "smb3",
+    "smbfs",
+    "afs",
+    "9p",
+    "ceph",
+    "glusterfs",
+    "fuse.sshfs",
+    "fuse.rclone",
+];
+
+/// Name of the file written to check that a destination is writable
+const PROBE_FILE_NAME: &str = ".tooka-probe";
+
+/// Checks whether action destinations are reachable.
+pub trait DestinationProbe {
+    /// Returns true if `dir` is on a network mount and should be probed.
+    fn is_network(&self, dir: &Path) -> bool;
+
+    /// Checks that files can be written to `dir`.
+    ///
+    /// # Errors
+    /// Returns the error that prevented writing to `dir`.
+    fn check(&self, dir: &Path) -> io::Result<()>;
+}
+
+/// Probes destinations on the mounted filesystems.
+#[derive(Debug, Clone, Copy, Default)]
+pub struct MountProbe;
+
+impl DestinationProbe for MountProbe {
+    #[cfg(target_os = "linux")]
+    fn is_network(&self, dir: &Path) -> bool {
+        let Some(existing) = nearest_existing(dir) else {
+            return false;
+        };
+        let Ok(mounts) = fs::read_to_string("/proc/mounts") else {
+            return false;
+        };
+        // The mount closest to the folder decides, e.g. a NAS mounted below a local home
+        mounts
+            .lines()
+            .filter_map(|line| {
+                // Device, mount point and filesystem type lead each line
+                let mut fields = line.split_whitespace().skip(1);
+                let mount_point = fields.next()?;
+                let fs_type = fields.next()?;
+                Some((mount_point.replace("\\040", " "), fs_type))
+            })
+            .filter(|(mount_point, _)| existing.starts_with(mount_point))
+            .max_by_key(|(mount_point, _)| mount_point.len())
+            .is_some_and(|(_, fs_type)| NETWORK_FILESYSTEMS.contains(&fs_type))
+    }
+
+    /// Only UNC paths (`\\server\share`) are detected as network destinations.
+    #[cfg(windows)]
+    fn is_network(&self, dir: &Path) -> bool {
+        dir.to_string_lossy().starts_with(r"\\")
+    }
+
+    /// Network mounts are not detected on this platform.
+    #[cfg(not(any(target_os = "linux", windows)))]
+    fn is_network(&self, _dir: &Path) -> bool {
+        false
+    }
+
+    fn check(&self, dir: &Path) -> io::Result<()> {
+        // Destination folders are often created by the action itself
+        let existing = nearest_existing(dir)
+            .ok_or_else(|| io::Error::new(ErrorKind::NotFound, "no part of the path exists"))?;
+        let probe = existing.join(PROBE_FILE_NAME);
+        OpenOptions::new()
+            .write(true)
+            .create(true)
+            .truncate(true)
+            .open(&probe)?;
+        fs::remove_file(&probe)
+    }
+}
+
+/// Returns the nearest ancestor of `dir`, including itself, that exists
+fn nearest_existing(dir: &Path) -> Option<&Path> {
+    dir.ancestors().find(|p| p.is_dir())
+}
+
+/// A rule left out of a run because its destination could not be reached.
+#[derive(Debug, Clone)]
+pub struct SkippedRule {
+    /// ID of the rule.
+    pub rule_id: String,
+    /// Destination that failed the probe.
+    pub destination: PathBuf,
+    /// Why the probe failed.
+    pub reason: String,
+}
+
+/// Probes the network destinations of all rules and leaves out the rules
+/// with a destination that cannot be written to.
+///
+/// Each destination is probed once, however many rules use it. Local
+/// destinations are not probed.
+pub fn rules_with_reachable_destinations(
+    rules_file: &RulesFile,
+    probe: &impl DestinationProbe,
+) -> (RulesFile, Vec<SkippedRule>) {
+    let mut probed: HashMap<PathBuf, Option<String>> = HashMap::new();
+    let mut skipped = Vec::new();
+
+    let rules = rules_file
+        .rules
+        .iter()
+        .filter(|rule| {
+            let failure = rule
+                .then
+                .iter()
+                .filter_map(file_ops::destination_root)
+                .find_map(|destination| {
+                    let reason = probed
+                        .entry(destination.clone())
+                        .or_insert_with(|| {
+                            if !probe.is_network(&destination) {
+                                return None;
+                            }
+                            log::debug!("Probing network destination '{}'", destination.display());
+                            probe.check(&destination).err().map(|e| e.to_string())
+                        })
+                        .clone()?;
+                    Some((destination, reason))
+                });
+            let Some((destination, reason)) = failure else {
+                return true;
+            };
+            log::warn!(
+                "Skipping rule '{}': network destination '{}' is unreachable: {}",
+                rule.id,
+                destination.display(),
+                reason
+            );
+            skipped.push(SkippedRule {
+                rule_id: rule.id.clone(),
+                destination,
+                reason,
+            });
+            false
+        })
+        .cloned()
+        .collect();
+
+    (RulesFile { rules }, skipped)
+}
+
+/// Returns true if an I/O error is likely to go away when retried, as with a
+/// network mount that briefly disconnects.
+pub fn is_transient(error: &io::Error) -> bool {
+    matches!(
+        error.kind(),
+        ErrorKind::Interrupted
+            | ErrorKind::TimedOut
+            | ErrorKind::WouldBlock
+            | ErrorKind::ConnectionReset
+            | ErrorKind::ConnectionAborted
+            | ErrorKind::NotConnected
+            | ErrorKind::BrokenPipe
+            | ErrorKind::NetworkDown
+            | ErrorKind::NetworkUnreachable
+            | ErrorKind::HostUnreachable
+            | ErrorKind::StaleNetworkFileHandle
+    )
+}
+
+/// Returns true if `action` may run again after a transient error.
+///
+/// Moves, copies and quarantines only write their destination, so running
+/// them again is safe; other actions, such as commands and archives, could
+/// apply their side effects twice.
+pub fn is_retryable(action: &Action) -> bool {
+    matches!(
+        action,
+        Action::Move(_) | Action::Copy(_) | Action::Quarantine(_)
+    )
+}
+
+/// Runs `operation`, retrying it up to [`TRANSIENT_RETRIES`] times while it
+/// fails with a transient I/O error.
+///
+/// # Errors
+/// Returns the last error if the operation fails with a non-transient error
+/// or keeps failing after all retries.
+pub fn with_retries<T>(
+    mut operation: impl FnMut() -> Result<T, TookaError>,
+) -> Result<T, TookaError> {
+    let mut attempt = 0;
+    loop {
+        match operation() {
+            Err(TookaError::Io(e)) if attempt < TRANSIENT_RETRIES && is_transient(&e) => {
+                attempt += 1;
+                log::warn!("Transient error, retrying ({attempt}/{TRANSIENT_RETRIES}): {e}");
+                std::thread::sleep(RETRY_DELAY * attempt);
+            }
+            result => return result,
+        }
+    }
+}
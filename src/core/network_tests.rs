@@ -0,0 +1,143 @@
+use std::cell::RefCell;
+use std::io::{self, ErrorKind};
+use std::path::{Path, PathBuf};
+
+use super::error::TookaError;
+use super::network::{
+    DestinationProbe, MountProbe, TRANSIENT_RETRIES, is_retryable,
+    rules_with_reachable_destinations, with_retries,
+};
+use crate::rules::rule::{Action, Conditions, ConflictStrategy, CopyAction, MoveAction, Rule};
+use crate::rules::rules_file::RulesFile;
+use tempfile::tempdir;
+
+/// Probe treating paths below `/mnt/nas` as network destinations that are down
+#[derive(Default)]
+struct StubProbe {
+    probed: RefCell<Vec<PathBuf>>,
+}
+
+impl DestinationProbe for StubProbe {
+    fn is_network(&self, dir: &Path) -> bool {
+        dir.starts_with("/mnt/nas")
+    }
+
+    fn check(&self, dir: &Path) -> io::Result<()> {
+        self.probed.borrow_mut().push(dir.to_path_buf());
+        Err(io::Error::new(ErrorKind::TimedOut, "mount not responding"))
+    }
+}
+
+fn rule(id: &str, action: Action) -> Rule {
+    Rule {
+        id: id.to_string(),
+        name: format!("Rule {id}"),
+        enabled: true,
+        description: None,
+        priority: 1,
+        max_per_run: None,
+        stop_on_match: true,
+        when: Conditions::default(),
+        then: vec![action],
+    }
+}
+
+fn move_to(to: &str) -> Action {
+    Action::Move(MoveAction {
+        to: to.to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
+    })
+}
+
+#[test]
+fn test_rules_with_unreachable_network_destination_are_skipped() {
+    let rules_file = RulesFile {
+        rules: vec![
+            rule("nas_photos", move_to("/mnt/nas/photos/{parent}")),
+            rule("local", move_to("/home/user/Documents")),
+            rule(
+                "nas_backup",
+                Action::Copy(CopyAction {
+                    to: "/mnt/nas/photos/".to_string(),
+                    preserve_structure: true,
+                    dir_mode: None,
+                    path_template: None,
+                    preserve_metadata: true,
+                }),
+            ),
+            rule("skip", Action::Skip),
+        ],
+    };
+    let probe = StubProbe::default();
+
+    let (reachable, skipped) = rules_with_reachable_destinations(&rules_file, &probe);
+
+    let kept: Vec<_> = reachable.rules.iter().map(|r| r.id.as_str()).collect();
+    assert_eq!(kept, vec!["local", "skip"]);
+    let skipped_ids: Vec<_> = skipped.iter().map(|s| s.rule_id.as_str()).collect();
+    assert_eq!(skipped_ids, vec!["nas_photos", "nas_backup"]);
+    assert_eq!(skipped[0].destination, PathBuf::from("/mnt/nas/photos/"));
+    assert!(skipped[0].reason.contains("mount not responding"));
+    // Both rules share a destination, which is probed only once
+    assert_eq!(probe.probed.borrow().len(), 1);
+}
+
+#[test]
+fn test_mount_probe_checks_writability_of_nearest_existing_folder() {
+    let dir = tempdir().unwrap();
+    MountProbe
+        .check(&dir.path().join("not/created/yet"))
+        .unwrap();
+    assert_eq!(std::fs::read_dir(dir.path()).unwrap().count(), 0);
+}
+
+#[test]
+fn test_with_retries_retries_only_transient_errors() {
+    let mut attempts = 0;
+    let result = with_retries(|| {
+        attempts += 1;
+        if attempts < 3 {
+            Err(TookaError::Io(io::Error::from(ErrorKind::TimedOut)))
+        } else {
+            Ok(attempts)
+        }
+    });
+    assert_eq!(result.unwrap(), 3);
+
+    let mut attempts = 0;
+    let result: Result<(), _> = with_retries(|| {
+        attempts += 1;
+        Err(TookaError::Io(io::Error::from(ErrorKind::PermissionDenied)))
+    });
+    assert!(result.is_err());
+    assert_eq!(attempts, 1);
+
+    let mut attempts = 0;
+    let result: Result<(), _> = with_retries(|| {
+        attempts += 1;
+        Err(TookaError::Io(io::Error::from(ErrorKind::ConnectionReset)))
+    });
+    assert!(result.is_err());
+    assert_eq!(attempts, TRANSIENT_RETRIES + 1);
+}
+
+#[test]
+fn test_only_destination_actions_are_retried() {
+    assert!(is_retryable(&move_to("/archive")));
+    for yaml in ["action: quarantine\ndays: 30", "action: copy\nto: /backup"] {
+        let action: Action = serde_yaml::from_str(yaml).unwrap();
+        assert!(is_retryable(&action), "{yaml}");
+    }
+    for yaml in [
+        "action: execute\ncommand: notify-send\nargs: []",
+        "action: compress\ntarget: /archive/files.zip",
+        "action: delete",
+        "action: rename\nto: \"{filename}\"",
+    ] {
+        let action: Action = serde_yaml::from_str(yaml).unwrap();
+        assert!(!is_retryable(&action), "{yaml}");
+    }
+}
@@ -0,0 +1,137 @@
+//! Stable dry-run plans for Tooka.
+//!
+//! Renders the results of a dry run as YAML that only changes when the plan
+//! itself changes, so it can be committed and reviewed like code. Files are
+//! listed in path order regardless of the order they were processed in, and
+//! paths are written relative to the source folder or the home directory with
+//! `/` separators, so plans of the same folder match across runs and machines.
+
+use crate::core::{error::TookaError, sorter::MatchResult};
+use serde::Serialize;
+use std::path::{Component, Path};
+
+/// A planned sorting run
+#[derive(Debug, Serialize)]
+struct Plan {
+    /// Source folder of the run; relative paths in the plan are relative to it
+    source: String,
+    files: Vec<PlannedFile>,
+}
+
+/// The actions planned for a single file, in the order they would run
+#[derive(Debug, Serialize)]
+struct PlannedFile {
+    path: String,
+    rule: String,
+    actions: Vec<PlannedAction>,
+}
+
+#[derive(Debug, Serialize)]
+struct PlannedAction {
+    action: String,
+    /// Where the file would end up, if the action places it somewhere new
+    #[serde(skip_serializing_if = "Option::is_none")]
+    to: Option<String>,
+}
+
+/// Renders dry-run results as a deterministic YAML plan.
+///
+/// Files no rule matched are left out. `home` is the home directory used to
+/// shorten paths outside the source folder to `~/...`.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the plan cannot be serialized.
+pub fn render_stable_plan(
+    results: &[MatchResult],
+    source: &Path,
+    home: Option<&Path>,
+) -> Result<String, TookaError> {
+    let normalize = |path: &Path| normalize_path(path, source, home);
+
+    let mut files: Vec<PlannedFile> = group_by_file(results)
+        .into_iter()
+        .filter(|group| group[0].matched_rule_id != "none")
+        .map(|group| PlannedFile {
+            path: normalize(&group[0].current_path),
+            rule: group[0].matched_rule_id.clone(),
+            actions: group
+                .iter()
+                .map(|r| PlannedAction {
+                    action: r.action.clone(),
+                    to: (r.action != "delete"
+                        && r.action != "trash"
+                        && r.new_path != r.current_path)
+                        .then(|| normalize(&r.new_path)),
+                })
+                .collect(),
+        })
+        .collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path).then_with(|| a.rule.cmp(&b.rule)));
+
+    let plan = Plan {
+        source: home
+            .and_then(|h| source.strip_prefix(h).ok())
+            .map_or_else(|| join_components(source), home_relative),
+        files,
+    };
+    Ok(serde_yaml::to_string(&plan)?)
+}
+
+/// Splits results into the runs of consecutive results belonging to one file.
+///
+/// The actions of a file are reported together, each starting where the
+/// previous one left the file.
+fn group_by_file(results: &[MatchResult]) -> Vec<&[MatchResult]> {
+    let mut groups = Vec::new();
+    let mut start = 0;
+    for i in 1..=results.len() {
+        let continues = results.get(i).is_some_and(|r| {
+            let prev = &results[i - 1];
+            r.file_name == prev.file_name
+                && r.matched_rule_id == prev.matched_rule_id
+                && r.current_path == prev.new_path
+        });
+        if !continues {
+            groups.push(&results[start..i]);
+            start = i;
+        }
+    }
+    groups
+}
+
+/// Writes a path relative to the source folder or home directory when inside them
+fn normalize_path(path: &Path, source: &Path, home: Option<&Path>) -> String {
+    if let Ok(rel) = path.strip_prefix(source) {
+        return join_components(rel);
+    }
+    if let Some(rel) = home.and_then(|h| path.strip_prefix(h).ok()) {
+        return home_relative(rel);
+    }
+    join_components(path)
+}
+
+fn home_relative(rel: &Path) -> String {
+    if rel.as_os_str().is_empty() {
+        "~".to_string()
+    } else {
+        format!("~/{}", join_components(rel))
+    }
+}
+
+/// Joins the components of a path with `/`, whatever the platform separator
+fn join_components(path: &Path) -> String {
+    let mut out = String::new();
+    for component in path.components() {
+        match component {
+            Component::RootDir => out.push('/'),
+            Component::Prefix(prefix) => out.push_str(&prefix.as_os_str().to_string_lossy()),
+            other => {
+                if !out.is_empty() && !out.ends_with('/') {
+                    out.push('/');
+                }
+                out.push_str(&other.as_os_str().to_string_lossy());
+            }
+        }
+    }
+    out
+}
@@ -0,0 +1,121 @@
+use std::path::{Path, PathBuf};
+
+use super::plan::render_stable_plan;
+use super::sorter::MatchResult;
+
+fn result(rule: &str, action: &str, current: &str, new: &str) -> MatchResult {
+    let current_path = PathBuf::from(current);
+    MatchResult {
+        file_name: current_path
+            .file_name()
+            .unwrap()
+            .to_string_lossy()
+            .to_string(),
+        action: action.to_string(),
+        matched_rule_id: rule.to_string(),
+        current_path,
+        new_path: PathBuf::from(new),
+        conflict: None,
+        error: None,
+        size: None,
+    }
+}
+
+fn sample_results() -> Vec<MatchResult> {
+    vec![
+        result(
+            "docs",
+            "move",
+            "/home/u/Downloads/b.pdf",
+            "/home/u/Documents/b.pdf",
+        ),
+        result(
+            "none",
+            "skip",
+            "/home/u/Downloads/x.bin",
+            "/home/u/Downloads/x.bin",
+        ),
+        result(
+            "photos",
+            "copy",
+            "/home/u/Downloads/a.jpg",
+            "/mnt/backup/a.jpg",
+        ),
+        result(
+            "photos",
+            "rename",
+            "/mnt/backup/a.jpg",
+            "/mnt/backup/photo_a.jpg",
+        ),
+        result(
+            "cleanup",
+            "delete",
+            "/home/u/Downloads/sub/old.tmp",
+            "[deleted]",
+        ),
+    ]
+}
+
+#[test]
+fn test_stable_plan_is_independent_of_processing_order() {
+    let source = Path::new("/home/u/Downloads");
+    let home = Some(Path::new("/home/u"));
+    let results = sample_results();
+
+    // Files finish in any order when sorted in parallel; their own actions stay together
+    let mut reordered = vec![results[4].clone(), results[2].clone(), results[3].clone()];
+    reordered.extend_from_slice(&results[..2]);
+
+    let first = render_stable_plan(&results, source, home).unwrap();
+    let second = render_stable_plan(&reordered, source, home).unwrap();
+    let again = render_stable_plan(&results, source, home).unwrap();
+    assert_eq!(first.as_bytes(), second.as_bytes());
+    assert_eq!(first.as_bytes(), again.as_bytes());
+}
+
+#[test]
+fn test_stable_plan_normalizes_paths() {
+    let plan: serde_json::Value = serde_yaml::from_str(
+        &render_stable_plan(
+            &sample_results(),
+            Path::new("/home/u/Downloads"),
+            Some(Path::new("/home/u")),
+        )
+        .unwrap(),
+    )
+    .unwrap();
+
+    assert_eq!(plan["source"], "~/Downloads");
+    let files = plan["files"].as_array().unwrap();
+    let paths: Vec<_> = files.iter().map(|f| f["path"].as_str().unwrap()).collect();
+    // Unmatched files are left out
+    assert_eq!(paths, vec!["a.jpg", "b.pdf", "sub/old.tmp"]);
+
+    let copy_then_rename = &files[0]["actions"];
+    assert_eq!(copy_then_rename[0]["to"], "/mnt/backup/a.jpg");
+    assert_eq!(copy_then_rename[1]["to"], "/mnt/backup/photo_a.jpg");
+    assert_eq!(files[1]["actions"][0]["to"], "~/Documents/b.pdf");
+    assert!(files[2]["actions"][0].get("to").is_none());
+}
+
+#[test]
+fn test_stable_plan_of_machine_specific_home() {
+    let results = |home: &str| {
+        vec![result(
+            "docs",
+            "move",
+            &format!("{home}/Downloads/b.pdf"),
+            &format!("{home}/Documents/b.pdf"),
+        )]
+    };
+    let render = |home: &str| {
+        render_stable_plan(
+            &results(home),
+            &Path::new(home).join("Downloads"),
+            Some(Path::new(home)),
+        )
+        .unwrap()
+    };
+
+    assert_eq!(render("/home/alice"), render("/Users/bob"));
+}
@@ -0,0 +1,142 @@
+//! Rule evaluation profiling for Tooka.
+//!
+//! This module evaluates rules against a set of files without executing any
+//! actions and records how much time is spent reading file metadata versus
+//! matching conditions, both in total and per rule. It backs the `bench`
+//! command and is meant to help users find slow rules before running a sort.
+
+use crate::{
+    file::file_match::{self, ExtensionLists},
+    rules::rule::Rule,
+};
+use std::fs;
+use std::path::PathBuf;
+use std::time::{Duration, Instant};
+
+/// Timing statistics for a single rule.
+#[derive(Debug, Clone, serde::Serialize)]
+pub struct RuleProfile {
+    /// ID of the profiled rule.
+    pub rule_id: String,
+    /// Number of files the rule was evaluated against.
+    pub evaluations: usize,
+    /// Number of files the rule matched.
+    pub matches: usize,
+    /// Total time spent evaluating the rule's conditions.
+    pub total_time: Duration,
+}
+
+impl RuleProfile {
+    /// Average time spent evaluating the rule against one file.
+    pub fn average_time(&self) -> Duration {
+        if self.evaluations == 0 {
+            return Duration::ZERO;
+        }
+        self.total_time / self.evaluations as u32
+    }
+}
+
+/// Aggregated results of profiling a rule set over a list of files.
+#[derive(Debug, Clone, serde::Serialize)]
+pub struct ProfileReport {
+    /// Number of files evaluated.
+    pub files_scanned: usize,
+    /// Number of files matched by at least one rule.
+    pub files_matched: usize,
+    /// Wall-clock time of the whole evaluation.
+    pub total_time: Duration,
+    /// Time spent reading file metadata.
+    pub metadata_time: Duration,
+    /// Time spent matching rule conditions.
+    pub matching_time: Duration,
+    /// Per-rule statistics, in rule order.
+    pub rules: Vec<RuleProfile>,
+}
+
+impl ProfileReport {
+    /// Number of files evaluated per second of wall-clock time.
+    pub fn files_per_second(&self) -> f64 {
+        let secs = self.total_time.as_secs_f64();
+        if secs == 0.0 {
+            return 0.0;
+        }
+        self.files_scanned as f64 / secs
+    }
+
+    /// Returns the `limit` rules with the highest total evaluation time.
+    pub fn slowest_rules(&self, limit: usize) -> Vec<&RuleProfile> {
+        let mut sorted: Vec<&RuleProfile> = self.rules.iter().collect();
+        sorted.sort_by(|a, b| b.total_time.cmp(&a.total_time));
+        sorted.truncate(limit);
+        sorted
+    }
+}
+
+/// Evaluates every rule against every file and records timing statistics.
+///
+/// Unlike sorting, all rules are evaluated for each file (no early exit on the
+/// first match) so that every rule gets a complete profile. No actions are run.
+pub fn profile_rules(
+    files: &[PathBuf],
+    rules: &[Rule],
+    extension_lists: &ExtensionLists,
+) -> ProfileReport {
+    let start = Instant::now();
+
+    let mut profiles: Vec<RuleProfile> = rules
+        .iter()
+        .map(|rule| RuleProfile {
+            rule_id: rule.id.clone(),
+            evaluations: 0,
+            matches: 0,
+            total_time: Duration::ZERO,
+        })
+        .collect();
+
+    let mut metadata_time = Duration::ZERO;
+    let mut matching_time = Duration::ZERO;
+    let mut files_matched = 0;
+
+    for file_path in files {
+        let metadata_start = Instant::now();
+        let metadata = fs::symlink_metadata(file_path);
+        metadata_time += metadata_start.elapsed();
+
+        let metadata = match metadata {
+            Ok(m) => m,
+            Err(e) => {
+                log::warn!("Failed to read metadata for {}: {}", file_path.display(), e);
+                continue;
+            }
+        };
+
+        let mut matched_any = false;
+        for (rule, profile) in rules.iter().zip(profiles.iter_mut()) {
+            let rule_start = Instant::now();
+            let is_match =
+                file_match::match_conditions(file_path, &metadata, &rule.when, extension_lists);
+            let elapsed = rule_start.elapsed();
+
+            profile.evaluations += 1;
+            profile.total_time += elapsed;
+            matching_time += elapsed;
+            if is_match {
+                profile.matches += 1;
+                matched_any = true;
+            }
+        }
+
+        if matched_any {
+            files_matched += 1;
+        }
+    }
+
+    ProfileReport {
+        files_scanned: files.len(),
+        files_matched,
+        total_time: start.elapsed(),
+        metadata_time,
+        matching_time,
+        rules: profiles,
+    }
+}
@@ -0,0 +1,101 @@
+use std::fs;
+use std::time::Duration;
+
+use super::profiler::profile_rules;
+use crate::core::sorter::collect_files;
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rule::{Action, DeleteAction, Rule};
+use crate::rules::test_support::extension_rule;
+use tempfile::tempdir;
+
+#[test]
+fn test_profile_rules_populates_metrics() {
+    let dir = tempdir().unwrap();
+    for name in ["a.txt", "b.txt", "c.log", "d.bin"] {
+        fs::write(dir.path().join(name), "content").unwrap();
+    }
+
+    let files = collect_files(dir.path()).unwrap();
+    let rules = vec![
+        extension_rule("txt_rule", &["txt"]),
+        extension_rule("log_rule", &["log"]),
+    ];
+
+    let report = profile_rules(&files, &rules, &ExtensionLists::default());
+
+    assert_eq!(report.files_scanned, 4);
+    assert_eq!(report.files_matched, 3);
+    assert_eq!(report.rules.len(), 2);
+    assert!(report.total_time > Duration::ZERO);
+    assert!(report.total_time >= report.matching_time);
+    assert!(report.files_per_second() > 0.0);
+
+    let txt = report
+        .rules
+        .iter()
+        .find(|r| r.rule_id == "txt_rule")
+        .unwrap();
+    assert_eq!(txt.evaluations, 4);
+    assert_eq!(txt.matches, 2);
+
+    let log = report
+        .rules
+        .iter()
+        .find(|r| r.rule_id == "log_rule")
+        .unwrap();
+    assert_eq!(log.evaluations, 4);
+    assert_eq!(log.matches, 1);
+}
+
+#[test]
+fn test_profile_rules_does_not_touch_files() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("keep.txt");
+    fs::write(&file, "content").unwrap();
+
+    let mut rule = extension_rule("txt_rule", &["txt"]);
+    rule.then = vec![Action::Delete(DeleteAction {
+        trash: false,
+        secure: false,
+        passes: None,
+    })];
+
+    let report = profile_rules(
+        std::slice::from_ref(&file),
+        &[rule],
+        &ExtensionLists::default(),
+    );
+
+    assert_eq!(report.rules[0].matches, 1);
+    assert!(file.exists(), "profiling must never execute actions");
+}
+
+#[test]
+fn test_slowest_rules_is_limited_and_sorted() {
+    let dir = tempdir().unwrap();
+    fs::write(dir.path().join("a.txt"), "content").unwrap();
+    let files = collect_files(dir.path()).unwrap();
+
+    let rules: Vec<Rule> = (0..4)
+        .map(|i| extension_rule(&format!("rule_{i}"), &["txt"]))
+        .collect();
+    let report = profile_rules(&files, &rules, &ExtensionLists::default());
+
+    let slowest = report.slowest_rules(2);
+    assert_eq!(slowest.len(), 2);
+    assert!(slowest[0].total_time >= slowest[1].total_time);
+}
+
+#[test]
+fn test_profile_rules_empty_file_list() {
+    let report = profile_rules(
+        &[],
+        &[extension_rule("txt_rule", &["txt"])],
+        &ExtensionLists::default(),
+    );
+
+    assert_eq!(report.files_scanned, 0);
+    assert_eq!(report.files_matched, 0);
+    assert_eq!(report.rules[0].average_time(), Duration::ZERO);
+    assert_eq!(report.files_per_second(), 0.0);
+}
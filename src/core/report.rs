@@ -1,14 +1,179 @@
 //! Report generation module for Tooka.
 //!
-//! Supports creating reports in JSON, CSV, and PDF formats from sorting results.
+//! Supports creating reports in JSON, CSV, and PDF formats from sorting results,
+//! and [`RunReport`]s: an audit record of every file a run processed, written
+//! even if the run fails part way.
 
-use crate::{core::error::TookaError, core::sorter::MatchResult, utils::gen_pdf::generate_pdf};
+use crate::{
+    core::error::TookaError,
+    core::sorter::{DEFERRED_ACTION, FAILED_ACTION, MatchResult},
+    utils::gen_pdf::generate_pdf,
+};
 use anyhow::Result;
+use chrono::{DateTime, Local};
+use serde::{Deserialize, Serialize};
 use std::{
     fs::{File, create_dir_all},
-    path::Path,
+    path::{Path, PathBuf},
 };
 
+/// Formats a [`RunReport`] can be written in
+pub const RUN_REPORT_FORMATS: &[&str] = &["json", "csv"];
+
+/// Machine-readable record of a sorting run.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct RunReport {
+    /// Folder that was sorted.
+    pub source: PathBuf,
+    /// Whether the run only planned its actions.
+    pub dry_run: bool,
+    /// When the run started, in RFC 3339 format.
+    pub started: String,
+    /// When the report was written, in RFC 3339 format.
+    pub finished: String,
+    /// Error that stopped the run before all files were processed.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+    /// One entry per action taken or planned, and per file that failed.
+    pub entries: Vec<ReportEntry>,
+}
+
+/// A file processed by a run, as recorded in a [`RunReport`].
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct ReportEntry {
+    /// Path of the file before the action.
+    pub source: PathBuf,
+    /// Action taken, e.g. `move` or `delete`.
+    pub action: String,
+    /// Path of the file after the action.
+    pub destination: PathBuf,
+    /// ID of the rule that matched, `none` if no rule did.
+    pub rule_id: String,
+    /// Outcome of the action.
+    pub status: ReportStatus,
+    /// Why the file failed.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+/// Outcome of an action recorded in a [`RunReport`].
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum ReportStatus {
+    /// Would be taken; the run was a dry run.
+    Planned,
+    /// Was taken.
+    Done,
+    /// No action was needed.
+    Skipped,
+    /// Left for a later run by a rule's `max_per_run`.
+    Deferred,
+    /// Failed, see the entry's error.
+    Failed,
+}
+
+impl RunReport {
+    /// Starts an empty report of a run over `source`.
+    pub fn new(source: &Path, dry_run: bool, started: DateTime<Local>) -> Self {
+        Self {
+            source: source.to_path_buf(),
+            dry_run,
+            started: started.to_rfc3339(),
+            finished: started.to_rfc3339(),
+            error: None,
+            entries: Vec::new(),
+        }
+    }
+
+    /// Records the results of processed files.
+    pub fn record_results(&mut self, results: &[MatchResult]) {
+        for result in results {
+            let status = match result.action.as_str() {
+                "skip" | "keep" => ReportStatus::Skipped,
+                DEFERRED_ACTION => ReportStatus::Deferred,
+                FAILED_ACTION => ReportStatus::Failed,
+                _ if self.dry_run => ReportStatus::Planned,
+                _ => ReportStatus::Done,
+            };
+            self.entries.push(ReportEntry {
+                source: result.current_path.clone(),
+                action: result.action.clone(),
+                destination: result.new_path.clone(),
+                rule_id: result.matched_rule_id.clone(),
+                status,
+                error: result.error.clone(),
+            });
+        }
+    }
+
+    /// Records the error that stopped the run, as a failed entry if it names a file.
+    pub fn record_error(&mut self, error: &TookaError) {
+        if let TookaError::FileFailed(path, cause) = error {
+            self.entries.push(ReportEntry {
+                source: path.clone(),
+                action: "none".to_string(),
+                destination: path.clone(),
+                rule_id: "none".to_string(),
+                status: ReportStatus::Failed,
+                error: Some(cause.to_string()),
+            });
+        }
+        self.error = Some(error.to_string());
+    }
+
+    /// Writes the report to `path` as `json` or `csv`, marking it finished at `finished`.
+    ///
+    /// CSV reports hold one row per entry; the run itself is only described
+    /// by JSON reports.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the format is not supported or the file cannot be written.
+    pub fn write(
+        &mut self,
+        path: &Path,
+        format: &str,
+        finished: DateTime<Local>,
+    ) -> Result<(), TookaError> {
+        self.finished = finished.to_rfc3339();
+        if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+            create_dir_all(parent)?;
+        }
+
+        match format.to_lowercase().as_str() {
+            "json" => serde_json::to_writer_pretty(File::create(path)?, self)?,
+            "csv" => {
+                let mut wtr = csv::Writer::from_path(path)?;
+                wtr.write_record([
+                    "source",
+                    "action",
+                    "destination",
+                    "rule_id",
+                    "status",
+                    "error",
+                ])?;
+                for entry in &self.entries {
+                    wtr.serialize((
+                        entry.source.display().to_string(),
+                        &entry.action,
+                        entry.destination.display().to_string(),
+                        &entry.rule_id,
+                        entry.status,
+                        entry.error.as_deref().unwrap_or_default(),
+                    ))?;
+                }
+                wtr.flush()?;
+            }
+            other => {
+                return Err(TookaError::Other(format!(
+                    "Unsupported run report format: {other}, expected one of: {}",
+                    RUN_REPORT_FORMATS.join(", ")
+                )));
+            }
+        }
+        Ok(())
+    }
+}
+
 /// Generates a report from sorting results in the specified format.
 ///
 /// Supported formats are `"json"`, `"csv"`, and `"pdf"`. The generated report
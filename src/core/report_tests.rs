@@ -0,0 +1,165 @@
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use super::error::TookaError;
+use super::report::{ReportStatus, RunReport};
+use super::sorter::{
+    DEFERRED_ACTION, FAILED_ACTION, MatchResult, SortOptions, SortSummary, sort_files,
+};
+use crate::rules::{
+    rule::{Action, Conditions, ConflictStrategy, MoveAction, Rule},
+    rules_file::RulesFile,
+};
+use chrono::{Local, TimeZone};
+use tempfile::tempdir;
+
+fn result(action: &str, current: &str, new: &str) -> MatchResult {
+    MatchResult {
+        file_name: Path::new(current)
+            .file_name()
+            .unwrap()
+            .to_string_lossy()
+            .to_string(),
+        action: action.to_string(),
+        matched_rule_id: "rule".to_string(),
+        current_path: PathBuf::from(current),
+        new_path: PathBuf::from(new),
+        conflict: None,
+        error: None,
+        size: None,
+    }
+}
+
+#[test]
+fn test_run_report_records_statuses() {
+    let started = Local.with_ymd_and_hms(2024, 5, 6, 7, 8, 9).unwrap();
+    let results = [
+        result("move", "/in/a.pdf", "/out/a.pdf"),
+        result("skip", "/in/b.txt", "/in/b.txt"),
+        result(DEFERRED_ACTION, "/in/c.pdf", "/in/c.pdf"),
+    ];
+
+    let mut report = RunReport::new(Path::new("/in"), false, started);
+    report.record_results(&results);
+    let statuses: Vec<_> = report.entries.iter().map(|e| e.status).collect();
+    assert_eq!(
+        statuses,
+        vec![
+            ReportStatus::Done,
+            ReportStatus::Skipped,
+            ReportStatus::Deferred
+        ]
+    );
+    assert_eq!(report.entries[0].destination, PathBuf::from("/out/a.pdf"));
+
+    let mut planned = RunReport::new(Path::new("/in"), true, started);
+    planned.record_results(&results[..1]);
+    assert_eq!(planned.entries[0].status, ReportStatus::Planned);
+}
+
+#[test]
+fn test_run_report_written_as_json_and_csv() {
+    let dir = tempdir().unwrap();
+    let started = Local.with_ymd_and_hms(2024, 5, 6, 7, 8, 9).unwrap();
+    let mut report = RunReport::new(Path::new("/in"), false, started);
+    report.record_results(&[result("move", "/in/a.pdf", "/out/a.pdf")]);
+    report.record_error(&TookaError::FileFailed(
+        PathBuf::from("/in/b.pdf"),
+        Box::new(TookaError::FileOperationError("disk full".to_string())),
+    ));
+
+    let json_path = dir.path().join("reports").join("run.json");
+    report.write(&json_path, "json", started).unwrap();
+    let read: RunReport = serde_json::from_str(&fs::read_to_string(&json_path).unwrap()).unwrap();
+    assert_eq!(read, report);
+    assert_eq!(read.entries[1].status, ReportStatus::Failed);
+    assert_eq!(
+        read.entries[1].error.as_deref(),
+        Some("File operation error: disk full")
+    );
+    assert!(read.error.unwrap().contains("/in/b.pdf"));
+
+    let csv_path = dir.path().join("run.csv");
+    report.write(&csv_path, "csv", started).unwrap();
+    let csv = fs::read_to_string(&csv_path).unwrap();
+    let lines: Vec<_> = csv.lines().collect();
+    assert_eq!(lines[0], "source,action,destination,rule_id,status,error");
+    assert_eq!(lines[1], "/in/a.pdf,move,/out/a.pdf,rule,done,");
+    assert_eq!(
+        lines[2],
+        "/in/b.pdf,none,/in/b.pdf,none,failed,File operation error: disk full"
+    );
+
+    assert!(report.write(&csv_path, "pdf", started).is_err());
+}
+
+#[test]
+fn test_failing_file_is_reported_and_the_run_continues() {
+    let dir = tempdir().unwrap();
+    let source = dir.path().join("source");
+    fs::create_dir(&source).unwrap();
+    let pdf = source.join("a.pdf");
+    fs::write(&pdf, "content").unwrap();
+    let txt = source.join("b.txt");
+    fs::write(&txt, "content").unwrap();
+    // A file where the destination folder of PDFs should be
+    let blocker = dir.path().join("blocker");
+    fs::write(&blocker, "").unwrap();
+
+    let move_rule = |id: &str, extension: &str, to: PathBuf| Rule {
+        id: id.to_string(),
+        name: format!("Move {id}"),
+        enabled: true,
+        description: None,
+        priority: 1,
+        max_per_run: None,
+        stop_on_match: true,
+        when: Conditions {
+            extensions: Some(vec![extension.to_string()]),
+            ..Default::default()
+        },
+        then: vec![Action::Move(MoveAction {
+            to: to.to_string_lossy().to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            on_conflict: ConflictStrategy::default(),
+        })],
+    };
+    let rules_file = RulesFile {
+        rules: vec![
+            move_rule("pdfs", "pdf", blocker.join("pdfs")),
+            move_rule("texts", "txt", dir.path().join("texts")),
+        ],
+    };
+    let results = sort_files(
+        &[pdf.clone(), txt.clone()],
+        &source,
+        &rules_file,
+        &SortOptions::default(),
+        |_, _| {},
+    )
+    .unwrap();
+
+    assert_eq!(results.len(), 2);
+    assert_eq!(results[0].action, FAILED_ACTION);
+    assert_eq!(results[0].current_path, pdf);
+    assert!(pdf.exists());
+    assert_eq!(results[1].action, "move");
+    assert!(dir.path().join("texts").join("b.txt").exists());
+
+    let summary = SortSummary::from_results(&results);
+    assert_eq!(summary.errors, 1);
+    assert_eq!(summary.moved, 1);
+
+    let mut report = RunReport::new(&source, false, Local::now());
+    report.record_results(&results);
+    let failed: Vec<_> = report
+        .entries
+        .iter()
+        .filter(|entry| entry.status == ReportStatus::Failed)
+        .collect();
+    assert_eq!(failed.len(), 1);
+    assert_eq!(failed[0].source, pdf);
+    assert!(failed[0].error.is_some());
+}
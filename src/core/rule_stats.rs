@@ -0,0 +1,105 @@
+//! Per-rule statistics for Tooka.
+//!
+//! Cumulative counters of how often each rule matched and acted, kept in a
+//! JSON file next to the rules file and updated after every (non dry-run)
+//! sort. Counters are keyed by rule ID, so they survive edits to the rules
+//! file; rules that are removed simply stop being updated.
+
+use crate::{
+    common::config::Config,
+    core::{
+        context::RULE_STATS_FILE_NAME,
+        error::TookaError,
+        sorter::{DEFERRED_ACTION, MatchResult},
+    },
+};
+use chrono::{DateTime, Local};
+use serde::{Deserialize, Serialize};
+use std::{
+    collections::BTreeMap,
+    fs,
+    path::{Path, PathBuf},
+};
+
+/// Cumulative counters of a single rule.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct RuleStats {
+    /// Files the rule matched, including files deferred by `max_per_run`.
+    pub files_matched: u64,
+    /// Actions the rule performed, not counting skips.
+    pub actions_applied: u64,
+    /// Time the rule last performed an action, in RFC 3339 format.
+    pub last_fired: Option<String>,
+}
+
+/// Statistics of all rules, persisted across runs.
+#[derive(Debug, Clone)]
+pub struct RuleStatsStore {
+    path: PathBuf,
+}
+
+impl RuleStatsStore {
+    /// Creates a statistics store at the given path.
+    pub fn new(path: impl Into<PathBuf>) -> Self {
+        Self { path: path.into() }
+    }
+
+    /// Creates the statistics store next to the configured rules file.
+    pub fn from_config(config: &Config) -> Self {
+        let dir = config.rules_file.parent().unwrap_or_else(|| Path::new("."));
+        Self::new(dir.join(RULE_STATS_FILE_NAME))
+    }
+
+    /// Loads the statistics of all rules; a missing file has none.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the file exists but cannot be read or parsed.
+    pub fn load(&self) -> Result<BTreeMap<String, RuleStats>, TookaError> {
+        if !self.path.exists() {
+            return Ok(BTreeMap::new());
+        }
+        let content = fs::read_to_string(&self.path)?;
+        Ok(serde_json::from_str(&content)?)
+    }
+
+    /// Adds the results of a sorting run to the stored counters.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the statistics cannot be read or written.
+    pub fn record(&self, results: &[MatchResult], now: DateTime<Local>) -> Result<(), TookaError> {
+        let mut stats = self.load()?;
+        let timestamp = now.to_rfc3339();
+
+        let mut previous: Option<&MatchResult> = None;
+        for result in results {
+            // Actions of one file follow each other, each starting where the last ended
+            let same_file = previous.is_some_and(|p| {
+                p.matched_rule_id == result.matched_rule_id && p.new_path == result.current_path
+            });
+            previous = Some(result);
+            if result.matched_rule_id == "none" {
+                continue;
+            }
+
+            let rule = stats.entry(result.matched_rule_id.clone()).or_default();
+            if !same_file {
+                rule.files_matched += 1;
+            }
+            if result.action != "skip" && result.action != DEFERRED_ACTION {
+                rule.actions_applied += 1;
+                rule.last_fired = Some(timestamp.clone());
+            }
+        }
+
+        if let Some(parent) = self.path.parent() {
+            fs::create_dir_all(parent)?;
+        }
+        fs::write(&self.path, serde_json::to_string_pretty(&stats)?)?;
+        log::debug!(
+            "Updated statistics of {} rules in '{}'",
+            stats.len(),
+            self.path.display()
+        );
+        Ok(())
+    }
+}
@@ -0,0 +1,100 @@
+use std::fs;
+use std::path::Path;
+
+use super::rule_stats::{RuleStats, RuleStatsStore};
+use crate::core::sorter::{SortOptions, collect_files, sort_files};
+use crate::rules::rule::{Action, ConflictStrategy, CopyAction, MoveAction, Rule};
+use crate::rules::rules_file::RulesFile;
+use crate::rules::test_support::extension_rule;
+use chrono::{Local, TimeZone};
+use tempfile::tempdir;
+
+fn rule(id: &str, ext: &str, then: Vec<Action>) -> Rule {
+    Rule {
+        then,
+        ..extension_rule(id, &[ext])
+    }
+}
+
+/// Moves .txt files, then backs them up; leaves .log files alone
+fn rules(dest: &Path, with_log_rule: bool) -> RulesFile {
+    let mut rules = vec![rule(
+        "archive_txt",
+        "txt",
+        vec![
+            Action::Move(MoveAction {
+                to: dest.join("sorted").to_string_lossy().to_string(),
+                preserve_structure: false,
+                dir_mode: None,
+                path_template: None,
+                on_conflict: ConflictStrategy::default(),
+            }),
+            Action::Copy(CopyAction {
+                to: dest.join("backup").to_string_lossy().to_string(),
+                preserve_structure: false,
+                dir_mode: None,
+                path_template: None,
+                preserve_metadata: true,
+            }),
+        ],
+    )];
+    if with_log_rule {
+        rules.push(rule("keep_logs", "log", vec![Action::Skip]));
+    }
+    RulesFile { rules }
+}
+
+fn sort(source: &Path, rules: &RulesFile) -> Vec<crate::core::sorter::MatchResult> {
+    let files = collect_files(source).unwrap();
+    sort_files(&files, source, rules, &SortOptions::default(), |_, _| {}).unwrap()
+}
+
+#[test]
+fn test_record_accumulates_across_runs() {
+    let source = tempdir().unwrap();
+    let dest = tempdir().unwrap();
+    let data = tempdir().unwrap();
+    let store = RuleStatsStore::new(data.path().join("rule_stats.json"));
+    let first_run = Local.with_ymd_and_hms(2025, 3, 1, 8, 0, 0).unwrap();
+    let second_run = Local.with_ymd_and_hms(2025, 3, 2, 8, 0, 0).unwrap();
+
+    for name in ["a.txt", "b.txt", "app.log", "image.bin"] {
+        fs::write(source.path().join(name), "content").unwrap();
+    }
+    let results = sort(source.path(), &rules(dest.path(), true));
+    store.record(&results, first_run).unwrap();
+
+    // The log rule was removed from the rules file before the second run
+    fs::write(source.path().join("c.txt"), "content").unwrap();
+    let results = sort(source.path(), &rules(dest.path(), false));
+    store.record(&results, second_run).unwrap();
+
+    let stats = store.load().unwrap();
+    assert_eq!(stats.len(), 2);
+    assert_eq!(
+        stats["archive_txt"],
+        RuleStats {
+            files_matched: 3,
+            actions_applied: 6,
+            last_fired: Some(second_run.to_rfc3339()),
+        }
+    );
+    assert_eq!(
+        stats["keep_logs"],
+        RuleStats {
+            files_matched: 1,
+            actions_applied: 0,
+            last_fired: None,
+        }
+    );
+}
+
+#[test]
+fn test_load_without_stats_file_is_empty() {
+    let data = tempdir().unwrap();
+    let store = RuleStatsStore::new(data.path().join("rule_stats.json"));
+    assert!(store.load().unwrap().is_empty());
+
+    store.record(&[], Local::now()).unwrap();
+    assert!(store.load().unwrap().is_empty());
+}
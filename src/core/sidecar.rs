@@ -0,0 +1,174 @@
+//! Sidecar grouping for Tooka.
+//!
+//! Sidecars are files that belong to another file of the same base name, like
+//! the subtitles `movie.srt` or `movie.en.srt` and the metadata `movie.nfo` of
+//! `movie.mkv`. With sidecar grouping, sidecars are not matched against the
+//! rules themselves but follow their primary file wherever its rule moves or
+//! copies it, keeping media sets intact.
+
+use super::error::TookaError;
+use super::sorter::MatchResult;
+use crate::file::file_ops;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Extensions treated as sidecars by default
+pub const DEFAULT_SIDECAR_EXTENSIONS: &[&str] = &["srt", "sub", "ass", "nfo", "xmp"];
+
+/// Sidecar files of a batch, grouped by their primary file.
+#[derive(Debug, Default)]
+pub struct SidecarGroups {
+    by_primary: HashMap<PathBuf, Vec<PathBuf>>,
+    grouped: HashSet<PathBuf>,
+}
+
+impl SidecarGroups {
+    /// Groups the files with one of `extensions` under the file in the same
+    /// folder whose name they extend, e.g. `movie.en.srt` under `movie.mkv`.
+    ///
+    /// Sidecars without a primary file in `files` are not grouped. If several
+    /// files could be the primary, the one with the longest base name wins,
+    /// then the first by path.
+    pub fn find(files: &[PathBuf], extensions: &[String]) -> Self {
+        let mut groups = Self::default();
+        if extensions.is_empty() {
+            return groups;
+        }
+        let is_sidecar = |path: &Path| {
+            path.extension()
+                .and_then(|ext| ext.to_str())
+                .is_some_and(|ext| {
+                    extensions
+                        .iter()
+                        .any(|s| s.trim_start_matches('.').eq_ignore_ascii_case(ext))
+                })
+        };
+
+        let mut primaries: HashMap<(&Path, &str), &PathBuf> = HashMap::new();
+        for file in files.iter().filter(|f| !is_sidecar(f)) {
+            let (Some(parent), Some(stem)) = (file.parent(), file_stem(file)) else {
+                continue;
+            };
+            primaries
+                .entry((parent, stem))
+                .and_modify(|primary| *primary = (*primary).min(file))
+                .or_insert(file);
+        }
+
+        for sidecar in files.iter().filter(|f| is_sidecar(f)) {
+            let (Some(parent), Some(mut stem)) = (sidecar.parent(), file_stem(sidecar)) else {
+                continue;
+            };
+            // Try `movie.en` before `movie` for `movie.en.srt`
+            let primary = loop {
+                if let Some(primary) = primaries.get(&(parent, stem)) {
+                    break Some(*primary);
+                }
+                match stem.rsplit_once('.') {
+                    Some((shorter, _)) if !shorter.is_empty() => stem = shorter,
+                    _ => break None,
+                }
+            };
+            if let Some(primary) = primary {
+                log::debug!(
+                    "Grouping sidecar '{}' with '{}'",
+                    sidecar.display(),
+                    primary.display()
+                );
+                groups
+                    .by_primary
+                    .entry(primary.clone())
+                    .or_default()
+                    .push(sidecar.clone());
+                groups.grouped.insert(sidecar.clone());
+            }
+        }
+        groups
+    }
+
+    /// Returns true if `file` is a sidecar that follows a primary file.
+    pub fn is_grouped(&self, file: &Path) -> bool {
+        self.grouped.contains(file)
+    }
+
+    /// Returns the sidecars following `primary`.
+    pub fn sidecars_of(&self, primary: &Path) -> &[PathBuf] {
+        self.by_primary.get(primary).map_or(&[], Vec::as_slice)
+    }
+}
+
+fn file_stem(path: &Path) -> Option<&str> {
+    path.file_stem().and_then(|stem| stem.to_str())
+}
+
+/// Moves and copies a sidecar the way its primary file was, given the
+/// primary's results, and returns the sidecar's results.
+///
+/// The sidecar keeps its name and goes into the folder its primary went to.
+/// Other actions of the primary, such as renames or deletions, are not
+/// applied; a sidecar no move or copy applied to is reported as skipped.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the sidecar cannot be moved or copied.
+pub fn follow_primary(
+    sidecar: &Path,
+    primary_results: &[MatchResult],
+    dry_run: bool,
+) -> Result<Vec<MatchResult>, TookaError> {
+    let file_name = sidecar.file_name().unwrap_or_default();
+    let mut current_path = sidecar.to_path_buf();
+    let mut results = Vec::new();
+
+    for result in primary_results {
+        if result.action != "move" && result.action != "copy" {
+            continue;
+        }
+        let folder = result.new_path.parent().unwrap_or(Path::new(""));
+        let new_path = folder.join(file_name);
+        let mut size = None;
+        if dry_run {
+            log::debug!(
+                "Dry run: would {} sidecar to: {}",
+                result.action,
+                new_path.display()
+            );
+        } else if result.action == "move" {
+            log::info!("Moving sidecar to: {}", new_path.display());
+            size = fs::symlink_metadata(&current_path).ok().map(|m| m.len());
+            file_ops::move_file(&current_path, &new_path)?;
+        } else {
+            log::info!("Copying sidecar to: {}", new_path.display());
+            fs::copy(&current_path, &new_path)?;
+        }
+        results.push(MatchResult {
+            file_name: file_name.to_string_lossy().to_string(),
+            action: result.action.clone(),
+            matched_rule_id: result.matched_rule_id.clone(),
+            current_path: current_path.clone(),
+            new_path: new_path.clone(),
+            conflict: None,
+            error: None,
+            size,
+        });
+        if result.action == "move" {
+            current_path = new_path;
+        }
+    }
+
+    if results.is_empty() {
+        results.push(MatchResult {
+            file_name: file_name.to_string_lossy().to_string(),
+            action: "skip".to_string(),
+            matched_rule_id: primary_results
+                .first()
+                .map_or_else(|| "none".to_string(), |r| r.matched_rule_id.clone()),
+            current_path: current_path.clone(),
+            new_path: current_path,
+            conflict: None,
+            error: None,
+            size: None,
+        });
+    }
+    Ok(results)
+}
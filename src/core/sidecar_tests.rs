@@ -0,0 +1,112 @@
+use std::fs::{self, File};
+use std::path::PathBuf;
+
+use super::sidecar::SidecarGroups;
+use super::sorter::{SortOptions, sort_files};
+use crate::rules::rule::{Action, ConflictStrategy, MoveAction, Rule};
+use crate::rules::rules_file::RulesFile;
+use crate::rules::test_support::extension_rule;
+use tempfile::tempdir;
+
+fn extensions() -> Vec<String> {
+    vec!["srt".to_string(), ".nfo".to_string()]
+}
+
+fn move_rule(id: &str, extension: &str, to: &std::path::Path) -> Rule {
+    Rule {
+        then: vec![Action::Move(MoveAction {
+            to: to.to_string_lossy().to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            on_conflict: ConflictStrategy::default(),
+        })],
+        ..extension_rule(id, &[extension])
+    }
+}
+
+#[test]
+fn test_sidecars_are_grouped_by_base_name() {
+    let files: Vec<PathBuf> = [
+        "/media/movie.mkv",
+        "/media/movie.srt",
+        "/media/movie.en.SRT",
+        "/media/movie.nfo",
+        "/media/other/movie.srt",
+        "/media/orphan.srt",
+        "/media/notes.txt",
+    ]
+    .iter()
+    .map(PathBuf::from)
+    .collect();
+
+    let groups = SidecarGroups::find(&files, &extensions());
+
+    assert_eq!(
+        groups.sidecars_of(&files[0]),
+        &files[1..4],
+        "sidecars in the same folder follow the movie"
+    );
+    assert!(!groups.is_grouped(&files[0]));
+    assert!(
+        !groups.is_grouped(&files[4]),
+        "sidecars in other folders stay alone"
+    );
+    assert!(
+        !groups.is_grouped(&files[5]),
+        "sidecars without a primary stay alone"
+    );
+    assert!(groups.sidecars_of(&files[6]).is_empty());
+    assert!(
+        SidecarGroups::find(&files, &[])
+            .sidecars_of(&files[0])
+            .is_empty()
+    );
+}
+
+#[test]
+fn test_sidecars_follow_moved_file() {
+    let temp_dir = tempdir().unwrap();
+    let source = temp_dir.path().join("source");
+    let movies = temp_dir.path().join("movies");
+    let subtitles = temp_dir.path().join("subtitles");
+    for dir in [&source, &movies, &subtitles] {
+        fs::create_dir_all(dir).unwrap();
+    }
+    let files: Vec<PathBuf> = ["movie.mkv", "movie.srt", "movie.nfo", "orphan.srt"]
+        .iter()
+        .map(|name| {
+            let path = source.join(name);
+            File::create(&path).unwrap();
+            path
+        })
+        .collect();
+    let rules_file = RulesFile {
+        rules: vec![
+            move_rule("movies", "mkv", &movies),
+            move_rule("subtitles", "srt", &subtitles),
+        ],
+    };
+
+    let results = sort_files(
+        &files,
+        &source,
+        &rules_file,
+        &SortOptions {
+            sidecar_extensions: extensions(),
+            ..Default::default()
+        },
+        |_, _| {},
+    )
+    .unwrap();
+
+    assert_eq!(results.len(), 4);
+    for name in ["movie.mkv", "movie.srt", "movie.nfo"] {
+        assert!(movies.join(name).exists(), "{name} should follow the movie");
+        let result = results.iter().find(|r| r.file_name == name).unwrap();
+        assert_eq!(result.matched_rule_id, "movies");
+    }
+    // Sidecars without a primary are matched like any other file
+    assert!(subtitles.join("orphan.srt").exists());
+    assert_eq!(fs::read_dir(&source).unwrap().count(), 0);
+}
@@ -0,0 +1,347 @@
+//! Rule simulation against synthetic file sets for Tooka.
+//!
+//! Generates a reproducible set of imaginary files with varied names,
+//! extensions, folders, sizes and ages, and evaluates the rules against it in
+//! memory to show how they behave at scale. Nothing is read from or written to
+//! the files the paths point to, so conditions that need file contents or
+//! other on-disk information cannot be evaluated and never match.
+
+use crate::{
+    file::file_match::{self, ExtensionLists},
+    rules::{
+        rule::Conditions,
+        rules_file::RulesFile,
+        units::{duration_days, parse_duration, parse_size},
+    },
+};
+use chrono::{DateTime, Local, TimeDelta, Utc};
+use std::path::{Path, PathBuf};
+use std::time::{Duration, Instant};
+
+/// Folder the synthetic files are placed in
+pub const SIMULATED_ROOT: &str = "/simulated";
+
+/// Extensions of synthetic files with their relative frequency; the empty
+/// extension stands for files without one
+const EXTENSIONS: &[(&str, u32)] = &[
+    ("jpg", 20),
+    ("png", 8),
+    ("heic", 3),
+    ("pdf", 10),
+    ("docx", 6),
+    ("xlsx", 3),
+    ("txt", 8),
+    ("md", 3),
+    ("csv", 4),
+    ("log", 6),
+    ("mp4", 5),
+    ("mkv", 3),
+    ("mp3", 6),
+    ("zip", 5),
+    ("tar.gz", 2),
+    ("exe", 2),
+    ("", 2),
+];
+
+/// Folders below [`SIMULATED_ROOT`] synthetic files are placed in
+const FOLDERS: &[&str] = &[
+    "",
+    "Downloads",
+    "Documents",
+    "Pictures/2023",
+    "Music",
+    "tmp",
+];
+
+/// Name prefixes of synthetic files
+const NAME_PREFIXES: &[&str] = &[
+    "IMG_",
+    "report_",
+    "invoice-",
+    "Screenshot ",
+    "backup_",
+    "notes",
+];
+
+/// Oldest age of a synthetic file, in days
+const MAX_AGE_DAYS: u64 = 3650;
+
+/// An imaginary file of a simulation.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SyntheticFile {
+    /// Path of the file below [`SIMULATED_ROOT`].
+    pub path: PathBuf,
+    /// Size in bytes.
+    pub size: u64,
+    /// Modification time, also used as the creation time.
+    pub modified: DateTime<Local>,
+}
+
+/// SplitMix64, a small and fast generator that is plenty for synthetic data
+struct Rng(u64);
+
+impl Rng {
+    fn next(&mut self) -> u64 {
+        self.0 = self.0.wrapping_add(0x9E37_79B9_7F4A_7C15);
+        let mut z = self.0;
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        z ^ (z >> 31)
+    }
+
+    /// Returns a number below `bound`, which must not be 0
+    fn below(&mut self, bound: u64) -> u64 {
+        self.next() % bound
+    }
+
+    fn pick<'a, T>(&mut self, items: &'a [T]) -> &'a T {
+        &items[self.below(items.len() as u64) as usize]
+    }
+}
+
+/// Generates `count` synthetic files, the same ones for the same `seed` and `now`.
+pub fn generate_files(count: usize, seed: u64, now: DateTime<Local>) -> Vec<SyntheticFile> {
+    let mut rng = Rng(seed);
+    let total_weight: u32 = EXTENSIONS.iter().map(|(_, weight)| weight).sum();
+
+    (0..count)
+        .map(|i| {
+            let mut roll = rng.below(u64::from(total_weight)) as u32;
+            let extension = EXTENSIONS
+                .iter()
+                .find(|(_, weight)| {
+                    let found = roll < *weight;
+                    roll = roll.saturating_sub(*weight);
+                    found
+                })
+                .map_or("", |(extension, _)| extension);
+            let mut name = format!("{}{i:05}", rng.pick(NAME_PREFIXES));
+            if !extension.is_empty() {
+                name = format!("{name}.{extension}");
+            }
+            let path = Path::new(SIMULATED_ROOT).join(rng.pick(FOLDERS)).join(name);
+
+            // Spread sizes over orders of magnitude, from empty files to a few GB
+            let magnitude = rng.below(33);
+            let size = rng.below(1 << magnitude);
+            let age_secs = rng.below(MAX_AGE_DAYS * 24 * 60 * 60);
+            let modified = now - TimeDelta::seconds(age_secs as i64);
+            SyntheticFile {
+                path,
+                size,
+                modified,
+            }
+        })
+        .collect()
+}
+
+/// Number of synthetic files a rule was applied to.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RuleMatches {
+    pub rule_id: String,
+    /// Files the rule would be applied to.
+    pub matches: usize,
+    /// Conditions of the rule that cannot be simulated and never match.
+    pub unsupported: Vec<&'static str>,
+}
+
+/// Result of simulating the rules against synthetic files.
+#[derive(Debug, Clone)]
+pub struct SimulationReport {
+    /// Number of files simulated.
+    pub files: usize,
+    /// Files no rule would be applied to.
+    pub unmatched: usize,
+    /// Matches per rule, in priority order.
+    pub rules: Vec<RuleMatches>,
+    /// Time spent evaluating the rules.
+    pub elapsed: Duration,
+}
+
+impl SimulationReport {
+    /// Number of files evaluated per second.
+    pub fn files_per_second(&self) -> f64 {
+        let secs = self.elapsed.as_secs_f64();
+        if secs > 0.0 {
+            self.files as f64 / secs
+        } else {
+            0.0
+        }
+    }
+}
+
+/// Evaluates the rules of `rules_file`, in priority order as returned by
+/// [`RulesFile::optimized_with_filter`], against synthetic files as a sort would.
+///
+/// Each file is matched by the first rule in priority order that matches it.
+/// Rules with `min_count` take part only if enough files match them.
+pub fn simulate(
+    files: &[SyntheticFile],
+    rules_file: &RulesFile,
+    now: DateTime<Local>,
+    extension_lists: &ExtensionLists,
+) -> SimulationReport {
+    let start = Instant::now();
+    let take_part: Vec<bool> = rules_file
+        .rules
+        .iter()
+        .map(|rule| {
+            rule.when.min_count.is_none_or(|min_count| {
+                files
+                    .iter()
+                    .filter(|file| matches(file, &rule.when, now, extension_lists))
+                    .count()
+                    >= min_count
+            })
+        })
+        .collect();
+
+    let mut counts = vec![0; rules_file.rules.len()];
+    let mut unmatched = 0;
+    for file in files {
+        let rule =
+            rules_file.rules.iter().enumerate().position(|(i, rule)| {
+                take_part[i] && matches(file, &rule.when, now, extension_lists)
+            });
+        match rule {
+            Some(index) => counts[index] += 1,
+            None => unmatched += 1,
+        }
+    }
+
+    let rules = rules_file
+        .rules
+        .iter()
+        .zip(counts)
+        .map(|(rule, matches)| RuleMatches {
+            rule_id: rule.id.clone(),
+            matches,
+            unsupported: unsupported_conditions(&rule.when),
+        })
+        .collect();
+    SimulationReport {
+        files: files.len(),
+        unmatched,
+        rules,
+        elapsed: start.elapsed(),
+    }
+}
+
+/// Names of the conditions, including nested ones, that need on-disk
+/// information and cannot be simulated
+pub fn unsupported_conditions(conditions: &Conditions) -> Vec<&'static str> {
+    let mut unsupported: Vec<&'static str> = direct_unsupported(conditions)
+        .chain(conditions.nested().flat_map(unsupported_conditions))
+        .collect();
+    unsupported.sort_unstable();
+    unsupported.dedup();
+    unsupported
+}
+
+/// Names of the unsupported conditions of a group, without nested groups
+fn direct_unsupported(conditions: &Conditions) -> impl Iterator<Item = &'static str> {
+    [
+        ("metadata", conditions.metadata.is_some()),
+        ("content_regex", conditions.content_regex.is_some()),
+        ("corrupt", conditions.corrupt.is_some()),
+        ("exif_date", conditions.exif_date.is_some()),
+        ("video", conditions.video.is_some()),
+        ("classify_with", conditions.classify_with.is_some()),
+        ("in_list", conditions.in_list.is_some()),
+        ("owner", conditions.owner.is_some()),
+        ("day", conditions.day.is_some()),
+    ]
+    .into_iter()
+    .filter_map(|(name, set)| set.then_some(name))
+}
+
+/// Matches a synthetic file against conditions like a real file would be,
+/// except for unsupported conditions, which never match
+fn matches(
+    file: &SyntheticFile,
+    conditions: &Conditions,
+    now: DateTime<Local>,
+    extension_lists: &ExtensionLists,
+) -> bool {
+    let path = file.path.as_path();
+    let modified_date = file.modified.with_timezone(&Utc).date_naive();
+    let results = [
+        conditions
+            .filename
+            .as_ref()
+            .map(|pattern| file_match::match_filename_regex(path, pattern).unwrap_or(false)),
+        conditions
+            .filename_glob
+            .as_ref()
+            .map(|pattern| file_match::match_filename_glob(path, pattern).unwrap_or(false)),
+        conditions
+            .extensions
+            .as_ref()
+            .map(|exts| file_match::match_extensions(path, exts)),
+        conditions
+            .path
+            .as_ref()
+            .map(|pattern| file_match::match_path(path, pattern).unwrap_or(false)),
+        conditions
+            .size_kb
+            .as_ref()
+            .map(|range| file_match::size_in_kb_range(file.size, range)),
+        conditions
+            .size_greater_than_kb
+            .map(|kb| file.size > kb.saturating_mul(1024)),
+        conditions
+            .size_greater_than
+            .as_deref()
+            .map(|size| parse_size(size).is_ok_and(|bytes| file.size > bytes)),
+        conditions.mime_type.as_ref().map(|pattern| {
+            mime_guess::from_path(path)
+                .first()
+                .is_some_and(|mime| file_match::mime_matches(mime.essence_str(), pattern))
+        }),
+        conditions
+            .created_date
+            .as_ref()
+            .map(|range| file_match::is_date_in_range(modified_date, range)),
+        conditions
+            .modified_date
+            .as_ref()
+            .map(|range| file_match::is_date_in_range(modified_date, range)),
+        // Synthetic files are regular files
+        conditions.is_symlink.map(|is_symlink| !is_symlink),
+        conditions
+            .older_than_days
+            .map(|days| file_match::is_older_than_days(file.modified, days, now)),
+        conditions.older_than.as_deref().map(|age| {
+            parse_duration(age).is_ok_and(|duration| {
+                file_match::is_older_than_days(file.modified, duration_days(duration), now)
+            })
+        }),
+        conditions
+            .in_allowlist
+            .map(|b| file_match::match_extension_list(path, &extension_lists.allowlist, b)),
+        conditions
+            .in_denylist
+            .map(|b| file_match::match_extension_list(path, &extension_lists.denylist, b)),
+        conditions.any_of.as_ref().map(|groups| {
+            groups
+                .iter()
+                .any(|group| matches(file, group, now, extension_lists))
+        }),
+        conditions.all_of.as_ref().map(|groups| {
+            groups
+                .iter()
+                .all(|group| matches(file, group, now, extension_lists))
+        }),
+        // Unsupported conditions never match, so their negation can't be trusted either
+        conditions.not.as_deref().map(|group| {
+            unsupported_conditions(group).is_empty() && !matches(file, group, now, extension_lists)
+        }),
+        direct_unsupported(conditions).next().map(|_| false),
+    ];
+
+    if conditions.any.unwrap_or(false) {
+        results.into_iter().any(|r| r.unwrap_or(true))
+    } else {
+        results.into_iter().all(|r| r.unwrap_or(true))
+    }
+}
@@ -0,0 +1,102 @@
+use std::path::Path;
+
+use chrono::{Local, TimeZone};
+
+use super::simulate::{SIMULATED_ROOT, generate_files, simulate, unsupported_conditions};
+use crate::file::file_match::ExtensionLists;
+use crate::rules::rule::{Action, Conditions, Rule};
+use crate::rules::rules_file::RulesFile;
+
+fn rule(id: &str, priority: u32, when: Conditions) -> Rule {
+    Rule {
+        id: id.to_string(),
+        name: format!("Rule {id}"),
+        enabled: true,
+        description: None,
+        priority,
+        max_per_run: None,
+        stop_on_match: true,
+        when,
+        then: vec![Action::Skip],
+    }
+}
+
+fn rules() -> RulesFile {
+    RulesFile {
+        rules: vec![
+            rule(
+                "photos",
+                5,
+                Conditions {
+                    extensions: Some(vec!["jpg".to_string(), "png".to_string()]),
+                    ..Default::default()
+                },
+            ),
+            rule(
+                "old_files",
+                1,
+                Conditions {
+                    older_than_days: Some(365),
+                    ..Default::default()
+                },
+            ),
+            rule(
+                "exif",
+                1,
+                Conditions {
+                    exif_date: Some(true),
+                    ..Default::default()
+                },
+            ),
+        ],
+    }
+    .optimized_with_filter(None)
+    .unwrap()
+}
+
+#[test]
+fn test_simulation_is_deterministic_for_a_seed() {
+    let now = Local.with_ymd_and_hms(2025, 6, 1, 12, 0, 0).unwrap();
+
+    let files = generate_files(2000, 42, now);
+    assert_eq!(files, generate_files(2000, 42, now));
+    assert_ne!(files, generate_files(2000, 43, now));
+
+    let first = simulate(&files, &rules(), now, &ExtensionLists::default());
+    let second = simulate(
+        &generate_files(2000, 42, now),
+        &rules(),
+        now,
+        &ExtensionLists::default(),
+    );
+    assert_eq!(first.rules, second.rules);
+    assert_eq!(first.unmatched, second.unmatched);
+
+    let total: usize = first.rules.iter().map(|r| r.matches).sum();
+    assert_eq!(total + first.unmatched, 2000);
+    let matches = |id: &str| first.rules.iter().find(|r| r.rule_id == id).unwrap();
+    // About a third of the files are photos and most others are over a year old
+    assert!((400..900).contains(&matches("photos").matches));
+    assert!(matches("old_files").matches > 900);
+    assert_eq!(matches("exif").matches, 0);
+    assert_eq!(matches("exif").unsupported, vec!["exif_date"]);
+
+    assert!(!Path::new(SIMULATED_ROOT).exists());
+}
+
+#[test]
+fn test_unsupported_conditions_include_nested_groups() {
+    let conditions = Conditions {
+        owner: Some("alice".to_string()),
+        any_of: Some(vec![Conditions {
+            corrupt: Some(true),
+            ..Default::default()
+        }]),
+        ..Default::default()
+    };
+    assert_eq!(
+        unsupported_conditions(&conditions),
+        vec!["corrupt", "owner"]
+    );
+    assert!(unsupported_conditions(&Conditions::default()).is_empty());
+}
@@ -4,16 +4,38 @@
 //! It supports recursively collecting files, matching files against rules, and
 //! executing actions such as move, copy, or delete. Sorting operations can be
 //! performed in parallel with progress callbacks and dry-run support.
+//!
+//! A run has two phases. Rules with a `min_count` condition are first
+//! evaluated against all files of the run, and take no part in the run if
+//! fewer files match them. Then every file is matched against the remaining
+//! rules and the actions of its rule are executed.
 
+use super::dedupe;
 use super::error::TookaError;
+use super::ignore::{IGNORE_FILE_NAME, IgnoreMatcher};
+use super::network;
+use super::sidecar::{self, SidecarGroups};
+use super::throttle::{DestinationLimiter, filesystem_id};
 use crate::{
-    common::logger::log_file_operation,
-    file::{file_match, file_ops},
-    rules::rules_file::RulesFile,
+    common::{config::TieBreak, logger::log_file_operation},
+    file::{
+        file_match::{self, ExtensionLists},
+        file_ops,
+        folder_index::INDEX_FILE_NAME,
+    },
+    rules::{
+        rule::{Action, ConflictStrategy, Rule},
+        rules_file::RulesFile,
+    },
 };
-use rayon::prelude::*;
+use glob::Pattern;
+use indicatif::HumanBytes;
+use rayon::{ThreadPoolBuilder, prelude::*};
+use std::fs;
 use std::path::{Path, PathBuf};
 use std::sync::Arc;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::time::{Duration, Instant, SystemTime};
 use walkdir::WalkDir;
 
 /// Result of matching a file against a rule and executing an action.
@@ -29,6 +51,152 @@ pub struct MatchResult {
     pub current_path: PathBuf,
     /// Destination path after action.
     pub new_path: PathBuf,
+    /// Strategy a move applied because its destination was already taken.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub conflict: Option<ConflictStrategy>,
+    /// Why the file could not be sorted, for results of [`FAILED_ACTION`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+    /// Size of a moved file, measured when it was moved; `None` for other
+    /// actions and for dry runs.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub size: Option<u64>,
+}
+
+/// Options controlling a sorting run.
+#[derive(Debug, Clone, Default)]
+pub struct SortOptions {
+    /// If true, actions are logged but not performed.
+    pub dry_run: bool,
+    /// How ties between matching rules of equal priority are resolved.
+    pub tie_break: TieBreak,
+    /// Maximum number of move and copy actions writing to the same destination
+    /// filesystem at once; unlimited if `None`.
+    pub concurrency_per_destination: Option<usize>,
+    /// Time after which no new files are started; files already being
+    /// processed are finished. Unlimited if `None`.
+    pub deadline: Option<Instant>,
+    /// Extensions of sidecar files that follow the file they belong to instead
+    /// of being matched themselves; sidecars are not grouped if empty.
+    pub sidecar_extensions: Vec<String>,
+    /// Number of files processed at once; one per CPU if `None`.
+    pub workers: Option<usize>,
+    /// Extension lists of the `in_allowlist` and `in_denylist` conditions.
+    pub extension_lists: ExtensionLists,
+}
+
+/// Action reported for files a rule matched but did not act on because its
+/// `max_per_run` cap was reached.
+pub const DEFERRED_ACTION: &str = "deferred";
+
+/// Action reported for files that could not be sorted; the run goes on with
+/// the other files.
+pub const FAILED_ACTION: &str = "failed";
+
+/// Actions that take a file away from the source without sorting it into a destination.
+pub const DESTRUCTIVE_ACTIONS: &[&str] = &["delete", "trash", "quarantine"];
+
+/// Returns the results of delete, trash and quarantine actions, in order.
+///
+/// Used to review the destructive impact of a dry run separately from moves.
+pub fn destructive_results(results: &[MatchResult]) -> Vec<&MatchResult> {
+    results
+        .iter()
+        .filter(|r| DESTRUCTIVE_ACTIONS.contains(&r.action.as_str()))
+        .collect()
+}
+
+/// Counts of the outcomes of a sorting run.
+///
+/// The run itself fills in `scanned` and `elapsed`; the rest is
+/// tallied from its results by [`SortSummary::from_results`].
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct SortSummary {
+    /// Files considered by the run.
+    pub scanned: usize,
+    /// Actions taken by a matching rule, including explicit skips.
+    pub matched: usize,
+    /// Files moved.
+    pub moved: usize,
+    /// Files copied.
+    pub copied: usize,
+    /// Files deleted or moved to the trash.
+    pub deleted: usize,
+    /// Files no rule matched or a rule chose to skip.
+    pub skipped: usize,
+    /// Files deferred to a later run by `max_per_run`.
+    pub deferred: usize,
+    /// Files moved to the quarantine folder.
+    pub quarantined: usize,
+    /// Files that could not be sorted.
+    pub errors: usize,
+    /// Total size of the moved files.
+    pub bytes_moved: u64,
+    /// How long the run took.
+    pub elapsed: Duration,
+}
+
+impl SortSummary {
+    /// Tallies the results returned by [`sort_files`].
+    ///
+    /// Moved bytes add up the sizes recorded when the files were moved, so
+    /// dry runs, which relocate nothing, move no bytes.
+    pub fn from_results(results: &[MatchResult]) -> Self {
+        let mut summary = Self::default();
+        for result in results {
+            match result.action.as_str() {
+                "move" => {
+                    summary.moved += 1;
+                    summary.bytes_moved += result.size.unwrap_or(0);
+                }
+                "copy" => summary.copied += 1,
+                "delete" | "trash" => summary.deleted += 1,
+                "quarantine" => summary.quarantined += 1,
+                "skip" => summary.skipped += 1,
+                DEFERRED_ACTION => {
+                    summary.deferred += 1;
+                    continue;
+                }
+                FAILED_ACTION => {
+                    summary.errors += 1;
+                    continue;
+                }
+                _ => {}
+            }
+            if result.matched_rule_id != "none" {
+                summary.matched += 1;
+            }
+        }
+        summary
+    }
+}
+
+impl std::fmt::Display for SortSummary {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(
+            f,
+            "{} scanned, {} matched, {} moved, {} copied, {} deleted, {} skipped, {} errors",
+            self.scanned,
+            self.matched,
+            self.moved,
+            self.copied,
+            self.deleted,
+            self.skipped,
+            self.errors
+        )?;
+        if self.deferred > 0 {
+            write!(f, ", {} deferred", self.deferred)?;
+        }
+        if self.quarantined > 0 {
+            write!(f, ", {} quarantined", self.quarantined)?;
+        }
+        write!(
+            f,
+            " | {} moved in {:.2?}",
+            HumanBytes(self.bytes_moved),
+            self.elapsed
+        )
+    }
 }
 
 /// Sorts a batch of files using optimized rules processing.
@@ -37,38 +205,208 @@ pub struct MatchResult {
 /// * `files` - Files to sort.
 /// * `source_path` - Base directory of source files.
 /// * `rules_file` - Rules file with pre-sorted rules to apply.
-/// * `dry_run` - If true, actions are logged but not performed.
-/// * `on_progress` - Optional callback invoked after each file processed.
+/// * `options` - Dry-run mode, tie-breaking, concurrency and sidecar settings.
+/// * `on_file` - Callback invoked with each file's results as soon as the file
+///   has been processed, e.g. to report progress or journal it. Files left
+///   unprocessed because the deadline passed are not reported. Grouped
+///   sidecars are reported right after the file they follow.
 ///
 /// # Returns
-/// List of matching results for files that matched any rule.
+/// List of matching results for files that matched any rule. A file that
+/// cannot be sorted, because a file operation fails or it matches several
+/// rules of equal priority and the tie-break mode is [`TieBreak::Error`],
+/// does not stop the run: it gets a single result of [`FAILED_ACTION`]
+/// holding the error.
 ///
 /// # Errors
-/// Returns `TookaError` if file operations fail.
+/// Returns `TookaError` if the workers cannot be started.
 pub fn sort_files<F>(
     files: &[PathBuf],
     source_path: &Path,
     rules_file: &RulesFile,
-    dry_run: bool,
-    on_progress: Option<F>,
+    options: &SortOptions,
+    on_file: F,
 ) -> Result<Vec<MatchResult>, TookaError>
 where
-    F: Fn() + Send + Sync,
+    F: Fn(&Path, &[MatchResult]) + Send + Sync,
 {
-    let progress = Arc::new(on_progress.map(|f| Arc::new(f)));
-
-    let results: Result<Vec<_>, TookaError> = files
-        .par_iter()
-        .map(|file_path| {
-            let res = sort_file(file_path, rules_file, dry_run, source_path);
-            if let Some(ref cb) = *progress {
-                cb();
-            }
-            res
+    let extension_lists = &options.extension_lists;
+    let counted = rules_meeting_min_count(files, rules_file, extension_lists);
+    let rules_file = counted.as_ref().unwrap_or(rules_file);
+    let deduped = rules_with_duplicates(files, rules_file, extension_lists);
+    let rules_file = deduped.as_ref().unwrap_or(rules_file);
+
+    // Number of files each rule has acted on, to enforce `max_per_run`
+    let acted: Vec<AtomicUsize> = rules_file
+        .rules
+        .iter()
+        .map(|_| AtomicUsize::new(0))
+        .collect();
+    // Dry runs write nothing, so there is nothing to throttle
+    let limiter = options
+        .concurrency_per_destination
+        .filter(|_| !options.dry_run)
+        .map(DestinationLimiter::new);
+
+    let sidecars = SidecarGroups::find(files, &options.sidecar_extensions);
+
+    let sort_all = || -> Vec<_> {
+        files
+            .par_iter()
+            .filter(|file_path| !sidecars.is_grouped(file_path))
+            .map(|file_path| {
+                if options
+                    .deadline
+                    .is_some_and(|deadline| Instant::now() >= deadline)
+                {
+                    log::debug!("Deadline passed, not starting '{}'", file_path.display());
+                    return Vec::new();
+                }
+                let mut file_results = sort_file(
+                    file_path,
+                    rules_file,
+                    &acted,
+                    options,
+                    limiter.as_ref(),
+                    source_path,
+                )
+                .unwrap_or_else(|e| vec![failed_result(file_path, &e)]);
+                on_file(file_path, &file_results);
+
+                let mut sidecar_results = Vec::new();
+                for sidecar_path in sidecars.sidecars_of(file_path) {
+                    let results =
+                        sidecar::follow_primary(sidecar_path, &file_results, options.dry_run)
+                            .unwrap_or_else(|e| {
+                                let e = TookaError::FileOperationError(format!(
+                                    "Failed to move sidecar: {e}"
+                                ));
+                                vec![failed_result(sidecar_path, &e)]
+                            });
+                    on_file(sidecar_path, &results);
+                    sidecar_results.extend(results);
+                }
+                file_results.extend(sidecar_results);
+                file_results
+            })
+            .collect()
+    };
+
+    // Results are collected in the order of `files`, however many workers ran
+    let results = match options.workers {
+        Some(workers) => ThreadPoolBuilder::new()
+            .num_threads(workers)
+            .build()
+            .map_err(|e| TookaError::Other(format!("Failed to start {workers} workers: {e}")))?
+            .install(sort_all),
+        None => sort_all(),
+    };
+
+    Ok(results.into_iter().flatten().collect())
+}
+
+/// Result recording that `file_path` could not be sorted because of `error`.
+fn failed_result(file_path: &Path, error: &TookaError) -> MatchResult {
+    log::error!("Failed to sort '{}': {}", file_path.display(), error);
+    MatchResult {
+        file_name: file_path
+            .file_name()
+            .map(|name| name.to_string_lossy().into_owned())
+            .unwrap_or_default(),
+        action: FAILED_ACTION.to_string(),
+        matched_rule_id: "none".to_string(),
+        current_path: file_path.to_path_buf(),
+        new_path: file_path.to_path_buf(),
+        conflict: None,
+        error: Some(error.to_string()),
+        size: None,
+    }
+}
+
+/// Aggregate phase of a run: counts the files matching each rule with a
+/// `min_count` condition and leaves out the rules that fall short.
+///
+/// A file counts for every such rule whose conditions it matches, even if a
+/// rule with a higher priority ends up handling it. Returns `None` if no rule
+/// has a `min_count`, so the rules are used as they are.
+fn rules_meeting_min_count(
+    files: &[PathBuf],
+    rules_file: &RulesFile,
+    extension_lists: &ExtensionLists,
+) -> Option<RulesFile> {
+    if rules_file
+        .rules
+        .iter()
+        .all(|rule| rule.when.min_count.is_none())
+    {
+        return None;
+    }
+
+    let rules = rules_file
+        .rules
+        .iter()
+        .filter(|rule| {
+            let Some(min_count) = rule.when.min_count else {
+                return true;
+            };
+            let count = files
+                .par_iter()
+                .filter(|file| file_match::match_rule_matcher(file, &rule.when, extension_lists))
+                .count();
+            log::info!(
+                "Rule '{}' matches {} files, needs at least {}",
+                rule.id,
+                count,
+                min_count
+            );
+            count >= min_count
         })
+        .cloned()
         .collect();
+    Some(RulesFile { rules })
+}
+
+/// Resolves the dedupe actions of the rules, finding the duplicates among the
+/// files each rule matches.
+///
+/// Returns `None` if no rule has a dedupe action, so the rules are used as they are.
+fn rules_with_duplicates(
+    files: &[PathBuf],
+    rules_file: &RulesFile,
+    extension_lists: &ExtensionLists,
+) -> Option<RulesFile> {
+    let is_dedupe = |action: &Action| matches!(action, Action::Dedupe(_));
+    if !rules_file
+        .rules
+        .iter()
+        .any(|rule| rule.then.iter().any(is_dedupe))
+    {
+        return None;
+    }
 
-    results.map(|v| v.into_iter().flatten().collect())
+    let mut rules = rules_file.rules.clone();
+    for rule in rules
+        .iter_mut()
+        .filter(|rule| rule.then.iter().any(is_dedupe))
+    {
+        let matching: Vec<PathBuf> = files
+            .par_iter()
+            .filter(|file| file_match::match_rule_matcher(file, &rule.when, extension_lists))
+            .cloned()
+            .collect();
+        for action in &mut rule.then {
+            if let Action::Dedupe(inner) = action {
+                inner.duplicates = Arc::new(dedupe::find_duplicates(&matching, inner.keep));
+                log::info!(
+                    "Rule '{}' found {} duplicates among {} matching files",
+                    rule.id,
+                    inner.duplicates.len(),
+                    matching.len()
+                );
+            }
+        }
+    }
+    Some(RulesFile { rules })
 }
 
 /// Processes a single file against rules and returns the match results.
@@ -76,9 +414,12 @@ where
 fn sort_file(
     file_path: &Path,
     rules_file: &RulesFile,
-    dry_run: bool,
+    acted: &[AtomicUsize],
+    options: &SortOptions,
+    limiter: Option<&DestinationLimiter>,
     source_path: &Path,
 ) -> Result<Vec<MatchResult>, TookaError> {
+    let dry_run = options.dry_run;
     log::debug!("Processing file: '{}'", file_path.display());
 
     let file_name = file_path
@@ -91,37 +432,128 @@ fn sort_file(
             ))
         })?;
 
-    // Since rules are pre-sorted by priority, we can take the first match
-    let Some(rule) = rules_file
-        .rules
-        .iter()
-        .find(|rule| file_match::match_rule_matcher(file_path, &rule.when))
-    else {
+    let mut results = Vec::new();
+    let mut current_path = file_path.to_path_buf();
+    // Rules before this index have been tried already
+    let mut next_rule = 0;
+
+    loop {
+        // A dry run leaves the file where it is, so later rules look at it there
+        let match_path: &Path = if dry_run { file_path } else { &current_path };
+        let Some((index, rule)) = select_rule(match_path, rules_file, next_rule, options)? else {
+            break;
+        };
+
+        log::debug!(
+            "File '{}' matched rule '{}' with priority {}",
+            file_name,
+            rule.id,
+            rule.priority
+        );
+
+        if let Some(max) = rule.max_per_run {
+            let within_cap = acted[index]
+                .fetch_update(Ordering::SeqCst, Ordering::SeqCst, |n| {
+                    (n < max).then_some(n + 1)
+                })
+                .is_ok();
+            if !within_cap {
+                log::debug!(
+                    "Rule '{}' reached its limit of {} files per run, deferring '{}'",
+                    rule.id,
+                    max,
+                    file_name
+                );
+                // A file other rules already acted on is not deferred
+                if results.is_empty() {
+                    results.push(MatchResult {
+                        file_name: file_name.to_string(),
+                        action: DEFERRED_ACTION.to_string(),
+                        matched_rule_id: rule.id.clone(),
+                        current_path: file_path.to_path_buf(),
+                        new_path: file_path.to_path_buf(),
+                        conflict: None,
+                        error: None,
+                        size: None,
+                    });
+                }
+                break;
+            }
+        }
+
+        let removed = apply_rule(
+            rule,
+            file_name,
+            &mut current_path,
+            &mut results,
+            options,
+            limiter,
+            source_path,
+        )?;
+        if removed || rule.stop_on_match {
+            break;
+        }
+        log::debug!(
+            "Rule '{}' does not stop on match, trying lower-priority rules for '{}'",
+            rule.id,
+            file_name
+        );
+        next_rule = index + 1;
+    }
+
+    if results.is_empty() {
         log::debug!("No matching rules found for file '{file_name}'");
-        return Ok(vec![MatchResult {
+        results.push(MatchResult {
             file_name: file_name.to_string(),
             action: "skip".to_string(),
             matched_rule_id: "none".to_string(),
             current_path: file_path.to_path_buf(),
             new_path: file_path.to_path_buf(),
-        }]);
-    };
-
-    log::debug!(
-        "File '{}' matched rule '{}' with priority {}",
-        file_name,
-        rule.id,
-        rule.priority
-    );
-
-    let mut results = Vec::with_capacity(rule.then.len());
-    let mut current_path = file_path.to_path_buf();
+            conflict: None,
+            error: None,
+            size: None,
+        });
+    }
+    Ok(results)
+}
 
+/// Executes the actions of a rule on the file at `current_path`, moving
+/// `current_path` along with the file and appending to `results`.
+///
+/// Returns true if the file was deleted or otherwise removed from the source.
+fn apply_rule(
+    rule: &Rule,
+    file_name: &str,
+    current_path: &mut PathBuf,
+    results: &mut Vec<MatchResult>,
+    options: &SortOptions,
+    limiter: Option<&DestinationLimiter>,
+    source_path: &Path,
+) -> Result<bool, TookaError> {
+    let dry_run = options.dry_run;
     for (i, action) in rule.then.iter().enumerate() {
-        let op_result = file_ops::execute_action(&current_path, action, dry_run, source_path)
-            .map_err(|e| {
-                TookaError::FileOperationError(format!("Failed to execute action: {e}"))
-            })?;
+        // Held until the action finished writing to its destination
+        let _permit = limiter.and_then(|limiter| {
+            file_ops::destination_dir(current_path.as_path(), action, source_path)
+                .map(|dir| limiter.acquire(filesystem_id(&dir)))
+        });
+        // Measured up front, as the file may be gone once it was moved
+        let size = if matches!(action, Action::Move(_)) && !dry_run {
+            fs::symlink_metadata(current_path.as_path())
+                .ok()
+                .map(|m| m.len())
+        } else {
+            None
+        };
+        let execute =
+            || file_ops::execute_action(current_path.as_path(), action, dry_run, source_path);
+        let op_result = if network::is_retryable(action) {
+            network::with_retries(execute)
+        } else {
+            execute()
+        }
+        .map_err(|e| TookaError::FileOperationError(format!("Failed to execute action: {e}")))?;
+        let moved = op_result.action == "move" && op_result.new_path != *current_path;
 
         let log_prefix = if dry_run { "DRY" } else { "" };
         log_file_operation(&format!(
@@ -136,26 +568,256 @@ fn sort_file(
             matched_rule_id: rule.id.clone(),
             current_path: current_path.clone(),
             new_path: op_result.new_path.clone(),
+            conflict: op_result.conflict,
+            error: None,
+            size: size.filter(|_| moved),
         });
 
-        if op_result.action == "delete" {
+        let removed = op_result.action == "delete"
+            || op_result.action == "trash"
+            || op_result.action == "quarantine"
+            || matches!(action, Action::Compress(inner) if inner.remove_source)
+            || matches!(action, Action::Extract(inner) if inner.remove_archive);
+        if removed {
             if i + 1 < rule.then.len() {
                 log::warn!(
-                    "File was deleted, skipping {} remaining action(s).",
+                    "File was removed, skipping {} remaining action(s).",
                     rule.then.len() - (i + 1)
                 );
             }
-            break;
+            return Ok(true);
         }
 
-        current_path.clone_from(&op_result.new_path);
+        // Compressed, extracted and linked files stay where they are
+        if !matches!(
+            action,
+            Action::Compress(_) | Action::Extract(_) | Action::Symlink(_)
+        ) {
+            current_path.clone_from(&op_result.new_path);
+        }
     }
+    Ok(false)
+}
 
-    Ok(results)
+/// Finds the rule to apply to a file among the rules from index `from` on,
+/// resolving ties according to the `tie_break` of `options`.
+///
+/// Since rules are pre-sorted by priority, the first match has the highest
+/// priority and any rules tied with it directly follow it.
+fn select_rule<'a>(
+    file_path: &Path,
+    rules_file: &'a RulesFile,
+    from: usize,
+    options: &SortOptions,
+) -> Result<Option<(usize, &'a Rule)>, TookaError> {
+    let rules = &rules_file.rules;
+    let tie_break = options.tie_break;
+    let matches = |i: usize| {
+        file_match::match_rule_matcher(file_path, &rules[i].when, &options.extension_lists)
+    };
+    let Some(first) = (from..rules.len()).find(|&i| matches(i)) else {
+        return Ok(None);
+    };
+    if tie_break == TieBreak::First {
+        return Ok(Some((first, &rules[first])));
+    }
+
+    let priority = rules[first].priority;
+    let tied: Vec<usize> = std::iter::once(first)
+        .chain(
+            (first + 1..rules.len())
+                .take_while(|&i| rules[i].priority == priority)
+                .filter(|&i| matches(i)),
+        )
+        .collect();
+
+    if tie_break == TieBreak::Error && tied.len() > 1 {
+        let ids: Vec<&str> = tied.iter().map(|&i| rules[i].id.as_str()).collect();
+        return Err(TookaError::InvalidRule(format!(
+            "File '{}' matches rules {} with equal priority {}; give them different priorities or change tie_break",
+            file_path.display(),
+            ids.join(", "),
+            priority
+        )));
+    }
+
+    let index = tied.last().copied().unwrap_or(first);
+    Ok(Some((index, &rules[index])))
 }
 
-/// Recursively collects all files in the given directory using optimized traversal
+/// Checks that the source folder exists and is readable before a run starts.
+///
+/// A missing source folder is usually an unmounted or disconnected drive, so it
+/// is reported by name instead of failing while walking the folder. With
+/// `create`, a missing source folder is created instead.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the source folder is missing (and not created),
+/// is not a directory, or cannot be read.
+pub fn prepare_source(source: &Path, create: bool) -> Result<(), TookaError> {
+    if !source.exists() {
+        if !create {
+            return Err(TookaError::ConfigError(format!(
+                "Source folder '{}' does not exist; check that its drive is mounted, or pass --create-source to create it",
+                source.display()
+            )));
+        }
+        log::info!("Creating missing source folder '{}'", source.display());
+        fs::create_dir_all(source).map_err(|e| {
+            TookaError::ConfigError(format!(
+                "Failed to create source folder '{}': {e}",
+                source.display()
+            ))
+        })?;
+    }
+
+    if !source.is_dir() {
+        return Err(TookaError::ConfigError(format!(
+            "Source folder '{}' is not a directory",
+            source.display()
+        )));
+    }
+    fs::read_dir(source).map_err(|e| {
+        TookaError::ConfigError(format!(
+            "Source folder '{}' is not readable: {e}",
+            source.display()
+        ))
+    })?;
+    Ok(())
+}
+
+/// Ad-hoc narrowing of the files a sort considers, applied before any rule.
+///
+/// Files ignored by `.tookaignore` are never collected, so no filter brings
+/// them back. An empty filter keeps every file.
+#[derive(Debug, Clone, Default)]
+pub struct FileFilter {
+    /// Glob patterns; a file is kept if its name or its path relative to the
+    /// source folder matches any of them.
+    pub patterns: Vec<Pattern>,
+    /// Only keep files modified within this duration.
+    pub newer_than: Option<Duration>,
+    /// Glob patterns; if any, a file is kept only if its name matches one of them.
+    pub include: Vec<Pattern>,
+    /// Glob patterns; a file whose name matches any of them is left out, even
+    /// if it is included.
+    pub exclude: Vec<Pattern>,
+}
+
+impl FileFilter {
+    /// Creates a filter from glob patterns and an optional maximum file age.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if a pattern is not a valid glob.
+    pub fn new(patterns: &[String], newer_than: Option<Duration>) -> Result<Self, TookaError> {
+        Ok(Self {
+            patterns: patterns
+                .iter()
+                .map(|p| Pattern::new(p))
+                .collect::<Result<_, _>>()?,
+            newer_than,
+            ..Default::default()
+        })
+    }
+
+    /// Adds glob patterns the file names must match (`include`) or must not
+    /// match (`exclude`) to the filter.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if a pattern is not a valid glob.
+    pub fn with_names(
+        mut self,
+        include: &[String],
+        exclude: &[String],
+    ) -> Result<Self, TookaError> {
+        let compile = |patterns: &[String]| {
+            patterns
+                .iter()
+                .map(|p| Pattern::new(p))
+                .collect::<Result<Vec<_>, _>>()
+        };
+        self.include = compile(include)?;
+        self.exclude = compile(exclude)?;
+        Ok(self)
+    }
+
+    /// Returns true if the filter keeps every file.
+    pub fn is_empty(&self) -> bool {
+        self.patterns.is_empty()
+            && self.newer_than.is_none()
+            && self.include.is_empty()
+            && self.exclude.is_empty()
+    }
+
+    /// Checks whether a file found in `source` passes the filter at time `now`.
+    pub fn matches(&self, file_path: &Path, source: &Path, now: SystemTime) -> bool {
+        let file_name = file_path
+            .file_name()
+            .and_then(|s| s.to_str())
+            .unwrap_or_default();
+        if self.exclude.iter().any(|p| p.matches(file_name)) {
+            return false;
+        }
+        if !self.include.is_empty() && !self.include.iter().any(|p| p.matches(file_name)) {
+            return false;
+        }
+        if !self.patterns.is_empty() {
+            let relative_path = file_path.strip_prefix(source).unwrap_or(file_path);
+            if !self
+                .patterns
+                .iter()
+                .any(|p| p.matches(file_name) || p.matches_path(relative_path))
+            {
+                return false;
+            }
+        }
+        if let Some(max_age) = self.newer_than {
+            // Files whose age cannot be determined are left out rather than guessed
+            let Ok(modified) = fs::metadata(file_path).and_then(|m| m.modified()) else {
+                log::warn!(
+                    "Could not read modification time of '{}', filtering it out",
+                    file_path.display()
+                );
+                return false;
+            };
+            if now.duration_since(modified).unwrap_or_default() > max_age {
+                return false;
+            }
+        }
+        true
+    }
+
+    /// Removes the files that do not pass the filter.
+    pub fn apply(&self, files: &mut Vec<PathBuf>, source: &Path) {
+        if self.is_empty() {
+            return;
+        }
+        let now = SystemTime::now();
+        let total = files.len();
+        files.retain(|f| self.matches(f, source, now));
+        log::debug!("File filter kept {} of {} files", files.len(), total);
+    }
+}
+
+/// Recursively collects all files in the given directory using optimized traversal.
+///
+/// Files and folders ignored by `.tookaignore` files are skipped, as are
+/// ignore files themselves and folder index files written by the `index` action.
+/// Symbolic links are collected as links, not followed, unless they point to a
+/// directory, so `is_symlink` conditions can match them.
 pub fn collect_files(dir: &Path) -> Result<Vec<PathBuf>, TookaError> {
+    collect_files_to_depth(dir, None)
+}
+
+/// Collects the files in the given directory down to `max_depth` levels of
+/// subfolders: `0` collects only the files directly in `dir`, `1` adds those
+/// of its immediate subfolders, and `None` walks the whole tree.
+///
+/// Folders below the limit are not descended into at all.
+pub fn collect_files_to_depth(
+    dir: &Path,
+    max_depth: Option<usize>,
+) -> Result<Vec<PathBuf>, TookaError> {
     if !dir.exists() || !dir.is_dir() {
         return Err(TookaError::ConfigError(format!(
             "Path '{}' does not exist or is not a directory.",
@@ -163,12 +825,36 @@ pub fn collect_files(dir: &Path) -> Result<Vec<PathBuf>, TookaError> {
         )));
     }
 
-    let files: Result<Vec<PathBuf>, std::io::Error> = WalkDir::new(dir)
-        .follow_links(false)
+    let mut ignore = IgnoreMatcher::load(dir)?;
+    let mut walker = WalkDir::new(dir).follow_links(false);
+    if let Some(depth) = max_depth {
+        // Files directly in `dir` are at walk depth 1
+        walker = walker.max_depth(depth.saturating_add(1));
+    }
+    let files: Result<Vec<PathBuf>, std::io::Error> = walker
         .into_iter()
+        // Runs in walk order, so a folder's ignore file is loaded before its entries are checked
+        .filter_entry(move |e| {
+            if e.depth() == 0 {
+                return true;
+            }
+            let is_dir = e.file_type().is_dir();
+            if ignore.is_ignored(e.path(), is_dir) {
+                log::debug!("Ignoring '{}'", e.path().display());
+                return false;
+            }
+            if is_dir {
+                if let Err(err) = ignore.load_dir(e.path()) {
+                    log::warn!("Skipping ignore file in '{}': {err}", e.path().display());
+                }
+            }
+            true
+        })
         .par_bridge()
         .filter_map(|entry| match entry {
+            Ok(e) if e.file_name() == INDEX_FILE_NAME || e.file_name() == IGNORE_FILE_NAME => None,
             Ok(e) if e.file_type().is_file() => Some(Ok(e.path().to_path_buf())),
+            Ok(e) if e.path_is_symlink() && !e.path().is_dir() => Some(Ok(e.path().to_path_buf())),
             Ok(_) => None, // Skip directories
             Err(err) => {
                 log::warn!("Error reading directory entry: {err}");
@@ -177,5 +863,9 @@ pub fn collect_files(dir: &Path) -> Result<Vec<PathBuf>, TookaError> {
         })
         .collect();
 
-    files.map_err(|e| TookaError::FileOperationError(format!("Failed to collect files: {e}")))
+    let mut files = files
+        .map_err(|e| TookaError::FileOperationError(format!("Failed to collect files: {e}")))?;
+    // Walked in parallel, so sort to process and report files in a stable order
+    files.sort_unstable();
+    Ok(files)
 }
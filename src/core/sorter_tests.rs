@@ -1,12 +1,21 @@
 #[cfg(test)]
 mod tests {
+    use crate::common::config::TieBreak;
     use crate::core::error::TookaError;
-    use crate::core::sorter::{MatchResult, collect_files, sort_files};
-    use crate::rules::rule::{Action, Conditions, CopyAction, MoveAction, Rule};
+    use crate::core::sorter::{
+        DEFERRED_ACTION, FAILED_ACTION, FileFilter, MatchResult, SortOptions, SortSummary,
+        collect_files, collect_files_to_depth, destructive_results, prepare_source, sort_files,
+    };
+    use crate::rules::rule::{
+        Action, Conditions, ConflictStrategy, CopyAction, DeleteAction, MoveAction,
+        QuarantineAction, Rule,
+    };
     use crate::rules::rules_file::RulesFile;
     use crate::utils::gen_pdf::generate_pdf;
     use std::fs::{File, create_dir_all};
     use std::io::Write;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::time::{Duration, Instant, SystemTime};
     use tempfile::tempdir;
 
     /// Helper function to create a test file with content
@@ -53,6 +62,8 @@ mod tests {
                 enabled: true,
                 description: Some("Move all .txt files to txt_files directory".to_string()),
                 priority: 1,
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.txt$".to_string()),
@@ -64,10 +75,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: txt_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
             Rule {
@@ -76,6 +91,8 @@ mod tests {
                 enabled: true,
                 description: Some("Copy all .log files to log_files directory".to_string()),
                 priority: 2,
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.log$".to_string()),
@@ -87,10 +104,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Copy(CopyAction {
                     to: log_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    preserve_metadata: true,
                 })],
             },
             Rule {
@@ -99,6 +120,8 @@ mod tests {
                 enabled: true,
                 description: Some("Move all .data files to data_files directory".to_string()),
                 priority: 3,
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.data$".to_string()),
@@ -110,10 +133,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: data_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
         ];
@@ -133,8 +160,17 @@ mod tests {
         let rules_file = create_test_rules(&source_path);
 
         // Sort files in dry run mode
-        let results = sort_files(&files, &source_path, &rules_file, true, None::<fn()>)
-            .expect("sort_files should succeed");
+        let results = sort_files(
+            &files,
+            &source_path,
+            &rules_file,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .expect("sort_files should succeed");
 
         // Check that we got results for all files
         assert_eq!(results.len(), files.len());
@@ -178,8 +214,17 @@ mod tests {
         let rules_file = create_test_rules(&source_path);
 
         // Sort files with actual execution (not dry run)
-        let results = sort_files(&files, &source_path, &rules_file, false, None::<fn()>)
-            .expect("sort_files should succeed");
+        let results = sort_files(
+            &files,
+            &source_path,
+            &rules_file,
+            &SortOptions {
+                dry_run: false,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .expect("sort_files should succeed");
 
         // Check that txt file was moved
         let txt_result = results.iter().find(|r| r.file_name == "test1.txt").unwrap();
@@ -240,6 +285,8 @@ mod tests {
                 enabled: true,
                 description: None,
                 priority: 1, // Lower priority (lower number)
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.txt$".to_string()),
@@ -251,10 +298,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: low_priority_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
             Rule {
@@ -263,6 +314,8 @@ mod tests {
                 enabled: true,
                 description: None,
                 priority: 10, // Higher priority (higher number)
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.txt$".to_string()),
@@ -274,10 +327,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: high_priority_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
         ];
@@ -290,8 +347,11 @@ mod tests {
             &[test_file],
             &source_path,
             &optimized_rules,
-            true,
-            None::<fn()>,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
         )
         .expect("sort_files should succeed");
 
@@ -313,7 +373,7 @@ mod tests {
         let progress_count = std::sync::Arc::new(std::sync::atomic::AtomicUsize::new(0));
         let progress_count_clone = progress_count.clone();
 
-        let progress_callback = move || {
+        let progress_callback = move |_: &std::path::Path, _: &[MatchResult]| {
             progress_count_clone.fetch_add(1, std::sync::atomic::Ordering::SeqCst);
         };
 
@@ -322,8 +382,11 @@ mod tests {
             &files,
             &source_path,
             &rules_file,
-            true,
-            Some(progress_callback),
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            progress_callback,
         )
         .expect("sort_files should succeed");
 
@@ -357,6 +420,8 @@ mod tests {
             enabled: true,
             description: None,
             priority: 1,
+            max_per_run: None,
+            stop_on_match: true,
             when: Conditions {
                 any: Some(false),
                 filename: Some(r".*\.txt$".to_string()),
@@ -368,15 +433,22 @@ mod tests {
                 modified_date: None,
                 is_symlink: None,
                 metadata: None,
+                ..Default::default()
             },
             then: vec![
                 Action::Copy(CopyAction {
                     to: copy_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    preserve_metadata: true,
                 }),
                 Action::Move(MoveAction {
                     to: move_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 }),
             ],
         }];
@@ -384,8 +456,17 @@ mod tests {
         let rules_file = RulesFile { rules };
 
         // Sort the file
-        let results = sort_files(&[test_file], &source_path, &rules_file, true, None::<fn()>)
-            .expect("sort_files should succeed");
+        let results = sort_files(
+            &[test_file],
+            &source_path,
+            &rules_file,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .expect("sort_files should succeed");
 
         // Should have two results for the two actions
         assert_eq!(results.len(), 2);
@@ -430,6 +511,56 @@ mod tests {
         }
     }
 
+    #[cfg(unix)]
+    #[test]
+    fn test_collect_files_includes_symlinks_without_following_them() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path();
+        let target = source_path.join("target.txt");
+        let linked_dir = source_path.join("linked_dir");
+        create_test_file(&target, "content").unwrap();
+        create_dir_all(source_path.join("real_dir")).unwrap();
+        create_test_file(&source_path.join("real_dir/inner.txt"), "content").unwrap();
+        std::os::unix::fs::symlink(&target, source_path.join("link.txt")).unwrap();
+        std::os::unix::fs::symlink(source_path.join("real_dir"), &linked_dir).unwrap();
+
+        let mut collected = collect_files(source_path).unwrap();
+        collected.sort();
+
+        // Links to directories are neither collected nor descended into
+        assert_eq!(
+            collected,
+            vec![
+                source_path.join("link.txt"),
+                source_path.join("real_dir/inner.txt"),
+                target,
+            ]
+        );
+    }
+
+    #[test]
+    fn test_collect_files_to_depth() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path();
+        let top = source_path.join("top.txt");
+        let first = source_path.join("a/first.txt");
+        let second = source_path.join("a/b/second.txt");
+        let third = source_path.join("a/b/c/third.txt");
+        create_dir_all(source_path.join("a/b/c")).unwrap();
+        for file in [&top, &first, &second, &third] {
+            create_test_file(file, "content").unwrap();
+        }
+
+        let collect = |depth| collect_files_to_depth(source_path, depth).unwrap();
+        assert_eq!(collect(Some(0)), vec![top.clone()]);
+        assert_eq!(collect(Some(1)), vec![first.clone(), top.clone()]);
+        assert_eq!(
+            collect(Some(2)),
+            vec![second.clone(), first.clone(), top.clone()]
+        );
+        assert_eq!(collect(None), vec![third, second, first, top]);
+    }
+
     #[test]
     fn test_collect_files_nonexistent_directory() {
         let temp_dir = tempdir().unwrap();
@@ -453,8 +584,17 @@ mod tests {
         let rules_file = create_test_rules(&source_path);
 
         // Sort empty file list
-        let results = sort_files(&[], &source_path, &rules_file, true, None::<fn()>)
-            .expect("sort_files should succeed with empty list");
+        let results = sort_files(
+            &[],
+            &source_path,
+            &rules_file,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .expect("sort_files should succeed with empty list");
 
         assert_eq!(results.len(), 0);
     }
@@ -475,6 +615,8 @@ mod tests {
             enabled: false, // Disabled
             description: None,
             priority: 1,
+            max_per_run: None,
+            stop_on_match: true,
             when: Conditions {
                 any: Some(false),
                 filename: Some(r".*\.txt$".to_string()),
@@ -486,10 +628,14 @@ mod tests {
                 modified_date: None,
                 is_symlink: None,
                 metadata: None,
+                ..Default::default()
             },
             then: vec![Action::Move(MoveAction {
                 to: source_path.join("dest").to_string_lossy().to_string(),
                 preserve_structure: false,
+                dir_mode: None,
+                path_template: None,
+                on_conflict: ConflictStrategy::default(),
             })],
         }];
 
@@ -529,6 +675,8 @@ mod tests {
                 enabled: false, // Disabled
                 description: None,
                 priority: 10, // Higher priority but disabled
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.txt$".to_string()),
@@ -540,10 +688,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: disabled_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
             Rule {
@@ -552,6 +704,8 @@ mod tests {
                 enabled: true, // Enabled
                 description: None,
                 priority: 5, // Lower priority but enabled
+                max_per_run: None,
+                stop_on_match: true,
                 when: Conditions {
                     any: Some(false),
                     filename: Some(r".*\.txt$".to_string()),
@@ -563,10 +717,14 @@ mod tests {
                     modified_date: None,
                     is_symlink: None,
                     metadata: None,
+                    ..Default::default()
                 },
                 then: vec![Action::Move(MoveAction {
                     to: enabled_dir.to_string_lossy().to_string(),
                     preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
                 })],
             },
         ];
@@ -579,8 +737,11 @@ mod tests {
             std::slice::from_ref(&test_file),
             &source_path,
             &optimized_rules,
-            true,
-            None::<fn()>,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
         )
         .expect("sort_files should succeed");
 
@@ -610,8 +771,11 @@ mod tests {
             &files,
             &source_path,
             &rules_file,
-            true, // dry run
-            None::<fn()>,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
         )
         .expect("sort_files should succeed");
 
@@ -686,6 +850,9 @@ mod tests {
                 new_path: source_path.join("txt_files").join(format!("file{i}.txt")),
                 matched_rule_id: "txt_rule".to_string(),
                 action: "move".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -696,6 +863,9 @@ mod tests {
                 new_path: source_path.join("log_files").join(format!("log{i}.log")),
                 matched_rule_id: "log_rule".to_string(),
                 action: "copy".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -706,6 +876,9 @@ mod tests {
                 new_path: source_path.join("data_files").join(format!("data{i}.data")),
                 matched_rule_id: "data_rule".to_string(),
                 action: "move".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -718,6 +891,9 @@ mod tests {
                     .join(format!("executed_{i}.exe")),
                 matched_rule_id: "execute_rule".to_string(),
                 action: "execute".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -728,6 +904,9 @@ mod tests {
                 new_path: source_path.join(format!("unknown{i}.unknown")), // Same path for skip
                 matched_rule_id: "none".to_string(),
                 action: "skip".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -789,6 +968,9 @@ mod tests {
                     .join(format!("document_{i}.txt")),
                 matched_rule_id: "document_organization_rule".to_string(),
                 action: "move".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -801,6 +983,9 @@ mod tests {
                     .join(format!("backup_{i}.log")),
                 matched_rule_id: "log_backup_rule".to_string(),
                 action: "copy".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -811,6 +996,9 @@ mod tests {
                 new_path: base_path.join("temp").join(format!("temp_{i}.tmp")), // Same path for delete
                 matched_rule_id: "cleanup_rule".to_string(),
                 action: "delete".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -821,6 +1009,9 @@ mod tests {
                 new_path: base_path.join("data").join(format!("new_file_{i}.dat")),
                 matched_rule_id: "rename_rule".to_string(),
                 action: "rename".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -833,6 +1024,9 @@ mod tests {
                     .join(format!("executed_script_{i}.result")),
                 matched_rule_id: "script_execution_rule".to_string(),
                 action: "execute".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -843,6 +1037,9 @@ mod tests {
                 new_path: base_path.join("misc").join(format!("unknown_{i}.xyz")), // Same path for skip
                 matched_rule_id: "none".to_string(),
                 action: "skip".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             });
         }
 
@@ -902,6 +1099,9 @@ mod tests {
                 ),
                 matched_rule_id: "document_organization_with_very_long_rule_name".to_string(),
                 action: "move".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             },
             MatchResult {
                 file_name: "short.log".to_string(),
@@ -911,6 +1111,9 @@ mod tests {
                 new_path: std::path::PathBuf::from("/backup/logs/short.log"),
                 matched_rule_id: "log_backup".to_string(),
                 action: "copy".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             },
             MatchResult {
                 file_name: "file_in_normal_path.dat".to_string(),
@@ -918,6 +1121,9 @@ mod tests {
                 new_path: std::path::PathBuf::from("/home/user/archived/file_in_normal_path.dat"),
                 matched_rule_id: "normal_rule".to_string(),
                 action: "move".to_string(),
+                conflict: None,
+                error: None,
+                size: None,
             },
         ];
 
@@ -939,4 +1145,780 @@ mod tests {
             "PDF should be substantial for inspection"
         );
     }
+
+    #[test]
+    fn test_sort_files_max_per_run() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().join("source");
+        let archive_dir = temp_dir.path().join("archive");
+        create_dir_all(&source_path).unwrap();
+
+        let files: Vec<_> = (0..5)
+            .map(|i| {
+                let path = source_path.join(format!("old{i}.txt"));
+                create_test_file(&path, "old content").unwrap();
+                path
+            })
+            .collect();
+
+        let rules_file = RulesFile {
+            rules: vec![Rule {
+                id: "archive_rule".to_string(),
+                name: "Archive old files".to_string(),
+                enabled: true,
+                description: None,
+                priority: 1,
+                max_per_run: Some(2),
+                stop_on_match: true,
+                when: Conditions {
+                    extensions: Some(vec!["txt".to_string()]),
+                    ..Default::default()
+                },
+                then: vec![Action::Move(MoveAction {
+                    to: archive_dir.to_string_lossy().to_string(),
+                    preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
+                })],
+            }],
+        };
+
+        let results = sort_files(
+            &files,
+            &source_path,
+            &rules_file,
+            &SortOptions {
+                dry_run: false,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .expect("sort_files should succeed");
+
+        let moved = results.iter().filter(|r| r.action == "move").count();
+        let deferred: Vec<_> = results
+            .iter()
+            .filter(|r| r.action == DEFERRED_ACTION)
+            .collect();
+        assert_eq!(moved, 2, "rule should act on exactly max_per_run files");
+        assert_eq!(deferred.len(), 3);
+        assert!(deferred.iter().all(|r| r.matched_rule_id == "archive_rule"));
+        assert!(deferred.iter().all(|r| r.current_path.exists()));
+        assert_eq!(std::fs::read_dir(&archive_dir).unwrap().count(), 2);
+    }
+
+    /// Two enabled rules of equal priority that both match `.txt` files
+    fn tied_rules() -> RulesFile {
+        let rule = |id: &str, priority: u32| Rule {
+            id: id.to_string(),
+            name: format!("Rule {id}"),
+            enabled: true,
+            description: None,
+            priority,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                extensions: Some(vec!["txt".to_string()]),
+                ..Default::default()
+            },
+            then: vec![Action::Skip],
+        };
+        RulesFile {
+            rules: vec![rule("low", 1), rule("first", 5), rule("last", 5)],
+        }
+        .optimized_with_filter(None)
+        .unwrap()
+    }
+
+    fn sort_tied(tie_break: TieBreak) -> Result<Vec<MatchResult>, TookaError> {
+        let temp_dir = tempdir().unwrap();
+        let file = temp_dir.path().join("notes.txt");
+        create_test_file(&file, "content").unwrap();
+        sort_files(
+            &[file],
+            temp_dir.path(),
+            &tied_rules(),
+            &SortOptions {
+                dry_run: true,
+                tie_break,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+    }
+
+    #[test]
+    fn test_tie_break_first() {
+        let results = sort_tied(TieBreak::First).unwrap();
+        assert_eq!(results[0].matched_rule_id, "first");
+    }
+
+    #[test]
+    fn test_tie_break_last() {
+        let results = sort_tied(TieBreak::Last).unwrap();
+        assert_eq!(results[0].matched_rule_id, "last");
+    }
+
+    #[test]
+    fn test_tie_break_error() {
+        let results = sort_tied(TieBreak::Error).unwrap();
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].action, FAILED_ACTION);
+        let message = results[0].error.as_deref().unwrap();
+        assert!(message.contains("first, last"), "{message}");
+        assert!(!message.contains("low"), "{message}");
+    }
+
+    #[test]
+    fn test_stop_on_match_decides_whether_lower_priority_rules_act() {
+        let sort_with = |stop_on_match: bool| {
+            let temp_dir = tempdir().unwrap();
+            let source_path = temp_dir.path().join("source");
+            let archive_dir = temp_dir.path().join("archive");
+            let backup_dir = temp_dir.path().join("backup");
+            let file = source_path.join("notes.txt");
+            create_dir_all(&source_path).unwrap();
+            create_test_file(&file, "content").unwrap();
+
+            let txt_rule = |id: &str, priority: u32, action: Action| Rule {
+                id: id.to_string(),
+                name: format!("Rule {id}"),
+                enabled: true,
+                description: None,
+                priority,
+                max_per_run: None,
+                stop_on_match,
+                when: Conditions {
+                    extensions: Some(vec!["txt".to_string()]),
+                    ..Default::default()
+                },
+                then: vec![action],
+            };
+            // Listed lowest priority first, so only sorting by priority puts the move first
+            let rules_file = RulesFile {
+                rules: vec![
+                    txt_rule(
+                        "backup",
+                        1,
+                        Action::Copy(CopyAction {
+                            to: backup_dir.to_string_lossy().to_string(),
+                            preserve_structure: false,
+                            dir_mode: None,
+                            path_template: None,
+                            preserve_metadata: true,
+                        }),
+                    ),
+                    txt_rule(
+                        "archive",
+                        5,
+                        Action::Move(MoveAction {
+                            to: archive_dir.to_string_lossy().to_string(),
+                            preserve_structure: false,
+                            dir_mode: None,
+                            path_template: None,
+                            on_conflict: ConflictStrategy::default(),
+                        }),
+                    ),
+                ],
+            }
+            .optimized_with_filter(None)
+            .unwrap();
+
+            let results = sort_files(
+                &[file],
+                &source_path,
+                &rules_file,
+                &SortOptions::default(),
+                |_, _| {},
+            )
+            .unwrap();
+            let applied: Vec<_> = results
+                .iter()
+                .map(|r| (r.matched_rule_id.clone(), r.current_path.clone()))
+                .collect();
+            (
+                applied,
+                archive_dir.join("notes.txt").exists(),
+                backup_dir.join("notes.txt").exists(),
+                temp_dir,
+            )
+        };
+
+        let (applied, archived, backed_up, _dir) = sort_with(true);
+        assert_eq!(applied.len(), 1);
+        assert_eq!(applied[0].0, "archive");
+        assert!(archived);
+        assert!(!backed_up);
+
+        let (applied, archived, backed_up, dir) = sort_with(false);
+        let ids: Vec<_> = applied.iter().map(|(id, _)| id.as_str()).collect();
+        assert_eq!(ids, ["archive", "backup"]);
+        // The lower-priority rule acts on the file where the move left it
+        assert_eq!(applied[1].1, dir.path().join("archive/notes.txt"));
+        assert!(archived);
+        assert!(backed_up);
+    }
+
+    #[test]
+    fn test_sort_files_with_concurrency_per_destination() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().join("source");
+        let archive_dir = temp_dir.path().join("archive");
+        create_dir_all(&source_path).unwrap();
+        let files: Vec<_> = (0..8)
+            .map(|i| {
+                let path = source_path.join(format!("file{i}.txt"));
+                create_test_file(&path, "content").unwrap();
+                path
+            })
+            .collect();
+        let rules_file = RulesFile {
+            rules: vec![Rule {
+                id: "archive_rule".to_string(),
+                name: "Archive files".to_string(),
+                enabled: true,
+                description: None,
+                priority: 1,
+                max_per_run: None,
+                stop_on_match: true,
+                when: Conditions {
+                    extensions: Some(vec!["txt".to_string()]),
+                    ..Default::default()
+                },
+                then: vec![Action::Move(MoveAction {
+                    to: archive_dir.to_string_lossy().to_string(),
+                    preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
+                })],
+            }],
+        };
+
+        let options = SortOptions {
+            concurrency_per_destination: Some(1),
+            ..Default::default()
+        };
+        let results = sort_files(&files, &source_path, &rules_file, &options, |_, _| {})
+            .expect("sort_files should succeed");
+
+        assert_eq!(results.iter().filter(|r| r.action == "move").count(), 8);
+        assert_eq!(std::fs::read_dir(&archive_dir).unwrap().count(), 8);
+    }
+
+    #[test]
+    fn test_prepare_source_missing_folder() {
+        let temp_dir = tempdir().unwrap();
+        let missing = temp_dir.path().join("unmounted").join("Downloads");
+
+        let err = prepare_source(&missing, false).unwrap_err();
+        assert!(err.to_string().contains(&missing.display().to_string()));
+        assert!(err.to_string().contains("--create-source"));
+        assert!(!missing.exists());
+
+        prepare_source(&missing, true).expect("missing source should be created");
+        assert!(missing.is_dir());
+        assert!(collect_files(&missing).unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_prepare_source_rejects_file() {
+        let temp_dir = tempdir().unwrap();
+        let file = temp_dir.path().join("not_a_folder.txt");
+        create_test_file(&file, "content").unwrap();
+
+        assert!(prepare_source(&file, false).is_err());
+        assert!(prepare_source(&file, true).is_err());
+        assert!(prepare_source(temp_dir.path(), false).is_ok());
+    }
+
+    #[test]
+    fn test_sort_summary_counts_outcomes() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().join("source");
+        create_dir_all(&source_path).unwrap();
+        let files = create_test_files(&source_path);
+        let mut rules_file = create_test_rules(&temp_dir.path().join("dest"));
+        // Disabled rules are left out of the run and never match
+        for rule in &mut rules_file.rules {
+            rule.enabled = rule.id == "txt_rule";
+        }
+        let rules_file = rules_file.optimized_with_filter(None).unwrap();
+
+        let results = sort_files(
+            &files,
+            &source_path,
+            &rules_file,
+            &SortOptions::default(),
+            |_, _| {},
+        )
+        .unwrap();
+        let summary = SortSummary::from_results(&results);
+
+        assert_eq!(summary.matched, 1);
+        assert_eq!(summary.moved, 1);
+        assert_eq!(summary.copied, 0);
+        assert_eq!(summary.skipped, 4);
+        assert_eq!(summary.deferred, 0);
+        assert_eq!(summary.deleted, 0);
+        // Only the moved test1.txt counts, with its "text content"
+        assert_eq!(summary.bytes_moved, 12);
+
+        let printed = SortSummary {
+            scanned: files.len(),
+            errors: 1,
+            elapsed: Duration::from_millis(1500),
+            ..summary
+        }
+        .to_string();
+        assert_eq!(
+            printed,
+            "5 scanned, 1 matched, 1 moved, 0 copied, 0 deleted, 4 skipped, 1 errors | 12 B moved in 1.50s"
+        );
+    }
+
+    #[test]
+    fn test_quarantined_file_is_left_alone_by_lower_priority_rules() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().join("source");
+        let quarantine_dir = temp_dir.path().join("quarantine");
+        let archive_dir = temp_dir.path().join("archive");
+        let file = source_path.join("virus.exe");
+        create_dir_all(&source_path).unwrap();
+        create_test_file(&file, "content").unwrap();
+
+        let exe_rule = |id: &str, priority: u32, action: Action| Rule {
+            id: id.to_string(),
+            name: format!("Rule {id}"),
+            enabled: true,
+            description: None,
+            priority,
+            max_per_run: None,
+            stop_on_match: false,
+            when: Conditions {
+                extensions: Some(vec!["exe".to_string()]),
+                ..Default::default()
+            },
+            then: vec![action],
+        };
+        let rules_file = RulesFile {
+            rules: vec![
+                exe_rule(
+                    "quarantine",
+                    5,
+                    Action::Quarantine(QuarantineAction {
+                        days: 30,
+                        to: Some(quarantine_dir.to_string_lossy().to_string()),
+                    }),
+                ),
+                exe_rule(
+                    "archive",
+                    1,
+                    Action::Move(MoveAction {
+                        to: archive_dir.to_string_lossy().to_string(),
+                        preserve_structure: false,
+                        dir_mode: None,
+                        path_template: None,
+                        on_conflict: ConflictStrategy::default(),
+                    }),
+                ),
+            ],
+        }
+        .optimized_with_filter(None)
+        .unwrap();
+
+        let results = sort_files(
+            &[file],
+            &source_path,
+            &rules_file,
+            &SortOptions::default(),
+            |_, _| {},
+        )
+        .unwrap();
+
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].action, "quarantine");
+        assert!(results[0].new_path.starts_with(&quarantine_dir));
+        assert!(results[0].new_path.exists());
+        assert!(!archive_dir.join("virus.exe").exists());
+    }
+
+    #[test]
+    fn test_sort_summary_counts_quarantine_and_sizes_at_move_time() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().join("source");
+        create_dir_all(&source_path).unwrap();
+        let files = create_test_files(&source_path);
+        let mut rules_file = create_test_rules(&temp_dir.path().join("dest"));
+        for rule in &mut rules_file.rules {
+            rule.enabled = rule.id == "txt_rule";
+        }
+        let rules_file = rules_file.optimized_with_filter(None).unwrap();
+
+        let mut results = sort_files(
+            &files,
+            &source_path,
+            &rules_file,
+            &SortOptions::default(),
+            |_, _| {},
+        )
+        .unwrap();
+        let moved = results.iter().find(|r| r.action == "move").unwrap();
+        // Changes at the destination after the run do not alter what it moved
+        std::fs::write(&moved.new_path, "much longer content than before").unwrap();
+        results.push(MatchResult {
+            file_name: "virus.exe".to_string(),
+            action: "quarantine".to_string(),
+            matched_rule_id: "quarantine_rule".to_string(),
+            current_path: source_path.join("virus.exe"),
+            new_path: temp_dir.path().join("quarantine").join("virus.exe"),
+            conflict: None,
+            error: None,
+            size: None,
+        });
+        let summary = SortSummary::from_results(&results);
+
+        assert_eq!(summary.bytes_moved, 12);
+        assert_eq!(summary.quarantined, 1);
+        assert_eq!(summary.matched, 2);
+        assert!(summary.to_string().contains(", 1 quarantined |"));
+    }
+
+    #[test]
+    fn test_sort_with_empty_rules_skips_every_file() {
+        let temp_dir = tempdir().unwrap();
+        let files = create_test_files(temp_dir.path());
+
+        let results = sort_files(
+            &files,
+            temp_dir.path(),
+            &RulesFile::default(),
+            &SortOptions::default(),
+            |_, _| {},
+        )
+        .unwrap();
+
+        assert_eq!(
+            SortSummary::from_results(&results),
+            SortSummary {
+                skipped: 5,
+                ..Default::default()
+            }
+        );
+        assert!(files.iter().all(|f| f.exists()));
+    }
+
+    #[test]
+    fn test_sort_stops_starting_files_after_deadline() {
+        let temp_dir = tempdir().unwrap();
+        let files = create_test_files(temp_dir.path());
+        let options = SortOptions {
+            deadline: Some(Instant::now() + Duration::from_millis(50)),
+            ..Default::default()
+        };
+        let processed = AtomicUsize::new(0);
+
+        // A single worker makes the number of files started before the deadline exact
+        let pool = rayon::ThreadPoolBuilder::new()
+            .num_threads(1)
+            .build()
+            .unwrap();
+        let results = pool
+            .install(|| {
+                sort_files(
+                    &files,
+                    temp_dir.path(),
+                    &RulesFile::default(),
+                    &options,
+                    |_, _| {
+                        // The first file takes longer than the whole budget
+                        processed.fetch_add(1, Ordering::SeqCst);
+                        std::thread::sleep(Duration::from_millis(100));
+                    },
+                )
+            })
+            .unwrap();
+
+        assert_eq!(processed.load(Ordering::SeqCst), 1);
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].current_path, files[0]);
+    }
+
+    #[test]
+    fn test_destructive_results_lists_only_deletions() {
+        let temp_dir = tempdir().unwrap();
+        let files = create_test_files(temp_dir.path());
+        let dest = temp_dir.path().join("dest");
+        let rules_file = RulesFile {
+            rules: vec![
+                Rule {
+                    id: "move_txt".to_string(),
+                    name: "Move txt files".to_string(),
+                    enabled: true,
+                    description: None,
+                    priority: 1,
+                    max_per_run: None,
+                    stop_on_match: true,
+                    when: Conditions {
+                        extensions: Some(vec!["txt".to_string()]),
+                        ..Default::default()
+                    },
+                    then: vec![Action::Move(MoveAction {
+                        to: dest.to_string_lossy().to_string(),
+                        preserve_structure: false,
+                        dir_mode: None,
+                        path_template: None,
+                        on_conflict: ConflictStrategy::default(),
+                    })],
+                },
+                Rule {
+                    id: "delete_logs".to_string(),
+                    name: "Delete log files".to_string(),
+                    enabled: true,
+                    description: None,
+                    priority: 1,
+                    max_per_run: None,
+                    stop_on_match: true,
+                    when: Conditions {
+                        extensions: Some(vec!["log".to_string()]),
+                        ..Default::default()
+                    },
+                    then: vec![Action::Delete(DeleteAction {
+                        trash: false,
+                        secure: false,
+                        passes: None,
+                    })],
+                },
+            ],
+        };
+
+        let results = sort_files(
+            &files,
+            temp_dir.path(),
+            &rules_file,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .unwrap();
+        let deletions = destructive_results(&results);
+
+        assert_eq!(deletions.len(), 1);
+        assert_eq!(deletions[0].matched_rule_id, "delete_logs");
+        assert_eq!(deletions[0].current_path, temp_dir.path().join("test2.log"));
+        // A dry run leaves the files for their sizes to be read
+        assert!(files.iter().all(|f| f.exists()));
+    }
+
+    #[test]
+    fn test_file_filter_narrows_files_before_rules() {
+        let temp_dir = tempdir().unwrap();
+        let source = temp_dir.path();
+        let reports = source.join("reports");
+        create_dir_all(&reports).unwrap();
+        let recent_pdf = reports.join("recent.pdf");
+        let old_pdf = source.join("old.pdf");
+        let notes = source.join("notes.txt");
+        for file in [&recent_pdf, &old_pdf, &notes] {
+            create_test_file(file, "content").unwrap();
+        }
+        let old = SystemTime::now() - Duration::from_secs(30 * 86_400);
+        File::options()
+            .write(true)
+            .open(&old_pdf)
+            .unwrap()
+            .set_modified(old)
+            .unwrap();
+
+        let mut files = collect_files(source).unwrap();
+        FileFilter::new(
+            &["*.pdf".to_string()],
+            Some(Duration::from_secs(7 * 86_400)),
+        )
+        .unwrap()
+        .apply(&mut files, source);
+        assert_eq!(files, vec![recent_pdf.clone()]);
+
+        // Patterns also match the path relative to the source folder
+        let mut files = collect_files(source).unwrap();
+        FileFilter::new(&["reports/*".to_string()], None)
+            .unwrap()
+            .apply(&mut files, source);
+        assert_eq!(files, vec![recent_pdf.clone()]);
+
+        // A rule matching every file only sees the filtered ones
+        let rules_file = RulesFile {
+            rules: vec![Rule {
+                id: "all_files".to_string(),
+                name: "Skip everything".to_string(),
+                enabled: true,
+                description: None,
+                priority: 1,
+                max_per_run: None,
+                stop_on_match: true,
+                when: Conditions::default(),
+                then: vec![Action::Skip],
+            }],
+        };
+        let results = sort_files(
+            &files,
+            source,
+            &rules_file,
+            &SortOptions {
+                dry_run: true,
+                ..Default::default()
+            },
+            |_, _| {},
+        )
+        .unwrap();
+        assert_eq!(results.len(), 1);
+        assert_eq!(results[0].current_path, recent_pdf);
+
+        assert!(FileFilter::new(&["[".to_string()], None).is_err());
+        assert!(FileFilter::default().is_empty());
+    }
+
+    #[test]
+    fn test_include_and_exclude_filter_names_after_ignore_file() {
+        let temp_dir = tempdir().unwrap();
+        let source = temp_dir.path();
+        let nested = source.join("nested");
+        create_dir_all(&nested).unwrap();
+        let invoice = nested.join("invoice.pdf");
+        let draft = source.join("invoice_draft.pdf");
+        let secret = source.join("secret.pdf");
+        let notes = source.join("notes.txt");
+        for file in [&invoice, &draft, &secret, &notes] {
+            create_test_file(file, "content").unwrap();
+        }
+        create_test_file(&source.join(".tookaignore"), "secret.pdf\n").unwrap();
+
+        let filtered = |include: &[&str], exclude: &[&str]| {
+            let to_strings =
+                |globs: &[&str]| globs.iter().map(|g| g.to_string()).collect::<Vec<_>>();
+            let mut files = collect_files(source).unwrap();
+            FileFilter::default()
+                .with_names(&to_strings(include), &to_strings(exclude))
+                .unwrap()
+                .apply(&mut files, source);
+            files.sort();
+            files
+        };
+
+        // Ignored files stay ignored, even if included
+        let mut pdfs = vec![invoice.clone(), draft.clone()];
+        pdfs.sort();
+        assert_eq!(filtered(&["*.pdf"], &[]), pdfs);
+        assert_eq!(
+            filtered(&["secret.pdf"], &[]),
+            Vec::<std::path::PathBuf>::new()
+        );
+
+        // Excludes win over includes and match the base name only
+        assert_eq!(
+            filtered(&["*.pdf"], &["*_draft.pdf"]),
+            vec![invoice.clone()]
+        );
+        assert_eq!(filtered(&["*.pdf"], &["nested*"]), pdfs);
+        assert_eq!(filtered(&[], &["*.pdf"]), vec![notes.clone()]);
+
+        assert!(
+            FileFilter::default()
+                .with_names(&[], &["[".to_string()])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_min_count_rule_fires_only_above_threshold() {
+        let temp_dir = tempdir().unwrap();
+        let source = temp_dir.path();
+        for name in ["shot1.png", "shot2.png", "shot3.png", "notes.txt"] {
+            create_test_file(&source.join(name), "content").unwrap();
+        }
+        let mut files = collect_files(source).unwrap();
+        files.sort();
+
+        let archive_rules = |min_count| RulesFile {
+            rules: vec![Rule {
+                id: "archive_screenshots".to_string(),
+                name: "Archive screenshots in bulk".to_string(),
+                enabled: true,
+                description: None,
+                priority: 1,
+                max_per_run: None,
+                stop_on_match: true,
+                when: Conditions {
+                    extensions: Some(vec!["png".to_string()]),
+                    min_count: Some(min_count),
+                    ..Default::default()
+                },
+                then: vec![Action::Move(MoveAction {
+                    to: source.join("archive").to_string_lossy().to_string(),
+                    preserve_structure: false,
+                    dir_mode: None,
+                    path_template: None,
+                    on_conflict: ConflictStrategy::default(),
+                })],
+            }],
+        };
+        let moved = |min_count| {
+            sort_files(
+                &files,
+                source,
+                &archive_rules(min_count),
+                &SortOptions {
+                    dry_run: true,
+                    ..Default::default()
+                },
+                |_, _| {},
+            )
+            .unwrap()
+            .iter()
+            .filter(|r| r.action == "move")
+            .count()
+        };
+
+        // Three screenshots reach a threshold of three, so all of them are moved
+        assert_eq!(moved(3), 3);
+        // Below the threshold the rule does not match any file
+        assert_eq!(moved(4), 0);
+    }
+
+    #[test]
+    fn test_sort_results_do_not_depend_on_worker_count() {
+        let temp_dir = tempdir().unwrap();
+        let source_path = temp_dir.path().to_path_buf();
+        let files = create_test_files(&source_path);
+        let rules_file = create_test_rules(&source_path);
+
+        let sort_with = |workers| {
+            sort_files(
+                &files,
+                &source_path,
+                &rules_file,
+                &SortOptions {
+                    dry_run: true,
+                    workers,
+                    ..Default::default()
+                },
+                |_, _| {},
+            )
+            .expect("sort_files should succeed")
+            .into_iter()
+            .map(|r| (r.current_path, r.matched_rule_id, r.action, r.new_path))
+            .collect::<Vec<_>>()
+        };
+
+        let single = sort_with(Some(1));
+        assert_eq!(
+            single.iter().map(|r| &r.0).collect::<Vec<_>>(),
+            files.iter().collect::<Vec<_>>()
+        );
+        assert_eq!(sort_with(Some(4)), single);
+        assert_eq!(sort_with(None), single);
+    }
 }
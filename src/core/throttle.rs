@@ -0,0 +1,102 @@
+//! Per-destination concurrency limits for Tooka.
+//!
+//! Sorting runs file actions in parallel, which pays off when reading from a
+//! fast source but can thrash a slow destination disk. A [`DestinationLimiter`]
+//! caps how many actions write to the same filesystem at once, while actions
+//! targeting other filesystems proceed unhindered.
+
+use std::{
+    collections::HashMap,
+    path::Path,
+    sync::{Condvar, Mutex, PoisonError},
+};
+
+/// Limits the number of concurrent actions per destination filesystem.
+#[derive(Debug)]
+pub struct DestinationLimiter {
+    limit: usize,
+    /// Number of actions currently writing to each filesystem
+    active: Mutex<HashMap<u64, usize>>,
+    released: Condvar,
+}
+
+/// Permission to write to a filesystem, released when dropped.
+#[derive(Debug)]
+pub struct DestinationPermit<'a> {
+    limiter: &'a DestinationLimiter,
+    filesystem: u64,
+}
+
+impl DestinationLimiter {
+    /// Creates a limiter allowing `limit` concurrent actions per filesystem.
+    ///
+    /// A limit of zero is treated as one.
+    pub fn new(limit: usize) -> Self {
+        Self {
+            limit: limit.max(1),
+            active: Mutex::new(HashMap::new()),
+            released: Condvar::new(),
+        }
+    }
+
+    /// Blocks until an action may write to `filesystem`, as returned by [`filesystem_id`].
+    pub fn acquire(&self, filesystem: u64) -> DestinationPermit<'_> {
+        // The counters stay consistent even if a holder panicked
+        let mut active = self.active.lock().unwrap_or_else(PoisonError::into_inner);
+        while active.get(&filesystem).copied().unwrap_or(0) >= self.limit {
+            log::debug!("Waiting for a free slot on filesystem {filesystem}");
+            active = self
+                .released
+                .wait(active)
+                .unwrap_or_else(PoisonError::into_inner);
+        }
+        *active.entry(filesystem).or_insert(0) += 1;
+        DestinationPermit {
+            limiter: self,
+            filesystem,
+        }
+    }
+}
+
+impl Drop for DestinationPermit<'_> {
+    fn drop(&mut self) {
+        let mut active = self
+            .limiter
+            .active
+            .lock()
+            .unwrap_or_else(PoisonError::into_inner);
+        if let Some(count) = active.get_mut(&self.filesystem) {
+            *count -= 1;
+            if *count == 0 {
+                active.remove(&self.filesystem);
+            }
+        }
+        self.limiter.released.notify_all();
+    }
+}
+
+/// Returns an identifier of the filesystem `path` is on, or would be created on.
+///
+/// Uses the device id of the nearest existing ancestor, since destination
+/// folders are often created by the action itself.
+#[cfg(unix)]
+pub fn filesystem_id(path: &Path) -> u64 {
+    use std::os::unix::fs::MetadataExt;
+
+    path.ancestors()
+        .find_map(|p| std::fs::metadata(p).ok())
+        .map_or(0, |metadata| metadata.dev())
+}
+
+/// Returns an identifier of the filesystem `path` is on, or would be created on.
+///
+/// Device ids are not available on this platform, so all paths sharing a root
+/// (e.g. a drive letter) are treated as one filesystem.
+#[cfg(not(unix))]
+pub fn filesystem_id(path: &Path) -> u64 {
+    use std::hash::{DefaultHasher, Hash, Hasher};
+
+    let mut hasher = DefaultHasher::new();
+    path.components().next().hash(&mut hasher);
+    hasher.finish()
+}
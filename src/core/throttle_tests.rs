@@ -0,0 +1,80 @@
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::thread;
+use std::time::Duration;
+
+use super::throttle::{DestinationLimiter, filesystem_id};
+use tempfile::tempdir;
+
+/// Tracks the current and highest number of concurrent holders of one filesystem
+#[derive(Default)]
+struct Gauge {
+    current: AtomicUsize,
+    max: AtomicUsize,
+}
+
+impl Gauge {
+    fn enter(&self) {
+        let now = self.current.fetch_add(1, Ordering::SeqCst) + 1;
+        self.max.fetch_max(now, Ordering::SeqCst);
+    }
+
+    fn leave(&self) {
+        self.current.fetch_sub(1, Ordering::SeqCst);
+    }
+}
+
+#[test]
+fn test_limiter_never_exceeds_limit_per_filesystem() {
+    let limiter = DestinationLimiter::new(2);
+    let gauges = [Gauge::default(), Gauge::default()];
+
+    thread::scope(|scope| {
+        for i in 0..16 {
+            let (limiter, gauges) = (&limiter, &gauges);
+            scope.spawn(move || {
+                let filesystem = i % 2;
+                let _permit = limiter.acquire(filesystem as u64);
+                gauges[filesystem].enter();
+                thread::sleep(Duration::from_millis(5));
+                gauges[filesystem].leave();
+            });
+        }
+    });
+
+    for gauge in &gauges {
+        assert!(gauge.max.load(Ordering::SeqCst) <= 2);
+        assert_eq!(gauge.current.load(Ordering::SeqCst), 0);
+    }
+}
+
+#[test]
+fn test_limiter_serializes_with_limit_of_one() {
+    let limiter = DestinationLimiter::new(1);
+    let gauge = Gauge::default();
+    let other = Gauge::default();
+
+    thread::scope(|scope| {
+        for i in 0..8 {
+            let (limiter, gauge, other) = (&limiter, &gauge, &other);
+            scope.spawn(move || {
+                // Even threads write to a second filesystem, which is not held up
+                let (filesystem, gauge) = if i % 2 == 0 { (1, other) } else { (7, gauge) };
+                let _permit = limiter.acquire(filesystem);
+                gauge.enter();
+                thread::sleep(Duration::from_millis(5));
+                gauge.leave();
+            });
+        }
+    });
+
+    assert_eq!(gauge.max.load(Ordering::SeqCst), 1);
+    assert_eq!(other.max.load(Ordering::SeqCst), 1);
+}
+
+#[test]
+fn test_filesystem_id_of_missing_folder_uses_existing_ancestor() {
+    let dir = tempdir().unwrap();
+    let missing = dir.path().join("not/yet/created");
+
+    assert_eq!(filesystem_id(&missing), filesystem_id(dir.path()));
+}
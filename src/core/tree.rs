@@ -0,0 +1,167 @@
+//! Destination tree preview for Tooka.
+//!
+//! Renders the folders and files a sorting run would produce as an indented
+//! tree, so the resulting organization can be judged before anything changes.
+//! Folders show how many files land in them, and destinations that several
+//! files are headed for, or that already exist, are marked as conflicts.
+//! Rendering only looks at the planned results, never at the filesystem.
+
+use crate::core::sorter::MatchResult;
+use crate::rules::rule::ConflictStrategy;
+use std::{
+    collections::BTreeMap,
+    path::{Path, PathBuf},
+};
+
+/// Actions that place a file at a new destination
+const PLACING_ACTIONS: [&str; 4] = ["move", "copy", "symlink", "rename"];
+
+/// A file in the destination tree
+#[derive(Debug, Default)]
+struct TreeFile {
+    /// Number of planned files headed for this destination
+    incoming: usize,
+    /// Strategy applied because the destination already exists
+    existing: Option<ConflictStrategy>,
+}
+
+/// A folder in the destination tree
+#[derive(Debug, Default)]
+struct TreeNode {
+    folders: BTreeMap<String, TreeNode>,
+    files: BTreeMap<String, TreeFile>,
+}
+
+/// A folder or file listed in a folder of the destination tree
+enum TreeEntry<'a> {
+    Folder(&'a TreeNode),
+    File(&'a TreeFile),
+}
+
+impl TreeNode {
+    fn insert(&mut self, relative: &Path, existing: Option<ConflictStrategy>) {
+        let mut node = self;
+        let mut components = relative
+            .components()
+            .map(|c| c.as_os_str().to_string_lossy().into_owned())
+            .peekable();
+        while let Some(name) = components.next() {
+            if components.peek().is_none() {
+                let file = node.files.entry(name).or_default();
+                file.incoming += 1;
+                file.existing = file.existing.or(existing);
+            } else {
+                node = node.folders.entry(name).or_default();
+            }
+        }
+    }
+
+    /// Number of planned files headed for this folder and its subfolders
+    fn file_count(&self) -> usize {
+        self.files.values().map(|f| f.incoming).sum::<usize>()
+            + self
+                .folders
+                .values()
+                .map(TreeNode::file_count)
+                .sum::<usize>()
+    }
+
+    fn render(&self, prefix: &str, out: &mut String) {
+        let entries: Vec<(&String, TreeEntry)> = self
+            .folders
+            .iter()
+            .map(|(name, node)| (name, TreeEntry::Folder(node)))
+            .chain(
+                self.files
+                    .iter()
+                    .map(|(name, file)| (name, TreeEntry::File(file))),
+            )
+            .collect();
+
+        for (i, (name, entry)) in entries.iter().enumerate() {
+            let last = i + 1 == entries.len();
+            let branch = if last { "└── " } else { "├── " };
+            match entry {
+                TreeEntry::Folder(node) => {
+                    out.push_str(&format!(
+                        "{prefix}{branch}{name}/ ({})\n",
+                        count_label(node.file_count())
+                    ));
+                    let indent = if last { "    " } else { "│   " };
+                    node.render(&format!("{prefix}{indent}"), out);
+                }
+                TreeEntry::File(file) => {
+                    out.push_str(&format!("{prefix}{branch}{name}{}\n", conflict_label(file)));
+                }
+            }
+        }
+    }
+}
+
+/// Returns e.g. `1 file` or `3 files`
+fn count_label(count: usize) -> String {
+    if count == 1 {
+        "1 file".to_string()
+    } else {
+        format!("{count} files")
+    }
+}
+
+/// Returns the conflict marker shown after a file name, if any
+fn conflict_label(file: &TreeFile) -> String {
+    let mut conflicts = Vec::new();
+    if file.incoming > 1 {
+        conflicts.push(format!("{} files headed here", file.incoming));
+    }
+    if let Some(strategy) = file.existing {
+        conflicts.push(format!("exists, on_conflict: {strategy}"));
+    }
+    if conflicts.is_empty() {
+        String::new()
+    } else {
+        format!("  ⚠ conflict: {}", conflicts.join("; "))
+    }
+}
+
+/// Renders the destination tree of the files the given results place somewhere.
+///
+/// Only moved, copied and renamed files are included. The tree is rooted at the
+/// deepest folder shared by all destinations; folders are listed before files,
+/// both in alphabetical order. Returns `None` if no file would be placed.
+pub fn render_destination_tree(results: &[MatchResult]) -> Option<String> {
+    let placed: Vec<&MatchResult> = results
+        .iter()
+        .filter(|r| PLACING_ACTIONS.contains(&r.action.as_str()))
+        .collect();
+    let destinations: Vec<&Path> = placed.iter().map(|r| r.new_path.as_path()).collect();
+
+    let root = common_folder(&destinations)?;
+    let mut tree = TreeNode::default();
+    for result in &placed {
+        if let Ok(relative) = result.new_path.strip_prefix(&root) {
+            tree.insert(relative, result.conflict);
+        }
+    }
+
+    let mut out = if root.as_os_str().is_empty() {
+        ".".to_string()
+    } else {
+        root.display().to_string()
+    };
+    out.push_str(&format!(" ({})\n", count_label(tree.file_count())));
+    tree.render("", &mut out);
+    Some(out)
+}
+/// Returns the deepest folder containing all of the given file paths
+fn common_folder(paths: &[&Path]) -> Option<PathBuf> {
+    let (first, rest) = paths.split_first()?;
+    let mut common = first.parent().unwrap_or(Path::new("")).to_path_buf();
+    for path in rest {
+        while !path.starts_with(&common) {
+            if !common.pop() {
+                break;
+            }
+        }
+    }
+    Some(common)
+}
@@ -0,0 +1,83 @@
+use std::path::PathBuf;
+
+use super::sorter::MatchResult;
+use super::tree::render_destination_tree;
+use crate::rules::rule::ConflictStrategy;
+
+fn result(action: &str, current: &str, new: &str) -> MatchResult {
+    let new_path = PathBuf::from(new);
+    MatchResult {
+        file_name: new_path.file_name().unwrap().to_string_lossy().to_string(),
+        action: action.to_string(),
+        matched_rule_id: "rule".to_string(),
+        current_path: PathBuf::from(current),
+        new_path,
+        conflict: None,
+        error: None,
+        size: None,
+    }
+}
+
+#[test]
+fn test_render_destination_tree_for_plan() {
+    let plan = vec![
+        result("move", "/in/b.pdf", "/out/Documents/b.pdf"),
+        result("move", "/in/a.pdf", "/out/Documents/a.pdf"),
+        result("copy", "/in/c.jpg", "/out/Images/2024/c.jpg"),
+        result("move", "/in/readme", "/out/readme.txt"),
+        result("delete", "/in/old.tmp", "/in/old.tmp"),
+        result("skip", "/in/keep.txt", "/in/keep.txt"),
+    ];
+
+    let expected = "\
+/out (4 files)
+├── Documents/ (2 files)
+│   ├── a.pdf
+│   └── b.pdf
+├── Images/ (1 file)
+│   └── 2024/ (1 file)
+│       └── c.jpg
+└── readme.txt
+";
+    assert_eq!(render_destination_tree(&plan).unwrap(), expected);
+}
+
+#[test]
+fn test_render_destination_tree_single_folder() {
+    let plan = vec![result("rename", "/in/IMG_1.jpg", "/in/photo_1.jpg")];
+
+    assert_eq!(
+        render_destination_tree(&plan).unwrap(),
+        "/in (1 file)\n└── photo_1.jpg\n"
+    );
+}
+
+#[test]
+fn test_render_destination_tree_without_placed_files() {
+    let plan = vec![
+        result("skip", "/in/a.txt", "/in/a.txt"),
+        result("deferred", "/in/b.txt", "/in/b.txt"),
+    ];
+
+    assert!(render_destination_tree(&plan).is_none());
+}
+
+#[test]
+fn test_render_destination_tree_marks_conflicts() {
+    let mut existing = result("move", "/in/c.pdf", "/out/c.pdf");
+    existing.conflict = Some(ConflictStrategy::Overwrite);
+    let plan = vec![
+        result("move", "/in/a/report.pdf", "/out/report.pdf"),
+        result("copy", "/in/b/report.pdf", "/out/report.pdf"),
+        existing,
+        result("move", "/in/d.pdf", "/out/d.pdf"),
+    ];
+
+    let expected = "\
+/out (4 files)
+├── c.pdf  ⚠ conflict: exists, on_conflict: overwrite
+├── d.pdf
+└── report.pdf  ⚠ conflict: 2 files headed here
+";
+    assert_eq!(render_destination_tree(&plan).unwrap(), expected);
+}
@@ -0,0 +1,384 @@
+//! Undo journals for Tooka.
+//!
+//! Every sort that changes files writes the actions it performs to a journal
+//! of its own in the logs folder, named after the time the run started. Each
+//! file's actions are appended as soon as the file has been processed, so a
+//! run that crashed can still be undone up to the last file it finished.
+//!
+//! `tooka undo` reverses the actions of a run, newest first: moved, renamed
+//! and quarantined files are moved back and copies are removed. Deleted files
+//! can only be restored if they were backed up before deletion (see
+//! [`crate::file::backup`]); other deletes are reported as non-reversible.
+
+use crate::{
+    core::{error::TookaError, sorter::MatchResult},
+    file::file_ops::{self, DELETED_PATH},
+};
+use chrono::{DateTime, Local};
+use serde::{Deserialize, Serialize};
+use std::{
+    fs::{self, OpenOptions},
+    io::{self, BufRead, BufReader, Read, Seek, SeekFrom, Write},
+    path::{Path, PathBuf},
+    sync::Mutex,
+};
+
+/// File name prefix of undo journals in the logs folder
+const UNDO_JOURNAL_PREFIX: &str = "undo-";
+
+/// File extension of undo journals
+const UNDO_JOURNAL_EXTENSION: &str = "jsonl";
+
+/// Actions recorded in undo journals, all of which change files
+const RECORDED_ACTIONS: &[&str] = &[
+    "move",
+    "copy",
+    "symlink",
+    "rename",
+    "delete",
+    "trash",
+    "quarantine",
+];
+
+/// A single event recorded in an undo journal.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(tag = "event", rename_all = "snake_case")]
+pub enum UndoRecord {
+    /// A run over `source` started.
+    Started { source: PathBuf, timestamp: String },
+    /// An action changed a file.
+    Action(UndoEntry),
+    /// The run was undone.
+    Undone { timestamp: String },
+}
+
+/// An action of a run that can be reversed.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct UndoEntry {
+    /// ID of the rule that performed the action.
+    pub rule_id: String,
+    /// Action performed (move, copy, rename, delete, trash or quarantine).
+    pub action: String,
+    /// Path of the file before the action.
+    pub source: PathBuf,
+    /// Path of the file after the action; for deletes and trash, the backup of
+    /// the file or `[deleted]` if there is none.
+    pub destination: PathBuf,
+}
+
+impl UndoEntry {
+    /// Returns the backup of a deleted or trashed file, if it was backed up.
+    pub fn backup(&self) -> Option<&Path> {
+        ((self.action == "delete" || self.action == "trash")
+            && self.destination != Path::new(DELETED_PATH))
+        .then_some(self.destination.as_path())
+    }
+}
+
+/// Overview of an undo journal.
+#[derive(Debug, Clone, PartialEq)]
+pub struct UndoJournalInfo {
+    /// ID of the run, which is the time it started.
+    pub id: String,
+    /// Folder the run sorted.
+    pub source: Option<PathBuf>,
+    /// Number of actions recorded.
+    pub actions: usize,
+    /// Whether the run was undone.
+    pub undone: bool,
+}
+
+/// Outcome of undoing a run.
+#[derive(Debug, Clone, Default)]
+pub struct UndoReport {
+    /// Actions that were reversed.
+    pub reverted: Vec<UndoEntry>,
+    /// Deletes without a backup, which cannot be reversed.
+    pub non_reversible: Vec<UndoEntry>,
+    /// Actions that could not be reversed, with the reason.
+    pub failed: Vec<(UndoEntry, String)>,
+}
+
+/// Journal of the actions of one sorting run.
+#[derive(Debug)]
+pub struct UndoJournal {
+    id: String,
+    path: PathBuf,
+    // Serializes appends from parallel sorting workers
+    lock: Mutex<()>,
+}
+
+impl UndoJournal {
+    fn new(logs_dir: &Path, id: &str) -> Self {
+        Self {
+            id: id.to_string(),
+            path: logs_dir.join(format!(
+                "{UNDO_JOURNAL_PREFIX}{id}.{UNDO_JOURNAL_EXTENSION}"
+            )),
+            lock: Mutex::new(()),
+        }
+    }
+
+    /// Starts the journal of a new run over `source` in `logs_dir`.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be created.
+    pub fn start(logs_dir: &Path, source: &Path, now: DateTime<Local>) -> Result<Self, TookaError> {
+        fs::create_dir_all(logs_dir)?;
+        let stamp = now.format("%Y%m%d-%H%M%S-%3f").to_string();
+        let mut journal = Self::new(logs_dir, &stamp);
+        let mut n = 1;
+        while journal.path.exists() {
+            journal = Self::new(logs_dir, &format!("{stamp}-{n}"));
+            n += 1;
+        }
+
+        journal.append(&UndoRecord::Started {
+            source: source.to_path_buf(),
+            timestamp: now.to_rfc3339(),
+        })?;
+        log::debug!("Started undo journal '{}'", journal.path.display());
+        Ok(journal)
+    }
+
+    /// Opens the journal of the run with the given ID.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if there is no journal with that ID.
+    pub fn open(logs_dir: &Path, id: &str) -> Result<Self, TookaError> {
+        let journal = Self::new(logs_dir, id);
+        if !journal.path.exists() {
+            return Err(TookaError::Other(format!("No run with ID '{id}' to undo")));
+        }
+        Ok(journal)
+    }
+
+    /// Opens the journal of the most recent run that has not been undone.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journals cannot be read.
+    pub fn latest(logs_dir: &Path) -> Result<Option<Self>, TookaError> {
+        let latest = Self::list(logs_dir)?
+            .into_iter()
+            .rev()
+            .find(|info| !info.undone);
+        Ok(latest.map(|info| Self::new(logs_dir, &info.id)))
+    }
+
+    /// Lists the journals in `logs_dir`, oldest first.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the logs folder or a journal cannot be read.
+    pub fn list(logs_dir: &Path) -> Result<Vec<UndoJournalInfo>, TookaError> {
+        if !logs_dir.exists() {
+            return Ok(Vec::new());
+        }
+
+        let mut ids: Vec<String> = fs::read_dir(logs_dir)?
+            .filter_map(Result::ok)
+            .filter_map(|entry| {
+                let name = entry.file_name().to_string_lossy().into_owned();
+                name.strip_prefix(UNDO_JOURNAL_PREFIX)?
+                    .strip_suffix(&format!(".{UNDO_JOURNAL_EXTENSION}"))
+                    .map(str::to_string)
+            })
+            .collect();
+        // IDs start with the time of the run, so they sort chronologically
+        ids.sort();
+
+        ids.into_iter()
+            .map(|id| {
+                let records = Self::new(logs_dir, &id).records()?;
+                let source = records.iter().find_map(|record| match record {
+                    UndoRecord::Started { source, .. } => Some(source.clone()),
+                    _ => None,
+                });
+                Ok(UndoJournalInfo {
+                    actions: records
+                        .iter()
+                        .filter(|record| matches!(record, UndoRecord::Action(_)))
+                        .count(),
+                    undone: records
+                        .iter()
+                        .any(|record| matches!(record, UndoRecord::Undone { .. })),
+                    source,
+                    id,
+                })
+            })
+            .collect()
+    }
+
+    /// Returns the ID of the run.
+    pub fn id(&self) -> &str {
+        &self.id
+    }
+
+    /// Returns the path of the journal file.
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Records the actions that changed files among a file's results.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be written.
+    pub fn record(&self, results: &[MatchResult]) -> Result<(), TookaError> {
+        let mut buf = Vec::new();
+        for result in results
+            .iter()
+            .filter(|r| RECORDED_ACTIONS.contains(&r.action.as_str()))
+        {
+            serde_json::to_writer(
+                &mut buf,
+                &UndoRecord::Action(UndoEntry {
+                    rule_id: result.matched_rule_id.clone(),
+                    action: result.action.clone(),
+                    source: result.current_path.clone(),
+                    destination: result.new_path.clone(),
+                }),
+            )?;
+            buf.push(b'\n');
+        }
+        if buf.is_empty() {
+            return Ok(());
+        }
+        self.write(&buf)
+    }
+
+    /// Reverses the recorded actions, newest first, and marks the run as undone.
+    ///
+    /// An action is not reversed if its file is gone or something else is
+    /// now in the way; it is reported as failed and the others are still
+    /// reversed.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the journal cannot be read or written, or if
+    /// the run was already undone.
+    pub fn undo(&self) -> Result<UndoReport, TookaError> {
+        let records = self.records()?;
+        if records
+            .iter()
+            .any(|record| matches!(record, UndoRecord::Undone { .. }))
+        {
+            return Err(TookaError::Other(format!(
+                "Run '{}' was already undone",
+                self.id
+            )));
+        }
+
+        let mut report = UndoReport::default();
+        let entries = records.into_iter().filter_map(|record| match record {
+            UndoRecord::Action(entry) => Some(entry),
+            _ => None,
+        });
+        for entry in entries.collect::<Vec<_>>().into_iter().rev() {
+            let outcome = match entry.action.as_str() {
+                "copy" | "symlink" => remove_copy(&entry.destination),
+                "delete" | "trash" => match entry.backup() {
+                    Some(backup) => restore(backup, &entry.source),
+                    None => {
+                        report.non_reversible.push(entry);
+                        continue;
+                    }
+                },
+                _ => restore(&entry.destination, &entry.source),
+            };
+            match outcome {
+                Ok(()) => {
+                    log::info!(
+                        "Undid {} of '{}' to '{}'",
+                        entry.action,
+                        entry.source.display(),
+                        entry.destination.display()
+                    );
+                    report.reverted.push(entry);
+                }
+                Err(reason) => {
+                    log::warn!(
+                        "Cannot undo {} of '{}': {reason}",
+                        entry.action,
+                        entry.source.display()
+                    );
+                    report.failed.push((entry, reason));
+                }
+            }
+        }
+
+        self.append(&UndoRecord::Undone {
+            timestamp: Local::now().to_rfc3339(),
+        })?;
+        Ok(report)
+    }
+
+    /// Reads all records of the journal.
+    fn records(&self) -> Result<Vec<UndoRecord>, TookaError> {
+        let reader = BufReader::new(fs::File::open(&self.path)?);
+        let mut records = Vec::new();
+        for line in reader.lines() {
+            let line = line?;
+            if line.trim().is_empty() {
+                continue;
+            }
+            // The last line may be cut short if the process was killed mid-write
+            match serde_json::from_str(&line) {
+                Ok(record) => records.push(record),
+                Err(e) => log::warn!("Skipping malformed undo journal line: {e}"),
+            }
+        }
+        Ok(records)
+    }
+
+    fn append(&self, record: &UndoRecord) -> Result<(), TookaError> {
+        let mut line = serde_json::to_vec(record)?;
+        line.push(b'\n');
+        self.write(&line)
+    }
+
+    fn write(&self, buf: &[u8]) -> Result<(), TookaError> {
+        let _guard = self
+            .lock
+            .lock()
+            .map_err(|e| TookaError::Other(format!("Undo journal lock poisoned: {e}")))?;
+        let mut file = OpenOptions::new()
+            .create(true)
+            .read(true)
+            .append(true)
+            .open(&self.path)?;
+        // A run killed mid-write leaves a partial last line, which must not swallow this one
+        if ends_mid_line(&mut file)? {
+            file.write_all(b"\n")?;
+        }
+        file.write_all(buf)?;
+        Ok(())
+    }
+}
+
+/// Returns true if `file` is not empty and does not end with a newline
+fn ends_mid_line(file: &mut fs::File) -> io::Result<bool> {
+    if file.metadata()?.len() == 0 {
+        return Ok(false);
+    }
+    let mut last = [0; 1];
+    file.seek(SeekFrom::End(-1))?;
+    file.read_exact(&mut last)?;
+    Ok(last[0] != b'\n')
+}
+
+/// Moves a file from where an action put it back to where it was
+fn restore(from: &Path, to: &Path) -> Result<(), String> {
+    if fs::symlink_metadata(from).is_err() {
+        return Err(format!("'{}' no longer exists", from.display()));
+    }
+    if fs::symlink_metadata(to).is_ok() {
+        return Err(format!("'{}' is occupied by another file", to.display()));
+    }
+    if let Some(parent) = to.parent() {
+        fs::create_dir_all(parent).map_err(|e| e.to_string())?;
+    }
+    file_ops::move_file(from, to).map_err(|e| e.to_string())
+}
+
+/// Removes a copy or link an action made
+fn remove_copy(copy: &Path) -> Result<(), String> {
+    fs::remove_file(copy).map_err(|e| format!("Cannot remove '{}': {e}", copy.display()))
+}
@@ -0,0 +1,161 @@
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::Path;
+
+use super::sorter::MatchResult;
+use super::undo::UndoJournal;
+use crate::file::{backup::DeleteBackup, file_ops::DELETED_PATH};
+use chrono::{Local, TimeZone};
+use tempfile::tempdir;
+
+fn result(action: &str, current: &Path, new: &Path) -> MatchResult {
+    MatchResult {
+        file_name: current.file_name().unwrap().to_string_lossy().to_string(),
+        action: action.to_string(),
+        matched_rule_id: "rule".to_string(),
+        current_path: current.to_path_buf(),
+        new_path: new.to_path_buf(),
+        conflict: None,
+        error: None,
+        size: None,
+    }
+}
+
+fn start(logs: &Path, source: &Path) -> UndoJournal {
+    let now = Local.with_ymd_and_hms(2025, 6, 1, 12, 0, 0).unwrap();
+    UndoJournal::start(logs, source, now).unwrap()
+}
+
+#[test]
+fn test_undo_reverses_moves_renames_and_copies() {
+    let source = tempdir().unwrap();
+    let logs = tempdir().unwrap();
+    let original = source.path().join("a.txt");
+    let copied = source.path().join("backup").join("a.txt");
+    let moved = source.path().join("sorted").join("a.txt");
+    let renamed = source.path().join("sorted").join("b.txt");
+    fs::create_dir_all(copied.parent().unwrap()).unwrap();
+    fs::create_dir_all(moved.parent().unwrap()).unwrap();
+    fs::write(&copied, "content").unwrap();
+    fs::write(&renamed, "content").unwrap();
+
+    let journal = start(logs.path(), source.path());
+    journal
+        .record(&[
+            result("copy", &original, &copied),
+            result("move", &original, &moved),
+            result("rename", &moved, &renamed),
+            result("skip", &renamed, &renamed),
+        ])
+        .unwrap();
+
+    let report = journal.undo().unwrap();
+    assert_eq!(report.reverted.len(), 3);
+    assert!(report.failed.is_empty());
+    assert_eq!(fs::read_to_string(&original).unwrap(), "content");
+    assert!(!copied.exists());
+    assert!(!moved.exists());
+    assert!(!renamed.exists());
+
+    assert!(journal.undo().is_err());
+    assert!(UndoJournal::latest(logs.path()).unwrap().is_none());
+}
+
+#[test]
+fn test_undo_restores_backed_up_deletes_only() {
+    let source = tempdir().unwrap();
+    let logs = tempdir().unwrap();
+    let backup_dir = tempdir().unwrap();
+    let kept = source.path().join("kept.log");
+    let lost = source.path().join("lost.log");
+    fs::write(&kept, "kept").unwrap();
+
+    let backup = DeleteBackup::new(backup_dir.path())
+        .backup(&kept, Local::now())
+        .unwrap();
+    assert!(!kept.exists());
+
+    let journal = start(logs.path(), source.path());
+    journal
+        .record(&[
+            result("delete", &kept, &backup),
+            result("delete", &lost, Path::new(DELETED_PATH)),
+        ])
+        .unwrap();
+
+    let report = journal.undo().unwrap();
+    assert_eq!(report.reverted.len(), 1);
+    assert_eq!(report.non_reversible.len(), 1);
+    assert_eq!(report.non_reversible[0].source, lost);
+    assert_eq!(fs::read_to_string(&kept).unwrap(), "kept");
+    assert!(!backup.exists());
+}
+
+#[test]
+fn test_undo_does_not_overwrite_occupied_paths() {
+    let source = tempdir().unwrap();
+    let logs = tempdir().unwrap();
+    let original = source.path().join("a.txt");
+    let moved = source.path().join("a-moved.txt");
+    fs::write(&original, "new file").unwrap();
+    fs::write(&moved, "sorted file").unwrap();
+
+    let journal = start(logs.path(), source.path());
+    journal
+        .record(&[result("move", &original, &moved)])
+        .unwrap();
+
+    let report = journal.undo().unwrap();
+    assert!(report.reverted.is_empty());
+    assert_eq!(report.failed.len(), 1);
+    assert_eq!(fs::read_to_string(&original).unwrap(), "new file");
+    assert_eq!(fs::read_to_string(&moved).unwrap(), "sorted file");
+}
+
+#[test]
+fn test_journal_of_crashed_run_can_be_undone() {
+    let source = tempdir().unwrap();
+    let logs = tempdir().unwrap();
+    let original = source.path().join("a.txt");
+    let moved = source.path().join("sorted.txt");
+    fs::write(&moved, "content").unwrap();
+
+    let journal = start(logs.path(), source.path());
+    journal
+        .record(&[result("move", &original, &moved)])
+        .unwrap();
+    let id = journal.id().to_string();
+    // The process died while writing the next file's actions
+    let mut file = OpenOptions::new()
+        .append(true)
+        .open(journal.path())
+        .unwrap();
+    file.write_all(b"{\"event\":\"action\",\"rule_id\":")
+        .unwrap();
+    drop(journal);
+
+    let runs = UndoJournal::list(logs.path()).unwrap();
+    assert_eq!(runs.len(), 1);
+    assert_eq!(runs[0].id, id);
+    assert_eq!(runs[0].actions, 1);
+    assert_eq!(runs[0].source.as_deref(), Some(source.path()));
+    assert!(!runs[0].undone);
+
+    let journal = UndoJournal::latest(logs.path()).unwrap().unwrap();
+    assert_eq!(journal.id(), id);
+    assert_eq!(journal.undo().unwrap().reverted.len(), 1);
+    assert!(original.exists());
+    assert!(UndoJournal::list(logs.path()).unwrap()[0].undone);
+}
+
+#[test]
+fn test_runs_started_at_the_same_time_get_distinct_ids() {
+    let source = tempdir().unwrap();
+    let logs = tempdir().unwrap();
+
+    let first = start(logs.path(), source.path());
+    let second = start(logs.path(), source.path());
+    assert_ne!(first.id(), second.id());
+    assert!(UndoJournal::open(logs.path(), first.id()).is_ok());
+    assert!(UndoJournal::open(logs.path(), "missing").is_err());
+}
@@ -0,0 +1,268 @@
+//! Archives for the `compress` and `extract` actions.
+//!
+//! The `compress` action adds files to a zip or tar.gz archive, creating it if
+//! it does not exist. Adding a file rewrites the archive next to itself and
+//! renames it into place, so a failure leaves the previous archive intact.
+//! A file whose name is already in the archive is added as `name (1).ext`,
+//! `name (2).ext`, ...
+//!
+//! The `extract` action recognizes zip and tar.gz archives by their content.
+//! Every entry is checked before anything is written: archives with entries
+//! that would land outside the destination folder (absolute paths or `..`)
+//! or on existing files are rejected as a whole. Links in tar archives are
+//! skipped.
+
+use crate::{core::error::TookaError, rules::rule::ArchiveFormat};
+use flate2::{Compression, read::GzDecoder, write::GzEncoder};
+use std::{
+    collections::HashSet,
+    fs::{self, File},
+    io::{self, Read},
+    path::{Component, Path, PathBuf},
+    sync::{Mutex, PoisonError},
+};
+use zip::{CompressionMethod, ZipArchive, ZipWriter, write::SimpleFileOptions};
+
+/// Serializes archive updates from parallel sorting workers
+static ARCHIVE_LOCK: Mutex<()> = Mutex::new(());
+
+/// Leading bytes of zip archives
+const ZIP_MAGIC: &[u8] = b"PK";
+
+/// Leading bytes of gzip files
+const GZIP_MAGIC: &[u8] = &[0x1f, 0x8b];
+
+/// Adds `file_path` to the archive at `archive`, creating the archive if needed.
+///
+/// # Returns
+/// The name of the file in the archive.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the file cannot be read, or the archive cannot
+/// be read or written.
+pub fn add_to_archive(
+    file_path: &Path,
+    archive: &Path,
+    format: ArchiveFormat,
+) -> Result<String, TookaError> {
+    let _guard = ARCHIVE_LOCK.lock().unwrap_or_else(PoisonError::into_inner);
+    if let Some(parent) = archive.parent() {
+        fs::create_dir_all(parent)?;
+    }
+
+    let archive_name = archive.file_name().unwrap_or_default().to_string_lossy();
+    let partial = archive.with_file_name(format!(".{archive_name}.tooka-partial"));
+    let name = file_path
+        .file_name()
+        .unwrap_or_default()
+        .to_string_lossy()
+        .into_owned();
+
+    let written = match format {
+        ArchiveFormat::Zip => write_zip(file_path, &name, archive, &partial),
+        ArchiveFormat::TarGz => write_tar_gz(file_path, &name, archive, &partial),
+    }
+    .and_then(|entry| {
+        fs::rename(&partial, archive)?;
+        Ok(entry)
+    });
+    if written.is_err() {
+        let _ = fs::remove_file(&partial);
+    }
+    written
+}
+
+/// Writes the entries of the zip archive at `archive`, if any, and `file_path` to `partial`.
+fn write_zip(
+    file_path: &Path,
+    name: &str,
+    archive: &Path,
+    partial: &Path,
+) -> Result<String, TookaError> {
+    let mut writer = ZipWriter::new(File::create(partial)?);
+    let mut names = HashSet::new();
+    if archive.exists() {
+        let mut existing = ZipArchive::new(File::open(archive)?).map_err(zip_error)?;
+        for i in 0..existing.len() {
+            let entry = existing.by_index_raw(i).map_err(zip_error)?;
+            names.insert(entry.name().to_string());
+            writer.raw_copy_file(entry).map_err(zip_error)?;
+        }
+    }
+
+    let entry = free_entry_name(name, &names);
+    let options = SimpleFileOptions::default().compression_method(CompressionMethod::Deflated);
+    writer
+        .start_file(entry.as_str(), options)
+        .map_err(zip_error)?;
+    io::copy(&mut File::open(file_path)?, &mut writer)?;
+    writer.finish().map_err(zip_error)?.sync_all()?;
+    Ok(entry)
+}
+
+/// Writes the entries of the tar.gz archive at `archive`, if any, and `file_path` to `partial`.
+fn write_tar_gz(
+    file_path: &Path,
+    name: &str,
+    archive: &Path,
+    partial: &Path,
+) -> Result<String, TookaError> {
+    let encoder = GzEncoder::new(File::create(partial)?, Compression::default());
+    let mut builder = tar::Builder::new(encoder);
+    let mut names = HashSet::new();
+    if archive.exists() {
+        for entry in open_tar_gz(archive)?.entries()? {
+            let mut entry = entry?;
+            let path = entry.path()?.into_owned();
+            let mut header = entry.header().clone();
+            names.insert(path.to_string_lossy().into_owned());
+            builder.append_data(&mut header, &path, &mut entry)?;
+        }
+    }
+
+    let entry = free_entry_name(name, &names);
+    builder.append_path_with_name(file_path, &entry)?;
+    builder.into_inner()?.finish()?.sync_all()?;
+    Ok(entry)
+}
+
+/// Returns `name`, or the first of `name (1)`, `name (2)`, ... that is not in `taken`.
+fn free_entry_name(name: &str, taken: &HashSet<String>) -> String {
+    if !taken.contains(name) {
+        return name.to_string();
+    }
+    let path = Path::new(name);
+    let stem = path.file_stem().unwrap_or_default().to_string_lossy();
+    let extension = path
+        .extension()
+        .map(|ext| format!(".{}", ext.to_string_lossy()))
+        .unwrap_or_default();
+    (1..)
+        .map(|n| format!("{stem} ({n}){extension}"))
+        .find(|candidate| !taken.contains(candidate))
+        .unwrap_or_default()
+}
+
+/// Extracts the zip or tar.gz archive at `archive` into `destination`, keeping
+/// its directory structure.
+///
+/// # Returns
+/// The number of extracted files.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the file is not a zip or tar.gz archive, an
+/// entry would be written outside `destination` or over an existing file, or
+/// the archive cannot be read or extracted.
+pub fn extract_archive(archive: &Path, destination: &Path) -> Result<usize, TookaError> {
+    let mut magic = [0u8; 2];
+    File::open(archive)?.read_exact(&mut magic).map_err(|_| {
+        TookaError::FileOperationError(format!(
+            "'{}' is not a zip or tar.gz archive",
+            archive.display()
+        ))
+    })?;
+
+    if magic == ZIP_MAGIC {
+        extract_zip(archive, destination)
+    } else if magic == GZIP_MAGIC {
+        extract_tar_gz(archive, destination)
+    } else {
+        Err(TookaError::FileOperationError(format!(
+            "'{}' is not a zip or tar.gz archive",
+            archive.display()
+        )))
+    }
+}
+
+fn extract_zip(archive: &Path, destination: &Path) -> Result<usize, TookaError> {
+    let mut zip = ZipArchive::new(File::open(archive)?).map_err(zip_error)?;
+    let mut targets = Vec::with_capacity(zip.len());
+    for i in 0..zip.len() {
+        let entry = zip.by_index(i).map_err(zip_error)?;
+        let target = entry_target(destination, Path::new(entry.name()))?;
+        targets.push((target, entry.is_dir()));
+    }
+
+    let mut extracted = 0;
+    for (i, (target, is_dir)) in targets.into_iter().enumerate() {
+        if is_dir {
+            fs::create_dir_all(&target)?;
+            continue;
+        }
+        if let Some(parent) = target.parent() {
+            fs::create_dir_all(parent)?;
+        }
+        let mut entry = zip.by_index(i).map_err(zip_error)?;
+        io::copy(&mut entry, &mut File::create(&target)?)?;
+        extracted += 1;
+    }
+    Ok(extracted)
+}
+
+fn open_tar_gz(archive: &Path) -> io::Result<tar::Archive<GzDecoder<File>>> {
+    Ok(tar::Archive::new(GzDecoder::new(File::open(archive)?)))
+}
+
+fn extract_tar_gz(archive: &Path, destination: &Path) -> Result<usize, TookaError> {
+    // Check every entry before writing any of them
+    for entry in open_tar_gz(archive)?.entries()? {
+        let entry = entry?;
+        entry_target(destination, &entry.path()?)?;
+    }
+
+    let mut extracted = 0;
+    for entry in open_tar_gz(archive)?.entries()? {
+        let mut entry = entry?;
+        let target = entry_target(destination, &entry.path()?)?;
+        let entry_type = entry.header().entry_type();
+        if entry_type.is_dir() {
+            fs::create_dir_all(&target)?;
+        } else if entry_type.is_file() {
+            if let Some(parent) = target.parent() {
+                fs::create_dir_all(parent)?;
+            }
+            entry.unpack(&target)?;
+            extracted += 1;
+        } else {
+            log::warn!(
+                "Skipping entry '{}' of archive {}: only files and folders are extracted",
+                entry.path()?.display(),
+                archive.display()
+            );
+        }
+    }
+    Ok(extracted)
+}
+
+/// Returns where the archive entry `name` is extracted to in `destination`.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the entry would be written outside `destination`,
+/// or over an existing file.
+fn entry_target(destination: &Path, name: &Path) -> Result<PathBuf, TookaError> {
+    let mut target = destination.to_path_buf();
+    for component in name.components() {
+        match component {
+            Component::Normal(part) => target.push(part),
+            Component::CurDir => {}
+            Component::ParentDir | Component::RootDir | Component::Prefix(_) => {
+                return Err(TookaError::FileOperationError(format!(
+                    "Archive entry '{}' points outside the destination folder, nothing was extracted",
+                    name.display()
+                )));
+            }
+        }
+    }
+    if fs::symlink_metadata(&target).is_ok_and(|m| !m.is_dir()) {
+        return Err(TookaError::FileOperationError(format!(
+            "Archive entry '{}' would overwrite '{}', nothing was extracted",
+            name.display(),
+            target.display()
+        )));
+    }
+    Ok(target)
+}
+
+fn zip_error(e: zip::result::ZipError) -> TookaError {
+    TookaError::FileOperationError(format!("Zip archive error: {e}"))
+}
@@ -0,0 +1,197 @@
+use std::{fs, io::Read, path::Path};
+
+use super::archive::{add_to_archive, extract_archive};
+use super::file_ops;
+use crate::rules::rule::{Action, ArchiveFormat, CompressAction, ExtractAction};
+use flate2::read::GzDecoder;
+use tempfile::tempdir;
+use zip::{ZipArchive, ZipWriter, write::SimpleFileOptions};
+
+fn compress_to(target: &Path, format: ArchiveFormat, remove_source: bool) -> Action {
+    Action::Compress(CompressAction {
+        target: target.to_string_lossy().to_string(),
+        format,
+        remove_source,
+    })
+}
+
+/// Returns the names and contents of the entries of a tar.gz archive
+fn tar_gz_entries(archive: &Path) -> Vec<(String, String)> {
+    let mut archive = tar::Archive::new(GzDecoder::new(fs::File::open(archive).unwrap()));
+    archive
+        .entries()
+        .unwrap()
+        .map(|entry| {
+            let mut entry = entry.unwrap();
+            let name = entry.path().unwrap().to_string_lossy().to_string();
+            let mut content = String::new();
+            entry.read_to_string(&mut content).unwrap();
+            (name, content)
+        })
+        .collect()
+}
+
+#[test]
+fn test_compress_action_creates_zip_and_removes_source() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("report.txt");
+    fs::write(&file, "quarterly").unwrap();
+    let target = dir.path().join("archives").join("old.zip");
+
+    let action = compress_to(&target, ArchiveFormat::Zip, true);
+    let result = file_ops::execute_action(&file, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "compress");
+    assert_eq!(result.new_path, target);
+    assert!(!file.exists());
+
+    let mut archive = ZipArchive::new(fs::File::open(&target).unwrap()).unwrap();
+    let mut content = String::new();
+    archive
+        .by_name("report.txt")
+        .unwrap()
+        .read_to_string(&mut content)
+        .unwrap();
+    assert_eq!(content, "quarterly");
+}
+
+#[test]
+fn test_compress_dry_run_writes_nothing() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("report.txt");
+    fs::write(&file, "quarterly").unwrap();
+    let target = dir.path().join("old.zip");
+
+    let action = compress_to(&target, ArchiveFormat::Zip, true);
+    let result = file_ops::execute_action(&file, &action, true, dir.path()).unwrap();
+    assert_eq!(result.new_path, target);
+    assert!(file.exists());
+    assert!(!target.exists());
+}
+
+#[test]
+fn test_zip_appends_to_existing_archive() {
+    let dir = tempdir().unwrap();
+    let target = dir.path().join("old.zip");
+    for (folder, content) in [("a", "first"), ("b", "second")] {
+        let file = dir.path().join(folder).join("notes.txt");
+        fs::create_dir(file.parent().unwrap()).unwrap();
+        fs::write(&file, content).unwrap();
+        add_to_archive(&file, &target, ArchiveFormat::Zip).unwrap();
+        assert!(file.exists());
+    }
+
+    let mut archive = ZipArchive::new(fs::File::open(&target).unwrap()).unwrap();
+    let mut names: Vec<_> = archive.file_names().map(str::to_string).collect();
+    names.sort();
+    assert_eq!(names, ["notes (1).txt", "notes.txt"]);
+    let mut content = String::new();
+    archive
+        .by_name("notes (1).txt")
+        .unwrap()
+        .read_to_string(&mut content)
+        .unwrap();
+    assert_eq!(content, "second");
+}
+
+#[test]
+fn test_tar_gz_appends_to_existing_archive() {
+    let dir = tempdir().unwrap();
+    let target = dir.path().join("old.tar.gz");
+    for (name, content) in [("a.log", "first"), ("b.log", "second")] {
+        let file = dir.path().join(name);
+        fs::write(&file, content).unwrap();
+        assert_eq!(
+            add_to_archive(&file, &target, ArchiveFormat::TarGz).unwrap(),
+            name
+        );
+    }
+
+    assert_eq!(
+        tar_gz_entries(&target),
+        [
+            ("a.log".to_string(), "first".to_string()),
+            ("b.log".to_string(), "second".to_string())
+        ]
+    );
+    assert_eq!(fs::read_dir(dir.path()).unwrap().count(), 3);
+}
+
+/// Writes a zip archive holding `entries` of names and contents
+fn write_zip(path: &Path, entries: &[(&str, &str)]) {
+    let mut writer = ZipWriter::new(fs::File::create(path).unwrap());
+    for (name, content) in entries {
+        writer
+            .start_file(*name, SimpleFileOptions::default())
+            .unwrap();
+        std::io::Write::write_all(&mut writer, content.as_bytes()).unwrap();
+    }
+    writer.finish().unwrap();
+}
+
+#[test]
+fn test_extract_action_keeps_structure_and_removes_archive() {
+    let dir = tempdir().unwrap();
+    let archive = dir.path().join("photos.zip");
+    write_zip(
+        &archive,
+        &[
+            ("album/a.jpg", "a"),
+            ("album/2024/b.jpg", "b"),
+            ("c.txt", "c"),
+        ],
+    );
+    let destination = dir.path().join("extracted");
+
+    let action = Action::Extract(ExtractAction {
+        to: destination.to_string_lossy().to_string(),
+        remove_archive: true,
+    });
+    let result = file_ops::execute_action(&archive, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "extract");
+    assert_eq!(result.new_path, destination);
+    assert!(!archive.exists());
+    assert_eq!(
+        fs::read_to_string(destination.join("album/2024/b.jpg")).unwrap(),
+        "b"
+    );
+    assert_eq!(fs::read_to_string(destination.join("c.txt")).unwrap(), "c");
+}
+
+#[test]
+fn test_extract_detects_tar_gz_by_content() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("notes.txt");
+    fs::write(&file, "notes").unwrap();
+    // The name does not give the format away
+    let archive = dir.path().join("download.bin");
+    add_to_archive(&file, &archive, ArchiveFormat::TarGz).unwrap();
+
+    let destination = dir.path().join("extracted");
+    assert_eq!(extract_archive(&archive, &destination).unwrap(), 1);
+    assert_eq!(
+        fs::read_to_string(destination.join("notes.txt")).unwrap(),
+        "notes"
+    );
+}
+
+#[test]
+fn test_extract_rejects_entries_outside_destination() {
+    let dir = tempdir().unwrap();
+    let archive = dir.path().join("evil.zip");
+    write_zip(&archive, &[("fine.txt", "fine"), ("../evil.txt", "evil")]);
+    let destination = dir.path().join("extracted");
+
+    assert!(extract_archive(&archive, &destination).is_err());
+    assert!(!dir.path().join("evil.txt").exists());
+    assert!(!destination.join("fine.txt").exists());
+    assert!(archive.exists());
+}
+
+#[test]
+fn test_extract_rejects_files_that_are_not_archives() {
+    let dir = tempdir().unwrap();
+    let file = dir.path().join("fake.zip");
+    fs::write(&file, "not an archive").unwrap();
+
+    assert!(extract_archive(&file, &dir.path().join("extracted")).is_err());
+}
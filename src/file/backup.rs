@@ -0,0 +1,200 @@
+//! Delete backups for Tooka.
+//!
+//! With `backup_before_delete` enabled, the `delete` action moves files into
+//! the backup folder instead of removing them, so `tooka undo` can put them
+//! back. Files deleted without a backup, or moved to the system trash, cannot
+//! be restored by Tooka; files the trash action moves to the `.tooka-trash`
+//! fallback folder can.
+//!
+//! Each run keeps its backups in a folder named after the time it started.
+//! A retention policy (`backup_max_age_days`, `backup_max_size_mb`) removes
+//! the folders of old runs at the start of each run.
+
+use crate::{common::config::Config, core::error::TookaError, file::file_ops};
+use chrono::{DateTime, Duration, Local, NaiveDateTime};
+use std::{
+    fs,
+    path::{Path, PathBuf},
+    sync::{Mutex, OnceLock, PoisonError},
+};
+use walkdir::WalkDir;
+
+/// Format of the names of the per-run backup folders
+const RUN_FOLDER_FORMAT: &str = "%Y%m%dT%H%M%S";
+
+/// Serializes backups from parallel sorting workers, which pick the first free name
+static BACKUP_LOCK: Mutex<()> = Mutex::new(());
+
+/// When the current run started, which names the folder of its backups
+static RUN_STARTED: OnceLock<DateTime<Local>> = OnceLock::new();
+
+/// Returns when the current run started, fixed the first time it is asked for.
+pub fn run_started() -> DateTime<Local> {
+    *RUN_STARTED.get_or_init(Local::now)
+}
+
+/// Limits on how many backups are kept.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct BackupRetention {
+    /// Runs backed up longer ago than this many days are removed.
+    pub max_age_days: Option<u64>,
+    /// The oldest runs are removed until the backups fit in this many bytes.
+    pub max_total_bytes: Option<u64>,
+}
+
+/// A folder keeping the files removed by delete actions.
+#[derive(Debug, Clone)]
+pub struct DeleteBackup {
+    dir: PathBuf,
+    retention: BackupRetention,
+}
+
+impl DeleteBackup {
+    /// Creates a backup stored in the given folder, kept forever.
+    pub fn new(dir: impl Into<PathBuf>) -> Self {
+        Self {
+            dir: dir.into(),
+            retention: BackupRetention::default(),
+        }
+    }
+
+    /// Sets the retention policy applied by [`DeleteBackup::prune`].
+    #[must_use]
+    pub fn with_retention(mut self, retention: BackupRetention) -> Self {
+        self.retention = retention;
+        self
+    }
+
+    /// Creates the backup stored in the configured backup folder, or `None`
+    /// if backing up deleted files is disabled.
+    pub fn from_config(config: &Config) -> Option<Self> {
+        config.backup_before_delete.then(|| {
+            Self::new(&config.backup_folder).with_retention(BackupRetention {
+                max_age_days: config.backup_max_age_days,
+                max_total_bytes: config
+                    .backup_max_size_mb
+                    .map(|mb| mb.saturating_mul(1024 * 1024)),
+            })
+        })
+    }
+
+    /// Moves `file_path` into the backup folder of the run started at `run`
+    /// instead of deleting it.
+    ///
+    /// If the file cannot be moved completely, e.g. because the backup folder
+    /// is on a full disk, no partial copy is left behind and the file is kept.
+    ///
+    /// # Returns
+    /// The path of the backed up file.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the file cannot be moved.
+    pub fn backup(&self, file_path: &Path, run: DateTime<Local>) -> Result<PathBuf, TookaError> {
+        let _guard = BACKUP_LOCK.lock().unwrap_or_else(PoisonError::into_inner);
+        let run_dir = self.dir.join(run.format(RUN_FOLDER_FORMAT).to_string());
+        fs::create_dir_all(&run_dir)?;
+
+        let name = file_path.file_name().unwrap_or_default().to_string_lossy();
+        let mut target = run_dir.join(name.as_ref());
+        let mut n = 1;
+        while fs::symlink_metadata(&target).is_ok() {
+            target = run_dir.join(format!("{n}_{name}"));
+            n += 1;
+        }
+
+        file_ops::move_file(file_path, &target).map_err(|e| {
+            TookaError::FileOperationError(format!(
+                "Failed to back up '{}' before deleting it, the file was kept: {e}",
+                file_path.display()
+            ))
+        })?;
+        Ok(target)
+    }
+
+    /// Removes the backups of runs that exceed the retention policy, oldest first.
+    ///
+    /// # Returns
+    /// The removed run folders.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the backup folder cannot be read or a run
+    /// folder cannot be removed.
+    pub fn prune(&self, now: DateTime<Local>) -> Result<Vec<PathBuf>, TookaError> {
+        let _guard = BACKUP_LOCK.lock().unwrap_or_else(PoisonError::into_inner);
+        let mut runs = self.runs()?;
+        let mut removed = Vec::new();
+
+        // Ages too large to subtract from now keep every run
+        let cutoff = self
+            .retention
+            .max_age_days
+            .and_then(|days| Duration::try_days(i64::try_from(days).ok()?))
+            .and_then(|age| now.naive_local().checked_sub_signed(age));
+        if let Some(cutoff) = cutoff {
+            while runs
+                .first()
+                .is_some_and(|(started, _, _)| *started < cutoff)
+            {
+                let (_, path, _) = runs.remove(0);
+                remove_run(&path)?;
+                removed.push(path);
+            }
+        }
+
+        if let Some(max_bytes) = self.retention.max_total_bytes {
+            let mut total: u64 = runs.iter().map(|(_, _, size)| size).sum();
+            while total > max_bytes && !runs.is_empty() {
+                let (_, path, size) = runs.remove(0);
+                remove_run(&path)?;
+                removed.push(path);
+                total -= size;
+            }
+        }
+
+        Ok(removed)
+    }
+
+    /// Lists the run folders with their start time and size, oldest first.
+    fn runs(&self) -> Result<Vec<(NaiveDateTime, PathBuf, u64)>, TookaError> {
+        if !self.dir.exists() {
+            return Ok(Vec::new());
+        }
+
+        let mut runs = Vec::new();
+        for entry in fs::read_dir(&self.dir)? {
+            let entry = entry?;
+            if !entry.file_type()?.is_dir() {
+                continue;
+            }
+            let name = entry.file_name();
+            let Ok(started) =
+                NaiveDateTime::parse_from_str(&name.to_string_lossy(), RUN_FOLDER_FORMAT)
+            else {
+                continue;
+            };
+            let path = entry.path();
+            let size = folder_size(&path);
+            runs.push((started, path, size));
+        }
+        runs.sort_by_key(|(started, _, _)| *started);
+        Ok(runs)
+    }
+}
+
+/// Removes the backup folder of a run.
+fn remove_run(path: &Path) -> Result<(), TookaError> {
+    log::info!("Removing old delete backups: {}", path.display());
+    fs::remove_dir_all(path)?;
+    Ok(())
+}
+
+/// Returns the total size of the files in a folder.
+fn folder_size(dir: &Path) -> u64 {
+    WalkDir::new(dir)
+        .into_iter()
+        .filter_map(Result::ok)
+        .filter(|e| e.file_type().is_file())
+        .filter_map(|e| e.metadata().ok())
+        .map(|m| m.len())
+        .sum()
+}
@@ -0,0 +1,87 @@
+use std::fs;
+
+use super::backup::{BackupRetention, DeleteBackup};
+use chrono::{DateTime, Duration, Local, TimeZone};
+use tempfile::tempdir;
+
+#[test]
+fn test_backup_keys_files_by_run() {
+    let dir = tempdir().unwrap();
+    let backup = DeleteBackup::new(dir.path().join("backup"));
+    let run = Local.with_ymd_and_hms(2024, 5, 6, 7, 8, 9).unwrap();
+
+    let mut backed_up = Vec::new();
+    for folder in ["a", "b"] {
+        let file = dir.path().join(folder).join("notes.txt");
+        fs::create_dir(file.parent().unwrap()).unwrap();
+        fs::write(&file, folder).unwrap();
+        backed_up.push(backup.backup(&file, run).unwrap());
+        assert!(!file.exists());
+    }
+
+    let run_dir = dir.path().join("backup").join("20240506T070809");
+    assert_eq!(backed_up[0], run_dir.join("notes.txt"));
+    assert_eq!(backed_up[1], run_dir.join("1_notes.txt"));
+    assert_eq!(fs::read_to_string(&backed_up[1]).unwrap(), "b");
+}
+
+/// Backs up a file of `size` bytes in the run started `days_ago` days before [`now`]
+fn back_up_run(backup: &DeleteBackup, dir: &std::path::Path, days_ago: i64, size: usize) {
+    let file = dir.join(format!("run-{days_ago}.bin"));
+    fs::write(&file, vec![0u8; size]).unwrap();
+    backup
+        .backup(&file, now() - Duration::days(days_ago))
+        .unwrap();
+}
+
+fn now() -> DateTime<Local> {
+    Local.with_ymd_and_hms(2024, 6, 1, 12, 0, 0).unwrap()
+}
+
+#[test]
+fn test_prune_removes_runs_older_than_max_age() {
+    let dir = tempdir().unwrap();
+    let backup_dir = dir.path().join("backup");
+    let backup = DeleteBackup::new(&backup_dir).with_retention(BackupRetention {
+        max_age_days: Some(30),
+        max_total_bytes: None,
+    });
+    for days_ago in [60, 31, 2] {
+        back_up_run(&backup, dir.path(), days_ago, 10);
+    }
+    fs::write(backup_dir.join("unrelated.txt"), "keep").unwrap();
+
+    let removed = backup.prune(now()).unwrap();
+    assert_eq!(removed.len(), 2);
+    let remaining: Vec<_> = fs::read_dir(&backup_dir).unwrap().collect();
+    assert_eq!(remaining.len(), 2);
+    assert!(backup_dir.join("unrelated.txt").exists());
+}
+
+#[test]
+fn test_prune_removes_oldest_runs_over_max_size() {
+    let dir = tempdir().unwrap();
+    let backup_dir = dir.path().join("backup");
+    let backup = DeleteBackup::new(&backup_dir).with_retention(BackupRetention {
+        max_age_days: None,
+        max_total_bytes: Some(250),
+    });
+    for days_ago in [3, 2, 1] {
+        back_up_run(&backup, dir.path(), days_ago, 100);
+    }
+
+    let removed = backup.prune(now()).unwrap();
+    assert_eq!(removed.len(), 1);
+    assert_eq!(removed[0], backup_dir.join("20240529T120000"));
+    assert!(!removed[0].exists());
+    assert!(backup_dir.join("20240531T120000/run-1.bin").exists());
+}
+
+#[test]
+fn test_prune_without_retention_keeps_everything() {
+    let dir = tempdir().unwrap();
+    let backup = DeleteBackup::new(dir.path().join("backup"));
+    back_up_run(&backup, dir.path(), 365, 10);
+
+    assert!(backup.prune(now()).unwrap().is_empty());
+}
@@ -1,22 +1,38 @@
 //! File matching utilities for Tooka.
 //!
 //! This module provides functions to match files against various criteria,
-//! including filename patterns, extensions, paths, sizes, MIME types, dates,
-//! symlink status, EXIF metadata, and combined rule conditions.
+//! including filename patterns, extensions, paths, sizes, MIME types, dates, file age,
+//! symlink status, owner, weekday and day of month, EXIF metadata, media integrity, video duration and resolution,
+//! text file contents, extension allow/deny lists, user-provided list files, external classifiers,
+//! built-in file categories, and combined rule conditions, including nested `any_of`/`all_of` groups and `not` exclusions.
 
 use crate::{
-    core::error::TookaError,
-    rules::rule::{self, Conditions, DateRange, Range},
-    utils::date_parser::parse_date,
+    common::{config::Config, environment::expand_path},
+    core::{context, error::TookaError},
+    rules::category::expand_category,
+    rules::rule::{
+        self, ClassifyCondition, Conditions, DateRange, DayConditions, ListFile, ListMatchBy,
+        Range, TimeField, VideoConditions,
+    },
+    rules::units::{duration_days, parse_duration, parse_size},
+    utils::{
+        classifier::classify,
+        media::{is_corrupt_media, probe_video},
+        mime::{TEXT_MIME, ZIP_MIME, detect_mime_type},
+        rename_pattern::extract_exif_date,
+    },
 };
 
-use chrono::{NaiveDate, Utc};
+use chrono::{DateTime, Datelike, Days, Local, NaiveDate, Utc};
 use exif::Reader;
 use glob::{self, Pattern};
+use regex::Regex;
+use std::collections::{HashMap, HashSet};
 use std::fs;
-use std::io::BufReader;
-use std::path::Path;
-use std::sync::LazyLock;
+use std::io::{BufRead, BufReader, Read};
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, LazyLock, Mutex};
+use std::time::{Duration, SystemTime};
 
 const MIN_DATE: (i32, u32, u32) = (1970, 1, 1);
 const MAX_DATE: (i32, u32, u32) = (9999, 12, 31);
@@ -33,6 +49,37 @@ static MAX_DATE_NAIVE: LazyLock<NaiveDate> = LazyLock::new(|| {
         .expect("MAX_DATE should be valid")
 });
 
+/// Entries of a list file, with the modification time of the file when it was read
+type ListFileEntries = (Option<SystemTime>, Arc<HashSet<String>>);
+
+/// List files read by `in_list` conditions, cached so each is loaded once
+/// until it changes
+static LIST_FILE_CACHE: LazyLock<Mutex<HashMap<PathBuf, ListFileEntries>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Labels printed by `classify_with` programs, keyed by program, arguments and
+/// file, so each file is classified once per run; `None` if classification failed
+type ClassifyCacheKey = (String, Vec<String>, PathBuf);
+static CLASSIFY_CACHE: LazyLock<Mutex<HashMap<ClassifyCacheKey, Option<String>>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Compiled regexes by pattern, so each rule's pattern is compiled once per run
+static REGEX_CACHE: LazyLock<Mutex<HashMap<String, Regex>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Returns the compiled regex of a pattern, compiling it on first use
+fn cached_regex(pattern: &str) -> Result<Regex, TookaError> {
+    let mut cache = REGEX_CACHE
+        .lock()
+        .map_err(|e| TookaError::Other(format!("Regex cache lock poisoned: {e}")))?;
+    if let Some(regex) = cache.get(pattern) {
+        return Ok(regex.clone());
+    }
+    let regex = Regex::new(pattern)?;
+    cache.insert(pattern.to_string(), regex.clone());
+    Ok(regex)
+}
+
 /// Matches a file's name against a regular expression pattern
 pub(crate) fn match_filename_regex(file_path: &Path, pattern: &str) -> Result<bool, TookaError> {
     log::debug!(
@@ -41,21 +88,55 @@ pub(crate) fn match_filename_regex(file_path: &Path, pattern: &str) -> Result<bo
         pattern
     );
     let file_name = file_path.file_name().and_then(|s| s.to_str()).unwrap_or("");
-    let regex = regex::Regex::new(pattern)?;
-    Ok(regex.is_match(file_name))
+    Ok(cached_regex(pattern)?.is_match(file_name))
+}
+
+/// Matches a file's name against a shell glob pattern
+pub(crate) fn match_filename_glob(file_path: &Path, pattern: &str) -> Result<bool, TookaError> {
+    log::debug!(
+        "Matching file: {} against filename glob: {}",
+        file_path.display(),
+        pattern
+    );
+    let file_name = file_path.file_name().and_then(|s| s.to_str()).unwrap_or("");
+    Ok(Pattern::new(pattern)?.matches(file_name))
 }
 
-/// Matches a file against a given vector of file extensions
+/// Matches a file against a given vector of file extensions.
+///
+/// Extensions are compared case-insensitively and may be listed with or without
+/// a leading dot. Multi-part entries such as `tar.gz` match the end of the file
+/// name. Files without an extension (including dotfiles like `.bashrc`) only
+/// match an explicitly listed empty string.
 pub(crate) fn match_extensions(file_path: &Path, extensions: &[String]) -> bool {
     log::debug!(
         "Matching file: {} against extensions: {:?}",
         file_path.display(),
         extensions
     );
-    file_path
+    let file_name = file_path
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or_default()
+        .to_lowercase();
+    let file_ext = file_path
         .extension()
         .and_then(|ext| ext.to_str())
-        .is_some_and(|ext_str| extensions.iter().any(|ext| ext.as_str() == ext_str))
+        .map(str::to_lowercase);
+
+    extensions.iter().any(|ext| {
+        let ext = ext.strip_prefix('.').unwrap_or(ext).to_lowercase();
+        if ext.is_empty() {
+            file_ext.is_none()
+        } else if ext.contains('.') {
+            file_name
+                .strip_suffix(&ext)
+                .and_then(|stem| stem.strip_suffix('.'))
+                .is_some_and(|stem| !stem.is_empty())
+        } else {
+            file_ext.as_deref() == Some(ext.as_str())
+        }
+    })
 }
 
 /// Matches a file path against a glob pattern
@@ -77,7 +158,11 @@ pub(crate) fn match_size_kb(metadata: &fs::Metadata, size_kb: &Range) -> bool {
         metadata.len(),
         size_kb
     );
-    let size = metadata.len();
+    size_in_kb_range(metadata.len(), size_kb)
+}
+
+/// Checks a size in bytes against a range in kilobytes
+pub(crate) fn size_in_kb_range(size: u64, size_kb: &Range) -> bool {
     let min = match size_kb.min {
         Some(m) => m.saturating_mul(1024),
         None => 0,
@@ -89,60 +174,160 @@ pub(crate) fn match_size_kb(metadata: &fs::Metadata, size_kb: &Range) -> bool {
     size >= min && size <= max
 }
 
-/// Matches a file's MIME type against a given MIME type string
+/// Matches files strictly larger than `kb` KB, so a file of exactly `kb` KB does not match.
+///
+/// `metadata` is the file's own metadata; for a symlink the size of its target
+/// is used unless `size_of_link` is set. Broken symlinks never match then.
+pub(crate) fn match_size_greater_than_kb(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    kb: u64,
+    size_of_link: bool,
+) -> bool {
+    match_size_greater_than(file_path, metadata, kb.saturating_mul(1024), size_of_link)
+}
+
+/// Matches a file whose size is strictly greater than `bytes`, following
+/// symlinks unless `size_of_link` is set
+pub(crate) fn match_size_greater_than(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    bytes: u64,
+    size_of_link: bool,
+) -> bool {
+    let size = if metadata.file_type().is_symlink() && !size_of_link {
+        match fs::metadata(file_path) {
+            Ok(target) => target.len(),
+            Err(e) => {
+                log::debug!(
+                    "Cannot read symlink target of {}: {}",
+                    file_path.display(),
+                    e
+                );
+                return false;
+            }
+        }
+    } else {
+        metadata.len()
+    };
+    log::debug!("Matching file size: {size} against more than {bytes} bytes");
+    size > bytes
+}
+
+/// Matches a file's MIME type against a given MIME type string.
+///
+/// The type is detected from the file's content. ZIP archives and plain text
+/// are containers for many formats (DOCX, EPUB, CSV, ...), so for those, and
+/// for files without a known signature, the type implied by the extension is
+/// used when there is one. A `type/*` pattern matches any subtype. Files that
+/// cannot be read are logged and do not match.
 pub(crate) fn match_mime_type(file_path: &Path, mime_type: &str) -> bool {
     log::debug!(
         "Matching file: {} against MIME type: {}",
         file_path.display(),
         mime_type
     );
-    mime_guess::from_path(file_path)
-        .first()
-        .is_some_and(|mime| {
-            let mime_essence = mime.essence_str();
-            mime_type
-                .strip_suffix("/*")
-                .map_or(mime_essence == mime_type, |prefix| {
-                    mime_essence.starts_with(prefix)
-                })
-        })
+    detected_mime_type(file_path).is_some_and(|mime_essence| mime_matches(&mime_essence, mime_type))
 }
 
-/// Helper function to parse date with fallback
-fn parse_date_with_fallback(date_str: &str, fallback: NaiveDate) -> NaiveDate {
-    parse_date(date_str).map_or_else(
-        |_| {
-            log::warn!("Invalid date format: {date_str}, using fallback");
-            fallback
-        },
-        |dt| dt.date_naive(),
-    )
+/// Detects the MIME type of a file as described for [`match_mime_type`].
+///
+/// Returns `None` if the type is unknown or the file cannot be read.
+fn detected_mime_type(file_path: &Path) -> Option<String> {
+    let sniffed = match detect_mime_type(file_path) {
+        Ok(sniffed) => sniffed,
+        Err(e) => {
+            log::warn!(
+                "Failed to read '{}' to detect its MIME type: {}",
+                file_path.display(),
+                e
+            );
+            return None;
+        }
+    };
+    let detected = match sniffed {
+        Some(mime) if mime != ZIP_MIME && mime != TEXT_MIME => Some(mime.to_string()),
+        _ => mime_guess::from_path(file_path)
+            .first()
+            .map(|mime| mime.essence_str().to_string())
+            .or_else(|| sniffed.map(str::to_string)),
+    };
+    log::debug!(
+        "Detected MIME type {:?} for file: {}",
+        detected,
+        file_path.display()
+    );
+    detected
 }
 
-/// Helper function to check if a date falls within a range
-fn is_date_in_range(date: NaiveDate, date_range: &DateRange) -> bool {
-    let from = date_range
-        .from
-        .as_ref()
-        .map_or(*MIN_DATE_NAIVE, |from_str| {
-            parse_date_with_fallback(from_str, *MIN_DATE_NAIVE)
+/// Matches a file against a built-in category by its extension, or else by
+/// its detected MIME type.
+pub(crate) fn match_category(file_path: &Path, name: &str) -> Result<bool, TookaError> {
+    let category = expand_category(name).map_err(TookaError::Other)?;
+    let by_extension = file_path
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .is_some_and(|ext| {
+            category
+                .extensions
+                .iter()
+                .any(|listed| listed.eq_ignore_ascii_case(ext))
         });
+    log::debug!(
+        "Matching file: {} against category: {} (by extension: {})",
+        file_path.display(),
+        category.name,
+        by_extension
+    );
+    if by_extension {
+        return Ok(true);
+    }
+    Ok(detected_mime_type(file_path).is_some_and(|mime_essence| {
+        category
+            .mime_types
+            .iter()
+            .any(|pattern| mime_matches(&mime_essence, pattern))
+    }))
+}
 
-    let to = date_range
-        .to
-        .as_ref()
-        .map_or(*MAX_DATE_NAIVE, |to_str| {
-            parse_date_with_fallback(to_str, *MAX_DATE_NAIVE)
-        });
+/// Checks a MIME type against a pattern, where `type/*` matches any subtype
+pub(crate) fn mime_matches(mime_essence: &str, pattern: &str) -> bool {
+    pattern
+        .strip_suffix("/*")
+        .map_or(mime_essence == pattern, |prefix| {
+            mime_essence
+                .strip_prefix(prefix)
+                .is_some_and(|rest| rest.starts_with('/'))
+        })
+}
 
-    date >= from && date <= to
+/// Helper function to check if a date falls within a range
+///
+/// Ranges with a malformed bound never match.
+pub(crate) fn is_date_in_range(date: NaiveDate, date_range: &DateRange) -> bool {
+    match date_range.parse() {
+        Ok((from, to)) => {
+            date >= from.unwrap_or(*MIN_DATE_NAIVE) && date <= to.unwrap_or(*MAX_DATE_NAIVE)
+        }
+        Err(e) => {
+            log::warn!("Invalid date range {date_range:?}: {e}");
+            false
+        }
+    }
 }
 
 /// Matches a file's metadata against a date range (created date)
+///
+/// Uses the birth time of the file, or its modification time on platforms and
+/// filesystems that do not record one.
 pub(crate) fn match_date_range_created(metadata: &fs::Metadata, date_range: &DateRange) -> bool {
     log::debug!("Matching against created date range: {date_range:?}");
 
-    metadata.created().is_ok_and(|created| {
+    let created = metadata.created().or_else(|e| {
+        log::debug!("Creation time unavailable ({e}), using modification time");
+        metadata.modified()
+    });
+    created.is_ok_and(|created| {
         let created_datetime: chrono::DateTime<Utc> = created.into();
         let created_date = created_datetime.date_naive();
         is_date_in_range(created_date, date_range)
@@ -160,7 +345,138 @@ pub(crate) fn match_date_range_mod(metadata: &fs::Metadata, date_range: &DateRan
     })
 }
 
+/// Matches the weekday and day of month of a file's timestamp in local time.
+///
+/// Files whose selected timestamp cannot be read never match.
+pub(crate) fn match_day(metadata: &fs::Metadata, day: &DayConditions) -> bool {
+    log::debug!("Matching against day conditions: {day:?}");
+
+    let time = match day.field {
+        TimeField::Created => metadata.created(),
+        TimeField::Modified => metadata.modified(),
+    };
+    time.is_ok_and(|time| {
+        let date = DateTime::<Local>::from(time).date_naive();
+        let weekday_matches = day
+            .weekdays
+            .as_ref()
+            .is_none_or(|days| days.contains(&date.weekday().into()));
+        let day_of_month_matches = day.days_of_month.as_ref().is_none_or(|days| {
+            // Negative days count back from the end, so -1 is the last day
+            let from_end = days_in_month(date) - date.day() + 1;
+            days.iter().any(|&d| {
+                u32::try_from(d).map_or_else(|_| d.unsigned_abs() == from_end, |d| d == date.day())
+            })
+        });
+        weekday_matches && day_of_month_matches
+    })
+}
+
+/// Returns the number of days in the month of `date`
+fn days_in_month(date: NaiveDate) -> u32 {
+    let (year, month) = if date.month() == 12 {
+        (date.year() + 1, 1)
+    } else {
+        (date.year(), date.month() + 1)
+    };
+    NaiveDate::from_ymd_opt(year, month, 1)
+        .and_then(|first| first.pred_opt())
+        .map_or(31, |last| last.day())
+}
+
+/// Result of resolving the user name of an `owner` condition
+#[cfg(unix)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum OwnerUid {
+    Uid(u32),
+    UnknownUser,
+    /// The user database cannot be read, so owner conditions are ignored
+    Unsupported,
+}
+
+/// User names resolved by `owner` conditions, so each is looked up once per run
+#[cfg(unix)]
+static OWNER_UIDS: LazyLock<Mutex<HashMap<String, OwnerUid>>> =
+    LazyLock::new(|| Mutex::new(HashMap::new()));
+
+/// Finds the uid of a user in the contents of a `passwd` file
+#[cfg(unix)]
+pub(crate) fn uid_from_passwd(passwd: &str, user: &str) -> Option<u32> {
+    passwd
+        .lines()
+        .filter(|line| !line.starts_with('#'))
+        .find_map(|line| {
+            let mut fields = line.split(':');
+            (fields.next()? == user)
+                .then(|| fields.nth(1)?.parse().ok())
+                .flatten()
+        })
+}
+
+/// Resolves the user name of an `owner` condition, which may also be a
+/// numeric uid, logging once if it cannot be resolved.
+///
+/// Names are looked up in `/etc/passwd` only, so users from LDAP or other NSS
+/// sources must be given by uid.
+#[cfg(unix)]
+fn owner_uid(owner: &str) -> OwnerUid {
+    let mut cache = OWNER_UIDS
+        .lock()
+        .unwrap_or_else(std::sync::PoisonError::into_inner);
+    *cache.entry(owner.to_string()).or_insert_with(|| {
+        if let Ok(uid) = owner.parse() {
+            return OwnerUid::Uid(uid);
+        }
+        match fs::read_to_string("/etc/passwd") {
+            Ok(passwd) => uid_from_passwd(&passwd, owner).map_or_else(
+                || {
+                    log::warn!(
+                        "Unknown user '{owner}' in owner condition, no file matches it; users not in /etc/passwd must be given by uid"
+                    );
+                    OwnerUid::UnknownUser
+                },
+                OwnerUid::Uid,
+            ),
+            Err(e) => {
+                log::warn!("Cannot read the user database ({e}), ignoring owner conditions");
+                OwnerUid::Unsupported
+            }
+        }
+    })
+}
+
+/// Matches the owner of a file against a user name or uid
+#[cfg(unix)]
+pub(crate) fn match_owner(metadata: &fs::Metadata, owner: &str) -> bool {
+    use std::os::unix::fs::MetadataExt;
+
+    log::debug!(
+        "Matching file owner uid: {} against expected: {}",
+        metadata.uid(),
+        owner
+    );
+    match owner_uid(owner) {
+        OwnerUid::Uid(uid) => metadata.uid() == uid,
+        OwnerUid::UnknownUser => false,
+        OwnerUid::Unsupported => true,
+    }
+}
+
+/// File owners are not supported on this platform, so the condition always matches
+#[cfg(not(unix))]
+pub(crate) fn match_owner(_metadata: &fs::Metadata, _owner: &str) -> bool {
+    static WARNED: std::sync::Once = std::sync::Once::new();
+    WARNED.call_once(|| {
+        log::warn!("Owner conditions are only supported on Unix and are ignored");
+    });
+    true
+}
+
 /// Matches a file's symlink status against a boolean value
+///
+/// `metadata` must come from [`fs::symlink_metadata`] so the link itself is
+/// inspected. On Windows, file and directory symlinks are detected, while
+/// junctions and shortcut files are treated as regular entries.
 pub(crate) fn match_is_symlink(metadata: &fs::Metadata, is_symlink: bool) -> bool {
     log::debug!(
         "Matching symlink status: {} against expected: {}",
@@ -170,6 +486,310 @@ pub(crate) fn match_is_symlink(metadata: &fs::Metadata, is_symlink: bool) -> boo
     metadata.file_type().is_symlink() == is_symlink
 }
 
+/// Matches whether a file is empty or truncated media against a boolean value.
+///
+/// Files that cannot be read never match, so a rule deleting corrupt files
+/// leaves files alone that are merely unreadable right now.
+pub(crate) fn match_corrupt(file_path: &Path, corrupt: bool) -> bool {
+    let is_corrupt = is_corrupt_media(file_path);
+    log::debug!(
+        "Matching corrupt status: {:?} against expected: {} for file: {}",
+        is_corrupt,
+        corrupt,
+        file_path.display()
+    );
+    is_corrupt == Some(corrupt)
+}
+
+/// Matches a video's duration and resolution against the given ranges.
+///
+/// Files that cannot be probed as video never match.
+pub(crate) fn match_video(file_path: &Path, video: &VideoConditions) -> bool {
+    let Some(info) = probe_video(file_path) else {
+        log::debug!(
+            "File '{}' could not be probed as video",
+            file_path.display()
+        );
+        return false;
+    };
+    log::debug!(
+        "Matching video {:?} against {:?} for file: {}",
+        info,
+        video,
+        file_path.display()
+    );
+
+    #[allow(clippy::cast_precision_loss)]
+    let in_range = |value: f64, range: &Option<Range>| {
+        range.as_ref().is_none_or(|r| {
+            r.min.is_none_or(|min| value >= min as f64)
+                && r.max.is_none_or(|max| value <= max as f64)
+        })
+    };
+    in_range(info.duration_secs, &video.duration_secs)
+        && in_range(f64::from(info.width), &video.width)
+        && in_range(f64::from(info.height), &video.height)
+}
+
+/// Matches files last modified more than `days` days before `now`.
+///
+/// A value of 0 disables the filter, so every file matches rather than only
+/// files modified before this instant. Files whose modification time cannot
+/// be read never match a non-zero age.
+pub(crate) fn match_older_than_days(
+    metadata: &fs::Metadata,
+    days: u32,
+    now: DateTime<Local>,
+) -> bool {
+    let is_older = days == 0
+        || metadata.modified().is_ok_and(|modified| {
+            is_older_than_days(DateTime::<Local>::from(modified), days, now)
+        });
+    log::debug!("Matching modification older than {days} days: {is_older}");
+    is_older
+}
+
+/// Checks whether a modification time is more than `days` calendar days before `now`
+pub(crate) fn is_older_than_days(
+    modified: DateTime<Local>,
+    days: u32,
+    now: DateTime<Local>,
+) -> bool {
+    // Calendar days, so a DST change does not shift the threshold by an hour
+    days == 0
+        || now
+            .checked_sub_days(Days::new(u64::from(days)))
+            .is_none_or(|threshold| modified < threshold)
+}
+
+/// Matches whether a file has an EXIF capture date against a boolean value.
+///
+/// Files without EXIF data or with a corrupt EXIF block have no capture date.
+pub(crate) fn match_exif_date(file_path: &Path, exif_date: bool) -> bool {
+    let has_date = extract_exif_date(file_path).is_some();
+    log::debug!(
+        "Matching EXIF capture date presence: {} against expected: {} for file: {}",
+        has_date,
+        exif_date,
+        file_path.display()
+    );
+    has_date == exif_date
+}
+
+/// Matches whether a file's extension is in the given list against a boolean value.
+///
+/// Extensions are compared case-insensitively and may be listed with or without
+/// a leading dot. Files without an extension are never in the list.
+pub(crate) fn match_extension_list(file_path: &Path, list: &[String], in_list: bool) -> bool {
+    let is_listed = file_path
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .is_some_and(|ext| {
+            list.iter()
+                .any(|item| item.trim_start_matches('.').eq_ignore_ascii_case(ext))
+        });
+    log::debug!(
+        "Matching extension list membership: {} against expected: {} for file: {}",
+        is_listed,
+        in_list,
+        file_path.display()
+    );
+    is_listed == in_list
+}
+
+/// Matches the label an external classifier prints for a file.
+///
+/// A classifier that fails, exits with a non-zero status or times out is
+/// logged and the file does not match.
+pub(crate) fn match_classify_with(
+    file_path: &Path,
+    condition: &ClassifyCondition,
+) -> Result<bool, TookaError> {
+    let key = (
+        condition.command.clone(),
+        condition.args.clone(),
+        file_path.to_path_buf(),
+    );
+    let cached = CLASSIFY_CACHE
+        .lock()
+        .map_err(|e| TookaError::Other(format!("Classifier cache lock poisoned: {e}")))?
+        .get(&key)
+        .cloned();
+    let label = if let Some(label) = cached {
+        label
+    } else {
+        // The cache is not locked while the classifier runs, so files are classified in parallel
+        let timeout = Duration::from_secs(condition.timeout_secs);
+        let label = classify(file_path, &condition.command, &condition.args, timeout)
+            .inspect_err(|e| log::warn!("Failed to classify '{}': {}", file_path.display(), e))
+            .ok();
+        CLASSIFY_CACHE
+            .lock()
+            .map_err(|e| TookaError::Other(format!("Classifier cache lock poisoned: {e}")))?
+            .insert(key, label.clone());
+        label
+    };
+
+    log::debug!(
+        "Matching classifier label {:?} against {} for file: {}",
+        label,
+        condition.label,
+        file_path.display()
+    );
+    let Some(label) = label else {
+        return Ok(false);
+    };
+    Ok(cached_regex(&format!("^(?:{})$", condition.label))?.is_match(&label))
+}
+
+/// Number of bytes in a KB, as used by `content_max_size_kb`
+const BYTES_PER_KB: u64 = 1024;
+
+/// Matches the content of a text file against a regex, line by line.
+///
+/// The file is read up to the first matching line only. Files larger than
+/// `max_bytes` and files that don't look like text are skipped without being
+/// read in full, and never match.
+pub(crate) fn match_content_regex(
+    file_path: &Path,
+    pattern: &str,
+    max_bytes: u64,
+) -> Result<bool, TookaError> {
+    let size = fs::metadata(file_path)?.len();
+    if size > max_bytes {
+        log::debug!(
+            "Skipping content match for file: {} ({} bytes, limit {})",
+            file_path.display(),
+            size,
+            max_bytes
+        );
+        return Ok(false);
+    }
+    let is_text = detect_mime_type(file_path)?.is_some_and(|mime| mime.starts_with("text/"));
+    if !is_text {
+        log::debug!(
+            "Skipping content match for binary file: {}",
+            file_path.display()
+        );
+        return Ok(false);
+    }
+
+    log::debug!(
+        "Matching content of file: {} against pattern: {}",
+        file_path.display(),
+        pattern
+    );
+    let regex = cached_regex(pattern)?;
+    // Limited as well, in case the file grows while it is read
+    let mut reader = BufReader::new(fs::File::open(file_path)?.take(max_bytes));
+    let mut line = Vec::new();
+    loop {
+        line.clear();
+        if reader.read_until(b'\n', &mut line)? == 0 {
+            return Ok(false);
+        }
+        if regex.is_match(&String::from_utf8_lossy(&line)) {
+            return Ok(true);
+        }
+    }
+}
+
+/// Returns the configured size limit of `content_regex` conditions in bytes.
+///
+/// Falls back to the default limit if the global configuration is not initialized.
+pub(crate) fn configured_content_max_bytes() -> u64 {
+    let max_kb = context::get_locked_config().map_or_else(
+        |_| Config::default().content_max_size_kb,
+        |c| c.content_max_size_kb,
+    );
+    max_kb.saturating_mul(BYTES_PER_KB)
+}
+
+/// Matches a file's basename or full path against the entries of a list file
+pub(crate) fn match_in_list(file_path: &Path, list: &ListFile) -> Result<bool, TookaError> {
+    let entries = load_list_file(&list.file)?;
+    let candidate = match list.match_by {
+        ListMatchBy::Basename => file_path
+            .file_name()
+            .map(|name| name.to_string_lossy().into_owned()),
+        ListMatchBy::Path => Some(file_path.to_string_lossy().into_owned()),
+    };
+    log::debug!(
+        "Matching {:?} of file: {} against list file: {}",
+        list.match_by,
+        file_path.display(),
+        list.file
+    );
+    Ok(candidate.is_some_and(|c| entries.contains(&c)))
+}
+
+/// Loads the entries of a list file, using the cache if it was loaded before
+/// and has not been modified since.
+///
+/// The path may start with `~` and contain `$VAR`s. Entries are trimmed;
+/// empty lines and lines starting with `#` are ignored.
+fn load_list_file(file: &str) -> Result<Arc<HashSet<String>>, TookaError> {
+    let path = PathBuf::from(expand_path(file));
+    let modified = fs::metadata(&path).and_then(|m| m.modified()).ok();
+
+    let mut cache = LIST_FILE_CACHE
+        .lock()
+        .map_err(|e| TookaError::Other(format!("List file cache lock poisoned: {e}")))?;
+    if let Some((cached_modified, entries)) = cache.get(&path) {
+        if modified.is_some() && *cached_modified == modified {
+            return Ok(Arc::clone(entries));
+        }
+    }
+
+    let content = fs::read_to_string(&path).inspect_err(|e| {
+        log::warn!("Failed to read list file '{}': {}", path.display(), e);
+    })?;
+    let entries: HashSet<String> = content
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .map(str::to_string)
+        .collect();
+    log::debug!(
+        "Loaded {} entries from list file '{}'",
+        entries.len(),
+        path.display()
+    );
+
+    let entries = Arc::new(entries);
+    cache.insert(path, (modified, Arc::clone(&entries)));
+    Ok(entries)
+}
+
+/// Extension lists used by the `in_allowlist` and `in_denylist` conditions.
+///
+/// Resolved from the configuration once per run and passed to the matchers,
+/// rather than read from the global configuration for every file.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExtensionLists {
+    /// Extensions matched by the `in_allowlist` condition
+    pub allowlist: Vec<String>,
+    /// Extensions matched by the `in_denylist` condition
+    pub denylist: Vec<String>,
+}
+
+impl ExtensionLists {
+    /// Takes the extension lists configured in `config`.
+    pub fn from_config(config: &Config) -> Self {
+        Self {
+            allowlist: config.extension_allowlist.clone(),
+            denylist: config.extension_denylist.clone(),
+        }
+    }
+}
+
+impl Default for ExtensionLists {
+    /// The lists of the default configuration.
+    fn default() -> Self {
+        Self::from_config(&Config::default())
+    }
+}
+
 /// Matches a specific metadata field (e.g., EXIF) against a file
 pub(crate) fn match_metadata_field(file_path: &Path, field: &rule::MetadataField) -> bool {
     log::debug!(
@@ -236,7 +856,11 @@ pub(crate) fn match_metadata_field(file_path: &Path, field: &rule::MetadataField
 /// Matches a file against all specified conditions in a rule.
 ///
 /// Uses OR logic if `conditions.any` is true; otherwise AND logic.
-pub fn match_rule_matcher(file_path: &Path, conditions: &Conditions) -> bool {
+pub fn match_rule_matcher(
+    file_path: &Path,
+    conditions: &Conditions,
+    extension_lists: &ExtensionLists,
+) -> bool {
     log::debug!(
         "Matching file: {} against conditions: {:?}",
         file_path.display(),
@@ -251,58 +875,314 @@ pub fn match_rule_matcher(file_path: &Path, conditions: &Conditions) -> bool {
     };
     log::debug!("File metadata: {metadata:?}");
 
-    let matches = [
-        conditions
-            .filename
-            .as_ref()
-            .map_or(Ok(true), |pattern| match_filename_regex(file_path, pattern)),
-        conditions
-            .extensions
-            .as_ref()
-            .map_or(Ok(true), |exts| Ok(match_extensions(file_path, exts))),
-        conditions
-            .path
-            .as_ref()
-            .map_or(Ok(true), |pattern| match_path(file_path, pattern)),
-        conditions
-            .size_kb
-            .as_ref()
-            .map_or(Ok(true), |size| Ok(match_size_kb(&metadata, size))),
-        conditions
-            .mime_type
-            .as_ref()
-            .map_or(Ok(true), |m| Ok(match_mime_type(file_path, m))),
-        conditions
-            .created_date
-            .as_ref()
-            .map_or(Ok(true), |date_range| {
-                Ok(match_date_range_created(&metadata, date_range))
-            }),
-        conditions
-            .modified_date
-            .as_ref()
-            .map_or(Ok(true), |date_range| {
-                Ok(match_date_range_mod(&metadata, date_range))
-            }),
-        conditions
-            .is_symlink
-            .map_or(Ok(true), |b| Ok(match_is_symlink(&metadata, b))),
-        conditions
-            .metadata
-            .as_ref()
-            .map_or(Ok(true), |metadata_fields| {
-                Ok(metadata_fields
-                    .iter()
-                    .all(|field| match_metadata_field(file_path, field)))
-            }),
+    match_conditions(file_path, &metadata, conditions, extension_lists)
+}
+
+/// Matches a file against all specified conditions using already-read metadata.
+///
+/// Split out of [`match_rule_matcher`] so callers that read metadata once
+/// (e.g. the rule profiler) can evaluate several rules against it.
+pub fn match_conditions(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    conditions: &Conditions,
+    extension_lists: &ExtensionLists,
+) -> bool {
+    match_conditions_at(file_path, metadata, conditions, extension_lists, 0)
+}
+
+/// Matches the condition groups nested in `any_of` (`any` true) or `all_of`
+fn match_nested(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    groups: &[Conditions],
+    extension_lists: &ExtensionLists,
+    any: bool,
+    depth: usize,
+) -> bool {
+    if depth >= rule::MAX_CONDITION_DEPTH {
+        log::warn!(
+            "Conditions nested deeper than {} levels, not matching '{}'",
+            rule::MAX_CONDITION_DEPTH,
+            file_path.display()
+        );
+        return false;
+    }
+    let mut matches = groups
+        .iter()
+        .map(|group| match_conditions_at(file_path, metadata, group, extension_lists, depth + 1));
+    if any {
+        matches.any(|m| m)
+    } else {
+        matches.all(|m| m)
+    }
+}
+
+/// Matches a `not` condition group nested `depth` levels deep, which matches
+/// if the group doesn't
+fn match_negated(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    group: &Conditions,
+    extension_lists: &ExtensionLists,
+    depth: usize,
+) -> bool {
+    if depth >= rule::MAX_CONDITION_DEPTH {
+        log::warn!(
+            "Conditions nested deeper than {} levels, not matching '{}'",
+            rule::MAX_CONDITION_DEPTH,
+            file_path.display()
+        );
+        return false;
+    }
+    !match_conditions_at(file_path, metadata, group, extension_lists, depth + 1)
+}
+
+/// Matches conditions nested `depth` levels deep in `any_of`/`all_of`/`not` groups.
+///
+/// Conditions are checked in order until the result is known, so the ones
+/// reading the file or running a classifier come last and are skipped once a
+/// cheap check decided the match.
+fn match_conditions_at(
+    file_path: &Path,
+    metadata: &fs::Metadata,
+    conditions: &Conditions,
+    extension_lists: &ExtensionLists,
+    depth: usize,
+) -> bool {
+    let checks: &[&dyn Fn() -> Result<bool, TookaError>] = &[
+        // Checks of the path and metadata only
+        &|| {
+            conditions
+                .filename
+                .as_ref()
+                .map_or(Ok(true), |pattern| match_filename_regex(file_path, pattern))
+        },
+        &|| {
+            conditions
+                .filename_glob
+                .as_ref()
+                .map_or(Ok(true), |pattern| match_filename_glob(file_path, pattern))
+        },
+        &|| {
+            conditions
+                .extensions
+                .as_ref()
+                .map_or(Ok(true), |exts| Ok(match_extensions(file_path, exts)))
+        },
+        &|| {
+            conditions
+                .path
+                .as_ref()
+                .map_or(Ok(true), |pattern| match_path(file_path, pattern))
+        },
+        &|| {
+            conditions
+                .size_kb
+                .as_ref()
+                .map_or(Ok(true), |size| Ok(match_size_kb(metadata, size)))
+        },
+        &|| {
+            conditions.size_greater_than_kb.map_or(Ok(true), |kb| {
+                let size_of_link = conditions.size_of_link.unwrap_or(false);
+                Ok(match_size_greater_than_kb(
+                    file_path,
+                    metadata,
+                    kb,
+                    size_of_link,
+                ))
+            })
+        },
+        &|| {
+            conditions
+                .size_greater_than
+                .as_ref()
+                .map_or(Ok(true), |size| {
+                    let bytes = parse_size(size).map_err(TookaError::InvalidRule)?;
+                    let size_of_link = conditions.size_of_link.unwrap_or(false);
+                    Ok(match_size_greater_than(
+                        file_path,
+                        metadata,
+                        bytes,
+                        size_of_link,
+                    ))
+                })
+        },
+        &|| {
+            conditions
+                .created_date
+                .as_ref()
+                .map_or(Ok(true), |date_range| {
+                    Ok(match_date_range_created(metadata, date_range))
+                })
+        },
+        &|| {
+            conditions
+                .modified_date
+                .as_ref()
+                .map_or(Ok(true), |date_range| {
+                    Ok(match_date_range_mod(metadata, date_range))
+                })
+        },
+        &|| {
+            conditions
+                .is_symlink
+                .map_or(Ok(true), |b| Ok(match_is_symlink(metadata, b)))
+        },
+        &|| {
+            conditions
+                .owner
+                .as_ref()
+                .map_or(Ok(true), |owner| Ok(match_owner(metadata, owner)))
+        },
+        &|| {
+            conditions.older_than_days.map_or(Ok(true), |days| {
+                Ok(match_older_than_days(metadata, days, Local::now()))
+            })
+        },
+        &|| {
+            conditions.older_than.as_ref().map_or(Ok(true), |age| {
+                let days = duration_days(parse_duration(age).map_err(TookaError::InvalidRule)?);
+                Ok(match_older_than_days(metadata, days, Local::now()))
+            })
+        },
+        &|| {
+            conditions.in_allowlist.map_or(Ok(true), |b| {
+                Ok(match_extension_list(
+                    file_path,
+                    &extension_lists.allowlist,
+                    b,
+                ))
+            })
+        },
+        &|| {
+            conditions.in_denylist.map_or(Ok(true), |b| {
+                Ok(match_extension_list(
+                    file_path,
+                    &extension_lists.denylist,
+                    b,
+                ))
+            })
+        },
+        &|| {
+            conditions
+                .in_list
+                .as_ref()
+                .map_or(Ok(true), |list| match_in_list(file_path, list))
+        },
+        &|| {
+            conditions
+                .day
+                .as_ref()
+                .map_or(Ok(true), |day| Ok(match_day(metadata, day)))
+        },
+        // Checks reading the file
+        &|| {
+            conditions
+                .category
+                .as_ref()
+                .map_or(Ok(true), |name| match_category(file_path, name))
+        },
+        &|| {
+            conditions
+                .mime_type
+                .as_ref()
+                .map_or(Ok(true), |m| Ok(match_mime_type(file_path, m)))
+        },
+        &|| {
+            conditions
+                .metadata
+                .as_ref()
+                .map_or(Ok(true), |metadata_fields| {
+                    Ok(metadata_fields
+                        .iter()
+                        .all(|field| match_metadata_field(file_path, field)))
+                })
+        },
+        &|| {
+            conditions
+                .exif_date
+                .map_or(Ok(true), |b| Ok(match_exif_date(file_path, b)))
+        },
+        &|| {
+            conditions
+                .corrupt
+                .map_or(Ok(true), |b| Ok(match_corrupt(file_path, b)))
+        },
+        &|| {
+            conditions
+                .content_regex
+                .as_ref()
+                .map_or(Ok(true), |pattern| {
+                    match_content_regex(file_path, pattern, configured_content_max_bytes())
+                })
+        },
+        &|| {
+            conditions
+                .video
+                .as_ref()
+                .map_or(Ok(true), |video| Ok(match_video(file_path, video)))
+        },
+        // Nested groups, which may hold any of the above
+        &|| {
+            conditions.any_of.as_ref().map_or(Ok(true), |groups| {
+                Ok(match_nested(
+                    file_path,
+                    metadata,
+                    groups,
+                    extension_lists,
+                    true,
+                    depth,
+                ))
+            })
+        },
+        &|| {
+            conditions.all_of.as_ref().map_or(Ok(true), |groups| {
+                Ok(match_nested(
+                    file_path,
+                    metadata,
+                    groups,
+                    extension_lists,
+                    false,
+                    depth,
+                ))
+            })
+        },
+        &|| {
+            conditions.not.as_deref().map_or(Ok(true), |group| {
+                Ok(match_negated(
+                    file_path,
+                    metadata,
+                    group,
+                    extension_lists,
+                    depth,
+                ))
+            })
+        },
+        // Runs an external program
+        &|| {
+            conditions
+                .classify_with
+                .as_ref()
+                .map_or(Ok(true), |classify| {
+                    match_classify_with(file_path, classify)
+                })
+        },
     ];
+    let mut matches = checks.iter().map(|check| {
+        check().unwrap_or_else(|e| {
+            log::debug!("Condition failed for '{}': {e}", file_path.display());
+            false
+        })
+    });
     let any_conditions = conditions.any.unwrap_or(false);
-    log::debug!("Conditions any: {any_conditions}, matches: {matches:?}");
-    if any_conditions {
+    let matched = if any_conditions {
         log::debug!("Using OR logic for conditions");
-        matches.into_iter().any(|m| m.unwrap_or(false))
+        matches.any(|m| m)
     } else {
         log::debug!("Using AND logic for conditions");
-        matches.into_iter().all(|m| m.unwrap_or(false))
-    }
+        matches.all(|m| m)
+    };
+    log::debug!("Conditions any: {any_conditions}, matched: {matched}");
+    matched
 }
@@ -3,8 +3,17 @@ use std::io::Write;
 use std::path::{Path, PathBuf};
 use tempfile::NamedTempFile;
 
-use super::file_match;
-use crate::rules::rule::{DateRange, MetadataField, Range};
+use super::file_match::{self, ExtensionLists};
+use crate::rules::rule::{
+    self, ClassifyCondition, Conditions, DateRange, DayConditions, ListFile, ListMatchBy,
+    MetadataField, Range, TimeField, VideoConditions, Weekday,
+};
+use crate::utils::rename_pattern::extract_metadata;
+
+// Helper to match a file against conditions with the default extension lists
+fn matches(file_path: &Path, conditions: &Conditions) -> bool {
+    file_match::match_rule_matcher(file_path, conditions, &ExtensionLists::default())
+}
 
 // Helper to create a temp file and rename it to a given filename
 fn create_temp_file_with_name(filename: &str) -> PathBuf {
@@ -58,6 +67,34 @@ fn test_match_extensions() {
     ));
 }
 
+#[test]
+fn test_match_extensions_case_and_dot_insensitive() {
+    let cases: &[(&str, &[&str], bool)] = &[
+        ("photo.JPG", &["jpg"], true),
+        ("photo.jpg", &[".JPG"], true),
+        ("photo.jpeg", &["jpg"], false),
+        ("archive.tar.gz", &["gz"], true),
+        ("archive.tar.gz", &["tar.gz"], true),
+        ("archive.TAR.GZ", &[".tar.gz"], true),
+        ("archive.gz", &["tar.gz"], false),
+        (".tar.gz", &["tar.gz"], false),
+        (".bashrc", &["bashrc"], false),
+        (".bashrc", &[""], true),
+        ("Makefile", &[""], true),
+        ("Makefile", &["txt"], false),
+        ("notes.txt", &[""], false),
+    ];
+
+    for (file_name, extensions, expected) in cases {
+        let extensions: Vec<String> = extensions.iter().map(ToString::to_string).collect();
+        assert_eq!(
+            file_match::match_extensions(Path::new(file_name), &extensions),
+            *expected,
+            "{file_name} against {extensions:?}"
+        );
+    }
+}
+
 #[test]
 fn test_match_path() {
     let matching_path = create_temp_file_in_dir("photos/match.jpg");
@@ -96,6 +133,62 @@ fn test_match_mime_type() {
     assert!(!file_match::match_mime_type(&txt_path, "image/*"));
 }
 
+#[test]
+fn test_match_mime_type_sniffs_content() {
+    // A PNG saved with a .jpg extension, well under the 512 bytes inspected
+    let mislabeled = create_temp_file_with_extension("jpg");
+    fs::write(&mislabeled, b"\x89PNG\r\n\x1a\n\0\0\0\rIHDR").unwrap();
+    assert!(file_match::match_mime_type(&mislabeled, "image/png"));
+    assert!(!file_match::match_mime_type(&mislabeled, "image/jpeg"));
+    assert!(file_match::match_mime_type(&mislabeled, "image/*"));
+
+    // Text keeps the more specific type of its extension
+    let json = create_temp_file_with_extension("json");
+    fs::write(&json, r#"{"sorted": true}"#).unwrap();
+    assert!(file_match::match_mime_type(&json, "application/json"));
+    let unnamed = create_temp_file_with_name("README");
+    fs::write(&unnamed, "plain words").unwrap();
+    assert!(file_match::match_mime_type(&unnamed, "text/*"));
+    assert!(!file_match::match_mime_type(&unnamed, "text/plainer"));
+}
+
+#[test]
+fn test_match_category() {
+    let photo = create_temp_file_with_extension("HEIC");
+    assert!(file_match::match_category(&photo, "image").unwrap());
+    assert!(file_match::match_category(&photo, "Image").unwrap());
+    assert!(!file_match::match_category(&photo, "document").unwrap());
+
+    // Files with an unknown extension fall back to their content
+    let png = create_temp_file_with_name("scan.upload");
+    fs::write(&png, b"\x89PNG\r\n\x1a\n\0\0\0\rIHDR").unwrap();
+    assert!(file_match::match_category(&png, "image").unwrap());
+    assert!(!file_match::match_category(&png, "video").unwrap());
+
+    assert!(file_match::match_category(&photo, "photos").is_err());
+    let conditions = Conditions {
+        category: Some("image".to_string()),
+        ..Default::default()
+    };
+    assert!(matches(&photo, &conditions));
+}
+
+#[cfg(unix)]
+#[test]
+fn test_match_mime_type_unreadable_file_does_not_match() {
+    use std::os::unix::fs::PermissionsExt;
+
+    let path = create_temp_file_with_extension("png");
+    fs::write(&path, b"\x89PNG\r\n\x1a\n").unwrap();
+    fs::set_permissions(&path, fs::Permissions::from_mode(0o000)).unwrap();
+    // Permissions do not stop root, so only check when the file really is unreadable
+    if fs::File::open(&path).is_err() {
+        assert!(!file_match::match_mime_type(&path, "image/png"));
+    }
+    fs::set_permissions(&path, fs::Permissions::from_mode(0o644)).unwrap();
+    assert!(file_match::match_mime_type(&path, "image/png"));
+}
+
 #[test]
 fn test_match_date_range_mod() {
     let file = NamedTempFile::new().unwrap();
@@ -129,6 +222,69 @@ fn test_match_date_range_created() {
     assert!(matches!(result, true | false));
 }
 
+/// Creates a temp file last modified at noon local time on the given date
+fn file_modified_on(year: i32, month: u32, day: u32) -> NamedTempFile {
+    use chrono::TimeZone;
+    let file = NamedTempFile::new().unwrap();
+    let noon = chrono::Local
+        .with_ymd_and_hms(year, month, day, 12, 0, 0)
+        .unwrap();
+    file.as_file().set_modified(noon.into()).unwrap();
+    file
+}
+
+fn modified_day(weekdays: Option<Vec<Weekday>>, days_of_month: Option<Vec<i32>>) -> DayConditions {
+    DayConditions {
+        field: TimeField::Modified,
+        weekdays,
+        days_of_month,
+    }
+}
+
+#[test]
+fn test_match_day_weekday() {
+    // 2024-06-01 was a Saturday, 2024-06-03 a Monday
+    let saturday = file_modified_on(2024, 6, 1);
+    let monday = file_modified_on(2024, 6, 3);
+    let weekend = modified_day(Some(vec![Weekday::Sat, Weekday::Sun]), None);
+
+    let meta = |f: &NamedTempFile| f.as_file().metadata().unwrap();
+    assert!(file_match::match_day(&meta(&saturday), &weekend));
+    assert!(!file_match::match_day(&meta(&monday), &weekend));
+    assert!(file_match::match_day(
+        &meta(&monday),
+        &modified_day(Some(vec![Weekday::Mon]), None)
+    ));
+}
+
+#[test]
+fn test_match_day_of_month() {
+    // 2024 is a leap year, so February ends on the 29th
+    let first = file_modified_on(2024, 3, 1);
+    let leap_day = file_modified_on(2024, 2, 29);
+    let meta = |f: &NamedTempFile| f.as_file().metadata().unwrap();
+
+    let first_of_month = modified_day(None, Some(vec![1]));
+    assert!(file_match::match_day(&meta(&first), &first_of_month));
+    assert!(!file_match::match_day(&meta(&leap_day), &first_of_month));
+
+    let last_of_month = modified_day(None, Some(vec![-1]));
+    assert!(file_match::match_day(&meta(&leap_day), &last_of_month));
+    assert!(!file_match::match_day(&meta(&first), &last_of_month));
+
+    // Both lists must match: 2024-03-01 was a Friday, not a Monday
+    let first_monday = modified_day(Some(vec![Weekday::Mon]), Some(vec![1]));
+    assert!(!file_match::match_day(&meta(&first), &first_monday));
+}
+
+#[test]
+fn test_day_conditions_parse_weekday_names() {
+    let day: DayConditions =
+        serde_yaml::from_str(r#"{"field": "modified", "weekdays": ["saturday", "sun"]}"#).unwrap();
+    assert_eq!(day.field, TimeField::Modified);
+    assert_eq!(day.weekdays, Some(vec![Weekday::Sat, Weekday::Sun]));
+}
+
 #[test]
 fn test_match_is_symlink() {
     let file = NamedTempFile::new().unwrap().into_temp_path();
@@ -145,6 +301,60 @@ fn test_match_is_symlink() {
 
     assert!(!file_match::match_is_symlink(&file_meta, true));
     assert!(file_match::match_is_symlink(&symlink_meta, true));
+    assert!(file_match::match_is_symlink(&file_meta, false));
+    assert!(!file_match::match_is_symlink(&symlink_meta, false));
+    fs::remove_file(&symlink_path).unwrap();
+}
+
+#[cfg(unix)]
+#[test]
+fn test_uid_from_passwd() {
+    let passwd = "# local users\nroot:x:0:0:root:/root:/bin/sh\nalice:x:1001:1001::/home/alice:/bin/bash\nbroken:x:abc:1\n";
+    assert_eq!(file_match::uid_from_passwd(passwd, "root"), Some(0));
+    assert_eq!(file_match::uid_from_passwd(passwd, "alice"), Some(1001));
+    assert_eq!(file_match::uid_from_passwd(passwd, "broken"), None);
+    assert_eq!(file_match::uid_from_passwd(passwd, "ali"), None);
+}
+
+#[cfg(unix)]
+#[test]
+fn test_match_owner() {
+    use std::os::unix::fs::MetadataExt;
+
+    let file = NamedTempFile::new().unwrap();
+    let metadata = fs::metadata(file.path()).unwrap();
+    let uid = metadata.uid();
+
+    assert!(file_match::match_owner(&metadata, &uid.to_string()));
+    assert!(!file_match::match_owner(&metadata, &(uid + 1).to_string()));
+    assert!(!file_match::match_owner(
+        &metadata,
+        "no-such-user-for-tooka"
+    ));
+}
+
+// Creating symlinks needs extra privileges on Windows, so this runs on Unix only
+#[cfg(unix)]
+#[test]
+fn test_is_symlink_condition_does_not_follow_links() {
+    let dir = tempfile::tempdir().unwrap();
+    let target = dir.path().join("target.txt");
+    let link = dir.path().join("link.txt");
+    fs::write(&target, "content").unwrap();
+    std::os::unix::fs::symlink(&target, &link).unwrap();
+
+    let conditions = |is_symlink: Option<bool>| Conditions {
+        extensions: Some(vec!["txt".to_string()]),
+        is_symlink,
+        ..Default::default()
+    };
+
+    assert!(matches(&link, &conditions(Some(true))));
+    assert!(!matches(&target, &conditions(Some(true))));
+    assert!(matches(&target, &conditions(Some(false))));
+    assert!(!matches(&link, &conditions(Some(false))));
+    assert!(matches(&link, &conditions(None)));
+    assert!(matches(&target, &conditions(None)));
 }
 
 #[test]
@@ -159,3 +369,689 @@ fn test_match_metadata_field_nonexistent() {
     // No EXIF data in a blank temp file
     assert!(!file_match::match_metadata_field(&path, &field));
 }
+
+// Builds a minimal structurally valid PNG (CRCs are not verified by the check)
+fn minimal_png() -> Vec<u8> {
+    let mut png = vec![0x89, b'P', b'N', b'G', 0x0D, 0x0A, 0x1A, 0x0A];
+    png.extend_from_slice(&13u32.to_be_bytes());
+    png.extend_from_slice(b"IHDR");
+    png.extend_from_slice(&[0, 0, 0, 1, 0, 0, 0, 1, 8, 2, 0, 0, 0]);
+    png.extend_from_slice(&[0; 4]);
+    png.extend_from_slice(&0u32.to_be_bytes());
+    png.extend_from_slice(b"IEND");
+    png.extend_from_slice(&[0; 4]);
+    png
+}
+
+// Builds a minimal JPEG with an APP0 segment, a start of scan and an end marker
+fn minimal_jpeg() -> Vec<u8> {
+    let mut jpeg = vec![0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10];
+    jpeg.extend_from_slice(b"JFIF\0");
+    jpeg.extend_from_slice(&[1, 1, 0, 0, 1, 0, 1, 0, 0]);
+    jpeg.extend_from_slice(&[0xFF, 0xDA, 0x00, 0x08, 1, 1, 0, 0, 0x3F, 0]);
+    jpeg.extend_from_slice(&[0x12, 0x34, 0x56, 0x78]);
+    jpeg.extend_from_slice(&[0xFF, 0xD9]);
+    jpeg
+}
+
+#[test]
+fn test_match_corrupt_zero_length_file() {
+    let path = create_temp_file_with_extension("jpg");
+
+    assert!(file_match::match_corrupt(&path, true));
+    assert!(!file_match::match_corrupt(&path, false));
+}
+
+#[test]
+fn test_match_corrupt_png() {
+    let valid = create_temp_file_with_extension("png");
+    let truncated = create_temp_file_with_extension("png");
+    let png = minimal_png();
+    fs::write(&valid, &png).unwrap();
+    fs::write(&truncated, &png[..png.len() - 6]).unwrap();
+
+    assert!(!file_match::match_corrupt(&valid, true));
+    assert!(file_match::match_corrupt(&truncated, true));
+}
+
+#[test]
+fn test_match_corrupt_jpeg() {
+    let valid = create_temp_file_with_extension("jpg");
+    let truncated = create_temp_file_with_extension("jpg");
+    let jpeg = minimal_jpeg();
+    fs::write(&valid, &jpeg).unwrap();
+    fs::write(&truncated, &jpeg[..jpeg.len() - 4]).unwrap();
+
+    assert!(!file_match::match_corrupt(&valid, true));
+    assert!(file_match::match_corrupt(&truncated, true));
+}
+
+#[test]
+fn test_match_corrupt_skips_unreadable_files() {
+    // Not a file, so it can't be read even with root privileges
+    let dir = tempfile::tempdir().unwrap();
+    let folder = dir.path().join("photo.jpg");
+    fs::create_dir(&folder).unwrap();
+    assert!(!file_match::match_corrupt(&folder, true));
+    assert!(!file_match::match_corrupt(&folder, false));
+
+    // Removed by another process in the meantime
+    let missing = dir.path().join("missing.jpg");
+    assert!(!file_match::match_corrupt(&missing, true));
+    assert!(!file_match::match_corrupt(&missing, false));
+
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::PermissionsExt;
+
+        let locked = dir.path().join("locked.png");
+        fs::write(&locked, minimal_png()).unwrap();
+        fs::set_permissions(&locked, fs::Permissions::from_mode(0o000)).unwrap();
+        assert!(!file_match::match_corrupt(&locked, true));
+    }
+}
+
+#[test]
+fn test_match_corrupt_ignores_unknown_formats() {
+    let path = create_temp_file_with_extension("txt");
+    fs::write(&path, "plain text content").unwrap();
+
+    assert!(!file_match::match_corrupt(&path, true));
+}
+
+#[test]
+fn test_match_exif_date_requires_capture_date() {
+    let no_exif = create_temp_file_with_extension("jpg");
+    fs::write(&no_exif, b"\xff\xd8\xff\xe0\0\x10JFIF\0").unwrap();
+    // A truncated APP1 segment is a corrupt EXIF block, not an error
+    let corrupt = create_temp_file_with_extension("jpg");
+    fs::write(&corrupt, b"\xff\xd8\xff\xe1\xff\xffExif\0\0MM").unwrap();
+
+    for path in [&no_exif, &corrupt] {
+        assert!(!file_match::match_exif_date(path, true));
+        assert!(file_match::match_exif_date(path, false));
+    }
+}
+
+#[test]
+fn test_match_extension_list() {
+    let list = vec!["exe".to_string(), ".PS1".to_string()];
+
+    let exe = PathBuf::from("/downloads/setup.EXE");
+    let script = PathBuf::from("/downloads/install.ps1");
+    let document = PathBuf::from("/downloads/report.pdf");
+    let no_extension = PathBuf::from("/downloads/README");
+
+    assert!(file_match::match_extension_list(&exe, &list, true));
+    assert!(file_match::match_extension_list(&script, &list, true));
+    assert!(!file_match::match_extension_list(&document, &list, true));
+    assert!(file_match::match_extension_list(&document, &list, false));
+    assert!(file_match::match_extension_list(
+        &no_extension,
+        &list,
+        false
+    ));
+}
+
+#[test]
+fn test_match_default_allow_and_deny_lists() {
+    let executable = create_temp_file_with_extension("exe");
+    let document = create_temp_file_with_extension("pdf");
+    let unknown = create_temp_file_with_extension("xyz");
+
+    let quarantine = Conditions {
+        in_denylist: Some(true),
+        ..Default::default()
+    };
+    assert!(matches(&executable, &quarantine));
+    assert!(!matches(&document, &quarantine));
+
+    let unknown_types = Conditions {
+        in_allowlist: Some(false),
+        in_denylist: Some(false),
+        ..Default::default()
+    };
+    assert!(matches(&unknown, &unknown_types));
+    assert!(!matches(&document, &unknown_types));
+    assert!(!matches(&executable, &unknown_types));
+}
+
+#[test]
+fn test_match_extension_lists_passed_in() {
+    let unknown = create_temp_file_with_extension("xyz");
+    let lists = ExtensionLists {
+        allowlist: vec!["xyz".to_string()],
+        denylist: Vec::new(),
+    };
+    let allowed = Conditions {
+        in_allowlist: Some(true),
+        ..Default::default()
+    };
+
+    assert!(!matches(&unknown, &allowed));
+    assert!(file_match::match_rule_matcher(&unknown, &allowed, &lists));
+}
+
+#[test]
+fn test_match_in_list_by_basename_and_path() {
+    let dir = tempfile::tempdir().unwrap();
+    let listed = dir.path().join("keep.pdf");
+    let unlisted = dir.path().join("other.pdf");
+    let list_path = dir.path().join("list.txt");
+    fs::write(
+        &list_path,
+        format!(
+            "# curated files\nkeep.pdf\n\n  {}  \n",
+            dir.path().join("other.pdf").display()
+        ),
+    )
+    .unwrap();
+
+    let by_name = ListFile {
+        file: list_path.to_string_lossy().to_string(),
+        match_by: ListMatchBy::Basename,
+    };
+    assert!(file_match::match_in_list(&listed, &by_name).unwrap());
+    assert!(!file_match::match_in_list(&unlisted, &by_name).unwrap());
+    assert!(!file_match::match_in_list(Path::new("/elsewhere/curated"), &by_name).unwrap());
+
+    let by_path = ListFile {
+        match_by: ListMatchBy::Path,
+        ..by_name
+    };
+    assert!(file_match::match_in_list(&unlisted, &by_path).unwrap());
+    assert!(!file_match::match_in_list(&listed, &by_path).unwrap());
+}
+
+#[test]
+fn test_match_in_list_reloads_changed_list_file() {
+    let dir = tempfile::tempdir().unwrap();
+    let file = dir.path().join("keep.pdf");
+    let list_path = dir.path().join("list.txt");
+    let write_list = |content: &str, modified: std::time::SystemTime| {
+        fs::write(&list_path, content).unwrap();
+        fs::File::options()
+            .write(true)
+            .open(&list_path)
+            .unwrap()
+            .set_modified(modified)
+            .unwrap();
+    };
+    let list = ListFile {
+        file: list_path.to_string_lossy().to_string(),
+        match_by: ListMatchBy::Basename,
+    };
+    let earlier = std::time::SystemTime::now() - std::time::Duration::from_secs(60);
+
+    write_list("other.pdf\n", earlier);
+    assert!(!file_match::match_in_list(&file, &list).unwrap());
+
+    write_list("keep.pdf\n", std::time::SystemTime::now());
+    assert!(file_match::match_in_list(&file, &list).unwrap());
+}
+
+#[test]
+fn test_match_in_list_missing_file_matches_nothing() {
+    let file = create_temp_file_with_name("listed.txt");
+    let conditions = Conditions {
+        in_list: Some(ListFile {
+            file: "/nonexistent/tooka/list.txt".to_string(),
+            match_by: ListMatchBy::Basename,
+        }),
+        ..Default::default()
+    };
+
+    assert!(!matches(&file, &conditions));
+}
+
+fn mp4_box(kind: &[u8; 4], body: &[u8]) -> Vec<u8> {
+    let mut data = u32::try_from(body.len() + 8)
+        .unwrap()
+        .to_be_bytes()
+        .to_vec();
+    data.extend_from_slice(kind);
+    data.extend_from_slice(body);
+    data
+}
+
+/// Builds a minimal MP4 with an audio track followed by a video track
+fn minimal_mp4(duration_secs: u32, width: u32, height: u32) -> Vec<u8> {
+    let timescale = 1000u32;
+    let mut mvhd = vec![0u8; 100];
+    mvhd[12..16].copy_from_slice(&timescale.to_be_bytes());
+    mvhd[16..20].copy_from_slice(&(duration_secs * timescale).to_be_bytes());
+
+    let tkhd = |width: u32, height: u32| {
+        let mut body = vec![0u8; 84];
+        body[76..80].copy_from_slice(&(width << 16).to_be_bytes());
+        body[80..84].copy_from_slice(&(height << 16).to_be_bytes());
+        mp4_box(b"trak", &mp4_box(b"tkhd", &body))
+    };
+
+    let mut moov = mp4_box(b"mvhd", &mvhd);
+    moov.extend(tkhd(0, 0));
+    moov.extend(tkhd(width, height));
+
+    let mut data = mp4_box(b"ftyp", b"isom\0\0\0\0");
+    data.extend(mp4_box(b"moov", &moov));
+    data.extend(mp4_box(b"mdat", &[0u8; 32]));
+    data
+}
+
+fn video_range(min: Option<u64>, max: Option<u64>) -> Option<Range> {
+    Some(Range { min, max })
+}
+
+#[test]
+fn test_match_video_duration() {
+    let clip = create_temp_file_with_extension("mp4");
+    fs::write(&clip, minimal_mp4(30, 1280, 720)).unwrap();
+    let movie = create_temp_file_with_extension("mp4");
+    fs::write(&movie, minimal_mp4(5400, 1280, 720)).unwrap();
+
+    let clips = VideoConditions {
+        duration_secs: video_range(None, Some(60)),
+        ..Default::default()
+    };
+    assert!(file_match::match_video(&clip, &clips));
+    assert!(!file_match::match_video(&movie, &clips));
+
+    let movies = VideoConditions {
+        duration_secs: video_range(Some(3600), None),
+        ..Default::default()
+    };
+    assert!(file_match::match_video(&movie, &movies));
+}
+
+#[test]
+fn test_match_video_resolution() {
+    let uhd = create_temp_file_with_extension("mp4");
+    fs::write(&uhd, minimal_mp4(10, 3840, 2160)).unwrap();
+    let sd = create_temp_file_with_extension("mov");
+    fs::write(&sd, minimal_mp4(10, 640, 480)).unwrap();
+
+    let conditions = Conditions {
+        video: Some(VideoConditions {
+            height: video_range(Some(2160), None),
+            ..Default::default()
+        }),
+        ..Default::default()
+    };
+    assert!(matches(&uhd, &conditions));
+    assert!(!matches(&sd, &conditions));
+}
+
+#[test]
+fn test_match_video_unprobeable_files_do_not_match() {
+    let text = create_temp_file_with_extension("mp4");
+    fs::write(&text, "not a video").unwrap();
+    let truncated = create_temp_file_with_extension("mp4");
+    let data = minimal_mp4(10, 1920, 1080);
+    fs::write(&truncated, &data[..40]).unwrap();
+
+    let any_video = VideoConditions::default();
+    assert!(!file_match::match_video(&text, &any_video));
+    assert!(!file_match::match_video(&truncated, &any_video));
+}
+
+#[test]
+fn test_video_metadata_template_fields() {
+    let path = create_temp_file_with_extension("mp4");
+    fs::write(&path, minimal_mp4(90, 1920, 1080)).unwrap();
+
+    let metadata = extract_metadata(&path).unwrap();
+    assert_eq!(metadata["VIDEO:Duration"], "90");
+    assert_eq!(metadata["VIDEO:Resolution"], "1920x1080");
+    assert_eq!(metadata["VIDEO:Height"], "1080");
+}
+
+/// Runs `script` through `sh`, which receives the classified file as `$1`
+#[cfg(unix)]
+fn shell_classifier(script: &str, label: &str, timeout_secs: u64) -> ClassifyCondition {
+    ClassifyCondition {
+        command: "sh".to_string(),
+        args: vec!["-c".to_string(), script.to_string(), "sh".to_string()],
+        label: label.to_string(),
+        timeout_secs,
+    }
+}
+
+#[cfg(unix)]
+#[test]
+fn test_match_classify_with_label_and_cache() {
+    let dir = tempfile::tempdir().unwrap();
+    let calls = dir.path().join("calls");
+    let cat = dir.path().join("cat_photo.jpg");
+    let dog = dir.path().join("dog_photo.jpg");
+    fs::write(&cat, "").unwrap();
+    fs::write(&dog, "").unwrap();
+    let script = format!(
+        "echo call >> '{}'; case \"$1\" in *cat*) echo ' cat ';; *) echo dog;; esac",
+        calls.display()
+    );
+
+    let cats = shell_classifier(&script, "cat", 10);
+    assert!(file_match::match_classify_with(&cat, &cats).unwrap());
+    assert!(!file_match::match_classify_with(&dog, &cats).unwrap());
+    // Labels are regexes matched against the whole label
+    let pets = shell_classifier(&script, "cat|dog", 10);
+    assert!(file_match::match_classify_with(&dog, &pets).unwrap());
+    assert!(!file_match::match_classify_with(&dog, &shell_classifier(&script, "do", 10)).unwrap());
+
+    // Each file is classified once per program, however many rules ask
+    assert!(file_match::match_classify_with(&cat, &cats).unwrap());
+    assert_eq!(fs::read_to_string(&calls).unwrap().lines().count(), 2);
+}
+
+#[cfg(unix)]
+#[test]
+fn test_classifier_is_skipped_once_cheap_conditions_decide() {
+    let dir = tempfile::tempdir().unwrap();
+    let calls = dir.path().join("calls");
+    let file = dir.path().join("notes.txt");
+    fs::write(&file, "").unwrap();
+    let script = format!("echo call >> '{}'; echo cat", calls.display());
+    let conditions = |any| Conditions {
+        any: Some(any),
+        extensions: Some(vec!["jpg".to_string()]),
+        filename: Some("^notes".to_string()),
+        classify_with: Some(shell_classifier(&script, "cat", 10)),
+        ..Default::default()
+    };
+
+    // The extension fails all conditions, and the file name matches one of them
+    assert!(!matches(&file, &conditions(false)));
+    assert!(matches(&file, &conditions(true)));
+    assert!(!calls.exists());
+}
+
+#[cfg(unix)]
+#[test]
+fn test_match_classify_with_failures_do_not_match() {
+    let file = create_temp_file_with_name("classify_failure.jpg");
+
+    let failing = shell_classifier("echo cat; exit 3", "cat", 10);
+    assert!(!file_match::match_classify_with(&file, &failing).unwrap());
+
+    let started = std::time::Instant::now();
+    let hanging = shell_classifier("sleep 30; echo cat", "cat", 1);
+    assert!(!file_match::match_classify_with(&file, &hanging).unwrap());
+    assert!(started.elapsed() < std::time::Duration::from_secs(10));
+
+    let missing = ClassifyCondition {
+        command: "/nonexistent/classifier".to_string(),
+        args: Vec::new(),
+        label: "cat".to_string(),
+        timeout_secs: 1,
+    };
+    assert!(!file_match::match_classify_with(&file, &missing).unwrap());
+}
+
+#[test]
+fn test_match_older_than_days() {
+    use chrono::TimeZone;
+    let file = file_modified_on(2024, 3, 1);
+    let meta = fs::metadata(file.path()).unwrap();
+    let now = chrono::Local
+        .with_ymd_and_hms(2024, 3, 11, 12, 0, 0)
+        .unwrap();
+
+    // Modified exactly ten days before `now`, so it is not older than ten days
+    assert!(file_match::match_older_than_days(&meta, 9, now));
+    assert!(!file_match::match_older_than_days(&meta, 10, now));
+    assert!(!file_match::match_older_than_days(&meta, 30, now));
+}
+
+#[test]
+fn test_nested_any_of_all_of_conditions() {
+    use chrono::{Duration, Local};
+    let file_with = |suffix: &str, days_old: i64| {
+        let file = tempfile::Builder::new().suffix(suffix).tempfile().unwrap();
+        let modified = Local::now() - Duration::days(days_old);
+        file.as_file().set_modified(modified.into()).unwrap();
+        file
+    };
+    let extension = |ext: &str| Conditions {
+        extensions: Some(vec![ext.to_string()]),
+        ..Default::default()
+    };
+    // Old photos: (jpg or png) and older than 30 days
+    let conditions = Conditions {
+        all_of: Some(vec![
+            Conditions {
+                any_of: Some(vec![extension("jpg"), extension("png")]),
+                ..Default::default()
+            },
+            Conditions {
+                older_than_days: Some(30),
+                ..Default::default()
+            },
+        ]),
+        ..Default::default()
+    };
+
+    for (suffix, days_old, expected) in [
+        (".jpg", 60, true),
+        (".png", 60, true),
+        (".gif", 60, false),
+        (".jpg", 5, false),
+    ] {
+        let file = file_with(suffix, days_old);
+        let matched = matches(file.path(), &conditions);
+        assert_eq!(matched, expected, "{suffix} modified {days_old} days ago");
+    }
+}
+
+#[test]
+fn test_not_excludes_matching_files() {
+    // Images that are not screenshots
+    let conditions = Conditions {
+        extensions: Some(vec!["png".to_string()]),
+        not: Some(Box::new(Conditions {
+            filename: Some("^Screenshot".to_string()),
+            ..Default::default()
+        })),
+        ..Default::default()
+    };
+
+    for (name, expected) in [
+        ("holiday.png", true),
+        ("Screenshot 2024-03-11.png", false),
+        ("notes.txt", false),
+    ] {
+        let path = create_temp_file_with_name(name);
+        let matched = matches(&path, &conditions);
+        assert_eq!(matched, expected, "{name}");
+        fs::remove_file(&path).unwrap();
+    }
+}
+
+#[test]
+fn test_too_deeply_nested_conditions_do_not_match() {
+    let file = NamedTempFile::new().unwrap();
+    let mut conditions = Conditions::default();
+    for _ in 0..=rule::MAX_CONDITION_DEPTH {
+        conditions = Conditions {
+            all_of: Some(vec![conditions]),
+            ..Default::default()
+        };
+    }
+    assert!(!matches(file.path(), &conditions));
+
+    let shallow = Conditions {
+        any_of: Some(vec![Conditions::default()]),
+        ..Default::default()
+    };
+    assert!(matches(file.path(), &shallow));
+}
+
+#[test]
+fn test_older_than_zero_days_disables_age_filter() {
+    use chrono::TimeZone;
+    // A file modified after `now` can never be older than it
+    let file = file_modified_on(2024, 3, 20);
+    let meta = fs::metadata(file.path()).unwrap();
+    let now = chrono::Local
+        .with_ymd_and_hms(2024, 3, 11, 12, 0, 0)
+        .unwrap();
+
+    assert!(file_match::match_older_than_days(&meta, 0, now));
+    assert!(!file_match::match_older_than_days(&meta, 1, now));
+
+    let conditions = Conditions {
+        older_than_days: Some(0),
+        ..Default::default()
+    };
+    assert!(file_match::match_conditions(
+        file.path(),
+        &meta,
+        &conditions,
+        &ExtensionLists::default()
+    ));
+}
+
+#[test]
+fn test_match_size_greater_than_kb_boundaries() {
+    for (size, kb, expected) in [
+        (0, 0, false),    // A 0 KB file is not greater than 0 KB
+        (1024, 1, false), // Exactly at the boundary
+        (1025, 1, true),
+        (4096, 2, true),
+    ] {
+        let file = NamedTempFile::new().unwrap();
+        file.as_file().set_len(size).unwrap();
+        let meta = fs::symlink_metadata(file.path()).unwrap();
+        assert_eq!(
+            file_match::match_size_greater_than_kb(file.path(), &meta, kb, false),
+            expected,
+            "{size} bytes against {kb} KB"
+        );
+    }
+}
+
+#[cfg(unix)]
+#[test]
+fn test_match_size_greater_than_kb_follows_symlinks() {
+    let dir = tempfile::tempdir().unwrap();
+    let target = dir.path().join("big.bin");
+    fs::File::create(&target)
+        .unwrap()
+        .set_len(8 * 1024)
+        .unwrap();
+    let link = dir.path().join("link.bin");
+    std::os::unix::fs::symlink(&target, &link).unwrap();
+    let meta = fs::symlink_metadata(&link).unwrap();
+
+    assert!(file_match::match_size_greater_than_kb(
+        &link, &meta, 4, false
+    ));
+    // The link itself is only as large as the target path
+    assert!(!file_match::match_size_greater_than_kb(
+        &link, &meta, 4, true
+    ));
+
+    fs::remove_file(&target).unwrap();
+    assert!(!file_match::match_size_greater_than_kb(
+        &link, &meta, 0, false
+    ));
+}
+
+#[test]
+fn test_created_date_range_with_open_bounds() {
+    let file = file_modified_on(2024, 3, 15);
+    let meta = fs::metadata(file.path()).unwrap();
+    // Birth time of a fresh file is now; fall back to the same reading as the matcher
+    let created: chrono::DateTime<chrono::Utc> =
+        meta.created().or_else(|_| meta.modified()).unwrap().into();
+    let day = created.date_naive();
+    let range = |from: &str, to: &str| DateRange {
+        from: Some(from.to_string()),
+        to: Some(to.to_string()),
+    };
+
+    let before = day.pred_opt().unwrap().to_string();
+    let after = day.succ_opt().unwrap().to_string();
+    // Empty bounds are open
+    assert!(file_match::match_date_range_created(
+        &meta,
+        &range(&before, "")
+    ));
+    assert!(file_match::match_date_range_created(
+        &meta,
+        &range("", &after)
+    ));
+    assert!(!file_match::match_date_range_created(
+        &meta,
+        &range(&after, "")
+    ));
+    assert!(!file_match::match_date_range_created(
+        &meta,
+        &range("", &before)
+    ));
+    // Malformed bounds never match
+    assert!(!file_match::match_date_range_created(
+        &meta,
+        &range("15/03/2024", "")
+    ));
+
+    assert_eq!(range("", " ").parse(), Ok((None, None)));
+    assert!(
+        range("2024-13-01", "")
+            .parse()
+            .unwrap_err()
+            .contains("'from'")
+    );
+}
+
+#[test]
+fn test_match_filename_glob_uses_base_name() {
+    let path = Path::new("/photos/2024/IMG_0042.jpg");
+    assert!(file_match::match_filename_glob(path, "IMG_*.jpg").unwrap());
+    assert!(file_match::match_filename_glob(path, "IMG_00[0-9][0-9].*").unwrap());
+    // The glob is not matched against the folders
+    assert!(!file_match::match_filename_glob(path, "*2024*").unwrap());
+    assert!(file_match::match_filename_glob(path, "[").is_err());
+}
+
+#[test]
+fn test_match_filename_regex_reuses_compiled_pattern() {
+    let pattern = r"^invoice_\d{4}\.pdf$";
+    for (name, expected) in [
+        ("invoice_2024.pdf", true),
+        ("invoice_24.pdf", false),
+        ("old_invoice_2024.pdf", false),
+    ] {
+        let path = PathBuf::from("/docs").join(name);
+        assert_eq!(
+            file_match::match_filename_regex(&path, pattern).unwrap(),
+            expected,
+            "{name}"
+        );
+    }
+    assert!(file_match::match_filename_regex(Path::new("a"), "(").is_err());
+}
+
+#[test]
+fn test_match_content_regex_in_text_files() {
+    let invoice = create_temp_file_with_name("scan_0001.txt");
+    fs::write(&invoice, "ACME Corp\nINVOICE #2024-17\nTotal: 42.00\n").unwrap();
+    assert!(file_match::match_content_regex(&invoice, r"INVOICE #\d+", 1024).unwrap());
+    assert!(!file_match::match_content_regex(&invoice, "RECEIPT", 1024).unwrap());
+
+    // Binary files are skipped even if the pattern occurs in them
+    let binary = create_temp_file_with_name("scan_0002.png");
+    fs::write(&binary, b"\x89PNG\r\n\x1a\nINVOICE #2024-18\n").unwrap();
+    assert!(!file_match::match_content_regex(&binary, "INVOICE", 1024).unwrap());
+}
+
+#[test]
+fn test_match_content_regex_skips_files_over_the_limit() {
+    let path = create_temp_file_with_name("huge_invoice.txt");
+    let mut file = fs::File::create(&path).unwrap();
+    file.write_all(b"INVOICE #2024-19\n").unwrap();
+    // Sparse, so the test doesn't write the whole file
+    file.set_len(1024 * 1024 * 1024).unwrap();
+
+    assert!(!file_match::match_content_regex(&path, "INVOICE", 1024 * 1024).unwrap());
+    fs::remove_file(&path).unwrap();
+}
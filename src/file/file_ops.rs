@@ -1,31 +1,67 @@
 //! Module handling file operations such as moving, copying, renaming, and deleting files.
 //! Supports dry run mode to simulate actions without making changes to the filesystem.
 //! Provides utilities for computing destination paths with optional preservation of
-//! directory structure, and uses metadata extraction to support renaming templates.
+//! directory structure or a per-file path template, and uses metadata extraction to support renaming templates.
 
 use crate::{
+    common::{config::Config, environment::expand_path},
+    core::context,
     core::error::TookaError,
-    rules::rule::{Action, CopyAction, DeleteAction, ExecuteAction, MoveAction, RenameAction},
-    utils::rename_pattern::{evaluate_template, extract_metadata},
+    file::{
+        archive,
+        backup::{self, DeleteBackup},
+        folder_index,
+        quarantine::Quarantine,
+        secure_delete,
+    },
+    rules::rule::{
+        Action, CompressAction, ConflictStrategy, CopyAction, DedupeAction, DeleteAction,
+        ExecuteAction, ExtractAction, LinkKind, MoveAction, PathTemplate, QuarantineAction,
+        RenameAction, SymlinkAction, parse_dir_mode,
+    },
+    utils::{
+        path_template::{render_destination, render_path_template},
+        rename_pattern::{
+            DEFAULT_COUNTER_WIDTH, extract_metadata, render_rename_template, validate_file_name,
+        },
+    },
 };
 use std::{
-    fs,
+    fs::{self, File, FileTimes},
+    io::{self, ErrorKind},
     path::{Path, PathBuf},
+    sync::{Mutex, PoisonError},
 };
 
+/// Maximum number tried when appending ` (n)` to resolve a move conflict
+const MAX_CONFLICT_SUFFIX: u32 = 999;
+
+/// Serializes picking the first free name in a folder, for rename actions and conflict-renaming moves
+static RENAME_LOCK: Mutex<()> = Mutex::new(());
+
+/// New path reported for files deleted without a backup or moved to the system trash
+pub const DELETED_PATH: &str = "[deleted]";
+
+/// Folder in the config directory that takes trashed files when the system trash is unavailable
+pub const FALLBACK_TRASH_DIR: &str = ".tooka-trash";
+
 /// Result of a file operation, containing the new path of the file and the action performed.
 pub struct FileOperationResult {
     pub new_path: PathBuf,
     pub action: String,
+    /// Strategy applied because the destination was already taken, if it was
+    pub conflict: Option<ConflictStrategy>,
 }
 
 /// Executes a file operation specified by the given action on the provided file path.
 /// Supports dry run mode, which simulates the operation without modifying the filesystem.
-/// Handles Move, Copy, Rename, Delete, and Skip actions.
+/// Handles Move, Copy, Symlink, Rename, Delete, Execute, Quarantine, Compress, Extract, Dedupe,
+/// Trash, Index, and Skip actions.
 ///
 /// # Arguments
 /// - `file_path`: The path of the file to operate on.
-/// - `action`: The action to execute (move, copy, rename, delete, skip).
+/// - `action`: The action to execute (move, copy, symlink, rename, delete, execute,
+///   quarantine, compress, extract, dedupe, trash, index, skip).
 /// - `dry_run`: If true, simulates the operation without performing it.
 /// - `source_path`: The base source directory, used when preserving directory structure.
 ///
@@ -48,14 +84,30 @@ pub fn execute_action(
     match action {
         Action::Move(inner) => handle_move(file_path, inner, dry_run, source_path),
         Action::Copy(inner) => handle_copy(file_path, inner, dry_run, source_path),
+        Action::Symlink(inner) => handle_symlink(file_path, inner, dry_run, source_path),
         Action::Rename(inner) => handle_rename(file_path, inner, dry_run),
         Action::Delete(inner) => handle_delete(file_path, inner, dry_run),
         Action::Execute(inner) => handle_execute(file_path, inner, dry_run),
+        Action::Quarantine(inner) => handle_quarantine(file_path, inner, dry_run),
+        Action::Compress(inner) => handle_compress(file_path, inner, dry_run),
+        Action::Extract(inner) => handle_extract(file_path, inner, dry_run),
+        Action::Dedupe(inner) => handle_dedupe(file_path, inner, dry_run, source_path),
+        Action::Trash => handle_delete(
+            file_path,
+            &DeleteAction {
+                trash: true,
+                secure: false,
+                passes: None,
+            },
+            dry_run,
+        ),
+        Action::Index => handle_index(file_path, dry_run),
         Action::Skip => {
             log::info!("Skipping file: {}", file_path.display());
             Ok(FileOperationResult {
                 new_path: file_path.to_path_buf(),
                 action: "skip".to_string(),
+                conflict: None,
             })
         }
     }
@@ -73,24 +125,266 @@ fn handle_move(
         file_path.display()
     );
 
-    let new_path = compute_destination(file_path, action, source_path);
+    let destination = compute_destination(file_path, action, source_path)?;
+    if !dry_run {
+        if let Some(parent) = destination.parent() {
+            create_dirs(parent, action.dir_mode.as_deref())?;
+        }
+    }
+
+    // Held while the free name is picked and reserved, not during the move
+    let guard = (action.on_conflict == ConflictStrategy::Rename)
+        .then(|| RENAME_LOCK.lock().unwrap_or_else(PoisonError::into_inner));
+
+    // Moving a path onto itself is a harmless no-op, not a conflict, but a
+    // destination linking back to the source must not be renamed around
+    let conflict = if destination == file_path {
+        None
+    } else {
+        ensure_not_same_file(file_path, &destination)?;
+        fs::symlink_metadata(&destination)
+            .is_ok()
+            .then_some(action.on_conflict)
+    };
+    if let Some(strategy) = conflict {
+        log::info!(
+            "Destination '{}' already exists, resolving with on_conflict '{strategy}'",
+            destination.display()
+        );
+    }
+    let new_path = match conflict {
+        None | Some(ConflictStrategy::Overwrite) => destination,
+        Some(ConflictStrategy::Rename) => free_conflict_name(&destination)?,
+        Some(ConflictStrategy::Skip) => {
+            log::info!("Skipping move of '{}'", file_path.display());
+            return Ok(FileOperationResult {
+                new_path: file_path.to_path_buf(),
+                action: "skip".to_string(),
+                conflict,
+            });
+        }
+        Some(ConflictStrategy::Error) => {
+            return Err(TookaError::FileOperationError(format!(
+                "Cannot move '{}': destination '{}' already exists",
+                file_path.display(),
+                destination.display()
+            )));
+        }
+    };
+
+    // An empty placeholder keeps other files from picking the same name until
+    // the move replaces it
+    let reserved = guard.is_some() && !dry_run && new_path != file_path;
+    if reserved {
+        File::create_new(&new_path)?;
+    }
+    drop(guard);
 
     if dry_run {
         log::debug!("Dry run: would move file to: {}", new_path.display());
     } else {
         log::info!("Moving file to: {}", new_path.display());
-        if let Some(parent) = new_path.parent() {
-            fs::create_dir_all(parent)?;
+        if let Err(e) = move_file(file_path, &new_path) {
+            if reserved {
+                let _ = fs::remove_file(&new_path);
+            }
+            return Err(e);
         }
-        fs::rename(file_path, &new_path)?;
     }
 
     Ok(FileOperationResult {
         new_path,
         action: "move".to_string(),
+        conflict,
     })
 }
 
+/// Moves `source` to `destination`, replacing any file there.
+///
+/// If the two are on different filesystems, the file is copied and the source
+/// deleted instead, keeping its modification time and permissions.
+///
+/// # Errors
+/// Returns an error if the file cannot be moved; the source is then left intact.
+pub(crate) fn move_file(source: &Path, destination: &Path) -> Result<(), TookaError> {
+    move_file_with(source, destination, |from, to| fs::rename(from, to))
+}
+
+/// Moves a file like [`move_file`], using `rename` to attempt the direct move.
+pub(crate) fn move_file_with<R>(
+    source: &Path,
+    destination: &Path,
+    rename: R,
+) -> Result<(), TookaError>
+where
+    R: Fn(&Path, &Path) -> io::Result<()>,
+{
+    match rename(source, destination) {
+        // EXDEV on Unix, ERROR_NOT_SAME_DEVICE on Windows
+        Err(e) if e.kind() == ErrorKind::CrossesDevices => {
+            log::info!(
+                "'{}' is on another filesystem than '{}', copying and deleting instead",
+                source.display(),
+                destination.display()
+            );
+            copy_then_delete(source, destination)
+        }
+        result => Ok(result?),
+    }
+}
+
+/// Copies `source` next to `destination` under a temporary name, renames the
+/// copy into place and deletes `source`.
+///
+/// A partial copy never replaces `destination`: if copying fails the temporary
+/// file is removed, and if the source cannot be deleted the copy is removed
+/// again, leaving only the source.
+fn copy_then_delete(source: &Path, destination: &Path) -> Result<(), TookaError> {
+    let file_name = destination
+        .file_name()
+        .map(|name| name.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let partial = destination.with_file_name(format!(".{file_name}.tooka-partial"));
+
+    let copied =
+        copy_with_metadata(source, &partial).and_then(|()| fs::rename(&partial, destination));
+    if let Err(e) = copied {
+        let _ = fs::remove_file(&partial);
+        if e.kind() == ErrorKind::StorageFull {
+            return Err(TookaError::FileOperationError(format!(
+                "Not enough space to copy '{}' to '{}', nothing was changed",
+                source.display(),
+                destination.display()
+            )));
+        }
+        return Err(TookaError::FileOperationError(format!(
+            "Failed to copy '{}' to '{}': {e}",
+            source.display(),
+            destination.display()
+        )));
+    }
+
+    if let Err(e) = fs::remove_file(source) {
+        let _ = fs::remove_file(destination);
+        return Err(TookaError::FileOperationError(format!(
+            "Failed to remove '{}' after copying it to '{}': {e}",
+            source.display(),
+            destination.display()
+        )));
+    }
+    Ok(())
+}
+
+/// Streams `source` into a new file at `target`, then applies the source's
+/// access and modification times, owner (best-effort) and permissions to it.
+///
+/// A symlink is recreated at `target` instead of copying what it points to.
+fn copy_with_metadata(source: &Path, target: &Path) -> io::Result<()> {
+    if fs::symlink_metadata(source)?.file_type().is_symlink() {
+        return copy_symlink(source, target);
+    }
+    let mut reader = File::open(source)?;
+    let metadata = reader.metadata()?;
+    let mut writer = File::create(target)?;
+    io::copy(&mut reader, &mut writer)?;
+
+    let mut times = FileTimes::new().set_modified(metadata.modified()?);
+    if let Ok(accessed) = metadata.accessed() {
+        times = times.set_accessed(accessed);
+    }
+    writer.set_times(times)?;
+    // Changing the owner may clear setuid bits, so permissions are applied afterwards
+    preserve_owner(&metadata, target);
+    writer.set_permissions(metadata.permissions())?;
+    writer.sync_all()
+}
+
+/// Creates a symlink at `target` with the same target path as the symlink
+/// `source`; a relative target path is kept as is, like a rename would
+#[cfg(unix)]
+fn copy_symlink(source: &Path, target: &Path) -> io::Result<()> {
+    std::os::unix::fs::symlink(fs::read_link(source)?, target)
+}
+
+/// Creates a symlink at `target` with the same target path as the symlink
+/// `source`; a relative target path is kept as is, like a rename would
+#[cfg(windows)]
+fn copy_symlink(source: &Path, target: &Path) -> io::Result<()> {
+    let link_target = fs::read_link(source)?;
+    if fs::metadata(source).is_ok_and(|metadata| metadata.is_dir()) {
+        std::os::windows::fs::symlink_dir(link_target, target)
+    } else {
+        std::os::windows::fs::symlink_file(link_target, target)
+    }
+}
+
+#[cfg(not(any(unix, windows)))]
+fn copy_symlink(source: &Path, _target: &Path) -> io::Result<()> {
+    Err(io::Error::new(
+        ErrorKind::Unsupported,
+        format!(
+            "Cannot move the symlink '{}': symlinks are not supported on this platform",
+            source.display()
+        ),
+    ))
+}
+
+/// Gives `target` the owner and group of the file with `source` metadata.
+///
+/// Only root can give files away, so otherwise the owner is kept and a
+/// warning logged; failures are logged too instead of failing the action.
+#[cfg(unix)]
+fn preserve_owner(source: &fs::Metadata, target: &Path) {
+    use std::os::unix::fs::{MetadataExt, chown};
+
+    let Ok(created) = fs::metadata(target) else {
+        return;
+    };
+    if created.uid() == source.uid() && created.gid() == source.gid() {
+        return;
+    }
+    // New files belong to the effective user, which tells whether we run as root
+    if created.uid() != 0 {
+        log::warn!(
+            "Not running as root, {} keeps its owner instead of that of the source",
+            target.display()
+        );
+        return;
+    }
+    if let Err(e) = chown(target, Some(source.uid()), Some(source.gid())) {
+        log::warn!("Failed to preserve the owner of {}: {e}", target.display());
+    }
+}
+
+#[cfg(not(unix))]
+fn preserve_owner(_source: &fs::Metadata, _target: &Path) {}
+
+/// Returns the first free path made by appending ` (1)`, ` (2)`, ... to the
+/// stem of `destination`, e.g. `report (1).pdf`.
+///
+/// # Errors
+/// Returns an error if every suffix up to [`MAX_CONFLICT_SUFFIX`] is taken.
+fn free_conflict_name(destination: &Path) -> Result<PathBuf, TookaError> {
+    let stem = destination
+        .file_stem()
+        .map(|s| s.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let extension = destination
+        .extension()
+        .map(|e| format!(".{}", e.to_string_lossy()))
+        .unwrap_or_default();
+
+    (1..=MAX_CONFLICT_SUFFIX)
+        .map(|n| destination.with_file_name(format!("{stem} ({n}){extension}")))
+        .find(|candidate| fs::symlink_metadata(candidate).is_err())
+        .ok_or_else(|| {
+            TookaError::FileOperationError(format!(
+                "No free name for '{}': suffixes (1) to ({MAX_CONFLICT_SUFFIX}) are all taken",
+                destination.display()
+            ))
+        })
+}
+
 fn handle_copy(
     file_path: &Path,
     action: &CopyAction,
@@ -103,24 +397,147 @@ fn handle_copy(
         file_path.display()
     );
 
-    let new_path = compute_destination(file_path, action, source_path);
+    let new_path = compute_destination(file_path, action, source_path)?;
 
     if dry_run {
         log::debug!("Dry run: would copy file to: {}", new_path.display());
     } else {
+        ensure_not_same_file(file_path, &new_path)?;
         log::info!("Copying file to: {}", new_path.display());
         if let Some(parent) = new_path.parent() {
-            fs::create_dir_all(parent)?;
+            create_dirs(parent, action.dir_mode.as_deref())?;
+        }
+        if action.preserve_metadata {
+            copy_with_metadata(file_path, &new_path)?;
+        } else {
+            fs::copy(file_path, &new_path)?;
         }
-        fs::copy(file_path, &new_path)?;
     }
 
     Ok(FileOperationResult {
         new_path,
         action: "copy".to_string(),
+        conflict: None,
     })
 }
 
+/// Handles the symlink action for a file, creating a link to it at the
+/// destination or simulating it in dry run mode. The file stays where it is.
+fn handle_symlink(
+    file_path: &Path,
+    action: &SymlinkAction,
+    dry_run: bool,
+    source_path: &Path,
+) -> Result<FileOperationResult, TookaError> {
+    log::debug!(
+        "Handling symlink action: {:?} for file: {}",
+        action,
+        file_path.display()
+    );
+
+    let new_path = compute_destination(file_path, action, source_path)?;
+
+    if dry_run {
+        log::debug!("Dry run: would link file from: {}", new_path.display());
+    } else {
+        if fs::symlink_metadata(&new_path).is_ok() {
+            return Err(TookaError::FileOperationError(format!(
+                "Cannot link '{}': destination '{}' already exists",
+                file_path.display(),
+                new_path.display()
+            )));
+        }
+        if let Some(parent) = new_path.parent() {
+            create_dirs(parent, action.dir_mode.as_deref())?;
+        }
+        let file_path = std::path::absolute(file_path)?;
+        let target = if action.relative {
+            relative_link_target(&file_path, &new_path)
+        } else {
+            file_path.clone()
+        };
+        log::info!(
+            "Linking file from: {} to: {}",
+            new_path.display(),
+            target.display()
+        );
+        create_symlink(&target, &file_path, &new_path)?;
+    }
+
+    Ok(FileOperationResult {
+        new_path,
+        action: "symlink".to_string(),
+        conflict: None,
+    })
+}
+
+/// Returns the path of the absolute `file` relative to the folder of `link`,
+/// e.g. `../../inbox/a.pdf`.
+///
+/// Returns `file` itself if the two have no common root, e.g. on different
+/// drives on Windows.
+pub(crate) fn relative_link_target(file: &Path, link: &Path) -> PathBuf {
+    let Ok(link_dir) = std::path::absolute(link.parent().unwrap_or(Path::new(""))) else {
+        return file.to_path_buf();
+    };
+    let file_parts: Vec<_> = file.components().collect();
+    let dir_parts: Vec<_> = link_dir.components().collect();
+    let common = file_parts
+        .iter()
+        .zip(&dir_parts)
+        .take_while(|(a, b)| a == b)
+        .count();
+    if common == 0 {
+        return file.to_path_buf();
+    }
+
+    let mut target: PathBuf = dir_parts[common..].iter().map(|_| "..").collect();
+    target.extend(&file_parts[common..]);
+    target
+}
+
+/// Creates a symbolic link at `link` pointing to `target`, which resolves to `file`
+#[cfg(unix)]
+fn create_symlink(target: &Path, _file: &Path, link: &Path) -> Result<(), TookaError> {
+    std::os::unix::fs::symlink(target, link)?;
+    Ok(())
+}
+
+/// Creates a symbolic link at `link` pointing to `target`, which resolves to `file`.
+///
+/// Creating symlinks on Windows needs Developer Mode or administrator rights;
+/// without them a hard link to `file` is created instead, which only works on
+/// the same volume.
+#[cfg(windows)]
+fn create_symlink(target: &Path, file: &Path, link: &Path) -> Result<(), TookaError> {
+    /// `ERROR_PRIVILEGE_NOT_HELD`
+    const PRIVILEGE_NOT_HELD: i32 = 1314;
+
+    match std::os::windows::fs::symlink_file(target, link) {
+        Err(e) if e.raw_os_error() == Some(PRIVILEGE_NOT_HELD) => {
+            log::warn!(
+                "Creating symlinks needs Developer Mode or administrator rights, creating a hard link at {} instead",
+                link.display()
+            );
+            fs::hard_link(file, link).map_err(|e| {
+                TookaError::FileOperationError(format!(
+                    "Cannot link '{}': creating symlinks needs Developer Mode or administrator rights, and a hard link failed too: {e}",
+                    file.display()
+                ))
+            })
+        }
+        result => Ok(result?),
+    }
+}
+
+#[cfg(not(any(unix, windows)))]
+fn create_symlink(_target: &Path, file: &Path, _link: &Path) -> Result<(), TookaError> {
+    Err(TookaError::FileOperationError(format!(
+        "Cannot link '{}': symlinks are not supported on this platform",
+        file.display()
+    )))
+}
+
 fn handle_rename(
     file_path: &Path,
     action: &RenameAction,
@@ -134,14 +551,38 @@ fn handle_rename(
 
     let metadata = extract_metadata(file_path)?;
 
-    let new_name = evaluate_template(&action.to, file_path, &metadata);
+    // Held until the rename is done, so no other file claims the same free name
+    let _guard = RENAME_LOCK.lock().unwrap_or_else(PoisonError::into_inner);
+    let counter_width = action.counter_width.unwrap_or(DEFAULT_COUNTER_WIDTH);
+    let new_name =
+        render_rename_template(&action.to, file_path, &metadata, counter_width, |name| {
+            let candidate = file_path.with_file_name(name);
+            candidate == file_path || fs::symlink_metadata(&candidate).is_err()
+        })
+        .map_err(|e| {
+            TookaError::FileOperationError(format!(
+                "Cannot rename '{}' with template '{}': {e}",
+                file_path.display(),
+                action.to
+            ))
+        })?;
     log::debug!("New file name: {new_name}");
+    validate_file_name(&new_name).map_err(|e| {
+        TookaError::FileOperationError(format!(
+            "Cannot rename '{}' with template '{}': {e}",
+            file_path.display(),
+            action.to
+        ))
+    })?;
 
     let new_path = file_path.with_file_name(new_name);
 
     if dry_run {
         log::debug!("Dry run: would rename file to: {}", new_path.display());
     } else {
+        if new_path != file_path {
+            ensure_not_same_file(file_path, &new_path)?;
+        }
         log::info!("Renaming file to: {}", new_path.display());
         fs::rename(file_path, &new_path)?;
     }
@@ -149,6 +590,7 @@ fn handle_rename(
     Ok(FileOperationResult {
         new_path,
         action: "rename".to_string(),
+        conflict: None,
     })
 }
 
@@ -164,25 +606,295 @@ fn handle_delete(
         file_path.display()
     );
 
+    let mut new_path = PathBuf::from(DELETED_PATH);
     if dry_run {
         log::debug!("Dry run: would delete file: {}", file_path.display());
     } else if action.trash {
-        log::info!("Moving file to trash: {}", file_path.display());
-
-        trash::delete(file_path).map_err(|e| {
-            TookaError::FileOperationError(format!("Failed to move file to trash: {e}"))
-        })?;
+        new_path = move_to_trash(file_path)?;
+    } else if action.secure {
+        // Keeping a backup would defeat the purpose of overwriting the file
+        secure_delete::secure_delete(
+            file_path,
+            action.passes.unwrap_or(secure_delete::DEFAULT_PASSES),
+        )?;
+    } else if let Some(backup) = context::get_locked_config()
+        .ok()
+        .and_then(|config| DeleteBackup::from_config(&config))
+    {
+        new_path = backup.backup(file_path, backup::run_started())?;
+        log::info!(
+            "Deleted file {} with a backup at: {}",
+            file_path.display(),
+            new_path.display()
+        );
     } else {
         log::info!("Deleting file permanently: {}", file_path.display());
         fs::remove_file(file_path)?;
     }
 
+    // Files moved to the trash are reported apart from deleted ones
+    let reported = if action.trash { "trash" } else { "delete" };
+    Ok(FileOperationResult {
+        new_path,
+        action: reported.into(),
+        conflict: None,
+    })
+}
+
+/// Handles the compress action for a file, adding it to an archive or simulating it in dry run mode.
+///
+/// The reported new path is the archive the file was added to.
+fn handle_compress(
+    file_path: &Path,
+    action: &CompressAction,
+    dry_run: bool,
+) -> Result<FileOperationResult, TookaError> {
+    log::debug!(
+        "Handling compress action: {:?} for file: {}",
+        action,
+        file_path.display()
+    );
+
+    let target = PathBuf::from(expand_path(&action.target));
+    if dry_run {
+        log::debug!(
+            "Dry run: would add file {} to archive {}",
+            file_path.display(),
+            target.display()
+        );
+    } else {
+        let entry = archive::add_to_archive(file_path, &target, action.format)?;
+        log::info!(
+            "Added file {} to archive {} as '{}'",
+            file_path.display(),
+            target.display(),
+            entry
+        );
+        if action.remove_source {
+            fs::remove_file(file_path)?;
+            log::info!("Removed archived file: {}", file_path.display());
+        }
+    }
+
     Ok(FileOperationResult {
-        new_path: "[deleted]".into(),
-        action: "delete".into(),
+        new_path: target,
+        action: "compress".into(),
+        conflict: None,
     })
 }
 
+/// Handles the extract action for an archive, extracting it or simulating it in dry run mode.
+///
+/// The reported new path is the folder the archive was extracted into.
+fn handle_extract(
+    file_path: &Path,
+    action: &ExtractAction,
+    dry_run: bool,
+) -> Result<FileOperationResult, TookaError> {
+    log::debug!(
+        "Handling extract action: {:?} for file: {}",
+        action,
+        file_path.display()
+    );
+
+    let destination = PathBuf::from(expand_path(&action.to));
+    if dry_run {
+        log::debug!(
+            "Dry run: would extract archive {} into {}",
+            file_path.display(),
+            destination.display()
+        );
+    } else {
+        let extracted = archive::extract_archive(file_path, &destination)?;
+        log::info!(
+            "Extracted {} entries of archive {} into {}",
+            extracted,
+            file_path.display(),
+            destination.display()
+        );
+        if action.remove_archive {
+            fs::remove_file(file_path)?;
+            log::info!("Removed extracted archive: {}", file_path.display());
+        }
+    }
+
+    Ok(FileOperationResult {
+        new_path: destination,
+        action: "extract".into(),
+        conflict: None,
+    })
+}
+
+/// Handles the dedupe action for a file.
+///
+/// Duplicates are moved to the action's folder, or deleted if it has none, and
+/// reported as moves or deletes; the file each group keeps is reported as `keep`.
+fn handle_dedupe(
+    file_path: &Path,
+    action: &DedupeAction,
+    dry_run: bool,
+    source_path: &Path,
+) -> Result<FileOperationResult, TookaError> {
+    log::debug!(
+        "Handling dedupe action: keep {:?} for file: {}",
+        action.keep,
+        file_path.display()
+    );
+
+    let Some(kept) = action.duplicates.get(file_path) else {
+        log::info!("Keeping file: {}", file_path.display());
+        return Ok(FileOperationResult {
+            new_path: file_path.to_path_buf(),
+            action: "keep".into(),
+            conflict: None,
+        });
+    };
+    log::info!(
+        "{}File {} is a duplicate of {}, which is kept",
+        if dry_run { "Dry run: " } else { "" },
+        file_path.display(),
+        kept.display()
+    );
+
+    if let Some(kind) = action.replace_with {
+        return replace_with_link(file_path, kept, kind, dry_run);
+    }
+    match &action.to {
+        Some(to) => handle_move(
+            file_path,
+            &MoveAction {
+                to: to.clone(),
+                preserve_structure: false,
+                dir_mode: None,
+                path_template: None,
+                on_conflict: ConflictStrategy::Rename,
+            },
+            dry_run,
+            source_path,
+        ),
+        None => handle_delete(
+            file_path,
+            &DeleteAction {
+                trash: false,
+                secure: false,
+                passes: None,
+            },
+            dry_run,
+        ),
+    }
+}
+
+/// Replaces the duplicate `file_path` with a link of the given kind to `kept`, keeping its name.
+///
+/// The link is created under a temporary name next to the duplicate and then
+/// renamed over it, so the duplicate is never lost if linking fails. A hard
+/// link across filesystems falls back to a symlink. Duplicates that already
+/// are links to `kept` are left alone.
+fn replace_with_link(
+    file_path: &Path,
+    kept: &Path,
+    kind: LinkKind,
+    dry_run: bool,
+) -> Result<FileOperationResult, TookaError> {
+    let result = |action: &str| FileOperationResult {
+        new_path: file_path.to_path_buf(),
+        action: action.into(),
+        conflict: None,
+    };
+    if let (Ok(file_meta), Ok(kept_meta)) = (fs::metadata(file_path), fs::metadata(kept)) {
+        if is_same_file(file_path, &file_meta, kept, &kept_meta) {
+            log::info!(
+                "File {} already links to {}",
+                file_path.display(),
+                kept.display()
+            );
+            return Ok(result("keep"));
+        }
+    }
+    if dry_run {
+        log::debug!(
+            "Dry run: would replace file {} with a {kind:?} link to {}",
+            file_path.display(),
+            kept.display()
+        );
+        return Ok(result("link"));
+    }
+
+    let file_name = file_path
+        .file_name()
+        .map(|name| name.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let partial = file_path.with_file_name(format!(".{file_name}.tooka-link"));
+    let kept = std::path::absolute(kept)?;
+    let linked = match kind {
+        LinkKind::Hardlink => match fs::hard_link(&kept, &partial) {
+            Err(e) if e.kind() == ErrorKind::CrossesDevices => {
+                log::warn!(
+                    "Cannot hard link {} to {} across filesystems, creating a symlink instead",
+                    file_path.display(),
+                    kept.display()
+                );
+                create_symlink(&kept, &kept, &partial)
+            }
+            result => Ok(result?),
+        },
+        LinkKind::Symlink => create_symlink(&kept, &kept, &partial),
+    };
+    let replaced = linked.and_then(|()| Ok(fs::rename(&partial, file_path)?));
+    if let Err(e) = replaced {
+        let _ = fs::remove_file(&partial);
+        return Err(TookaError::FileOperationError(format!(
+            "Failed to replace '{}' with a link to '{}': {e}",
+            file_path.display(),
+            kept.display()
+        )));
+    }
+    log::info!(
+        "Replaced file {} with a link to {}",
+        file_path.display(),
+        kept.display()
+    );
+    Ok(result("link"))
+}
+
+/// Moves a file to the system trash, falling back to [`FALLBACK_TRASH_DIR`] in
+/// the config directory if the system trash cannot be used.
+///
+/// # Returns
+/// [`DELETED_PATH`] if the file went to the system trash, or its path in the fallback folder.
+fn move_to_trash(file_path: &Path) -> Result<PathBuf, TookaError> {
+    move_to_trash_with(
+        file_path,
+        &Config::config_dir().join(FALLBACK_TRASH_DIR),
+        |path| trash::delete(path),
+    )
+}
+
+/// Moves a file to the trash with `trash`, moving it into `fallback_dir` instead if that fails.
+pub(crate) fn move_to_trash_with<T>(
+    file_path: &Path,
+    fallback_dir: &Path,
+    trash: T,
+) -> Result<PathBuf, TookaError>
+where
+    T: FnOnce(&Path) -> Result<(), trash::Error>,
+{
+    match trash(file_path) {
+        Ok(()) => {
+            log::info!("Moved file to trash: {}", file_path.display());
+            Ok(PathBuf::from(DELETED_PATH))
+        }
+        Err(e) => {
+            log::warn!(
+                "System trash unavailable for {} ({e}); moving it to {} instead",
+                file_path.display(),
+                fallback_dir.display()
+            );
+            DeleteBackup::new(fallback_dir).backup(file_path, backup::run_started())
+        }
+    }
+}
+
 /// Handles the execute action for a file, executing a command or script specified in the action.
 fn handle_execute(
     file_path: &Path,
@@ -221,18 +933,161 @@ fn handle_execute(
     Ok(FileOperationResult {
         new_path: file_path.to_path_buf(),
         action: "execute".into(),
+        conflict: None,
     })
 }
 
-fn compute_destination<A>(file_path: &Path, action: &A, source_path: &Path) -> PathBuf
-where
-    A: HasToAndPreserveStructure,
-{
-    log::debug!("Computing destination for file: {}", file_path.display());
-    let to = action.to();
-    let preserve_structure = action.preserve_structure();
+/// Handles the quarantine action, moving the file into the quarantine folder.
+fn handle_quarantine(
+    file_path: &Path,
+    action: &QuarantineAction,
+    dry_run: bool,
+) -> Result<FileOperationResult, TookaError> {
+    log::debug!(
+        "Handling quarantine action: {:?} for file: {}",
+        action,
+        file_path.display()
+    );
+
+    let quarantine = match &action.to {
+        Some(to) => Quarantine::new(expand_destination(&expand_path(to))),
+        None => context::get_locked_config().map_or_else(
+            |_| Quarantine::from_config(&Config::default()),
+            |config| Quarantine::from_config(&config),
+        ),
+    };
+    let now = chrono::Local::now();
+
+    let new_path = if dry_run {
+        let target = quarantine.target_path(file_path, now);
+        log::debug!("Dry run: would quarantine file to: {}", target.display());
+        target
+    } else {
+        let target = quarantine.quarantine(file_path, action.days, now)?;
+        log::info!(
+            "Quarantined file to: {} for {} days",
+            target.display(),
+            action.days
+        );
+        target
+    };
+
+    Ok(FileOperationResult {
+        new_path,
+        action: "quarantine".into(),
+        conflict: None,
+    })
+}
+
+/// Handles the index action, recording the file in the index of its folder.
+fn handle_index(file_path: &Path, dry_run: bool) -> Result<FileOperationResult, TookaError> {
+    log::debug!("Handling index action for file: {}", file_path.display());
+
+    if dry_run {
+        log::debug!(
+            "Dry run: would index file in folder: {}",
+            file_path.parent().unwrap_or(file_path).display()
+        );
+    } else {
+        let index_path = folder_index::update_folder_index(file_path)?;
+        log::info!(
+            "Indexed file '{}' in '{}'",
+            file_path.display(),
+            index_path.display()
+        );
+    }
+
+    Ok(FileOperationResult {
+        new_path: file_path.to_path_buf(),
+        action: "index".into(),
+        conflict: None,
+    })
+}
 
-    let destination = match to.chars().next() {
+/// Returns an error if `destination` already exists and resolves to the same file as `source`.
+///
+/// This catches destinations that point back at the source through symlinks
+/// or hard links, where moving or copying would destroy the file.
+fn ensure_not_same_file(source: &Path, destination: &Path) -> Result<(), TookaError> {
+    let (Ok(src_meta), Ok(dest_meta)) = (fs::metadata(source), fs::metadata(destination)) else {
+        return Ok(());
+    };
+
+    if is_same_file(source, &src_meta, destination, &dest_meta) {
+        log::warn!(
+            "Skipping '{}': destination '{}' is the same file",
+            source.display(),
+            destination.display()
+        );
+        return Err(TookaError::FileOperationError(format!(
+            "Destination '{}' resolves to the source file '{}'",
+            destination.display(),
+            source.display()
+        )));
+    }
+    Ok(())
+}
+
+#[cfg(unix)]
+fn is_same_file(_: &Path, src: &fs::Metadata, _: &Path, dest: &fs::Metadata) -> bool {
+    use std::os::unix::fs::MetadataExt;
+
+    src.dev() == dest.dev() && src.ino() == dest.ino()
+}
+
+#[cfg(not(unix))]
+fn is_same_file(source: &Path, _: &fs::Metadata, destination: &Path, _: &fs::Metadata) -> bool {
+    match (fs::canonicalize(source), fs::canonicalize(destination)) {
+        (Ok(a), Ok(b)) => a == b,
+        _ => false,
+    }
+}
+
+/// Creates `dir` and any missing parents, applying `dir_mode` to the directories it creates.
+///
+/// Without a mode the platform default (subject to the umask) is used. Existing
+/// directories are left untouched.
+fn create_dirs(dir: &Path, dir_mode: Option<&str>) -> Result<(), TookaError> {
+    let Some(mode) = dir_mode else {
+        fs::create_dir_all(dir)?;
+        return Ok(());
+    };
+    let mode = parse_dir_mode(mode).map_err(TookaError::FileOperationError)?;
+
+    // Deepest first, so a restrictive mode never blocks creating a child
+    let missing: Vec<&Path> = dir.ancestors().take_while(|p| !p.exists()).collect();
+    fs::create_dir_all(dir)?;
+    for path in missing {
+        log::debug!(
+            "Setting mode {mode:o} on created directory {}",
+            path.display()
+        );
+        set_dir_mode(path, mode)?;
+    }
+    Ok(())
+}
+
+#[cfg(unix)]
+fn set_dir_mode(path: &Path, mode: u32) -> Result<(), TookaError> {
+    use std::os::unix::fs::PermissionsExt;
+
+    // Set explicitly so the umask does not weaken or strengthen the requested mode
+    fs::set_permissions(path, fs::Permissions::from_mode(mode))?;
+    Ok(())
+}
+
+#[cfg(not(unix))]
+fn set_dir_mode(path: &Path, _mode: u32) -> Result<(), TookaError> {
+    log::warn!(
+        "dir_mode is only supported on Unix; created {} with default permissions",
+        path.display()
+    );
+    Ok(())
+}
+
+/// Expands a configured destination folder: `.`-relative, `~`-relative or absolute.
+fn expand_destination(to: &str) -> PathBuf {
+    match to.chars().next() {
         Some('.') => {
             log::debug!("Destination is a relative path: {to}");
             PathBuf::from(to)
@@ -247,28 +1102,87 @@ where
             log::debug!("Destination is an absolute path: {to}");
             PathBuf::from("/").join(to.trim_start_matches('/'))
         }
-    };
+    }
+}
 
-    if preserve_structure {
+fn compute_destination<A>(
+    file_path: &Path,
+    action: &A,
+    source_path: &Path,
+) -> Result<PathBuf, TookaError>
+where
+    A: HasToAndPreserveStructure,
+{
+    log::debug!("Computing destination for file: {}", file_path.display());
+    let preserve_structure = action.preserve_structure();
+    // Variables are expanded before tokens, so folder names are never taken for variables
+    let to = expand_path(action.to());
+    let destination = expand_destination(&render_destination(&to, file_path, source_path)?);
+
+    if let Some(template) = action.path_template() {
+        Ok(destination.join(render_path_template(template, file_path, source_path)?))
+    } else if preserve_structure {
         log::debug!(
             "Preserving directory structure for file: {}",
             file_path.display()
         );
         let relative_path = file_path.strip_prefix(source_path).unwrap_or(file_path);
-        destination.join(relative_path)
+        Ok(destination.join(relative_path))
     } else {
         log::debug!(
             "Not preserving directory structure for file: {}",
             file_path.display()
         );
         let file_name = file_path.file_name().unwrap_or_default();
-        destination.join(file_name)
+        Ok(destination.join(file_name))
+    }
+}
+
+/// Returns the folder a move, copy, symlink, compress or extract action writes into.
+///
+/// Returns `None` for actions that do not write to another location.
+pub(crate) fn destination_dir(
+    file_path: &Path,
+    action: &Action,
+    source_path: &Path,
+) -> Option<PathBuf> {
+    let destination = match action {
+        Action::Move(inner) => compute_destination(file_path, inner, source_path),
+        Action::Copy(inner) => compute_destination(file_path, inner, source_path),
+        Action::Symlink(inner) => compute_destination(file_path, inner, source_path),
+        Action::Compress(inner) => Ok(PathBuf::from(expand_path(&inner.target))),
+        Action::Extract(inner) => return Some(PathBuf::from(expand_path(&inner.to))),
+        _ => return None,
     }
+    // A template that fails to render is reported by the action itself
+    .ok()?;
+    destination.parent().map(Path::to_path_buf)
+}
+
+/// Returns the fixed part of the destination of a move, copy or symlink action, i.e.
+/// the folder before any `{parent}` token.
+///
+/// Returns `None` for actions that do not write to another location.
+pub(crate) fn destination_root(action: &Action) -> Option<PathBuf> {
+    let to = match action {
+        Action::Move(inner) => expand_path(&inner.to),
+        Action::Copy(inner) => expand_path(&inner.to),
+        Action::Symlink(inner) => expand_path(&inner.to),
+        _ => return None,
+    };
+    let fixed = to.find('{').map_or(to.as_str(), |i| &to[..i]);
+    // Drop a partial component in front of the token, e.g. `backup-` in `backup-{parent}`
+    let fixed = match fixed.rfind('/') {
+        Some(i) if fixed.len() < to.len() => &fixed[..=i],
+        _ => fixed,
+    };
+    Some(expand_destination(fixed))
 }
 
 trait HasToAndPreserveStructure {
     fn to(&self) -> &str;
     fn preserve_structure(&self) -> bool;
+    fn path_template(&self) -> Option<&PathTemplate>;
 }
 
 impl HasToAndPreserveStructure for MoveAction {
@@ -278,6 +1192,9 @@ impl HasToAndPreserveStructure for MoveAction {
     fn preserve_structure(&self) -> bool {
         self.preserve_structure
     }
+    fn path_template(&self) -> Option<&PathTemplate> {
+        self.path_template.as_ref()
+    }
 }
 
 impl HasToAndPreserveStructure for CopyAction {
@@ -287,4 +1204,19 @@ impl HasToAndPreserveStructure for CopyAction {
     fn preserve_structure(&self) -> bool {
         self.preserve_structure
     }
+    fn path_template(&self) -> Option<&PathTemplate> {
+        self.path_template.as_ref()
+    }
+}
+
+impl HasToAndPreserveStructure for SymlinkAction {
+    fn to(&self) -> &str {
+        &self.to
+    }
+    fn preserve_structure(&self) -> bool {
+        self.preserve_structure
+    }
+    fn path_template(&self) -> Option<&PathTemplate> {
+        self.path_template.as_ref()
+    }
 }
@@ -1,10 +1,15 @@
 use std::{fs, os::unix::fs::PermissionsExt};
 
 use super::file_ops;
+use super::folder_index::{self, FolderIndex};
 use crate::{
     rules::rule::ExecuteAction,
-    rules::rule::{Action, CopyAction, DeleteAction, MoveAction, RenameAction},
+    rules::rule::{
+        Action, ConflictStrategy, CopyAction, DedupeAction, DeleteAction, KeepPolicy, LinkKind,
+        MoveAction, PathTemplate, PathTemplateSource, RenameAction, SymlinkAction,
+    },
 };
+use chrono::{Local, TimeZone};
 use tempfile::{NamedTempFile, TempDir, tempdir};
 
 fn setup_temp_dir_and_file() -> (TempDir, NamedTempFile) {
@@ -22,6 +27,9 @@ fn test_move_file() {
     let move_action = Action::Move(MoveAction {
         to: dest_dir.to_str().unwrap().to_string(),
         preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
     });
 
     let result = file_ops::execute_action(&src_path, &move_action, false, dir.path()).unwrap();
@@ -29,6 +37,254 @@ fn test_move_file() {
     assert!(!src_path.exists());
 }
 
+#[test]
+fn test_move_file_with_path_template() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("report.pdf");
+    let file = fs::File::create(&src_path).unwrap();
+    let modified = Local.with_ymd_and_hms(2023, 11, 5, 8, 0, 0).unwrap();
+    file.set_modified(modified.into()).unwrap();
+
+    let dest_dir = dir.path().join("archive");
+    let move_action = Action::Move(MoveAction {
+        to: dest_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: Some(PathTemplate {
+            source: PathTemplateSource::Mtime,
+            format: "{year}/{month}/{filename}".to_string(),
+        }),
+        on_conflict: ConflictStrategy::default(),
+    });
+
+    let result = file_ops::execute_action(&src_path, &move_action, false, dir.path()).unwrap();
+    assert_eq!(result.new_path, dest_dir.join("2023/11/report.pdf"));
+    assert!(result.new_path.exists());
+    assert!(!src_path.exists());
+}
+
+fn move_to(dest_dir: &std::path::Path, on_conflict: ConflictStrategy) -> Action {
+    Action::Move(MoveAction {
+        to: dest_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        on_conflict,
+    })
+}
+
+/// Creates `src/report.pdf` and a different `dest/report.pdf` it conflicts with
+fn setup_move_conflict() -> (TempDir, std::path::PathBuf, std::path::PathBuf) {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("src").join("report.pdf");
+    let dest_dir = dir.path().join("dest");
+    fs::create_dir_all(src_path.parent().unwrap()).unwrap();
+    fs::create_dir_all(&dest_dir).unwrap();
+    fs::write(&src_path, "new").unwrap();
+    fs::write(dest_dir.join("report.pdf"), "existing").unwrap();
+    (dir, src_path, dest_dir)
+}
+
+#[test]
+fn test_move_conflict_renames_by_default() {
+    let (dir, src_path, dest_dir) = setup_move_conflict();
+    fs::write(dest_dir.join("report (1).pdf"), "also existing").unwrap();
+
+    let action = move_to(&dest_dir, ConflictStrategy::default());
+    let planned = file_ops::execute_action(&src_path, &action, true, dir.path()).unwrap();
+    assert_eq!(planned.new_path, dest_dir.join("report (2).pdf"));
+    assert_eq!(planned.conflict, Some(ConflictStrategy::Rename));
+    assert!(src_path.exists());
+
+    let result = file_ops::execute_action(&src_path, &action, false, dir.path()).unwrap();
+    assert_eq!(result.new_path, dest_dir.join("report (2).pdf"));
+    assert_eq!(fs::read_to_string(&result.new_path).unwrap(), "new");
+    assert_eq!(
+        fs::read_to_string(dest_dir.join("report.pdf")).unwrap(),
+        "existing"
+    );
+    assert!(!src_path.exists());
+}
+
+#[test]
+fn test_concurrent_moves_get_distinct_names() {
+    let dir = tempdir().unwrap();
+    let dest_dir = dir.path().join("dest");
+    let sources: Vec<_> = (0..8)
+        .map(|i| {
+            let src_path = dir.path().join(format!("src{i}")).join("report.pdf");
+            fs::create_dir_all(src_path.parent().unwrap()).unwrap();
+            fs::write(&src_path, i.to_string()).unwrap();
+            src_path
+        })
+        .collect();
+
+    let action = move_to(&dest_dir, ConflictStrategy::Rename);
+    let mut new_paths: Vec<_> = std::thread::scope(|scope| {
+        let handles: Vec<_> = sources
+            .iter()
+            .map(|src_path| {
+                scope.spawn(|| {
+                    file_ops::execute_action(src_path, &action, false, dir.path())
+                        .unwrap()
+                        .new_path
+                })
+            })
+            .collect();
+        handles.into_iter().map(|h| h.join().unwrap()).collect()
+    });
+
+    new_paths.sort();
+    new_paths.dedup();
+    assert_eq!(new_paths.len(), 8);
+    let mut contents: Vec<_> = new_paths
+        .iter()
+        .map(|path| fs::read_to_string(path).unwrap())
+        .collect();
+    contents.sort();
+    assert_eq!(contents, ["0", "1", "2", "3", "4", "5", "6", "7"]);
+}
+
+#[test]
+fn test_failed_move_releases_the_reserved_name() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("missing.pdf");
+    let dest_dir = dir.path().join("dest");
+
+    let action = move_to(&dest_dir, ConflictStrategy::Rename);
+    assert!(file_ops::execute_action(&src_path, &action, false, dir.path()).is_err());
+    assert!(!dest_dir.join("missing.pdf").exists());
+}
+
+#[test]
+fn test_move_conflict_rename_fails_when_suffixes_are_exhausted() {
+    let (dir, src_path, dest_dir) = setup_move_conflict();
+    for n in 1..=999 {
+        fs::write(dest_dir.join(format!("report ({n}).pdf")), "").unwrap();
+    }
+
+    let action = move_to(&dest_dir, ConflictStrategy::Rename);
+    assert!(file_ops::execute_action(&src_path, &action, false, dir.path()).is_err());
+    assert_eq!(fs::read_to_string(&src_path).unwrap(), "new");
+}
+
+#[test]
+fn test_move_conflict_skip_overwrite_and_error() {
+    let (dir, src_path, dest_dir) = setup_move_conflict();
+    let existing = dest_dir.join("report.pdf");
+
+    let skip = move_to(&dest_dir, ConflictStrategy::Skip);
+    let result = file_ops::execute_action(&src_path, &skip, false, dir.path()).unwrap();
+    assert_eq!(result.action, "skip");
+    assert_eq!(result.new_path, src_path);
+    assert_eq!(result.conflict, Some(ConflictStrategy::Skip));
+    assert_eq!(fs::read_to_string(&existing).unwrap(), "existing");
+
+    let error = move_to(&dest_dir, ConflictStrategy::Error);
+    assert!(file_ops::execute_action(&src_path, &error, false, dir.path()).is_err());
+    assert!(src_path.exists());
+
+    let overwrite = move_to(&dest_dir, ConflictStrategy::Overwrite);
+    let result = file_ops::execute_action(&src_path, &overwrite, false, dir.path()).unwrap();
+    assert_eq!(result.new_path, existing);
+    assert_eq!(result.conflict, Some(ConflictStrategy::Overwrite));
+    assert_eq!(fs::read_to_string(&existing).unwrap(), "new");
+    assert!(!src_path.exists());
+}
+
+#[test]
+fn test_move_onto_itself_is_not_a_conflict() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("report.pdf");
+    fs::write(&src_path, "content").unwrap();
+
+    for strategy in [ConflictStrategy::Rename, ConflictStrategy::Error] {
+        let action = move_to(dir.path(), strategy);
+        let result = file_ops::execute_action(&src_path, &action, false, dir.path()).unwrap();
+        assert_eq!(result.new_path, src_path);
+        assert_eq!(result.action, "move");
+        assert_eq!(result.conflict, None);
+    }
+    assert!(!dir.path().join("report (1).pdf").exists());
+}
+
+/// Stands in for `fs::rename` between two filesystems
+fn cross_device_rename(_: &std::path::Path, _: &std::path::Path) -> std::io::Result<()> {
+    Err(std::io::ErrorKind::CrossesDevices.into())
+}
+
+#[test]
+fn test_cross_device_move_copies_and_deletes_source() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("movie.mkv");
+    let dest_path = dir.path().join("nas").join("movie.mkv");
+    fs::create_dir(dest_path.parent().unwrap()).unwrap();
+    fs::write(&src_path, "frames").unwrap();
+    fs::set_permissions(&src_path, fs::Permissions::from_mode(0o640)).unwrap();
+    let modified = Local.with_ymd_and_hms(2022, 3, 4, 5, 6, 7).unwrap();
+    fs::File::options()
+        .write(true)
+        .open(&src_path)
+        .unwrap()
+        .set_modified(modified.into())
+        .unwrap();
+
+    file_ops::move_file_with(&src_path, &dest_path, cross_device_rename).unwrap();
+
+    assert!(!src_path.exists());
+    assert_eq!(fs::read_to_string(&dest_path).unwrap(), "frames");
+    let metadata = fs::metadata(&dest_path).unwrap();
+    assert_eq!(metadata.permissions().mode() & 0o777, 0o640);
+    assert_eq!(
+        metadata.modified().unwrap(),
+        std::time::SystemTime::from(modified)
+    );
+    assert_eq!(
+        fs::read_dir(dest_path.parent().unwrap()).unwrap().count(),
+        1
+    );
+}
+
+#[test]
+fn test_cross_device_move_keeps_symlinks() {
+    let dir = tempdir().unwrap();
+    let target = dir.path().join("movie.mkv");
+    fs::write(&target, "frames").unwrap();
+    let src_path = dir.path().join("latest.mkv");
+    std::os::unix::fs::symlink(&target, &src_path).unwrap();
+    let dest_path = dir.path().join("nas").join("latest.mkv");
+    fs::create_dir(dest_path.parent().unwrap()).unwrap();
+
+    file_ops::move_file_with(&src_path, &dest_path, cross_device_rename).unwrap();
+
+    assert!(fs::symlink_metadata(&src_path).is_err());
+    assert!(
+        fs::symlink_metadata(&dest_path)
+            .unwrap()
+            .file_type()
+            .is_symlink()
+    );
+    assert_eq!(fs::read_link(&dest_path).unwrap(), target);
+    assert_eq!(fs::read_to_string(&target).unwrap(), "frames");
+}
+
+#[test]
+fn test_failed_cross_device_copy_leaves_source_intact() {
+    let dir = tempdir().unwrap();
+    // Opening a directory succeeds but reading it fails, so the copy fails partway
+    let src_path = dir.path().join("unreadable");
+    fs::create_dir(&src_path).unwrap();
+    let dest_dir = dir.path().join("nas");
+    fs::create_dir(&dest_dir).unwrap();
+
+    let result =
+        file_ops::move_file_with(&src_path, &dest_dir.join("unreadable"), cross_device_rename);
+
+    assert!(result.is_err());
+    assert!(src_path.is_dir());
+    assert_eq!(fs::read_dir(&dest_dir).unwrap().count(), 0);
+}
+
 #[test]
 fn test_copy_file() {
     let (dir, src_file) = setup_temp_dir_and_file();
@@ -38,6 +294,9 @@ fn test_copy_file() {
     let copy_action = Action::Copy(CopyAction {
         to: dest_dir.to_str().unwrap().to_string(),
         preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        preserve_metadata: true,
     });
 
     let result = file_ops::execute_action(&src_path, &copy_action, false, dir.path()).unwrap();
@@ -45,6 +304,129 @@ fn test_copy_file() {
     assert!(src_path.exists());
 }
 
+fn symlink_action(to: &std::path::Path, relative: bool) -> Action {
+    Action::Symlink(SymlinkAction {
+        to: to.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        relative,
+    })
+}
+
+#[test]
+fn test_symlink_file_leaves_file_in_place() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+    fs::write(&src_path, "invoice").unwrap();
+
+    let absolute = symlink_action(&dir.path().join("by-type/absolute"), false);
+    let result = file_ops::execute_action(&src_path, &absolute, false, dir.path()).unwrap();
+    assert_eq!(result.action, "symlink");
+    assert!(src_path.exists());
+    assert_eq!(fs::read_link(&result.new_path).unwrap(), src_path);
+    assert_eq!(fs::read_to_string(&result.new_path).unwrap(), "invoice");
+
+    let relative = symlink_action(&dir.path().join("by-type/relative"), true);
+    let result = file_ops::execute_action(&src_path, &relative, false, dir.path()).unwrap();
+    let expected = std::path::Path::new("../..").join(src_path.file_name().unwrap());
+    assert_eq!(fs::read_link(&result.new_path).unwrap(), expected);
+    assert_eq!(fs::read_to_string(&result.new_path).unwrap(), "invoice");
+
+    // An existing link is never replaced
+    assert!(file_ops::execute_action(&src_path, &relative, false, dir.path()).is_err());
+}
+
+#[test]
+fn test_relative_link_target() {
+    use std::path::{Path, PathBuf};
+
+    let file = Path::new("/home/me/inbox/a.pdf");
+    assert_eq!(
+        file_ops::relative_link_target(file, Path::new("/home/me/docs/pdf/a.pdf")),
+        PathBuf::from("../../inbox/a.pdf")
+    );
+    assert_eq!(
+        file_ops::relative_link_target(file, Path::new("/home/me/inbox/links/a.pdf")),
+        PathBuf::from("../a.pdf")
+    );
+    assert_eq!(
+        file_ops::relative_link_target(file, Path::new("/home/me/inbox/b.pdf")),
+        PathBuf::from("a.pdf")
+    );
+}
+
+/// Dedupe action that replaces `duplicate` with a link of `kind` to `kept`
+fn link_dedupe_action(
+    duplicate: &std::path::Path,
+    kept: &std::path::Path,
+    kind: LinkKind,
+) -> Action {
+    Action::Dedupe(DedupeAction {
+        keep: KeepPolicy::Oldest,
+        to: None,
+        replace_with: Some(kind),
+        duplicates: std::sync::Arc::new([(duplicate.to_path_buf(), kept.to_path_buf())].into()),
+    })
+}
+
+#[test]
+fn test_dedupe_replaces_duplicates_with_links_to_kept_file() {
+    use std::os::unix::fs::MetadataExt;
+
+    let dir = tempdir().unwrap();
+    let kept = dir.path().join("original.jpg");
+    let hard = dir.path().join("copy.jpg");
+    let soft = dir.path().join("nested/another copy.jpg");
+    fs::create_dir(dir.path().join("nested")).unwrap();
+    for path in [&kept, &hard, &soft] {
+        fs::write(path, "photo").unwrap();
+    }
+
+    let action = link_dedupe_action(&hard, &kept, LinkKind::Hardlink);
+    let result = file_ops::execute_action(&hard, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "link");
+    assert_eq!(result.new_path, hard);
+    assert_eq!(
+        fs::metadata(&hard).unwrap().ino(),
+        fs::metadata(&kept).unwrap().ino()
+    );
+
+    let action = link_dedupe_action(&soft, &kept, LinkKind::Symlink);
+    let result = file_ops::execute_action(&soft, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "link");
+    assert_eq!(fs::read_link(&soft).unwrap(), kept);
+    assert_eq!(fs::read_to_string(&soft).unwrap(), "photo");
+
+    // Already linked duplicates are left alone on the next run
+    let result = file_ops::execute_action(&soft, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "keep");
+    assert!(kept.exists());
+    assert_eq!(fs::read_dir(dir.path()).unwrap().count(), 3);
+}
+
+#[test]
+fn test_dedupe_dry_run_keeps_duplicate() {
+    use std::os::unix::fs::MetadataExt;
+
+    let dir = tempdir().unwrap();
+    let kept = dir.path().join("a.txt");
+    let duplicate = dir.path().join("b.txt");
+    fs::write(&kept, "same").unwrap();
+    fs::write(&duplicate, "same").unwrap();
+
+    let action = link_dedupe_action(&duplicate, &kept, LinkKind::Hardlink);
+    let result = file_ops::execute_action(&duplicate, &action, true, dir.path()).unwrap();
+    assert_eq!(result.action, "link");
+    assert!(
+        !fs::symlink_metadata(&duplicate)
+            .unwrap()
+            .file_type()
+            .is_symlink()
+    );
+    assert_eq!(fs::metadata(&duplicate).unwrap().nlink(), 1);
+}
+
 #[test]
 fn test_rename_file() {
     let (dir, src_file) = setup_temp_dir_and_file();
@@ -52,6 +434,7 @@ fn test_rename_file() {
 
     let rename_action = Action::Rename(RenameAction {
         to: "renamed_{{ext}}".to_string(),
+        counter_width: None,
     });
 
     let result = file_ops::execute_action(&src_path, &rename_action, false, dir.path()).unwrap();
@@ -64,13 +447,113 @@ fn test_delete_file() {
     let (dir, src_file) = setup_temp_dir_and_file();
     let src_path = src_file.path().to_path_buf();
 
-    let delete_action = Action::Delete(DeleteAction { trash: false });
+    let delete_action = Action::Delete(DeleteAction {
+        trash: false,
+        secure: false,
+        passes: None,
+    });
 
     let result = file_ops::execute_action(&src_path, &delete_action, false, dir.path()).unwrap();
     assert!(!src_path.exists());
     assert_eq!(result.action, "delete");
 }
 
+fn secure_delete(passes: Option<u32>) -> Action {
+    Action::Delete(DeleteAction {
+        trash: false,
+        secure: true,
+        passes,
+    })
+}
+
+#[test]
+fn test_secure_delete_file() {
+    let dir = tempdir().unwrap();
+    for passes in [None, Some(3)] {
+        let src_path = dir.path().join("secret.txt");
+        fs::write(&src_path, "x".repeat(100_000)).unwrap();
+
+        let result =
+            file_ops::execute_action(&src_path, &secure_delete(passes), false, dir.path()).unwrap();
+        assert_eq!(result.action, "delete");
+        assert_eq!(
+            result.new_path,
+            std::path::Path::new(file_ops::DELETED_PATH)
+        );
+        assert!(fs::symlink_metadata(&src_path).is_err());
+    }
+}
+
+#[test]
+fn test_secure_delete_only_unlinks_symlinks() {
+    let dir = tempdir().unwrap();
+    let target = dir.path().join("target.txt");
+    fs::write(&target, "keep me").unwrap();
+    let link = dir.path().join("link.txt");
+    std::os::unix::fs::symlink(&target, &link).unwrap();
+
+    file_ops::execute_action(&link, &secure_delete(None), false, dir.path()).unwrap();
+    assert!(fs::symlink_metadata(&link).is_err());
+    assert_eq!(fs::read_to_string(&target).unwrap(), "keep me");
+}
+
+#[test]
+fn test_trash_file_dry_run() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+
+    let delete_to_trash = Action::Delete(DeleteAction {
+        trash: true,
+        secure: false,
+        passes: None,
+    });
+    for trash in [Action::Trash, delete_to_trash] {
+        let result = file_ops::execute_action(&src_path, &trash, true, dir.path()).unwrap();
+        assert_eq!(result.action, "trash");
+        assert_eq!(
+            result.new_path,
+            std::path::Path::new(file_ops::DELETED_PATH)
+        );
+        assert!(src_path.exists());
+    }
+}
+
+#[test]
+fn test_trash_falls_back_to_folder() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("old.log");
+    fs::write(&src_path, "log").unwrap();
+    let fallback_dir = dir.path().join(file_ops::FALLBACK_TRASH_DIR);
+
+    let trashed = file_ops::move_to_trash_with(&src_path, &fallback_dir, |_| {
+        Err(trash::Error::Unknown {
+            description: "no trash".to_string(),
+        })
+    })
+    .unwrap();
+
+    assert!(!src_path.exists());
+    assert!(trashed.starts_with(&fallback_dir));
+    assert_eq!(fs::read_to_string(&trashed).unwrap(), "log");
+}
+
+#[test]
+fn test_trash_uses_system_trash_when_available() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("old.log");
+    fs::write(&src_path, "log").unwrap();
+    let fallback_dir = dir.path().join(file_ops::FALLBACK_TRASH_DIR);
+
+    let trashed = file_ops::move_to_trash_with(&src_path, &fallback_dir, |path| {
+        fs::remove_file(path).unwrap();
+        Ok(())
+    })
+    .unwrap();
+
+    assert_eq!(trashed, std::path::Path::new(file_ops::DELETED_PATH));
+    assert!(!fallback_dir.exists());
+}
+
 #[test]
 fn test_execute_file() {
     let (dir, src_file) = setup_temp_dir_and_file();
@@ -102,3 +585,250 @@ fn test_skip_file() {
     assert_eq!(result.action, "skip");
     assert!(src_path.exists());
 }
+
+#[cfg(unix)]
+#[test]
+fn test_move_file_with_dir_mode() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+
+    let dest_dir = dir.path().join("private").join("archive");
+    let move_action = Action::Move(MoveAction {
+        to: dest_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: Some("0700".to_string()),
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
+    });
+
+    let result = file_ops::execute_action(&src_path, &move_action, false, dir.path()).unwrap();
+    assert!(result.new_path.exists());
+    for created in [dir.path().join("private"), dest_dir] {
+        let mode = fs::metadata(&created).unwrap().permissions().mode();
+        assert_eq!(mode & 0o7777, 0o700, "{}", created.display());
+    }
+}
+
+#[cfg(unix)]
+#[test]
+fn test_copy_file_with_dir_mode_keeps_existing_dirs() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+
+    let existing = dir.path().join("shared");
+    fs::create_dir(&existing).unwrap();
+    fs::set_permissions(&existing, fs::Permissions::from_mode(0o755)).unwrap();
+
+    let dest_dir = existing.join("copies");
+    let copy_action = Action::Copy(CopyAction {
+        to: dest_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: Some("750".to_string()),
+        path_template: None,
+        preserve_metadata: true,
+    });
+
+    file_ops::execute_action(&src_path, &copy_action, false, dir.path()).unwrap();
+    let created_mode = fs::metadata(&dest_dir).unwrap().permissions().mode();
+    let existing_mode = fs::metadata(&existing).unwrap().permissions().mode();
+    assert_eq!(created_mode & 0o7777, 0o750);
+    assert_eq!(existing_mode & 0o7777, 0o755);
+}
+
+#[test]
+fn test_copy_preserves_metadata_unless_disabled() {
+    let dir = tempdir().unwrap();
+    let src_path = dir.path().join("photo.jpg");
+    fs::write(&src_path, "pixels").unwrap();
+    fs::set_permissions(&src_path, fs::Permissions::from_mode(0o640)).unwrap();
+    let modified = Local.with_ymd_and_hms(2021, 7, 8, 9, 10, 11).unwrap();
+    fs::File::options()
+        .write(true)
+        .open(&src_path)
+        .unwrap()
+        .set_modified(modified.into())
+        .unwrap();
+
+    for preserve_metadata in [true, false] {
+        let dest_dir = dir.path().join(format!("copies-{preserve_metadata}"));
+        let copy_action = Action::Copy(CopyAction {
+            to: dest_dir.to_str().unwrap().to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            preserve_metadata,
+        });
+
+        let result = file_ops::execute_action(&src_path, &copy_action, false, dir.path()).unwrap();
+        let metadata = fs::metadata(&result.new_path).unwrap();
+        assert_eq!(fs::read_to_string(&result.new_path).unwrap(), "pixels");
+        assert_eq!(
+            metadata.modified().unwrap() == std::time::SystemTime::from(modified),
+            preserve_metadata
+        );
+        if preserve_metadata {
+            assert_eq!(metadata.permissions().mode() & 0o777, 0o640);
+        }
+    }
+}
+
+#[test]
+fn test_move_file_with_invalid_dir_mode() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+
+    let move_action = Action::Move(MoveAction {
+        to: dir.path().join("moved").to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: Some("rwx".to_string()),
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
+    });
+
+    assert!(file_ops::execute_action(&src_path, &move_action, false, dir.path()).is_err());
+    assert!(src_path.exists());
+}
+
+#[cfg(unix)]
+#[test]
+fn test_move_onto_symlink_to_source_is_refused() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+    fs::write(&src_path, "precious").unwrap();
+
+    // The destination file is a symlink pointing back at the source
+    let dest_dir = dir.path().join("dest");
+    fs::create_dir(&dest_dir).unwrap();
+    std::os::unix::fs::symlink(&src_path, dest_dir.join(src_path.file_name().unwrap())).unwrap();
+
+    let move_action = Action::Move(MoveAction {
+        to: dest_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
+    });
+
+    assert!(file_ops::execute_action(&src_path, &move_action, false, dir.path()).is_err());
+    assert_eq!(fs::read_to_string(&src_path).unwrap(), "precious");
+}
+
+#[cfg(unix)]
+#[test]
+fn test_copy_into_symlinked_source_dir_is_refused() {
+    let (dir, src_file) = setup_temp_dir_and_file();
+    let src_path = src_file.path().to_path_buf();
+    fs::write(&src_path, "precious").unwrap();
+
+    // The destination directory is a symlink to the directory holding the source
+    let linked_dir = dir.path().join("linked");
+    std::os::unix::fs::symlink(dir.path(), &linked_dir).unwrap();
+
+    let copy_action = Action::Copy(CopyAction {
+        to: linked_dir.to_str().unwrap().to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        preserve_metadata: true,
+    });
+
+    assert!(file_ops::execute_action(&src_path, &copy_action, false, dir.path()).is_err());
+    assert_eq!(fs::read_to_string(&src_path).unwrap(), "precious");
+}
+
+#[test]
+fn test_index_action_creates_and_updates_folder_index() {
+    let dir = tempdir().unwrap();
+    let archive = dir.path().join("archive");
+    let index_path = archive.join(folder_index::INDEX_FILE_NAME);
+    let actions = [
+        Action::Move(MoveAction {
+            to: archive.to_str().unwrap().to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            on_conflict: ConflictStrategy::default(),
+        }),
+        Action::Index,
+    ];
+    let run = |name: &str| {
+        let mut path = dir.path().join(name);
+        fs::write(&path, "content").unwrap();
+        for action in &actions {
+            path = file_ops::execute_action(&path, action, false, dir.path())
+                .unwrap()
+                .new_path;
+        }
+    };
+
+    // Dry runs leave no index behind
+    let pending = dir.path().join("pending.txt");
+    fs::write(&pending, "content").unwrap();
+    file_ops::execute_action(&pending, &Action::Index, true, dir.path()).unwrap();
+    assert!(!dir.path().join(folder_index::INDEX_FILE_NAME).exists());
+
+    run("a.txt");
+    assert!(index_path.exists());
+    let index = FolderIndex::load(&archive);
+    assert_eq!(index.files.len(), 1);
+    assert_eq!(index.files[0].name, "a.txt");
+    assert_eq!(index.files[0].size, 7);
+
+    // A second run adds new files and updates, rather than duplicates, existing ones
+    run("b.txt");
+    fs::remove_file(archive.join("a.txt")).unwrap();
+    run("a.txt");
+    let names: Vec<_> = FolderIndex::load(&archive)
+        .files
+        .into_iter()
+        .map(|e| e.name)
+        .collect();
+    assert_eq!(names, vec!["a.txt", "b.txt"]);
+}
+
+#[test]
+fn test_rename_counter_does_not_overwrite() {
+    let dir = tempdir().unwrap();
+    fs::write(dir.path().join("scan_01.pdf"), "taken").unwrap();
+    let action = Action::Rename(RenameAction {
+        to: "scan_{{counter}}{{ext}}".to_string(),
+        counter_width: Some(2),
+    });
+
+    let mut renamed = Vec::new();
+    for file in ["a.pdf", "b.pdf"] {
+        let path = dir.path().join(file);
+        fs::write(&path, file).unwrap();
+        let result = file_ops::execute_action(&path, &action, false, dir.path()).unwrap();
+        renamed.push(result.new_path);
+    }
+
+    assert_eq!(
+        renamed,
+        vec![
+            dir.path().join("scan_02.pdf"),
+            dir.path().join("scan_03.pdf")
+        ]
+    );
+    assert_eq!(
+        fs::read_to_string(dir.path().join("scan_01.pdf")).unwrap(),
+        "taken"
+    );
+}
+
+#[test]
+fn test_rename_rejects_invalid_rendered_names() {
+    let dir = tempdir().unwrap();
+    // The stem of "..txt" is ".", so the template renders a traversal name
+    for (file, template) in [("a.txt", "{{metadata.missing}}"), ("..txt", "{{filename}}")] {
+        let path = dir.path().join(file);
+        fs::write(&path, "content").unwrap();
+        let action = Action::Rename(RenameAction {
+            to: template.to_string(),
+            counter_width: None,
+        });
+
+        assert!(file_ops::execute_action(&path, &action, false, dir.path()).is_err());
+        assert!(path.exists(), "{file} must be left in place");
+    }
+}
@@ -0,0 +1,98 @@
+//! Per-folder index files for Tooka.
+//!
+//! The `index` action records a file in a `.tooka-index.json` file stored in
+//! the folder the file is in, so archive folders document what Tooka placed
+//! there and when. Updating the index is idempotent: a file that is indexed
+//! again replaces its previous entry, and entries of files that no longer exist
+//! in the folder are dropped.
+
+use crate::core::error::TookaError;
+use chrono::Local;
+use serde::{Deserialize, Serialize};
+use std::{
+    fs,
+    path::{Path, PathBuf},
+    sync::Mutex,
+};
+
+/// File name of the index written into each indexed folder
+pub const INDEX_FILE_NAME: &str = ".tooka-index.json";
+
+/// Serializes index updates from parallel sorting workers
+static INDEX_LOCK: Mutex<()> = Mutex::new(());
+
+/// Contents of a folder's index file.
+#[derive(Debug, Default, Serialize, Deserialize)]
+pub struct FolderIndex {
+    /// When the index was last updated, in RFC3339 format.
+    pub updated_at: String,
+    /// Indexed files, sorted by name.
+    pub files: Vec<IndexEntry>,
+}
+
+/// A file recorded in a folder's index.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct IndexEntry {
+    /// File name within the folder.
+    pub name: String,
+    /// File size in bytes.
+    pub size: u64,
+    /// When the file was indexed, in RFC3339 format.
+    pub indexed_at: String,
+}
+
+impl FolderIndex {
+    /// Loads the index of `folder`; a missing or unreadable index is empty.
+    pub fn load(folder: &Path) -> Self {
+        let path = folder.join(INDEX_FILE_NAME);
+        let Ok(content) = fs::read_to_string(&path) else {
+            return Self::default();
+        };
+        serde_json::from_str(&content).unwrap_or_else(|e| {
+            log::warn!("Replacing invalid index file '{}': {}", path.display(), e);
+            Self::default()
+        })
+    }
+}
+
+/// Records `file_path` in the index of the folder containing it.
+///
+/// # Returns
+/// The path of the updated index file.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the file cannot be inspected or the index cannot be written.
+pub fn update_folder_index(file_path: &Path) -> Result<PathBuf, TookaError> {
+    let folder = file_path.parent().unwrap_or_else(|| Path::new("."));
+    let name = file_path
+        .file_name()
+        .map(|n| n.to_string_lossy().into_owned())
+        .ok_or_else(|| {
+            TookaError::FileOperationError(format!(
+                "Cannot index '{}': path has no file name",
+                file_path.display()
+            ))
+        })?;
+    let size = fs::metadata(file_path)?.len();
+    let now = Local::now().to_rfc3339();
+
+    let _guard = INDEX_LOCK
+        .lock()
+        .map_err(|e| TookaError::Other(format!("Index lock poisoned: {e}")))?;
+
+    let mut index = FolderIndex::load(folder);
+    index
+        .files
+        .retain(|entry| entry.name != name && folder.join(&entry.name).is_file());
+    index.files.push(IndexEntry {
+        name,
+        size,
+        indexed_at: now.clone(),
+    });
+    index.files.sort_by(|a, b| a.name.cmp(&b.name));
+    index.updated_at = now;
+
+    let index_path = folder.join(INDEX_FILE_NAME);
+    fs::write(&index_path, serde_json::to_string_pretty(&index)?)?;
+    Ok(index_path)
+}
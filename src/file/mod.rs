@@ -1,7 +1,18 @@
+pub mod archive;
+pub mod backup;
 pub mod file_match;
 pub mod file_ops;
+pub mod folder_index;
+pub mod quarantine;
+pub mod secure_delete;
 
+#[cfg(test)]
+mod archive_tests;
+#[cfg(test)]
+mod backup_tests;
 #[cfg(test)]
 mod file_match_tests;
 #[cfg(test)]
 mod file_ops_tests;
+#[cfg(test)]
+mod quarantine_tests;
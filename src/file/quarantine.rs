@@ -0,0 +1,176 @@
+//! Quarantine for Tooka.
+//!
+//! The `quarantine` action moves files into a quarantine folder instead of
+//! deleting them, recording when each file expires in an index stored in that
+//! folder. `tooka quarantine purge` later deletes the files whose expiry has
+//! passed, so mistakes can be undone until then.
+
+use crate::{common::config::Config, core::error::TookaError, file::file_ops};
+use chrono::{DateTime, Duration, Local};
+use serde::{Deserialize, Serialize};
+use std::{
+    fs,
+    path::{Path, PathBuf},
+    sync::Mutex,
+};
+
+/// File name of the index of quarantined files, stored in the quarantine folder
+pub const QUARANTINE_INDEX_FILE: &str = ".tooka-quarantine.json";
+
+/// Serializes index updates from parallel sorting workers
+static QUARANTINE_LOCK: Mutex<()> = Mutex::new(());
+
+/// A quarantined file.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct QuarantineEntry {
+    /// Where the file was before it was quarantined.
+    pub original_path: PathBuf,
+    /// Where the file is kept in the quarantine folder.
+    pub quarantined_path: PathBuf,
+    /// When the file was quarantined, in RFC3339 format.
+    pub quarantined_at: String,
+    /// When the file may be purged, in RFC3339 format.
+    pub expires_at: String,
+}
+
+impl QuarantineEntry {
+    /// Returns true if the entry expired at or before `now`.
+    ///
+    /// Entries with an unreadable expiry never expire, so they are not purged by accident.
+    pub fn is_expired(&self, now: DateTime<Local>) -> bool {
+        DateTime::parse_from_rfc3339(&self.expires_at).is_ok_and(|expires| expires <= now)
+    }
+}
+
+/// A quarantine folder and its index.
+#[derive(Debug, Clone)]
+pub struct Quarantine {
+    dir: PathBuf,
+}
+
+impl Quarantine {
+    /// Creates a quarantine stored in the given folder.
+    pub fn new(dir: impl Into<PathBuf>) -> Self {
+        Self { dir: dir.into() }
+    }
+
+    /// Creates the quarantine stored in the configured quarantine folder.
+    pub fn from_config(config: &Config) -> Self {
+        Self::new(&config.quarantine_folder)
+    }
+
+    /// Returns the path a file would be quarantined at, without moving it.
+    pub fn target_path(&self, file_path: &Path, now: DateTime<Local>) -> PathBuf {
+        let name = file_path.file_name().unwrap_or_default().to_string_lossy();
+        let stamp = now.format("%Y%m%dT%H%M%S");
+        let mut target = self.dir.join(format!("{stamp}_{name}"));
+        let mut n = 1;
+        while target.exists() {
+            target = self.dir.join(format!("{stamp}_{n}_{name}"));
+            n += 1;
+        }
+        target
+    }
+
+    /// Moves `file_path` into quarantine, expiring `days` days after `now`.
+    ///
+    /// # Returns
+    /// The path of the quarantined file.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the file cannot be moved or the index cannot be written.
+    pub fn quarantine(
+        &self,
+        file_path: &Path,
+        days: u32,
+        now: DateTime<Local>,
+    ) -> Result<PathBuf, TookaError> {
+        let _guard = lock()?;
+        fs::create_dir_all(&self.dir)?;
+
+        let target = self.target_path(file_path, now);
+        file_ops::move_file(file_path, &target)?;
+
+        let mut entries = self.load_entries()?;
+        entries.push(QuarantineEntry {
+            original_path: file_path.to_path_buf(),
+            quarantined_path: target.clone(),
+            quarantined_at: now.to_rfc3339(),
+            expires_at: (now + Duration::days(i64::from(days))).to_rfc3339(),
+        });
+        self.save_entries(&entries)?;
+        Ok(target)
+    }
+
+    /// Lists the quarantined files.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the index exists but cannot be read.
+    pub fn entries(&self) -> Result<Vec<QuarantineEntry>, TookaError> {
+        let _guard = lock()?;
+        self.load_entries()
+    }
+
+    /// Deletes the quarantined files that expired at or before `now`.
+    ///
+    /// Expired entries whose file is already gone are only dropped from the
+    /// index. With `dry_run`, nothing is deleted.
+    ///
+    /// # Returns
+    /// The purged entries.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if a file cannot be deleted or the index cannot be written.
+    pub fn purge(
+        &self,
+        now: DateTime<Local>,
+        dry_run: bool,
+    ) -> Result<Vec<QuarantineEntry>, TookaError> {
+        let _guard = lock()?;
+        let (expired, kept): (Vec<_>, Vec<_>) = self
+            .load_entries()?
+            .into_iter()
+            .partition(|entry| entry.is_expired(now));
+        if dry_run {
+            return Ok(expired);
+        }
+
+        for entry in &expired {
+            match fs::remove_file(&entry.quarantined_path) {
+                Ok(()) => log::info!("Purged '{}'", entry.quarantined_path.display()),
+                Err(e) if e.kind() == std::io::ErrorKind::NotFound => {
+                    log::warn!(
+                        "Quarantined file '{}' is already gone",
+                        entry.quarantined_path.display()
+                    );
+                }
+                Err(e) => return Err(e.into()),
+            }
+        }
+        self.save_entries(&kept)?;
+        Ok(expired)
+    }
+
+    fn index_path(&self) -> PathBuf {
+        self.dir.join(QUARANTINE_INDEX_FILE)
+    }
+
+    fn load_entries(&self) -> Result<Vec<QuarantineEntry>, TookaError> {
+        let path = self.index_path();
+        if !path.exists() {
+            return Ok(Vec::new());
+        }
+        Ok(serde_json::from_str(&fs::read_to_string(path)?)?)
+    }
+
+    fn save_entries(&self, entries: &[QuarantineEntry]) -> Result<(), TookaError> {
+        fs::write(self.index_path(), serde_json::to_string_pretty(entries)?)?;
+        Ok(())
+    }
+}
+
+fn lock() -> Result<std::sync::MutexGuard<'static, ()>, TookaError> {
+    QUARANTINE_LOCK
+        .lock()
+        .map_err(|e| TookaError::Other(format!("Quarantine lock poisoned: {e}")))
+}
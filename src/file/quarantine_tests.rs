@@ -0,0 +1,79 @@
+use std::fs;
+
+use super::file_ops;
+use super::quarantine::Quarantine;
+use crate::rules::rule::{Action, QuarantineAction};
+use chrono::{Duration, Local};
+use tempfile::tempdir;
+
+#[test]
+fn test_quarantine_action_moves_file_and_records_expiry() {
+    let dir = tempdir().unwrap();
+    let quarantine_dir = dir.path().join("quarantine");
+    let file = dir.path().join("old.log");
+    fs::write(&file, "log").unwrap();
+    let action = Action::Quarantine(QuarantineAction {
+        days: 7,
+        to: Some(quarantine_dir.to_string_lossy().to_string()),
+    });
+
+    let result = file_ops::execute_action(&file, &action, false, dir.path()).unwrap();
+    assert_eq!(result.action, "quarantine");
+    assert!(!file.exists());
+    assert!(result.new_path.starts_with(&quarantine_dir));
+    assert_eq!(fs::read_to_string(&result.new_path).unwrap(), "log");
+
+    let entries = Quarantine::new(&quarantine_dir).entries().unwrap();
+    assert_eq!(entries.len(), 1);
+    assert_eq!(entries[0].original_path, file);
+    assert!(!entries[0].is_expired(Local::now() + Duration::days(6)));
+    assert!(entries[0].is_expired(Local::now() + Duration::days(8)));
+}
+
+#[test]
+fn test_purge_deletes_only_expired_files() {
+    let dir = tempdir().unwrap();
+    let quarantine = Quarantine::new(dir.path().join("quarantine"));
+    let now = Local::now();
+
+    let short = dir.path().join("short.txt");
+    let long = dir.path().join("long.txt");
+    fs::write(&short, "a").unwrap();
+    fs::write(&long, "b").unwrap();
+    let short_path = quarantine.quarantine(&short, 1, now).unwrap();
+    let long_path = quarantine.quarantine(&long, 30, now).unwrap();
+
+    // Nothing has expired yet
+    assert!(quarantine.purge(now, false).unwrap().is_empty());
+
+    // Simulate two days passing; a dry run leaves everything in place
+    let later = now + Duration::days(2);
+    assert_eq!(quarantine.purge(later, true).unwrap().len(), 1);
+    assert!(short_path.exists());
+
+    let purged = quarantine.purge(later, false).unwrap();
+    assert_eq!(purged.len(), 1);
+    assert_eq!(purged[0].original_path, short);
+    assert!(!short_path.exists());
+    assert!(long_path.exists());
+    assert_eq!(quarantine.entries().unwrap().len(), 1);
+}
+
+#[test]
+fn test_quarantine_keeps_files_with_the_same_name_apart() {
+    let dir = tempdir().unwrap();
+    let quarantine = Quarantine::new(dir.path().join("quarantine"));
+    let now = Local::now();
+
+    let mut targets = Vec::new();
+    for sub in ["a", "b"] {
+        let file = dir.path().join(sub).join("report.pdf");
+        fs::create_dir_all(file.parent().unwrap()).unwrap();
+        fs::write(&file, sub).unwrap();
+        targets.push(quarantine.quarantine(&file, 1, now).unwrap());
+    }
+
+    assert_ne!(targets[0], targets[1]);
+    assert_eq!(fs::read_to_string(&targets[0]).unwrap(), "a");
+    assert_eq!(fs::read_to_string(&targets[1]).unwrap(), "b");
+}
@@ -0,0 +1,92 @@
+//! Secure deletion for Tooka.
+//!
+//! With `secure: true`, the `delete` action overwrites the contents of a file
+//! with random bytes before removing it, so the data is harder to recover from
+//! the disk. Symbolic links are only unlinked; the file they point to is left
+//! untouched. Securely deleted files are never backed up, even with
+//! `backup_before_delete` enabled.
+
+use crate::core::error::TookaError;
+use std::{
+    collections::hash_map::RandomState,
+    fs::{self, OpenOptions},
+    hash::{BuildHasher, Hasher},
+    io::{Seek, SeekFrom, Write},
+    path::Path,
+};
+
+/// Number of overwrite passes when none are configured
+pub const DEFAULT_PASSES: u32 = 1;
+
+/// Size of the buffer of random bytes written at a time
+const CHUNK_SIZE: usize = 64 * 1024;
+
+/// Overwrites `file_path` with random bytes `passes` times, then removes it.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the file cannot be overwritten or removed.
+pub fn secure_delete(file_path: &Path, passes: u32) -> Result<(), TookaError> {
+    let metadata = fs::symlink_metadata(file_path)?;
+    if metadata.file_type().is_symlink() {
+        log::info!(
+            "Not overwriting symbolic link, only removing it: {}",
+            file_path.display()
+        );
+        fs::remove_file(file_path)?;
+        return Ok(());
+    }
+
+    let len = metadata.len();
+    let mut file = OpenOptions::new().write(true).open(file_path)?;
+    let mut random = RandomBytes::new();
+    let mut buffer = vec![0u8; CHUNK_SIZE];
+    for pass in 1..=passes {
+        log::debug!(
+            "Overwriting {} ({} bytes), pass {}/{}",
+            file_path.display(),
+            len,
+            pass,
+            passes
+        );
+        file.seek(SeekFrom::Start(0))?;
+        let mut remaining = len;
+        while remaining > 0 {
+            let n = usize::try_from(remaining).map_or(CHUNK_SIZE, |r| r.min(CHUNK_SIZE));
+            random.fill(&mut buffer[..n]);
+            file.write_all(&buffer[..n])?;
+            remaining -= n as u64;
+        }
+        file.sync_all()?;
+    }
+    drop(file);
+
+    fs::remove_file(file_path)?;
+    log::info!(
+        "Securely deleted file with {} overwrite pass(es): {}",
+        passes,
+        file_path.display()
+    );
+    Ok(())
+}
+
+/// Pseudo-random bytes (xorshift64*) seeded from the randomly keyed std hasher.
+struct RandomBytes {
+    state: u64,
+}
+
+impl RandomBytes {
+    fn new() -> Self {
+        let seed = RandomState::new().build_hasher().finish();
+        Self { state: seed | 1 }
+    }
+
+    fn fill(&mut self, buffer: &mut [u8]) {
+        for chunk in buffer.chunks_mut(8) {
+            self.state ^= self.state >> 12;
+            self.state ^= self.state << 25;
+            self.state ^= self.state >> 27;
+            let value = self.state.wrapping_mul(0x2545_F491_4F6C_DD1D);
+            chunk.copy_from_slice(&value.to_le_bytes()[..chunk.len()]);
+        }
+    }
+}
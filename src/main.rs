@@ -7,8 +7,8 @@ mod file;
 mod rules;
 mod utils;
 
-use crate::common::logger::init_logger;
-use crate::core::context::{init_config, init_rules_file};
+use crate::common::logger::{ConsoleLevel, init_logger};
+use crate::core::context::{init_config, init_rules_file, set_config_path};
 use anyhow::Result;
 use clap::Parser;
 
@@ -21,6 +21,34 @@ use clap::Parser;
 )]
 #[command(disable_version_flag = true)]
 struct Cli {
+    /// Configuration file to use instead of the default one
+    #[arg(
+        long,
+        global = true,
+        value_name = "FILE",
+        help = "Use this configuration file instead of the default one"
+    )]
+    config: Option<std::path::PathBuf>,
+
+    /// Show debug messages on the console
+    #[arg(
+        long,
+        short = 'v',
+        global = true,
+        conflicts_with = "quiet",
+        help = "Show debug messages on the console (the log file always has full detail)"
+    )]
+    verbose: bool,
+
+    /// Only show errors on the console
+    #[arg(
+        long,
+        short = 'q',
+        global = true,
+        help = "Only show errors on the console, and leave out per-file output"
+    )]
+    quiet: bool,
+
     #[clap(subcommand)]
     command: Commands,
 }
@@ -28,14 +56,26 @@ struct Cli {
 #[derive(clap::Subcommand)]
 enum Commands {
     Add(commands::add::AddArgs),
+    Bench(commands::bench::BenchArgs),
+    Categories(commands::categories::CategoriesArgs),
     Completions(completions::CompletionsArgs),
     Config(commands::config::ConfigArgs),
+    Coverage(commands::coverage::CoverageArgs),
+    Disable(commands::disable::DisableArgs),
+    Edit(commands::edit::EditArgs),
+    Enable(commands::enable::EnableArgs),
     Export(commands::export::ExportArgs),
+    InitRules(commands::init_rules::InitRulesArgs),
     List(commands::list::ListArgs),
+    Quarantine(commands::quarantine::QuarantineArgs),
     Remove(commands::remove::RemoveArgs),
+    Rules(commands::rules::RulesArgs),
+    Simulate(commands::simulate::SimulateArgs),
     Sort(commands::sort::SortArgs),
     Toggle(commands::toggle::ToggleArgs),
     Template(commands::template::TemplateArgs),
+    Trace(commands::trace::TraceArgs),
+    Undo(commands::undo::UndoArgs),
     Validate(commands::validate::ValidateArgs),
 }
 
@@ -61,22 +101,45 @@ fn main() {
 fn run() -> Result<()> {
     let cli = Cli::parse();
 
+    if let Some(path) = cli.config {
+        set_config_path(path)?;
+    }
     init_config()?;
-    init_logger()?;
-    init_rules_file()?;
+    init_logger(ConsoleLevel::from_flags(cli.quiet, cli.verbose))?;
+    // Validation reports the problems of the rules file instead of failing to load it
+    let skip_rules = matches!(&cli.command, Commands::Validate(_))
+        || matches!(&cli.command, Commands::Rules(args) if args.skips_rules_loading());
+    if !skip_rules {
+        init_rules_file()?;
+    }
 
     log::info!("Tooka CLI started");
 
     match cli.command {
         Commands::Config(args) => commands::config::run(&args)?,
+        Commands::Coverage(args) => commands::coverage::run(&args)?,
         Commands::Add(args) => commands::add::run(&args)?,
+        Commands::Bench(args) => commands::bench::run(&args)?,
+        Commands::Categories(args) => commands::categories::run(&args)?,
+        Commands::Disable(args) => commands::disable::run(&args)?,
+        Commands::Edit(args) => commands::edit::run(&args)?,
+        Commands::Enable(args) => commands::enable::run(&args)?,
         Commands::Export(args) => commands::export::run(args)?,
+        Commands::InitRules(args) => commands::init_rules::run(&args)?,
         Commands::List(args) => commands::list::run(args)?,
+        Commands::Quarantine(args) => commands::quarantine::run(&args)?,
         Commands::Remove(args) => commands::remove::run(&args)?,
-        Commands::Sort(args) => commands::sort::run(args)?,
+        Commands::Rules(args) => commands::rules::run(&args)?,
+        Commands::Simulate(args) => commands::simulate::run(&args)?,
+        Commands::Sort(mut args) => {
+            args.quiet = cli.quiet;
+            commands::sort::run(args)?
+        }
         Commands::Toggle(args) => commands::toggle::run(&args)?,
         Commands::Completions(args) => completions::run(&args)?,
         Commands::Template(args) => commands::template::run(args)?,
+        Commands::Trace(args) => commands::trace::run(&args)?,
+        Commands::Undo(args) => commands::undo::run(&args)?,
         Commands::Validate(args) => commands::validate::run(&args)?,
     }
 
@@ -0,0 +1,123 @@
+//! Built-in file categories for the `category` condition.
+//!
+//! A category stands for a curated set of extensions and MIME types, so rules
+//! can match e.g. all images without listing every format. A file is in a
+//! category if its extension is listed, or else if its detected MIME type is.
+
+/// A named set of file types.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Category {
+    /// Name used in the `category` condition.
+    pub name: &'static str,
+    /// What the category covers.
+    pub description: &'static str,
+    /// Extensions of the files in the category, lowercase and without a dot.
+    pub extensions: &'static [&'static str],
+    /// MIME types of the files in the category; `type/*` matches any subtype.
+    pub mime_types: &'static [&'static str],
+}
+
+/// The built-in categories.
+pub const CATEGORIES: &[Category] = &[
+    Category {
+        name: "image",
+        description: "Photos, graphics and raw camera images",
+        extensions: &[
+            "jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp", "heic", "heif", "avif",
+            "svg", "ico", "raw", "cr2", "cr3", "nef", "arw", "dng", "orf", "rw2",
+        ],
+        mime_types: &["image/*"],
+    },
+    Category {
+        name: "video",
+        description: "Movies and video clips",
+        extensions: &[
+            "mp4", "m4v", "mov", "avi", "mkv", "webm", "wmv", "flv", "mpg", "mpeg", "3gp", "mts",
+        ],
+        mime_types: &["video/*"],
+    },
+    Category {
+        name: "audio",
+        description: "Music, recordings and podcasts",
+        extensions: &[
+            "mp3", "wav", "flac", "aac", "m4a", "ogg", "oga", "opus", "wma", "aiff", "alac", "mid",
+            "midi",
+        ],
+        mime_types: &["audio/*"],
+    },
+    Category {
+        name: "document",
+        description: "Text documents, spreadsheets, presentations and e-books",
+        extensions: &[
+            "pdf", "doc", "docx", "odt", "rtf", "txt", "md", "xls", "xlsx", "ods", "csv", "ppt",
+            "pptx", "odp", "epub", "mobi", "pages", "numbers", "key",
+        ],
+        mime_types: &[
+            "application/pdf",
+            "application/msword",
+            "application/rtf",
+            "application/epub+zip",
+            "application/vnd.oasis.opendocument.text",
+            "application/vnd.oasis.opendocument.spreadsheet",
+            "application/vnd.oasis.opendocument.presentation",
+            "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+            "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+            "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+            "application/vnd.ms-excel",
+            "application/vnd.ms-powerpoint",
+        ],
+    },
+    Category {
+        name: "archive",
+        description: "Compressed archives and disk images",
+        extensions: &[
+            "zip", "tar", "gz", "tgz", "bz2", "xz", "zst", "7z", "rar", "iso", "dmg",
+        ],
+        mime_types: &[
+            "application/zip",
+            "application/x-tar",
+            "application/gzip",
+            "application/x-bzip2",
+            "application/x-xz",
+            "application/zstd",
+            "application/x-7z-compressed",
+            "application/vnd.rar",
+            "application/x-iso9660-image",
+        ],
+    },
+    Category {
+        name: "code",
+        description: "Source code, scripts and markup",
+        extensions: &[
+            "rs", "go", "py", "js", "ts", "jsx", "tsx", "java", "kt", "c", "h", "cpp", "hpp", "cs",
+            "rb", "php", "swift", "sh", "bash", "ps1", "sql", "html", "css", "json", "yaml", "yml",
+            "toml", "xml",
+        ],
+        mime_types: &[
+            "text/x-rust",
+            "text/x-python",
+            "text/x-c",
+            "text/x-java",
+            "text/javascript",
+            "application/javascript",
+            "application/x-sh",
+        ],
+    },
+];
+
+/// Returns the category called `name`, ignoring case.
+///
+/// # Errors
+/// Returns a message listing the available categories if there is no such category.
+pub fn expand_category(name: &str) -> Result<&'static Category, String> {
+    CATEGORIES
+        .iter()
+        .find(|category| category.name.eq_ignore_ascii_case(name))
+        .ok_or_else(|| {
+            let names: Vec<_> = CATEGORIES.iter().map(|category| category.name).collect();
+            format!(
+                "Unknown category '{name}', expected one of: {}",
+                names.join(", ")
+            )
+        })
+}
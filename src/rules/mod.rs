@@ -1,3 +1,18 @@
+pub mod category;
+pub mod remote;
 pub mod rule;
 pub mod rules_file;
 pub mod template;
+pub mod units;
+pub mod validation;
+
+#[cfg(test)]
+mod remote_tests;
+#[cfg(test)]
+mod rules_file_tests;
+#[cfg(test)]
+pub(crate) mod test_support;
+#[cfg(test)]
+mod units_tests;
+#[cfg(test)]
+mod validation_tests;
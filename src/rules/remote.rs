@@ -0,0 +1,264 @@
+//! Remote rules source for Tooka.
+//!
+//! Fetches a centrally managed rules file over HTTP(S) and caches it locally.
+//! Conditional requests (`If-None-Match` / `If-Modified-Since`) ensure the file
+//! is only downloaded again when it changed on the server, and the cached copy
+//! is used when the server cannot be reached.
+//!
+//! Rule snippets shared by URL are fetched once with [`fetch_rule_snippet`],
+//! without caching.
+
+use crate::{core::error::TookaError, rules::rules_file::RulesFile};
+use reqwest::{
+    StatusCode,
+    blocking::Client,
+    header::{ETAG, IF_MODIFIED_SINCE, IF_NONE_MATCH, LAST_MODIFIED},
+};
+use serde::{Deserialize, Serialize};
+use std::{fs, io::Read, path::PathBuf, time::Duration};
+
+/// File name of the cached remote rules file
+const CACHE_FILE_NAME: &str = "remote_rules.yaml";
+/// File name of the cache validators stored alongside the cached rules
+const CACHE_META_FILE_NAME: &str = "remote_rules.meta.json";
+/// Timeout for fetching the remote rules file
+const FETCH_TIMEOUT: Duration = Duration::from_secs(10);
+/// Largest rule snippet accepted from a URL, in bytes
+pub const MAX_SNIPPET_BYTES: u64 = 1024 * 1024;
+
+/// How the rules returned by [`RemoteRules::fetch`] were obtained.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum FetchStatus {
+    /// The rules changed on the server and were downloaded.
+    Downloaded,
+    /// The server reported the cached rules are still current.
+    NotModified,
+    /// The server could not be reached, so the cached rules were used.
+    Cached,
+}
+
+/// Rules loaded from a remote source.
+#[derive(Debug)]
+pub struct FetchedRules {
+    /// The loaded rules.
+    pub rules_file: RulesFile,
+    /// How the rules were obtained.
+    pub status: FetchStatus,
+    /// Path of the cached rules file.
+    pub path: PathBuf,
+}
+
+/// Body and cache validators of a downloaded rules file
+struct Download {
+    body: String,
+    etag: Option<String>,
+    last_modified: Option<String>,
+}
+
+/// Cache validators of the last successful download
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct CacheMeta {
+    url: String,
+    etag: Option<String>,
+    last_modified: Option<String>,
+}
+
+/// A rules file served over HTTP(S), cached in a local directory.
+#[derive(Debug, Clone)]
+pub struct RemoteRules {
+    url: String,
+    cache_dir: PathBuf,
+}
+
+impl RemoteRules {
+    /// Creates a remote rules source for `url`, cached in `cache_dir`.
+    pub fn new(url: impl Into<String>, cache_dir: impl Into<PathBuf>) -> Self {
+        Self {
+            url: url.into(),
+            cache_dir: cache_dir.into(),
+        }
+    }
+
+    /// Returns the path of the cached rules file.
+    pub fn cache_path(&self) -> PathBuf {
+        self.cache_dir.join(CACHE_FILE_NAME)
+    }
+
+    /// Fetches the rules, downloading them only if they changed since the last fetch.
+    ///
+    /// Falls back to the cached copy if the server cannot be reached or responds
+    /// with an error. Downloaded rules are validated before the cache is updated,
+    /// so a broken upload never replaces a working cached copy.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if the rules cannot be fetched and no cached copy
+    /// exists, or if the downloaded or cached rules are invalid.
+    pub fn fetch(&self) -> Result<FetchedRules, TookaError> {
+        let meta = self.load_meta();
+
+        match self.request(meta.as_ref()) {
+            Ok(Some(download)) => {
+                let rules_file: RulesFile = serde_yaml::from_str(&download.body)?;
+                for rule in &rules_file.rules {
+                    rule.validate(true)?;
+                }
+                self.store(download)?;
+                log::info!(
+                    "Downloaded {} rules from {}",
+                    rules_file.rules.len(),
+                    self.url
+                );
+                Ok(self.fetched(rules_file, FetchStatus::Downloaded))
+            }
+            Ok(None) => {
+                log::info!("Remote rules at {} are unchanged", self.url);
+                let rules_file = RulesFile::load_from(&self.cache_path())?;
+                Ok(self.fetched(rules_file, FetchStatus::NotModified))
+            }
+            Err(e) if meta.is_some() => {
+                log::warn!(
+                    "Failed to fetch rules from {}: {}; using cached copy",
+                    self.url,
+                    e
+                );
+                let rules_file = RulesFile::load_from(&self.cache_path())?;
+                Ok(self.fetched(rules_file, FetchStatus::Cached))
+            }
+            Err(e) => Err(e),
+        }
+    }
+
+    /// Sends the (conditional) request.
+    ///
+    /// Returns `None` if the server reports the cached copy is still current.
+    fn request(&self, meta: Option<&CacheMeta>) -> Result<Option<Download>, TookaError> {
+        let client = Client::builder().timeout(FETCH_TIMEOUT).build()?;
+        let mut request = client.get(&self.url);
+        if let Some(meta) = meta {
+            if let Some(etag) = &meta.etag {
+                request = request.header(IF_NONE_MATCH, etag);
+            }
+            if let Some(last_modified) = &meta.last_modified {
+                request = request.header(IF_MODIFIED_SINCE, last_modified);
+            }
+        }
+
+        let response = request.send()?;
+        if response.status() == StatusCode::NOT_MODIFIED && meta.is_some() {
+            return Ok(None);
+        }
+        let response = response.error_for_status()?;
+
+        let header = |name| {
+            response
+                .headers()
+                .get(name)
+                .and_then(|v| v.to_str().ok())
+                .map(str::to_string)
+        };
+        let etag = header(ETAG);
+        let last_modified = header(LAST_MODIFIED);
+
+        Ok(Some(Download {
+            body: response.text()?,
+            etag,
+            last_modified,
+        }))
+    }
+
+    /// Loads the cache validators, if a cached copy of this URL exists
+    fn load_meta(&self) -> Option<CacheMeta> {
+        if !self.cache_path().is_file() {
+            return None;
+        }
+        let content = fs::read_to_string(self.meta_path()).ok()?;
+        let meta: CacheMeta = serde_json::from_str(&content)
+            .inspect_err(|e| log::warn!("Ignoring invalid remote rules cache metadata: {e}"))
+            .ok()?;
+        // A cached copy of a different URL must not be used
+        (meta.url == self.url).then_some(meta)
+    }
+
+    /// Writes the downloaded rules and their cache validators
+    fn store(&self, download: Download) -> Result<(), TookaError> {
+        fs::create_dir_all(&self.cache_dir)?;
+        fs::write(self.cache_path(), &download.body)?;
+        let meta = CacheMeta {
+            url: self.url.clone(),
+            etag: download.etag,
+            last_modified: download.last_modified,
+        };
+        fs::write(self.meta_path(), serde_json::to_string_pretty(&meta)?)?;
+        Ok(())
+    }
+
+    fn meta_path(&self) -> PathBuf {
+        self.cache_dir.join(CACHE_META_FILE_NAME)
+    }
+
+    fn fetched(&self, rules_file: RulesFile, status: FetchStatus) -> FetchedRules {
+        FetchedRules {
+            rules_file,
+            status,
+            path: self.cache_path(),
+        }
+    }
+}
+
+/// Returns true if `source` is an `http://` or `https://` URL rather than a path.
+pub fn is_url(source: &str) -> bool {
+    let lower = source.to_ascii_lowercase();
+    lower.starts_with("https://") || lower.starts_with("http://")
+}
+
+/// Downloads the YAML of rules shared at `url`, e.g. a gist.
+///
+/// Only HTTPS is used unless `allow_insecure` is set. The response must be a
+/// `200 OK` of at most [`MAX_SNIPPET_BYTES`]; the rules are not validated here.
+///
+/// # Errors
+/// Returns [`TookaError::FetchError`] if the URL is refused, the server cannot
+/// be reached or answers with another status, or the body is too large or not text.
+pub fn fetch_rule_snippet(url: &str, allow_insecure: bool) -> Result<String, TookaError> {
+    let fail = |reason: String| TookaError::FetchError(format!("{url}: {reason}"));
+    if !url.to_ascii_lowercase().starts_with("https://") {
+        if !is_url(url) {
+            return Err(fail("only http(s) URLs are supported".into()));
+        }
+        if !allow_insecure {
+            return Err(fail(
+                "refusing to download rules over plain HTTP; use an https:// URL or pass --insecure"
+                    .into(),
+            ));
+        }
+    }
+
+    let client = Client::builder().timeout(FETCH_TIMEOUT).build()?;
+    let response = client.get(url).send().map_err(|e| {
+        if e.is_timeout() {
+            fail(format!("no response within {}s", FETCH_TIMEOUT.as_secs()))
+        } else {
+            fail(format!("could not connect: {e}"))
+        }
+    })?;
+    if response.status() != StatusCode::OK {
+        return Err(fail(format!("server responded with {}", response.status())));
+    }
+    if response
+        .content_length()
+        .is_some_and(|length| length > MAX_SNIPPET_BYTES)
+    {
+        return Err(fail(format!("larger than {MAX_SNIPPET_BYTES} bytes")));
+    }
+
+    // The length header may be missing or wrong, so the body is limited as well
+    let mut body = Vec::new();
+    response
+        .take(MAX_SNIPPET_BYTES + 1)
+        .read_to_end(&mut body)
+        .map_err(|e| fail(format!("failed to read the response: {e}")))?;
+    if body.len() as u64 > MAX_SNIPPET_BYTES {
+        return Err(fail(format!("larger than {MAX_SNIPPET_BYTES} bytes")));
+    }
+    String::from_utf8(body).map_err(|_| fail("the response is not UTF-8 text".into()))
+}
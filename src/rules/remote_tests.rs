@@ -0,0 +1,159 @@
+use std::io::{BufRead, BufReader, Write};
+use std::net::TcpListener;
+use std::sync::{Arc, Mutex};
+use std::thread;
+
+use super::remote::{FetchStatus, MAX_SNIPPET_BYTES, RemoteRules, fetch_rule_snippet};
+use super::rules_file::RulesFile;
+use super::test_support::extension_rule;
+use tempfile::tempdir;
+
+const ETAG: &str = "\"v1\"";
+
+fn rules_body() -> String {
+    let rules_file = RulesFile {
+        rules: vec![extension_rule("remote_rule", &["txt"])],
+    };
+    serde_yaml::to_string(&rules_file).unwrap()
+}
+
+/// Serves `requests` requests, answering 304 when the client sends the current ETag.
+///
+/// Returns the server URL and the `If-None-Match` header seen for each request.
+fn serve(requests: usize, body: String) -> (String, Arc<Mutex<Vec<Option<String>>>>) {
+    let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+    let url = format!("http://{}/rules.yaml", listener.local_addr().unwrap());
+    let seen = Arc::new(Mutex::new(Vec::new()));
+    let seen_by_server = Arc::clone(&seen);
+
+    thread::spawn(move || {
+        for stream in listener.incoming().take(requests) {
+            let mut stream = stream.unwrap();
+            let mut reader = BufReader::new(stream.try_clone().unwrap());
+            let mut if_none_match = None;
+            loop {
+                let mut line = String::new();
+                reader.read_line(&mut line).unwrap();
+                let line = line.trim_end();
+                if line.is_empty() {
+                    break;
+                }
+                if let Some((name, value)) = line.split_once(':') {
+                    if name.eq_ignore_ascii_case("if-none-match") {
+                        if_none_match = Some(value.trim().to_string());
+                    }
+                }
+            }
+
+            let response = if if_none_match.as_deref() == Some(ETAG) {
+                format!("HTTP/1.1 304 Not Modified\r\nETag: {ETAG}\r\nConnection: close\r\n\r\n")
+            } else {
+                format!(
+                    "HTTP/1.1 200 OK\r\nETag: {ETAG}\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{body}",
+                    body.len()
+                )
+            };
+            seen_by_server.lock().unwrap().push(if_none_match);
+            stream.write_all(response.as_bytes()).unwrap();
+        }
+    });
+
+    (url, seen)
+}
+
+#[test]
+fn test_fetch_uses_etag_for_conditional_requests() {
+    let cache = tempdir().unwrap();
+    let (url, seen) = serve(2, rules_body());
+    let remote = RemoteRules::new(&url, cache.path());
+
+    let first = remote.fetch().unwrap();
+    assert_eq!(first.status, FetchStatus::Downloaded);
+    assert_eq!(first.rules_file.rules[0].id, "remote_rule");
+    assert!(remote.cache_path().exists());
+
+    let second = remote.fetch().unwrap();
+    assert_eq!(second.status, FetchStatus::NotModified);
+    assert_eq!(second.rules_file.rules.len(), 1);
+
+    assert_eq!(*seen.lock().unwrap(), vec![None, Some(ETAG.to_string())]);
+}
+
+#[test]
+fn test_fetch_falls_back_to_cache_when_offline() {
+    let cache = tempdir().unwrap();
+    let (url, _) = serve(1, rules_body());
+    let remote = RemoteRules::new(&url, cache.path());
+    remote.fetch().unwrap();
+
+    // The server only answers once, so the next request cannot connect
+    let offline = remote.fetch().unwrap();
+    assert_eq!(offline.status, FetchStatus::Cached);
+    assert_eq!(offline.rules_file.rules[0].id, "remote_rule");
+}
+
+#[test]
+fn test_fetch_without_cache_fails_when_offline() {
+    let cache = tempdir().unwrap();
+    let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+    let url = format!("http://{}/rules.yaml", listener.local_addr().unwrap());
+    drop(listener);
+
+    assert!(RemoteRules::new(&url, cache.path()).fetch().is_err());
+}
+
+#[test]
+fn test_fetch_rejects_invalid_rules() {
+    let cache = tempdir().unwrap();
+    let (url, _) = serve(1, "rules: [{ id: broken }]".to_string());
+
+    assert!(RemoteRules::new(&url, cache.path()).fetch().is_err());
+    assert!(!cache.path().join("remote_rules.yaml").exists());
+}
+
+/// Answers a single request with `status` and `body`, returning the URL served
+fn serve_once(status: &str, body: String) -> String {
+    let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+    let url = format!("http://{}/snippet.yaml", listener.local_addr().unwrap());
+    let status = status.to_string();
+
+    thread::spawn(move || {
+        let (mut stream, _) = listener.accept().unwrap();
+        let mut reader = BufReader::new(stream.try_clone().unwrap());
+        let mut line = String::new();
+        while reader.read_line(&mut line).unwrap() > 0 && line.trim_end() != "" {
+            line.clear();
+        }
+        let response = format!(
+            "HTTP/1.1 {status}\r\nContent-Length: {}\r\nConnection: close\r\n\r\n{body}",
+            body.len()
+        );
+        // The client may hang up early on a response it refuses
+        let _ = stream.write_all(response.as_bytes());
+    });
+
+    url
+}
+
+#[test]
+fn test_fetch_rule_snippet_requires_https() {
+    let err = fetch_rule_snippet("http://127.0.0.1:9/rule.yaml", false)
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("--insecure"), "{err}");
+    assert!(fetch_rule_snippet("ftp://example.com/rule.yaml", true).is_err());
+
+    let url = serve_once("200 OK", rules_body());
+    assert_eq!(fetch_rule_snippet(&url, true).unwrap(), rules_body());
+}
+
+#[test]
+fn test_fetch_rule_snippet_rejects_errors_and_large_bodies() {
+    let url = serve_once("404 Not Found", "missing".to_string());
+    let err = fetch_rule_snippet(&url, true).unwrap_err().to_string();
+    assert!(err.contains("404"), "{err}");
+
+    let url = serve_once("200 OK", "#".repeat(MAX_SNIPPET_BYTES as usize + 1));
+    let err = fetch_rule_snippet(&url, true).unwrap_err().to_string();
+    assert!(err.contains("larger than"), "{err}");
+}
@@ -2,10 +2,20 @@
 //! Includes rule conditions, actions, and validation logic ensuring rule correctness.
 //! Supports complex matching criteria such as filename patterns, metadata, size, dates, etc.
 
-use std::{fs, path::Path};
+use chrono::NaiveDate;
+use std::{
+    collections::HashMap,
+    fmt, fs,
+    path::{Path, PathBuf},
+    sync::Arc,
+};
 
 use crate::core::error::RuleValidationError;
+use crate::rules::category::expand_category;
+use crate::rules::units::{parse_duration, parse_size};
 use crate::utils::date_parser::parse_date;
+use crate::utils::path_template::{validate_destination, validate_path_template};
+use crate::utils::rename_pattern::validate_template;
 use serde::{Deserialize, Serialize};
 
 /// Represents a rule for file operations, specifying when it applies and what actions to take.
@@ -21,7 +31,19 @@ pub struct Rule {
     /// Optional detailed description.
     pub description: Option<String>,
     /// Rule priority (higher is more important).
+    ///
+    /// Rules are tried from the highest priority down; rules of equal priority
+    /// are tried in the order of the rules file (see the `tie_break` setting).
     pub priority: u32,
+    /// Maximum number of files the rule acts on in a single run; further matches are deferred.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub max_per_run: Option<usize>,
+    /// Whether a file this rule acted on is left alone by lower-priority rules.
+    ///
+    /// If false, the next matching rule also acts on the file, where the
+    /// previous rule's actions left it.
+    #[serde(default = "default_stop_on_match", skip_serializing_if = "is_true")]
+    pub stop_on_match: bool,
     /// Conditions to match files for this rule.
     pub when: Conditions,
     /// Actions to perform when conditions match.
@@ -29,7 +51,7 @@ pub struct Rule {
 }
 
 /// Contains matching criteria to determine when a rule applies.
-#[derive(Debug, Serialize, Deserialize, Clone)]
+#[derive(Debug, Serialize, Deserialize, Clone, Default)]
 #[serde(deny_unknown_fields)]
 pub struct Conditions {
     /// If true, matches if any condition is true (logical OR); otherwise all must match (AND).
@@ -37,6 +59,13 @@ pub struct Conditions {
     pub any: Option<bool>,
     /// Regex pattern to match against the filename.
     pub filename: Option<String>,
+    /// Shell glob to match against the filename, e.g. `IMG_*.jpg`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub filename_glob: Option<String>,
+    /// Regex searched for line by line in text files, up to the configured
+    /// `content_max_size_kb`; binary and larger files don't match.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub content_regex: Option<String>,
     /// List of file extensions to match.
     #[serde(default)]
     pub extensions: Option<Vec<String>>,
@@ -44,17 +73,342 @@ pub struct Conditions {
     pub path: Option<String>,
     /// File size range in KB.
     pub size_kb: Option<Range>,
+    /// Only match files larger than this many KB (1 KB = 1024 bytes).
+    ///
+    /// A rule can't also set `size_greater_than`; validation rejects rules setting both.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub size_greater_than_kb: Option<u64>,
+    /// Only match files larger than a size such as `500MB` or `1GB`.
+    ///
+    /// A rule can't also set `size_greater_than_kb`; validation rejects rules setting both.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub size_greater_than: Option<String>,
+    /// Measure symlinks themselves instead of their targets for `size_greater_than_kb`
+    /// and `size_greater_than`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub size_of_link: Option<bool>,
     /// MIME type filter.
     pub mime_type: Option<String>,
-    /// Date range when the file was created.
+    /// Built-in category of file types, e.g. `image` or `document` (see `tooka categories`).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub category: Option<String>,
+    /// Date range when the file was created, also accepted as `created_between`.
+    #[serde(alias = "created_between")]
     pub created_date: Option<DateRange>,
     /// Date range when the file was modified.
     pub modified_date: Option<DateRange>,
-    /// Whether the file is a symbolic link.
+    /// Whether the file is a symbolic link, detected without following it.
+    /// On Windows only true symlinks count; junctions and `.lnk` shortcuts do not.
     pub is_symlink: Option<bool>,
+    /// User name (or numeric uid) owning the file; Unix only, ignored elsewhere.
+    ///
+    /// Names are looked up in `/etc/passwd`, so users from LDAP or other NSS
+    /// sources must be given by uid.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub owner: Option<String>,
     /// Additional metadata fields for matching.
     #[serde(default)]
     pub metadata: Option<Vec<MetadataField>>,
+    /// Whether the file is empty or a truncated/undecodable media file.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub corrupt: Option<bool>,
+    /// Whether the file's extension is on the configured extension allowlist.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub in_allowlist: Option<bool>,
+    /// Whether the file's extension is on the configured extension denylist.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub in_denylist: Option<bool>,
+    /// Newline-separated list file the file's name or path must appear in.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub in_list: Option<ListFile>,
+    /// Duration and resolution of MP4/MOV video files.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub video: Option<VideoConditions>,
+    /// Weekday or day of the month of the file's created or modified time.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub day: Option<DayConditions>,
+    /// Category label printed by an external classifier program.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub classify_with: Option<ClassifyCondition>,
+    /// Whether the file has an EXIF capture date (`DateTimeOriginal`).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub exif_date: Option<bool>,
+    /// Only match files last modified more than this many days ago; 0 means no age filter.
+    ///
+    /// A rule can't also set `older_than`; validation rejects rules setting both.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub older_than_days: Option<u32>,
+    /// Only match files last modified longer ago than a duration such as `30d`, `2w`, `6mo` or `1y`.
+    ///
+    /// A rule can't also set `older_than_days`; validation rejects rules setting both.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub older_than: Option<String>,
+    /// Only match if at least this many files of the run match the other conditions.
+    ///
+    /// Evaluated once per run rather than per file, see [`crate::core::sorter::sort_files`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub min_count: Option<usize>,
+    /// Nested condition groups of which at least one must match (logical OR).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub any_of: Option<Vec<Conditions>>,
+    /// Nested condition groups which must all match (logical AND).
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub all_of: Option<Vec<Conditions>>,
+    /// Nested condition group which must not match, e.g. to exclude screenshots from images.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub not: Option<Box<Conditions>>,
+}
+
+/// Deepest nesting of `any_of`/`all_of`/`not` condition groups allowed in a rule
+pub const MAX_CONDITION_DEPTH: usize = 8;
+
+impl Conditions {
+    /// Returns the condition groups nested directly in `any_of`, `all_of` and `not`.
+    pub fn nested(&self) -> impl Iterator<Item = &Conditions> {
+        self.any_of
+            .iter()
+            .chain(&self.all_of)
+            .flatten()
+            .chain(self.not.as_deref())
+    }
+
+    /// Returns true if any condition other than `not` is set, so the
+    /// conditions don't match every file that isn't excluded.
+    pub fn has_positive_criteria(&self) -> bool {
+        !self.positive_summaries().is_empty()
+    }
+
+    /// Returns how deeply condition groups are nested, 0 if they are not.
+    pub fn nesting_depth(&self) -> usize {
+        self.nested()
+            .map(|group| group.nesting_depth() + 1)
+            .max()
+            .unwrap_or(0)
+    }
+
+    /// Returns a short, human-readable summary of the conditions, e.g.
+    /// `extensions: jpg, png and older_than_days: 30`.
+    pub fn summary(&self) -> String {
+        let mut parts = self.positive_summaries();
+        if let Some(group) = &self.not {
+            parts.push(format!("not: ({})", group.summary()));
+        }
+
+        if parts.is_empty() {
+            return "any file".to_string();
+        }
+        let separator = if self.any == Some(true) {
+            " or "
+        } else {
+            " and "
+        };
+        parts.join(separator)
+    }
+
+    /// Returns the summaries of all set conditions except `not`
+    fn positive_summaries(&self) -> Vec<String> {
+        let mut parts = Vec::new();
+        if let Some(pattern) = &self.filename {
+            parts.push(format!("filename: {pattern}"));
+        }
+        if let Some(pattern) = &self.filename_glob {
+            parts.push(format!("filename_glob: {pattern}"));
+        }
+        if let Some(extensions) = &self.extensions {
+            parts.push(format!("extensions: {}", extensions.join(", ")));
+        }
+        if let Some(pattern) = &self.path {
+            parts.push(format!("path: {pattern}"));
+        }
+        if let Some(mime_type) = &self.mime_type {
+            parts.push(format!("mime_type: {mime_type}"));
+        }
+        if let Some(category) = &self.category {
+            parts.push(format!("category: {category}"));
+        }
+        if let Some(kb) = self.size_greater_than_kb {
+            parts.push(format!("size_greater_than_kb: {kb}"));
+        }
+        if let Some(size) = &self.size_greater_than {
+            parts.push(format!("size_greater_than: {size}"));
+        }
+        if let Some(days) = self.older_than_days {
+            parts.push(format!("older_than_days: {days}"));
+        }
+        if let Some(age) = &self.older_than {
+            parts.push(format!("older_than: {age}"));
+        }
+        // Conditions with structured values are only named
+        parts.extend(
+            [
+                ("content_regex", self.content_regex.is_some()),
+                ("size_kb", self.size_kb.is_some()),
+                ("created_date", self.created_date.is_some()),
+                ("modified_date", self.modified_date.is_some()),
+                ("is_symlink", self.is_symlink.is_some()),
+                ("owner", self.owner.is_some()),
+                ("metadata", self.metadata.is_some()),
+                ("corrupt", self.corrupt.is_some()),
+                ("in_allowlist", self.in_allowlist.is_some()),
+                ("in_denylist", self.in_denylist.is_some()),
+                ("in_list", self.in_list.is_some()),
+                ("video", self.video.is_some()),
+                ("day", self.day.is_some()),
+                ("classify_with", self.classify_with.is_some()),
+                ("exif_date", self.exif_date.is_some()),
+                ("min_count", self.min_count.is_some()),
+            ]
+            .into_iter()
+            .filter_map(|(name, set)| set.then(|| name.to_string())),
+        );
+        for (name, groups) in [("any_of", &self.any_of), ("all_of", &self.all_of)] {
+            if let Some(groups) = groups {
+                let groups: Vec<String> = groups.iter().map(Conditions::summary).collect();
+                parts.push(format!("{name}: [{}]", groups.join(" | ")));
+            }
+        }
+        parts
+    }
+}
+
+/// Represents a list file used to match files by name or path
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct ListFile {
+    /// Path to the list file, one entry per line (`#` starts a comment); may
+    /// start with `~` and contain `$VAR`s, and is read again when it changes
+    pub file: String,
+    /// Whether entries are compared with the file's basename or full path
+    #[serde(default)]
+    pub match_by: ListMatchBy,
+}
+
+/// Part of a file's path compared against list file entries
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum ListMatchBy {
+    /// Compare with the file name, e.g. `report.pdf`
+    #[default]
+    Basename,
+    /// Compare with the full path, e.g. `/home/user/Downloads/report.pdf`
+    Path,
+}
+
+/// Video properties to match, each as an inclusive range
+#[derive(Debug, Serialize, Deserialize, Clone, Default)]
+#[serde(deny_unknown_fields)]
+pub struct VideoConditions {
+    /// Duration in seconds
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub duration_secs: Option<Range>,
+    /// Picture width in pixels
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub width: Option<Range>,
+    /// Picture height in pixels (e.g. at least 2160 for 4K)
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub height: Option<Range>,
+}
+
+/// External program classifying files, and the label to match.
+///
+/// The program is run with `args` followed by the file path and must print the
+/// file's label on the first line of its output. Results are cached per file
+/// for the rest of the run.
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct ClassifyCondition {
+    /// Program to run
+    pub command: String,
+    /// Arguments passed before the file path
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub args: Vec<String>,
+    /// Regex the whole label must match; a plain word matches that label exactly
+    pub label: String,
+    /// Seconds after which the program is killed and the file does not match
+    #[serde(default = "default_classify_timeout")]
+    pub timeout_secs: u64,
+}
+
+fn default_classify_timeout() -> u64 {
+    10
+}
+
+fn default_stop_on_match() -> bool {
+    true
+}
+
+fn default_preserve_metadata() -> bool {
+    true
+}
+
+fn is_true(value: &bool) -> bool {
+    *value
+}
+
+/// Calendar days to match a file's timestamp against.
+///
+/// The timestamp is converted to the local timezone before the weekday and day
+/// of the month are taken, so a file modified late on Friday in local time is a
+/// Friday file even if it is already Saturday in UTC. When both lists are given,
+/// the timestamp must match both.
+#[derive(Debug, Serialize, Deserialize, Clone, Default)]
+#[serde(deny_unknown_fields)]
+pub struct DayConditions {
+    /// Which timestamp to check
+    #[serde(default)]
+    pub field: TimeField,
+    /// Weekdays to match, e.g. `[sat, sun]`
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub weekdays: Option<Vec<Weekday>>,
+    /// Days of the month to match (1-31); negative values count from the end
+    /// of the month, so `-1` is the last day
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub days_of_month: Option<Vec<i32>>,
+}
+
+/// File timestamp used by time-based conditions
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum TimeField {
+    /// Creation time; files on filesystems without it never match
+    #[default]
+    Created,
+    /// Last modification time
+    Modified,
+}
+
+/// Day of the week
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum Weekday {
+    #[serde(alias = "monday")]
+    Mon,
+    #[serde(alias = "tuesday")]
+    Tue,
+    #[serde(alias = "wednesday")]
+    Wed,
+    #[serde(alias = "thursday")]
+    Thu,
+    #[serde(alias = "friday")]
+    Fri,
+    #[serde(alias = "saturday")]
+    Sat,
+    #[serde(alias = "sunday")]
+    Sun,
+}
+
+impl From<chrono::Weekday> for Weekday {
+    fn from(day: chrono::Weekday) -> Self {
+        match day {
+            chrono::Weekday::Mon => Self::Mon,
+            chrono::Weekday::Tue => Self::Tue,
+            chrono::Weekday::Wed => Self::Wed,
+            chrono::Weekday::Thu => Self::Thu,
+            chrono::Weekday::Fri => Self::Fri,
+            chrono::Weekday::Sat => Self::Sat,
+            chrono::Weekday::Sun => Self::Sun,
+        }
+    }
 }
 
 /// Represents a single metadata field to match against
@@ -67,13 +421,13 @@ pub struct MetadataField {
     pub value: Option<String>,
 }
 
-/// Represents a data range for matching files
+/// Represents a numeric range for matching files, e.g. a size in KB
 #[derive(Debug, Serialize, Deserialize, Clone)]
 #[serde(deny_unknown_fields)]
 pub struct Range {
-    /// Minimum size in KB (inclusive)
+    /// Minimum value (inclusive)
     pub min: Option<u64>,
-    /// Maximum size in KB (inclusive)
+    /// Maximum value (inclusive)
     pub max: Option<u64>,
 }
 
@@ -81,12 +435,39 @@ pub struct Range {
 #[derive(Debug, Serialize, Deserialize, Clone)]
 #[serde(deny_unknown_fields)]
 pub struct DateRange {
-    /// Optional start date in RFC3339 format (inclusive)
+    /// Optional start date in RFC3339 format (inclusive); empty means no lower bound
     pub from: Option<String>,
-    /// Optional end date in RFC3339 format (inclusive)
+    /// Optional end date in RFC3339 format (inclusive); empty means no upper bound
     pub to: Option<String>,
 }
 
+impl DateRange {
+    /// Parses the bounds of the range into dates, where `None` is an open bound.
+    ///
+    /// Bounds may be anything [`parse_date`] accepts, e.g. `2024-01-31` or `-7d`.
+    ///
+    /// # Errors
+    /// Returns a message naming the malformed bound.
+    pub fn parse(&self) -> Result<(Option<NaiveDate>, Option<NaiveDate>), String> {
+        let parse_bound = |label: &str, bound: &Option<String>| {
+            bound
+                .as_deref()
+                .map(str::trim)
+                .filter(|value| !value.is_empty())
+                .map(|value| {
+                    parse_date(value)
+                        .map(|date| date.date_naive())
+                        .map_err(|e| format!("Invalid '{label}' date: {e}"))
+                })
+                .transpose()
+        };
+        Ok((
+            parse_bound("from", &self.from)?,
+            parse_bound("to", &self.to)?,
+        ))
+    }
+}
+
 /// Represents an action to perform when a rule matches
 #[derive(Debug, Serialize, Deserialize, Clone)]
 #[serde(tag = "action", rename_all = "lowercase")]
@@ -95,12 +476,26 @@ pub enum Action {
     Move(MoveAction),
     /// Copy the file to a new location
     Copy(CopyAction),
+    /// Create a symbolic link to the file in another folder, leaving the file where it is
+    Symlink(SymlinkAction),
     /// Rename the file to a new name
     Rename(RenameAction),
     /// Delete the file, optionally moving it to trash
     Delete(DeleteAction),
     /// Executes a CLI command or script
     Execute(ExecuteAction),
+    /// Move the file to a quarantine folder, to be purged after it expires
+    Quarantine(QuarantineAction),
+    /// Add the file to a zip or tar.gz archive
+    Compress(CompressAction),
+    /// Extract a zip or tar.gz archive into a folder
+    Extract(ExtractAction),
+    /// Keep one of a group of identical files and move or delete the others
+    Dedupe(DedupeAction),
+    /// Move the file to the trash, like `delete` with `trash: true`
+    Trash,
+    /// Record the file in the index of the folder it is in
+    Index,
     /// Skip the file without any action
     Skip,
 }
@@ -114,6 +509,41 @@ pub struct MoveAction {
     /// If true, preserves the directory structure relative to the source path
     #[serde(default)]
     pub preserve_structure: bool,
+    /// Octal permission mode for destination directories created by the action (e.g. "0700")
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dir_mode: Option<String>,
+    /// Sub-path below the destination, rendered per file from date and name tokens
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub path_template: Option<PathTemplate>,
+    /// What to do when the destination already holds a file of the same name
+    #[serde(default)]
+    pub on_conflict: ConflictStrategy,
+}
+
+/// How a move resolves a destination that is already taken
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum ConflictStrategy {
+    /// Leave the file where it is
+    Skip,
+    /// Replace the existing file
+    Overwrite,
+    /// Append ` (1)`, ` (2)`, ... to the file name until it is free
+    #[default]
+    Rename,
+    /// Fail the file's actions with an error
+    Error,
+}
+
+impl fmt::Display for ConflictStrategy {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Self::Skip => "skip",
+            Self::Overwrite => "overwrite",
+            Self::Rename => "rename",
+            Self::Error => "error",
+        })
+    }
 }
 
 /// Represents a copy action, specifying the destination path and whether to preserve structure
@@ -125,6 +555,58 @@ pub struct CopyAction {
     /// If true, preserves the directory structure relative to the source path
     #[serde(default)]
     pub preserve_structure: bool,
+    /// Octal permission mode for destination directories created by the action (e.g. "0700")
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dir_mode: Option<String>,
+    /// Sub-path below the destination, rendered per file from date and name tokens
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub path_template: Option<PathTemplate>,
+    /// If true, the copy keeps the file's timestamps and permissions, and its owner when running as root
+    #[serde(default = "default_preserve_metadata", skip_serializing_if = "is_true")]
+    pub preserve_metadata: bool,
+}
+
+/// Represents a symlink action, specifying where the link to the file is created
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct SymlinkAction {
+    /// Destination path where the link should be created
+    pub to: String,
+    /// If true, preserves the directory structure relative to the source path
+    #[serde(default)]
+    pub preserve_structure: bool,
+    /// Octal permission mode for destination directories created by the action (e.g. "0700")
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dir_mode: Option<String>,
+    /// Sub-path below the destination, rendered per file from date and name tokens
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub path_template: Option<PathTemplate>,
+    /// If true, the link points at the file by a path relative to the link's folder,
+    /// so both can be moved together; otherwise by its absolute path
+    #[serde(default)]
+    pub relative: bool,
+}
+
+/// Sub-path a move, copy or symlink action places the file at, e.g. `{year}/{month}/{filename}`
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct PathTemplate {
+    /// Date the `{year}`, `{month}` and `{day}` tokens are taken from
+    #[serde(default)]
+    pub source: PathTemplateSource,
+    /// Path with tokens, relative to the action's destination
+    pub format: String,
+}
+
+/// Date source of a path template
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum PathTemplateSource {
+    /// Last modification time of the file
+    #[default]
+    Mtime,
+    /// EXIF capture date, falling back to the modification time
+    ExifDate,
 }
 
 /// Represents a rename action, specifying the new name for the file
@@ -133,15 +615,128 @@ pub struct CopyAction {
 pub struct RenameAction {
     /// New name for the file, can include metadata placeholders
     pub to: String,
+    /// Minimum number of digits of the `{{counter}}` placeholder (default 3)
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub counter_width: Option<usize>,
 }
 
 /// Represents a delete action, specifying whether to move the file to trash
 #[derive(Debug, Serialize, Deserialize, Clone)]
 #[serde(deny_unknown_fields)]
 pub struct DeleteAction {
-    /// If true, moves the file to the trash instead of permanently deleting it
+    /// If true, moves the file to the system trash instead of permanently
+    /// deleting it, or to `.tooka-trash` in the config folder if the system
+    /// trash is unavailable
     #[serde(default)]
     pub trash: bool,
+    /// If true, overwrites the file with random bytes before deleting it
+    #[serde(default)]
+    pub secure: bool,
+    /// Number of overwrite passes of a secure delete (default 1)
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub passes: Option<u32>,
+}
+
+/// Represents a quarantine action, specifying how long the file is kept before it may be purged
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct QuarantineAction {
+    /// Number of days the file is kept in quarantine
+    pub days: u32,
+    /// Quarantine folder; defaults to the configured `quarantine_folder`
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub to: Option<String>,
+}
+
+/// Represents a compress action, specifying the archive the file is added to
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct CompressAction {
+    /// Path of the archive; created if it does not exist, otherwise the file is appended to it
+    pub target: String,
+    /// Format of the archive (default zip)
+    #[serde(default)]
+    pub format: ArchiveFormat,
+    /// If true, removes the file from the source once it is in the archive
+    #[serde(default)]
+    pub remove_source: bool,
+}
+
+/// Represents an extract action, specifying the folder an archive is extracted into
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct ExtractAction {
+    /// Folder the archive is extracted into, keeping its directory structure
+    #[serde(alias = "destination")]
+    pub to: String,
+    /// If true, removes the archive once it has been extracted
+    #[serde(default)]
+    pub remove_archive: bool,
+}
+
+/// Represents a dedupe action, specifying which of a group of identical files is kept
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(deny_unknown_fields)]
+pub struct DedupeAction {
+    /// Which file of a group of identical files is kept
+    #[serde(default)]
+    pub keep: KeepPolicy,
+    /// Folder the other files are moved to; they are deleted if neither this
+    /// nor `replace_with` is set
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub to: Option<String>,
+    /// Replace the other files with links to the kept file, keeping their names
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub replace_with: Option<LinkKind>,
+    /// Duplicates among the files the rule matches, with the file kept in their place;
+    /// resolved before sorting
+    #[serde(skip)]
+    pub duplicates: Arc<HashMap<PathBuf, PathBuf>>,
+}
+
+/// Which file of a group of identical files a dedupe action keeps
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "snake_case")]
+pub enum KeepPolicy {
+    /// The most recently modified file
+    Newest,
+    /// The least recently modified file
+    #[default]
+    Oldest,
+    /// The file with the shortest path
+    ShortestPath,
+}
+
+/// Kind of link a dedupe action replaces duplicates with
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum LinkKind {
+    /// A hard link, falling back to a symlink across filesystems
+    Hardlink,
+    /// A symbolic link to the absolute path of the kept file
+    Symlink,
+}
+
+/// Format of the archive written by a compress action
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq, Eq)]
+pub enum ArchiveFormat {
+    /// A zip archive with deflate compression
+    #[default]
+    #[serde(rename = "zip")]
+    Zip,
+    /// A gzip-compressed tar archive
+    #[serde(rename = "tar.gz")]
+    TarGz,
+}
+
+impl ArchiveFormat {
+    /// Returns the file extension of archives in this format.
+    pub fn extension(self) -> &'static str {
+        match self {
+            Self::Zip => "zip",
+            Self::TarGz => "tar.gz",
+        }
+    }
 }
 
 /// Represents an execute action, specifying the command to run and its arguments
@@ -167,24 +762,20 @@ impl Rule {
         let content = fs::read_to_string(path)
             .map_err(|e| RuleValidationError::InvalidFormat(format!("Failed to read file: {e}")))?;
 
-        if content.trim_start().starts_with("rules:") {
-            // Multiple rules
-            let parsed: Result<RulesWrapper, _> = serde_yaml::from_str(&content);
-            match parsed {
-                Ok(wrapper) => Ok(wrapper.rules),
-                Err(e) => Err(RuleValidationError::InvalidFormat(format!(
-                    "YAML parsing failed: {e}"
-                ))),
-            }
+        Self::parse_all(&content)
+            .map_err(|e| RuleValidationError::InvalidFormat(format!("YAML parsing failed: {e}")))
+    }
+
+    /// Parses either a single rule or multiple rules under a `rules:` key.
+    pub(crate) fn parse_all(content: &str) -> Result<Vec<Self>, serde_yaml::Error> {
+        // Documents may start with comments, so look for the key in the parsed value as well
+        let is_multi = content.trim_start().starts_with("rules:")
+            || serde_yaml::from_str::<serde_yaml::Value>(content)
+                .is_ok_and(|value| value.get("rules").is_some());
+        if is_multi {
+            serde_yaml::from_str::<RulesWrapper>(content).map(|wrapper| wrapper.rules)
         } else {
-            // Single rule
-            let rule: Result<Rule, _> = serde_yaml::from_str(&content);
-            match rule {
-                Ok(r) => Ok(vec![r]),
-                Err(e) => Err(RuleValidationError::InvalidFormat(format!(
-                    "YAML parsing failed: {e}"
-                ))),
-            }
+            serde_yaml::from_str::<Rule>(content).map(|rule| vec![rule])
         }
     }
     /// Validates the rule, with an optional `deep` check for logic and content consistency.
@@ -208,7 +799,94 @@ impl Rule {
             return Err(RuleValidationError::NoActions(self.id.clone()));
         }
 
-        if let Some(metadata) = &self.when.metadata {
+        if self.max_per_run == Some(0) {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                "max_per_run must be at least 1".into(),
+            ));
+        }
+
+        self.check_patterns()?;
+        self.check_nesting()?;
+
+        if self.when.min_count == Some(0) {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                "min_count must be at least 1".into(),
+            ));
+        }
+
+        self.check_condition_values(&self.when)?;
+
+        if let Some(value) = self.action_validation() {
+            return value;
+        }
+
+        Ok(())
+    }
+
+    /// Checks that the filename regex and the globs of the rule compile, and
+    /// that its categories exist.
+    ///
+    /// Cheap enough to run whenever rules are loaded for sorting, so a broken
+    /// pattern is reported by rule ID rather than failing on the first file.
+    pub fn check_patterns(&self) -> Result<(), RuleValidationError> {
+        self.check_condition_patterns(&self.when)
+    }
+
+    /// Checks the patterns of a condition group and all groups nested in it
+    fn check_condition_patterns(&self, conditions: &Conditions) -> Result<(), RuleValidationError> {
+        for group in conditions.nested() {
+            self.check_condition_patterns(group)?;
+        }
+        for (label, pattern) in [
+            ("filename", &conditions.filename),
+            ("content_regex", &conditions.content_regex),
+        ] {
+            if let Some(Err(e)) = pattern.as_deref().map(regex::Regex::new) {
+                let pattern = pattern.as_deref().unwrap_or_default();
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    format!("Invalid {label} regex '{pattern}': {e}"),
+                ));
+            }
+        }
+        for (label, pattern) in [
+            ("filename_glob", &conditions.filename_glob),
+            ("path", &conditions.path),
+        ] {
+            if let Some(Err(e)) = pattern.as_deref().map(glob::Pattern::new) {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    format!("Invalid {label} glob: {e}"),
+                ));
+            }
+        }
+        if let Some(Err(e)) = conditions.category.as_deref().map(expand_category) {
+            return Err(RuleValidationError::InvalidCondition(self.id.clone(), e));
+        }
+        if let Some(Err(e)) = conditions.size_greater_than.as_deref().map(parse_size) {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                format!("Invalid size_greater_than: {e}"),
+            ));
+        }
+        if let Some(Err(e)) = conditions.older_than.as_deref().map(parse_duration) {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                format!("Invalid older_than: {e}"),
+            ));
+        }
+        Ok(())
+    }
+
+    /// Checks the values of a condition group and all groups nested in it,
+    /// such as ranges, day lists and the classifier command
+    fn check_condition_values(&self, conditions: &Conditions) -> Result<(), RuleValidationError> {
+        for group in conditions.nested() {
+            self.check_condition_values(group)?;
+        }
+        if let Some(metadata) = &conditions.metadata {
             let mut keys = std::collections::HashSet::new();
             for field in metadata {
                 if !keys.insert(&field.key) {
@@ -220,7 +898,16 @@ impl Rule {
             }
         }
 
-        if let Some(size) = &self.when.size_kb {
+        if let Some(list) = &conditions.in_list {
+            if list.file.trim().is_empty() {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    "in_list requires a list file path".into(),
+                ));
+            }
+        }
+
+        if let Some(size) = &conditions.size_kb {
             if let (Some(min), Some(max)) = (size.min, size.max) {
                 if min > max {
                     return Err(RuleValidationError::InvalidCondition(
@@ -231,34 +918,154 @@ impl Rule {
             }
         }
 
+        for (label, both_set) in [
+            (
+                "size_greater_than and size_greater_than_kb",
+                conditions.size_greater_than.is_some() && conditions.size_greater_than_kb.is_some(),
+            ),
+            (
+                "older_than and older_than_days",
+                conditions.older_than.is_some() && conditions.older_than_days.is_some(),
+            ),
+        ] {
+            if both_set {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    format!("{label} can't be combined; use one of them"),
+                ));
+            }
+        }
+
+        if let Some(video) = &conditions.video {
+            for (label, range) in [
+                ("duration_secs", &video.duration_secs),
+                ("width", &video.width),
+                ("height", &video.height),
+            ] {
+                if let Some(Range {
+                    min: Some(min),
+                    max: Some(max),
+                }) = range
+                {
+                    if min > max {
+                        return Err(RuleValidationError::InvalidCondition(
+                            self.id.clone(),
+                            format!("Invalid video {label} range: min > max"),
+                        ));
+                    }
+                }
+            }
+        }
+
+        if let Some(classify) = &conditions.classify_with {
+            if classify.command.trim().is_empty() {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    "classify_with requires a command".into(),
+                ));
+            }
+            if classify.timeout_secs == 0 {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    "classify_with timeout_secs must be at least 1".into(),
+                ));
+            }
+            if let Err(e) = regex::Regex::new(&classify.label) {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    format!("Invalid classify_with label pattern: {e}"),
+                ));
+            }
+        }
+
+        if let Some(day) = &conditions.day {
+            if day.weekdays.as_ref().is_some_and(Vec::is_empty)
+                || day.days_of_month.as_ref().is_some_and(Vec::is_empty)
+            {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    "day lists must not be empty".into(),
+                ));
+            }
+            if let Some(invalid) = day
+                .days_of_month
+                .iter()
+                .flatten()
+                .find(|d| **d == 0 || d.abs() > 31)
+            {
+                return Err(RuleValidationError::InvalidCondition(
+                    self.id.clone(),
+                    format!("Invalid day of month {invalid}: expected 1 to 31 or -1 to -31"),
+                ));
+            }
+        }
+
         for (label, date_range) in [
-            ("created_date", &self.when.created_date),
-            ("modified_date", &self.when.modified_date),
+            ("created_date", &conditions.created_date),
+            ("modified_date", &conditions.modified_date),
         ] {
             if let Some(range) = date_range {
-                if let Some(from) = &range.from {
-                    if let Err(e) = parse_date(from) {
+                match range.parse() {
+                    Err(e) => {
                         return Err(RuleValidationError::InvalidCondition(
                             self.id.clone(),
-                            format!("Invalid {label} 'from' date: {e}"),
+                            format!("Invalid {label} range: {e}"),
                         ));
                     }
-                }
-                if let Some(to) = &range.to {
-                    if let Err(e) = parse_date(to) {
+                    Ok((Some(from), Some(to))) if from > to => {
                         return Err(RuleValidationError::InvalidCondition(
                             self.id.clone(),
-                            format!("Invalid {label} 'to' date: {e}"),
+                            format!("Invalid {label} range: 'from' ({from}) is after 'to' ({to})"),
                         ));
                     }
+                    Ok(_) => {}
                 }
             }
         }
+        Ok(())
+    }
 
-        if let Some(value) = self.action_validation() {
-            return value;
+    /// Checks that nested condition groups are neither empty nor too deep, and
+    /// carry no per-run conditions, and that the rule doesn't only exclude files
+    fn check_nesting(&self) -> Result<(), RuleValidationError> {
+        if self.when.not.is_some() && !self.when.has_positive_criteria() {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                "not requires other conditions next to it; on its own it matches every other file in the folder".into(),
+            ));
+        }
+        let depth = self.when.nesting_depth();
+        if depth > MAX_CONDITION_DEPTH {
+            return Err(RuleValidationError::InvalidCondition(
+                self.id.clone(),
+                format!(
+                    "any_of/all_of/not are nested {depth} levels deep, at most {MAX_CONDITION_DEPTH} are allowed"
+                ),
+            ));
+        }
+        let mut pending: Vec<&Conditions> = vec![&self.when];
+        while let Some(conditions) = pending.pop() {
+            for (label, groups) in [
+                ("any_of", &conditions.any_of),
+                ("all_of", &conditions.all_of),
+            ] {
+                if groups.as_ref().is_some_and(Vec::is_empty) {
+                    return Err(RuleValidationError::InvalidCondition(
+                        self.id.clone(),
+                        format!("{label} requires at least one condition group"),
+                    ));
+                }
+            }
+            for group in conditions.nested() {
+                if group.min_count.is_some() {
+                    return Err(RuleValidationError::InvalidCondition(
+                        self.id.clone(),
+                        "min_count is only allowed at the top level of a rule".into(),
+                    ));
+                }
+                pending.push(group);
+            }
         }
-
         Ok(())
     }
 
@@ -266,23 +1073,64 @@ impl Rule {
         // Action validation
         for (i, action) in self.then.iter().enumerate() {
             match action {
-                Action::Move(inner) => {
-                    if inner.to.trim().is_empty() {
+                Action::Move(MoveAction {
+                    to,
+                    preserve_structure,
+                    dir_mode,
+                    path_template,
+                    ..
+                })
+                | Action::Copy(CopyAction {
+                    to,
+                    preserve_structure,
+                    dir_mode,
+                    path_template,
+                    ..
+                })
+                | Action::Symlink(SymlinkAction {
+                    to,
+                    preserve_structure,
+                    dir_mode,
+                    path_template,
+                    ..
+                }) => {
+                    if to.trim().is_empty() {
                         return Some(Err(RuleValidationError::InvalidAction(
                             self.id.clone(),
                             i,
                             "Missing destination path".into(),
                         )));
                     }
-                }
-                Action::Copy(inner) => {
-                    if inner.to.trim().is_empty() {
+                    if let Err(e) = validate_destination(to) {
                         return Some(Err(RuleValidationError::InvalidAction(
                             self.id.clone(),
                             i,
-                            "Missing destination path".into(),
+                            e,
+                        )));
+                    }
+                    if let Some(Err(e)) = dir_mode.as_deref().map(parse_dir_mode) {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            e,
                         )));
                     }
+                    if let Some(template) = path_template {
+                        if *preserve_structure {
+                            return Some(Err(RuleValidationError::InvalidAction(
+                                self.id.clone(),
+                                i,
+                                "preserve_structure cannot be combined with path_template".into(),
+                            )));
+                        }
+                        if let Err(e) = validate_path_template(&template.format) {
+                            return Some(Err(RuleValidationError::InvalidAction(
+                                self.id.clone(),
+                                i,
+                                e,
+                            )));
+                        }
+                    }
                 }
                 Action::Rename(inner) => {
                     if inner.to.trim().is_empty() {
@@ -292,11 +1140,39 @@ impl Rule {
                             "Missing rename target path".into(),
                         )));
                     }
+                    if let Err(e) = validate_template(&inner.to) {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            e,
+                        )));
+                    }
+                    if inner.counter_width == Some(0) {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "counter_width must be at least 1".into(),
+                        )));
+                    }
                 }
                 Action::Delete(inner) => {
-                    if inner.trash && !self.when.is_symlink.unwrap_or(false) {
+                    if inner.secure && inner.trash {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "A delete action cannot be both secure and moved to trash".into(),
+                        )));
+                    }
+                    if inner.passes == Some(0) {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "passes must be at least 1".into(),
+                        )));
+                    }
+                    if inner.passes.is_some() && !inner.secure {
                         log::warn!(
-                            "Rule {}: Delete action with trash enabled but file is not marked as symlink",
+                            "Rule {}: Delete action sets passes but is not secure; the file will not be overwritten",
                             self.id
                         );
                     }
@@ -310,13 +1186,82 @@ impl Rule {
                         )));
                     }
                 }
-                Action::Skip => {}
+                Action::Quarantine(inner) => {
+                    if inner.days == 0 {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "Quarantine days must be at least 1".into(),
+                        )));
+                    }
+                }
+                Action::Compress(inner) => {
+                    if inner.target.trim().is_empty() {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "Missing target archive for compress action".into(),
+                        )));
+                    }
+                    let extension = inner.format.extension();
+                    if !inner.target.ends_with(&format!(".{extension}")) {
+                        log::warn!(
+                            "Rule {}: Compress action writes a {} archive to '{}', which does not end in .{}",
+                            self.id,
+                            extension,
+                            inner.target,
+                            extension
+                        );
+                    }
+                }
+                Action::Extract(inner) => {
+                    if inner.to.trim().is_empty() {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "Missing destination for extract action".into(),
+                        )));
+                    }
+                }
+                Action::Dedupe(inner) => {
+                    if inner.to.as_ref().is_some_and(|to| to.trim().is_empty()) {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "Dedupe destination must not be empty".into(),
+                        )));
+                    }
+                    if inner.to.is_some() && inner.replace_with.is_some() {
+                        return Some(Err(RuleValidationError::InvalidAction(
+                            self.id.clone(),
+                            i,
+                            "Dedupe cannot both move duplicates with to and replace them with links"
+                                .into(),
+                        )));
+                    }
+                }
+                Action::Trash | Action::Index | Action::Skip => {}
             }
         }
         None
     }
 }
 
+/// Parses an octal directory permission mode such as `"0700"`, `"755"` or `"0o750"`.
+///
+/// Returns an error message if the string is not a valid octal mode up to `0o7777`.
+pub fn parse_dir_mode(mode: &str) -> Result<u32, String> {
+    let trimmed = mode.trim();
+    let digits = trimmed.strip_prefix("0o").unwrap_or(trimmed);
+    if digits.is_empty() || digits.len() > 4 || !digits.bytes().all(|b| (b'0'..=b'7').contains(&b))
+    {
+        return Err(format!(
+            "Invalid dir_mode '{mode}': expected an octal mode like 0755"
+        ));
+    }
+    u32::from_str_radix(digits, 8).map_err(|e| format!("Invalid dir_mode '{mode}': {e}"))
+}
+
 /// Wrapper for multi-rule YAML files
 #[derive(Debug, Serialize, Deserialize)]
 struct RulesWrapper {
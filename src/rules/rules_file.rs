@@ -1,9 +1,15 @@
 //! Provides the `RulesFile` struct representing the `rules.yaml` configuration file
-//! and methods to load, save, add, remove, find, export, list, and toggle rules.
+//! and methods to load, save, add, remove, find, export, list, toggle, and repair rules.
 //! Handles reading from and writing to disk, rule validation, and rule management
-//! within Tooka's file operation rules system.
-
-use crate::{core::context, core::error::TookaError, rules::rule::Rule};
+//! within Tooka's file operation rules system. A rules file ending in `.toml`
+//! is read and written as TOML instead of YAML.
+
+use crate::{
+    common::{atomic_write::write_atomic, config::Config, file_format::FileFormat},
+    core::context,
+    core::error::TookaError,
+    rules::rule::Rule,
+};
 use serde::{Deserialize, Serialize};
 use std::{
     fs,
@@ -11,12 +17,50 @@ use std::{
     path::{Path, PathBuf},
 };
 
+/// Formats rules can be exported in.
+pub const EXPORT_FORMATS: &[&str] = &["yaml", "json"];
+
 /// Top-level struct for the `rules.yaml` file containing all rules.
 #[derive(Debug, Serialize, Deserialize, Clone, Default)]
 pub struct RulesFile {
     pub rules: Vec<Rule>,
 }
 
+/// IDs of the rules added or replaced by an import.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct ImportSummary {
+    /// Rules that did not exist before the import.
+    pub added: Vec<String>,
+    /// Existing rules that were overwritten by the import.
+    pub replaced: Vec<String>,
+}
+
+/// Outcome of [`RulesFile::repair`].
+#[derive(Debug, Clone, Default)]
+pub struct RepairReport {
+    /// IDs of the rules that were recovered.
+    pub recovered: Vec<String>,
+    /// Rules that were dropped, named by ID (or position if the ID is unreadable), with the reason.
+    pub broken: Vec<(String, String)>,
+    /// Number of trailing lines dropped because they could not be parsed.
+    pub discarded_lines: usize,
+    /// Copy of the original file, if the rules file was rewritten.
+    pub backup: Option<PathBuf>,
+}
+
+/// Rules file read without interpreting the individual rules
+#[derive(Deserialize)]
+struct RawRulesFile {
+    #[serde(default)]
+    rules: Option<Vec<serde_yaml::Value>>,
+}
+
+/// Just enough of a rule to name it in a repair report
+#[derive(Deserialize)]
+struct RawRuleId {
+    id: String,
+}
+
 /// Represents the rules file, providing methods to load, save, and manipulate rules
 impl RulesFile {
     /// Loads all rules from the default `rules.yaml` file path.
@@ -39,6 +83,15 @@ impl RulesFile {
             return Ok(empty);
         }
 
+        Self::load_from(&path)
+    }
+
+    /// Loads all rules from an existing rules file at the given path.
+    ///
+    /// # Errors
+    /// Returns an error if the path is not a regular file, cannot be read or
+    /// parsed, or if rules share an ID.
+    pub fn load_from(path: &Path) -> Result<Self, TookaError> {
         if !path.is_file() {
             return Err(TookaError::ConfigError(format!(
                 "Rules file is not a regular file: {}",
@@ -46,8 +99,18 @@ impl RulesFile {
             )));
         }
 
-        let content = fs::read_to_string(&path)?;
-        let rules: Self = serde_yaml::from_str(&content)?;
+        let content = fs::read_to_string(path)?;
+        let rules: Self = FileFormat::from_path(path).parse(&content)?;
+
+        // A repeated ID would be shadowed by the first rule using it
+        let duplicates = rules.duplicate_ids();
+        if !duplicates.is_empty() {
+            return Err(TookaError::ConfigError(format!(
+                "Duplicate rule IDs in {}: {}; give each rule its own ID or run `tooka rules repair`",
+                path.display(),
+                duplicates.join(", ")
+            )));
+        }
 
         log::debug!("Successfully loaded {} rules", rules.rules.len());
         Ok(rules)
@@ -56,85 +119,128 @@ impl RulesFile {
     /// Saves the current set of rules to the rules file on disk.
     ///
     /// # Errors
-    /// Returns an error if the file cannot be written.
+    /// Returns an error if the rules are read-only or the file cannot be written.
     pub fn save(&self) -> Result<(), TookaError> {
         log::debug!("Saving rules to file");
+        Self::check_writable()?;
         let path = Self::rules_file_path()?;
         Self::write_to_file(&path, self)?;
         log::debug!("Saved {} rules to {}", self.rules.len(), path.display());
         Ok(())
     }
 
+    /// Returns an error if the given configuration forbids changing the rules.
+    ///
+    /// Rules are read-only when `rules_read_only` is set, when they are fetched
+    /// from `rules_url`, or when the rules file itself is not writable, since
+    /// local changes would then drift from the rules' source of truth.
+    ///
+    /// # Errors
+    /// Returns [`TookaError::RulesReadOnly`] naming the source of truth.
+    pub fn ensure_writable(config: &Config) -> Result<(), TookaError> {
+        if let Some(url) = &config.rules_url {
+            return Err(TookaError::RulesReadOnly(format!(
+                "they are managed at {url}; change them there instead"
+            )));
+        }
+        if config.rules_read_only {
+            return Err(TookaError::RulesReadOnly(format!(
+                "rules_read_only is set in the config; change {} at its source instead",
+                config.rules_file.display()
+            )));
+        }
+        let read_only_file = fs::metadata(&config.rules_file)
+            .is_ok_and(|metadata| metadata.permissions().readonly());
+        if read_only_file {
+            return Err(TookaError::RulesReadOnly(format!(
+                "{} is not writable; change it at its source instead",
+                config.rules_file.display()
+            )));
+        }
+        Ok(())
+    }
+
     /// Adds rule(s) from a YAML file path.
     /// Supports single or multiple rules depending on YAML content.
-    /// Optionally overwrites existing rules with the same ID.
+    /// Optionally replaces existing rules with the same ID.
     ///
     /// # Errors
     /// Returns an error if the file can't be read, parsed, or validation fails.
     pub fn add_rule_from_file(
         &mut self,
         file_path: &str,
-        overwrite: bool,
-    ) -> Result<(), TookaError> {
+        replace: bool,
+    ) -> Result<ImportSummary, TookaError> {
         log::debug!("Adding rule(s) from file: {file_path}");
+        Self::check_writable()?;
 
         let mut content = String::new();
         fs::File::open(file_path)?.read_to_string(&mut content)?;
 
-        if content.trim_start().starts_with("rules:") {
-            self.add_multiple_rules(&content, overwrite)
-        } else {
-            self.add_single_rule(&content, overwrite)
-        }
+        self.add_rules_from_str(&content, replace)
     }
 
-    /// Add a single rule from a YAML string, optionally overwriting existing rules
-    fn add_single_rule(&mut self, yaml: &str, overwrite: bool) -> Result<(), TookaError> {
-        let rule: Rule = serde_yaml::from_str(yaml)?;
-        log::debug!("Parsed new rule: {rule:?}");
-        rule.validate(true)?;
-
-        if let Some(pos) = self.rules.iter().position(|r| r.id == rule.id) {
-            if overwrite {
-                self.rules[pos] = rule;
-                self.save()?;
-                return Ok(());
-            }
-            return Err(TookaError::InvalidRule(format!(
-                "Rule ID '{}' already exists",
-                rule.id
-            )));
-        }
+    /// Adds rule(s) from YAML content, e.g. downloaded from a URL, and saves the rules file.
+    ///
+    /// # Errors
+    /// Returns an error if the rules are read-only, any rule is invalid or
+    /// conflicts with an existing one, or the file cannot be written.
+    pub fn add_rules_from_str(
+        &mut self,
+        yaml: &str,
+        replace: bool,
+    ) -> Result<ImportSummary, TookaError> {
+        Self::check_writable()?;
 
-        self.rules.push(rule);
+        let summary = self.import_rules(yaml, replace)?;
         self.save()?;
-        Ok(())
+        Ok(summary)
     }
 
-    /// Add multiple rules from a YAML string, optionally overwriting existing rules
-    fn add_multiple_rules(&mut self, yaml: &str, overwrite: bool) -> Result<(), TookaError> {
-        let parsed: RulesFile = serde_yaml::from_str(yaml)?;
+    /// Imports rule(s) from a YAML string without saving the rules file.
+    ///
+    /// All rules are parsed and validated before any of them is applied, so a
+    /// failing rule never leaves the rules file half-updated. Rules whose ID
+    /// already exists are replaced if `replace` is true, otherwise an error is
+    /// returned.
+    ///
+    /// # Errors
+    /// Returns an error if parsing or validation fails, or on an ID conflict.
+    pub fn import_rules(&mut self, yaml: &str, replace: bool) -> Result<ImportSummary, TookaError> {
+        let rules = Rule::parse_all(yaml)?;
 
-        for rule in parsed.rules {
+        for (i, rule) in rules.iter().enumerate() {
             log::debug!("Parsed rule: {rule:?}");
             rule.validate(true)?;
 
+            if rules[..i].iter().any(|r| r.id == rule.id) {
+                return Err(TookaError::InvalidRule(format!(
+                    "Rule ID '{}' is defined more than once in the imported rules",
+                    rule.id
+                )));
+            }
+
+            if !replace && self.rules.iter().any(|r| r.id == rule.id) {
+                return Err(TookaError::InvalidRule(format!(
+                    "Rule ID '{}' already exists",
+                    rule.id
+                )));
+            }
+        }
+
+        let mut summary = ImportSummary::default();
+        for rule in rules {
             if let Some(pos) = self.rules.iter().position(|r| r.id == rule.id) {
-                if overwrite {
-                    self.rules[pos] = rule;
-                } else {
-                    return Err(TookaError::InvalidRule(format!(
-                        "Rule ID '{}' already exists",
-                        rule.id
-                    )));
-                }
+                log::debug!("Replacing existing rule with id: {}", rule.id);
+                summary.replaced.push(rule.id.clone());
+                self.rules[pos] = rule;
             } else {
+                summary.added.push(rule.id.clone());
                 self.rules.push(rule);
             }
         }
 
-        self.save()?;
-        Ok(())
+        Ok(summary)
     }
 
     /// Removes a rule identified by its ID.
@@ -143,6 +249,7 @@ impl RulesFile {
     /// Returns an error if the rule ID is not found.
     pub fn remove_rule(&mut self, rule_id: &str) -> Result<(), TookaError> {
         log::debug!("Removing rule with id: {rule_id}");
+        Self::check_writable()?;
 
         if let Some(pos) = self.rules.iter().position(|r| r.id == rule_id) {
             self.rules.remove(pos);
@@ -156,34 +263,94 @@ impl RulesFile {
         }
     }
 
+    /// Replaces the rule with ID `rule_id` by `updated`, keeping its position
+    /// in the file.
+    ///
+    /// The updated rule may have another ID, as long as no other rule uses it.
+    ///
+    /// # Errors
+    /// Returns an error if the rules are read-only, the rule ID is not found,
+    /// the updated rule is invalid or its new ID is taken, or the file cannot
+    /// be written; the rules are left unchanged in that case.
+    pub fn replace_rule(&mut self, rule_id: &str, updated: Rule) -> Result<(), TookaError> {
+        log::debug!("Replacing rule with id: {rule_id}");
+        Self::check_writable()?;
+        self.replace_rule_with(rule_id, updated, Self::save)
+    }
+
+    /// Replaces the rule with ID `rule_id` by `updated` like
+    /// [`RulesFile::replace_rule`], writing the rules with `save`.
+    pub(crate) fn replace_rule_with<S>(
+        &mut self,
+        rule_id: &str,
+        updated: Rule,
+        save: S,
+    ) -> Result<(), TookaError>
+    where
+        S: FnOnce(&Self) -> Result<(), TookaError>,
+    {
+        updated.validate(true)?;
+
+        let Some(pos) = self.rules.iter().position(|r| r.id == rule_id) else {
+            return Err(TookaError::RuleNotFound(format!(
+                "Rule with id '{rule_id}' not found"
+            )));
+        };
+        if updated.id != rule_id && self.rules.iter().any(|r| r.id == updated.id) {
+            return Err(TookaError::InvalidRule(format!(
+                "Rule ID '{}' already exists",
+                updated.id
+            )));
+        }
+
+        let previous = std::mem::replace(&mut self.rules[pos], updated);
+        if let Err(e) = save(self) {
+            self.rules[pos] = previous;
+            return Err(e);
+        }
+        log::debug!("Successfully replaced rule with id: {rule_id}");
+        Ok(())
+    }
+
     /// Finds a rule by its ID.
     ///
-    /// Returns `Some(Rule)` if found, otherwise `None`.
+    /// Returns a copy of the rule if found, otherwise `None`; use
+    /// [`RulesFile::find_rule_mut`] to change the stored rule.
     pub fn find_rule(&self, rule_id: &str) -> Option<Rule> {
         log::debug!("Finding rule with id: {rule_id}");
         self.rules.iter().find(|r| r.id == rule_id).cloned()
     }
 
-    /// Exports a rule by ID either to a file or prints it to stdout.
+    /// Finds a rule by its ID for changing it in place.
+    ///
+    /// Changes to the returned rule are part of the rules file, and are
+    /// written to disk with the next [`RulesFile::save`].
+    pub fn find_rule_mut(&mut self, rule_id: &str) -> Option<&mut Rule> {
+        log::debug!("Finding rule with id: {rule_id} for changes");
+        self.rules.iter_mut().find(|r| r.id == rule_id)
+    }
+
+    /// Exports a rule by ID either to a file or prints it to stdout, in one of
+    /// the [`EXPORT_FORMATS`].
     ///
     /// # Errors
-    /// Returns an error if the rule ID is not found or if writing to file fails.
-    pub fn export_rule(&self, rule_id: &str, out_path: Option<&str>) -> Result<(), TookaError> {
+    /// Returns an error if the rule ID is not found, the format is unsupported,
+    /// or if writing to file fails.
+    pub fn export_rule(
+        &self,
+        rule_id: &str,
+        out_path: Option<&str>,
+        format: &str,
+    ) -> Result<(), TookaError> {
         log::debug!(
-            "Exporting rule with id: {} to {}",
+            "Exporting rule with id: {} to {} as {format}",
             rule_id,
             out_path.unwrap_or("stdout")
         );
 
         if let Some(rule) = self.rules.iter().find(|r| r.id == rule_id) {
-            let content = serde_yaml::to_string(rule)?;
-            if let Some(path) = out_path {
-                fs::write(path, content)?;
-                log::debug!("Exported rule {rule_id} to {path}");
-            } else {
-                println!("{content}");
-                log::debug!("Exported rule {rule_id} to stdout");
-            }
+            Self::write_export(&Self::export_content(rule, format)?, out_path)?;
+            log::debug!("Exported rule {rule_id}");
             Ok(())
         } else {
             Err(TookaError::RuleNotFound(format!(
@@ -192,6 +359,20 @@ impl RulesFile {
         }
     }
 
+    /// Exports all rules as a rules file either to a file or prints it to
+    /// stdout, in one of the [`EXPORT_FORMATS`].
+    ///
+    /// # Errors
+    /// Returns an error if the format is unsupported or writing to file fails.
+    pub fn export_all(&self, out_path: Option<&str>, format: &str) -> Result<(), TookaError> {
+        log::debug!(
+            "Exporting {} rules to {} as {format}",
+            self.rules.len(),
+            out_path.unwrap_or("stdout")
+        );
+        Self::write_export(&Self::export_content(self, format)?, out_path)
+    }
+
     /// Returns a clone of all rules.
     pub fn list_rules(&self) -> Vec<Rule> {
         log::debug!("Listing all rules");
@@ -204,17 +385,98 @@ impl RulesFile {
     /// Returns an error if the rule ID is not found.
     pub fn toggle_rule(&mut self, rule_id: &str) -> Result<(), TookaError> {
         log::debug!("Toggling rule with id: {rule_id}");
+        let Some(enabled) = self.find_rule(rule_id).map(|r| r.enabled) else {
+            return Err(TookaError::RuleNotFound(format!(
+                "Rule with id '{rule_id}' not found"
+            )));
+        };
+        self.set_enabled(rule_id, !enabled)?;
+        log::debug!("Successfully toggled rule with id: {rule_id}");
+        Ok(())
+    }
 
-        if let Some(rule) = self.rules.iter_mut().find(|r| r.id == rule_id) {
-            rule.enabled = !rule.enabled;
-            self.save()?;
-            log::debug!("Successfully toggled rule with id: {rule_id}");
-            Ok(())
-        } else {
-            Err(TookaError::RuleNotFound(format!(
+    /// Enables or disables the rule with ID `rule_id`.
+    ///
+    /// The file is only written if the rule was not in that state already.
+    ///
+    /// # Returns
+    /// Whether the rule changed.
+    ///
+    /// # Errors
+    /// Returns an error if the rules are read-only, the rule ID is not found,
+    /// or the file cannot be written; the rule is left unchanged in that case.
+    pub fn set_enabled(&mut self, rule_id: &str, enabled: bool) -> Result<bool, TookaError> {
+        log::debug!("Setting enabled={enabled} for rule with id: {rule_id}");
+        Self::check_writable()?;
+        self.set_enabled_with(rule_id, enabled, Self::save)
+    }
+
+    /// Enables or disables the rule with ID `rule_id` like
+    /// [`RulesFile::set_enabled`], writing the rules with `save`.
+    pub(crate) fn set_enabled_with<S>(
+        &mut self,
+        rule_id: &str,
+        enabled: bool,
+        save: S,
+    ) -> Result<bool, TookaError>
+    where
+        S: FnOnce(&Self) -> Result<(), TookaError>,
+    {
+        let Some(pos) = self.rules.iter().position(|r| r.id == rule_id) else {
+            return Err(TookaError::RuleNotFound(format!(
                 "Rule with id '{rule_id}' not found"
-            )))
+            )));
+        };
+        if self.rules[pos].enabled == enabled {
+            return Ok(false);
+        }
+        self.rules[pos].enabled = enabled;
+        if let Err(e) = save(self) {
+            self.rules[pos].enabled = !enabled;
+            return Err(e);
+        }
+        Ok(true)
+    }
+
+    /// Enables or disables every rule.
+    ///
+    /// # Returns
+    /// The IDs of the rules that changed; the file is only written if any did.
+    ///
+    /// # Errors
+    /// Returns an error if the rules are read-only or the file cannot be
+    /// written; the rules are left unchanged in that case.
+    pub fn set_all_enabled(&mut self, enabled: bool) -> Result<Vec<String>, TookaError> {
+        log::debug!("Setting enabled={enabled} for all rules");
+        Self::check_writable()?;
+        self.set_all_enabled_with(enabled, Self::save)
+    }
+
+    /// Enables or disables every rule like [`RulesFile::set_all_enabled`],
+    /// writing the rules with `save`.
+    pub(crate) fn set_all_enabled_with<S>(
+        &mut self,
+        enabled: bool,
+        save: S,
+    ) -> Result<Vec<String>, TookaError>
+    where
+        S: FnOnce(&Self) -> Result<(), TookaError>,
+    {
+        let mut changed = Vec::new();
+        for rule in self.rules.iter_mut().filter(|r| r.enabled != enabled) {
+            rule.enabled = enabled;
+            changed.push(rule.id.clone());
+        }
+        if changed.is_empty() {
+            return Ok(changed);
         }
+        if let Err(e) = save(self) {
+            for rule in self.rules.iter_mut().filter(|r| changed.contains(&r.id)) {
+                rule.enabled = !enabled;
+            }
+            return Err(e);
+        }
+        Ok(changed)
     }
 
     /// Creates an optimized rules file with rule filtering and priority sorting
@@ -241,6 +503,9 @@ impl RulesFile {
             .into_iter()
             .filter(|rule| rule.enabled)
             .collect();
+        for rule in &enabled_rules {
+            rule.check_patterns()?;
+        }
 
         if enabled_rules.is_empty() {
             return Err(TookaError::RuleNotFound(
@@ -257,6 +522,141 @@ impl RulesFile {
         })
     }
 
+    /// Returns the ruleset as sorting applies it.
+    ///
+    /// Every rule is validated, disabled rules are dropped and the remaining
+    /// rules are ordered by priority (rules of equal priority keep their order).
+    /// Optional settings that were left out hold their default values, so the
+    /// serialized result spells out the complete ruleset.
+    ///
+    /// # Errors
+    /// Returns a [`TookaError`] if any rule is invalid.
+    pub fn resolved(self) -> Result<Self, TookaError> {
+        for rule in &self.rules {
+            rule.validate(true)?;
+        }
+
+        let mut rules: Vec<Rule> = self.rules.into_iter().filter(|r| r.enabled).collect();
+        rules.sort_by(|a, b| b.priority.cmp(&a.priority));
+        Ok(Self { rules })
+    }
+
+    /// Salvages the valid rules of a corrupted or partially written rules file.
+    ///
+    /// Trailing lines of a YAML file are dropped until the rest of the file
+    /// parses, which recovers files cut short by a crash; a TOML file must
+    /// parse as a whole. Each remaining rule is then parsed and validated on
+    /// its own; rules that fail, and repeated IDs, are dropped. If anything was
+    /// dropped, the original file is copied to `<file>.bak` and the file is
+    /// rewritten with the recovered rules only, in its own format.
+    ///
+    /// # Errors
+    /// Returns an error if the file cannot be read, no part of it parses, or
+    /// the backup or repaired file cannot be written.
+    pub fn repair(path: &Path) -> Result<RepairReport, TookaError> {
+        log::debug!("Repairing rules file: {}", path.display());
+        let content = fs::read_to_string(path)?;
+
+        let (raw, discarded_lines) = match FileFormat::from_path(path) {
+            FileFormat::Yaml => {
+                let lines: Vec<&str> = content.lines().collect();
+                (0..=lines.len())
+                    .rev()
+                    .find_map(|keep| {
+                        serde_yaml::from_str::<RawRulesFile>(&lines[..keep].join("\n"))
+                            .ok()
+                            .map(|raw| (raw, lines.len() - keep))
+                    })
+                    .ok_or_else(|| {
+                        TookaError::ConfigError(format!(
+                            "No part of {} could be parsed as a rules file",
+                            path.display()
+                        ))
+                    })?
+            }
+            FileFormat::Toml => {
+                let raw = FileFormat::Toml
+                    .parse::<RawRulesFile>(&content)
+                    .map_err(|e| {
+                        TookaError::ConfigError(format!(
+                            "{} could not be parsed ({e}); repairing a truncated rules file is only supported for YAML",
+                            path.display()
+                        ))
+                    })?;
+                (raw, 0)
+            }
+        };
+
+        let mut report = RepairReport {
+            discarded_lines,
+            ..Default::default()
+        };
+        let mut rules: Vec<Rule> = Vec::new();
+        for (index, value) in raw.rules.unwrap_or_default().into_iter().enumerate() {
+            let name = serde_yaml::from_value::<RawRuleId>(value.clone())
+                .map_or_else(|_| format!("rule #{}", index + 1), |raw| raw.id);
+            let checked = serde_yaml::from_value::<Rule>(value)
+                .map_err(|e| e.to_string())
+                .and_then(|rule| {
+                    rule.validate(true).map_err(|e| e.to_string())?;
+                    if rules.iter().any(|r| r.id == rule.id) {
+                        return Err(format!("duplicate rule ID '{}'", rule.id));
+                    }
+                    Ok(rule)
+                });
+            match checked {
+                Ok(rule) => {
+                    report.recovered.push(rule.id.clone());
+                    rules.push(rule);
+                }
+                Err(reason) => {
+                    log::warn!("Dropping broken rule {name}: {reason}");
+                    report.broken.push((name, reason));
+                }
+            }
+        }
+
+        if report.broken.is_empty() && report.discarded_lines == 0 {
+            log::info!("Rules file {} needs no repair", path.display());
+            return Ok(report);
+        }
+
+        let file_name = path
+            .file_name()
+            .map_or_else(|| "rules.yaml".into(), |n| n.to_string_lossy());
+        let backup = path.with_file_name(format!("{file_name}.bak"));
+        fs::copy(path, &backup)?;
+        Self::write_to_file(path, &Self { rules })?;
+        log::info!(
+            "Repaired {}: kept {} rules, dropped {}, backup at {}",
+            path.display(),
+            report.recovered.len(),
+            report.broken.len(),
+            backup.display()
+        );
+        report.backup = Some(backup);
+        Ok(report)
+    }
+
+    /// Helper function to check the global configuration allows changing the rules
+    fn check_writable() -> Result<(), TookaError> {
+        let config = context::get_locked_config()
+            .map_err(|e| TookaError::ConfigError(format!("Failed to get config: {e}")))?;
+        Self::ensure_writable(&config)
+    }
+
+    /// Returns the IDs used by more than one rule, each once, in file order
+    fn duplicate_ids(&self) -> Vec<&str> {
+        let mut seen = std::collections::HashSet::new();
+        let mut duplicates = Vec::new();
+        for rule in &self.rules {
+            if !seen.insert(rule.id.as_str()) && !duplicates.contains(&rule.id.as_str()) {
+                duplicates.push(rule.id.as_str());
+            }
+        }
+        duplicates
+    }
+
     /// Helper function to get the path to the rules file
     fn rules_file_path() -> Result<PathBuf, TookaError> {
         let config = context::get_locked_config()
@@ -265,13 +665,33 @@ impl RulesFile {
         Ok(Path::new(&config.rules_file).to_path_buf())
     }
 
-    /// Helper function to write rules to a file
+    /// Helper function to write rules to a file atomically, in YAML or TOML by the file extension
     fn write_to_file(path: &Path, rules: &Self) -> Result<(), TookaError> {
         if let Some(parent) = path.parent() {
             fs::create_dir_all(parent)?;
         }
-        let file = fs::File::create(path)?;
-        serde_yaml::to_writer(file, rules)?;
+        write_atomic(path, FileFormat::from_path(path).to_string(rules)?)?;
+        Ok(())
+    }
+
+    /// Helper function to serialize exported rules in the given format
+    fn export_content<T: Serialize>(value: &T, format: &str) -> Result<String, TookaError> {
+        match format {
+            "yaml" => Ok(serde_yaml::to_string(value)?),
+            "json" => Ok(serde_json::to_string_pretty(value)? + "\n"),
+            other => Err(TookaError::Other(format!(
+                "Unsupported export format: {other}, expected one of: {}",
+                EXPORT_FORMATS.join(", ")
+            ))),
+        }
+    }
+
+    /// Helper function to write exported rules to a file, or to stdout without one
+    fn write_export(content: &str, out_path: Option<&str>) -> Result<(), TookaError> {
+        match out_path {
+            Some(path) => fs::write(path, content)?,
+            None => print!("{content}"),
+        }
         Ok(())
     }
 }
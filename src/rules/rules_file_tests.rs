@@ -0,0 +1,922 @@
+use super::rule::{
+    Action, Conditions, ConflictStrategy, MAX_CONDITION_DEPTH, MoveAction, Range, RenameAction,
+    Rule,
+};
+use super::rules_file::RulesFile;
+use super::template::starter_rules;
+use super::test_support::extension_rule;
+use crate::common::{config::Config, file_format::FileFormat};
+use crate::core::error::{RuleValidationError, TookaError};
+use tempfile::tempdir;
+
+fn sample_rule(id: &str, name: &str) -> Rule {
+    Rule {
+        name: name.to_string(),
+        ..extension_rule(id, &["txt"])
+    }
+}
+
+#[test]
+fn test_import_rules_replaces_existing_rule() {
+    let mut rf = RulesFile {
+        rules: vec![sample_rule("shared", "Original name")],
+    };
+    let updated = serde_yaml::to_string(&sample_rule("shared", "Updated name")).unwrap();
+
+    let summary = rf.import_rules(&updated, true).unwrap();
+
+    assert_eq!(summary.replaced, vec!["shared".to_string()]);
+    assert!(summary.added.is_empty());
+    assert_eq!(rf.rules.len(), 1);
+    assert_eq!(rf.rules[0].name, "Updated name");
+}
+
+#[test]
+fn test_import_rules_without_replace_rejects_duplicate() {
+    let mut rf = RulesFile {
+        rules: vec![sample_rule("shared", "Original name")],
+    };
+    let updated = serde_yaml::to_string(&sample_rule("shared", "Updated name")).unwrap();
+
+    let err = rf.import_rules(&updated, false).unwrap_err();
+
+    assert!(err.to_string().contains("already exists"));
+    assert_eq!(rf.rules[0].name, "Original name");
+}
+
+#[test]
+fn test_import_rules_adds_new_rule() {
+    let mut rf = RulesFile {
+        rules: vec![sample_rule("existing", "Existing rule")],
+    };
+    let new_rule = serde_yaml::to_string(&sample_rule("fresh", "Fresh rule")).unwrap();
+
+    let summary = rf.import_rules(&new_rule, true).unwrap();
+
+    assert_eq!(summary.added, vec!["fresh".to_string()]);
+    assert!(summary.replaced.is_empty());
+    assert_eq!(rf.rules.len(), 2);
+}
+
+#[test]
+fn test_import_rules_rejects_invalid_rule_without_changes() {
+    let mut rf = RulesFile {
+        rules: vec![sample_rule("shared", "Original name")],
+    };
+    let invalid = serde_yaml::to_string(&sample_rule("shared", "  ")).unwrap();
+
+    assert!(rf.import_rules(&invalid, true).is_err());
+    assert_eq!(rf.rules[0].name, "Original name");
+}
+
+#[test]
+fn test_import_rules_accepts_rules_file_wrapper() {
+    let mut rf = RulesFile::default();
+    let wrapped = RulesFile {
+        rules: vec![
+            sample_rule("first", "First"),
+            sample_rule("second", "Second"),
+        ],
+    };
+    let yaml = format!(
+        "# Shared rules\n{}",
+        serde_yaml::to_string(&wrapped).unwrap()
+    );
+
+    let summary = rf.import_rules(&yaml, false).unwrap();
+
+    assert_eq!(
+        summary.added,
+        vec!["first".to_string(), "second".to_string()]
+    );
+    assert_eq!(rf.rules.len(), 2);
+}
+
+#[test]
+fn test_import_rules_rejects_ids_repeated_in_snippet() {
+    let mut rf = RulesFile::default();
+    let wrapped = RulesFile {
+        rules: vec![sample_rule("twin", "One"), sample_rule("twin", "Two")],
+    };
+    let yaml = serde_yaml::to_string(&wrapped).unwrap();
+
+    let err = rf.import_rules(&yaml, true).unwrap_err();
+
+    assert!(err.to_string().contains("more than once"), "{err}");
+    assert!(rf.rules.is_empty());
+}
+
+#[test]
+fn test_validate_rejects_invalid_dir_mode() {
+    let mut rule = sample_rule("private", "Private archive");
+    rule.then = vec![Action::Move(MoveAction {
+        to: "/archive".to_string(),
+        preserve_structure: false,
+        dir_mode: Some("0799".to_string()),
+        path_template: None,
+        on_conflict: ConflictStrategy::default(),
+    })];
+    assert!(rule.validate(true).is_err());
+
+    if let Action::Move(inner) = &mut rule.then[0] {
+        inner.dir_mode = Some("0700".to_string());
+    }
+    assert!(rule.validate(true).is_ok());
+}
+
+#[test]
+fn test_validate_rejects_dedupe_moving_and_linking() {
+    let mut rule = sample_rule("dedupe", "Dedupe");
+    rule.then = vec![serde_yaml::from_str("action: dedupe\nreplace_with: hardlink").unwrap()];
+    assert!(rule.validate(true).is_ok());
+
+    rule.then = vec![
+        serde_yaml::from_str("action: dedupe\nto: ~/Duplicates\nreplace_with: symlink").unwrap(),
+    ];
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("replace them with links"), "{err}");
+    assert!(serde_yaml::from_str::<Action>("action: dedupe\nreplace_with: copy").is_err());
+}
+
+#[test]
+fn test_validate_requires_symlink_destination() {
+    let mut rule = sample_rule("links", "Links");
+    rule.then =
+        vec![serde_yaml::from_str("action: symlink\nto: ~/Sorted/pdf\nrelative: true").unwrap()];
+    assert!(rule.validate(true).is_ok());
+
+    if let Action::Symlink(inner) = &mut rule.then[0] {
+        inner.to = " ".to_string();
+    }
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("Missing destination path"), "{err}");
+
+    assert!(serde_yaml::from_str::<Action>("action: symlink\nrelative: true").is_err());
+}
+
+#[test]
+fn test_validate_rejects_escaping_rename_templates() {
+    let mut rule = sample_rule("rename", "Rename files");
+    for template in [
+        "{{filename}}/../evil",
+        "../{{filename}}",
+        "..",
+        "{{nonexistent}}",
+    ] {
+        rule.then = vec![Action::Rename(RenameAction {
+            to: template.to_string(),
+            counter_width: None,
+        })];
+        assert!(rule.validate(true).is_err(), "{template}");
+    }
+
+    rule.then = vec![Action::Rename(RenameAction {
+        to: "{{filename}}_archived".to_string(),
+        counter_width: None,
+    })];
+    assert!(rule.validate(true).is_ok());
+}
+
+#[test]
+fn test_validate_rejects_inverted_created_between() {
+    let rule_json = |from: &str, to: &str| {
+        format!(
+            r#"{{"id": "old", "name": "Old files", "enabled": true, "priority": 1,
+                "when": {{"created_between": {{"from": "{from}", "to": "{to}"}}}},
+                "then": [{{"action": "skip"}}]}}"#
+        )
+    };
+
+    let inverted: Rule = serde_yaml::from_str(&rule_json("2024-06-01", "2024-01-01")).unwrap();
+    let err = inverted.validate(true).unwrap_err().to_string();
+    assert!(err.contains("is after"), "{err}");
+
+    let malformed: Rule = serde_yaml::from_str(&rule_json("2024-06-01", "June")).unwrap();
+    assert!(malformed.validate(true).is_err());
+
+    let open_ended: Rule = serde_yaml::from_str(&rule_json("2024-01-01", "")).unwrap();
+    assert!(open_ended.validate(true).is_ok());
+    assert!(open_ended.when.created_date.is_some());
+}
+
+#[test]
+fn test_validate_checks_nested_condition_groups() {
+    let nested = |conditions: Conditions| Conditions {
+        any_of: Some(vec![conditions]),
+        ..Default::default()
+    };
+
+    let mut rule = sample_rule("nested", "Nested");
+    rule.when = nested(Conditions {
+        filename: Some("report_(\\d+".to_string()),
+        ..Default::default()
+    });
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("filename regex"), "{err}");
+
+    rule.when = nested(Conditions {
+        all_of: Some(Vec::new()),
+        ..Default::default()
+    });
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("all_of requires"), "{err}");
+
+    rule.when = nested(Conditions {
+        min_count: Some(2),
+        ..Default::default()
+    });
+    assert!(rule.validate(true).is_err());
+
+    let mut deep = Conditions::default();
+    for _ in 0..=MAX_CONDITION_DEPTH {
+        deep = nested(deep);
+    }
+    rule.when = deep;
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("nested"), "{err}");
+}
+
+#[test]
+fn test_validate_checks_condition_values_in_nested_groups() {
+    let rule_yaml = |nested: &str| {
+        format!(
+            "id: nested\nname: Nested\nenabled: true\npriority: 1\nwhen:\n  extensions: [jpg]\n  any_of:\n    - {nested}\nthen:\n  - action: skip\n"
+        )
+    };
+
+    for (nested, expected) in [
+        ("{day: {weekdays: []}}", "day lists"),
+        ("{day: {days_of_month: [32]}}", "day of month 32"),
+        (
+            "{classify_with: {command: ' ', label: photo}}",
+            "requires a command",
+        ),
+        ("{in_list: {file: ''}}", "list file path"),
+        ("{video: {width: {min: 100, max: 10}}}", "video width"),
+        ("{size_kb: {min: 10, max: 1}}", "size_kb"),
+        (
+            "{modified_date: {from: '2024-06-01', to: '2024-01-01'}}",
+            "is after",
+        ),
+        ("{all_of: [{day: {weekdays: []}}]}", "day lists"),
+    ] {
+        let rule: Rule = serde_yaml::from_str(&rule_yaml(nested)).unwrap();
+        let err = rule.validate(true).unwrap_err().to_string();
+        assert!(err.contains(expected), "{nested}: {err}");
+    }
+
+    let valid: Rule = serde_yaml::from_str(&rule_yaml("{day: {weekdays: [mon]}}")).unwrap();
+    assert!(valid.validate(true).is_ok());
+}
+
+#[test]
+fn test_trash_action_is_accepted() {
+    let yaml = "id: old_logs\nname: Old logs\nenabled: true\npriority: 1\nwhen:\n  extensions: [log]\nthen:\n  - action: trash\n";
+
+    let rule: Rule = serde_yaml::from_str(yaml).unwrap();
+    assert!(matches!(rule.then[..], [Action::Trash]));
+    assert!(rule.validate(true).is_ok());
+}
+
+#[test]
+fn test_validate_rejects_rules_that_only_exclude() {
+    let screenshots = Conditions {
+        filename: Some("^Screenshot".to_string()),
+        ..Default::default()
+    };
+
+    let mut rule = sample_rule("not_screenshots", "Not screenshots");
+    rule.when = Conditions {
+        not: Some(Box::new(screenshots.clone())),
+        ..Default::default()
+    };
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("not requires other conditions"), "{err}");
+
+    rule.when.extensions = Some(vec!["png".to_string()]);
+    assert!(rule.validate(true).is_ok());
+    assert_eq!(
+        rule.when.summary(),
+        "extensions: png and not: (filename: ^Screenshot)"
+    );
+}
+
+#[test]
+fn test_validate_checks_conditions_inside_not() {
+    let mut rule = sample_rule("not_invalid", "Not invalid");
+    let excluding = |not: Conditions| Conditions {
+        extensions: Some(vec!["png".to_string()]),
+        not: Some(Box::new(not)),
+        ..Default::default()
+    };
+
+    rule.when = excluding(Conditions {
+        filename: Some("^Screenshot (".to_string()),
+        ..Default::default()
+    });
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("filename regex"), "{err}");
+
+    rule.when = excluding(Conditions {
+        size_kb: Some(Range {
+            min: Some(10),
+            max: Some(1),
+        }),
+        ..Default::default()
+    });
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("size_kb"), "{err}");
+
+    // Groups nested below a not are checked as well
+    rule.when = excluding(Conditions {
+        any_of: Some(vec![Conditions {
+            older_than: Some("soon".to_string()),
+            ..Default::default()
+        }]),
+        ..Default::default()
+    });
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("older_than"), "{err}");
+
+    rule.when = excluding(Conditions {
+        min_count: Some(2),
+        ..Default::default()
+    });
+    assert!(rule.validate(true).is_err());
+}
+
+#[test]
+fn test_validate_rejects_zero_max_per_run() {
+    let mut rule = sample_rule("capped", "Capped");
+    rule.max_per_run = Some(0);
+
+    let err = rule.validate(false).unwrap_err();
+    assert!(matches!(err, RuleValidationError::InvalidCondition(ref id, _) if id == "capped"));
+    assert_eq!(
+        err.to_string(),
+        "rule capped: invalid conditions: max_per_run must be at least 1"
+    );
+
+    rule.max_per_run = Some(1);
+    assert!(rule.validate(false).is_ok());
+}
+
+#[test]
+fn test_validate_rejects_unknown_category() {
+    let mut rule = sample_rule("media", "Media");
+    rule.when.category = Some("video".to_string());
+    assert!(rule.validate(true).is_ok());
+
+    rule.when.category = Some("movies".to_string());
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("Unknown category 'movies'"), "{err}");
+    assert!(err.contains("image, video, audio"), "{err}");
+}
+
+#[test]
+fn test_validate_rejects_invalid_size_and_age_units() {
+    let mut rule = sample_rule("big_old", "Big and old");
+    rule.when.size_greater_than = Some("1GB".to_string());
+    rule.when.older_than = Some("6mo".to_string());
+    assert!(rule.validate(true).is_ok());
+
+    rule.when.size_greater_than = Some("1 gigabyte".to_string());
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("rule big_old"), "{err}");
+    assert!(err.contains("Invalid size_greater_than"), "{err}");
+
+    rule.when.size_greater_than = None;
+    rule.when.older_than = Some("30x".to_string());
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("rule big_old"), "{err}");
+    assert!(err.contains("Invalid older_than"), "{err}");
+}
+
+#[test]
+fn test_validate_rejects_both_forms_of_size_and_age() {
+    let mut rule = sample_rule("big_old", "Big and old");
+    rule.when.size_greater_than = Some("1GB".to_string());
+    rule.when.size_greater_than_kb = Some(1024);
+    let err = rule.validate(false).unwrap_err().to_string();
+    assert!(err.contains("rule big_old"), "{err}");
+    assert!(
+        err.contains("size_greater_than and size_greater_than_kb can't be combined"),
+        "{err}"
+    );
+
+    rule.when.size_greater_than_kb = None;
+    rule.when.any_of = Some(vec![Conditions {
+        older_than: Some("30d".to_string()),
+        older_than_days: Some(30),
+        ..Default::default()
+    }]);
+    let err = rule.validate(false).unwrap_err().to_string();
+    assert!(
+        err.contains("older_than and older_than_days can't be combined"),
+        "{err}"
+    );
+}
+
+#[test]
+fn test_starter_rules_are_valid() {
+    let rules = starter_rules();
+    assert_eq!(rules.len(), 3);
+    for rule in &rules {
+        assert!(rule.validate(true).is_ok(), "{}", rule.id);
+    }
+
+    // They survive a round trip through the rules file
+    let yaml = serde_yaml::to_string(&RulesFile { rules }).unwrap();
+    let mut rules_file = RulesFile::default();
+    let summary = rules_file.import_rules(&yaml, false).unwrap();
+    assert_eq!(
+        summary.added,
+        vec!["images_by_date", "documents", "old_files_to_trash"]
+    );
+}
+
+#[test]
+fn test_invalid_filename_regex_is_reported_at_load() {
+    let mut rule = sample_rule("broken_regex", "Broken regex");
+    rule.when.filename = Some("report_(\\d+".to_string());
+    let err = rule.validate(true).unwrap_err().to_string();
+    assert!(err.contains("broken_regex"), "{err}");
+
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("fine", "Fine"), rule],
+    };
+    let err = rules_file
+        .optimized_with_filter(None)
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("broken_regex"), "{err}");
+    assert!(err.contains("filename regex"), "{err}");
+}
+
+#[test]
+fn test_load_rejects_duplicate_rule_ids() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let rules_file = RulesFile {
+        rules: vec![
+            sample_rule("foo", "First foo"),
+            sample_rule("bar", "Bar"),
+            sample_rule("foo", "Second foo"),
+        ],
+    };
+    std::fs::write(&path, serde_yaml::to_string(&rules_file).unwrap()).unwrap();
+
+    let err = RulesFile::load_from(&path).unwrap_err().to_string();
+    assert!(err.contains("Duplicate rule IDs"), "{err}");
+    assert!(err.contains(": foo;"), "{err}");
+
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("foo", "Foo"), sample_rule("bar", "Bar")],
+    };
+    std::fs::write(&path, serde_yaml::to_string(&rules_file).unwrap()).unwrap();
+    assert_eq!(RulesFile::load_from(&path).unwrap().rules.len(), 2);
+}
+
+#[test]
+fn test_resolved_ruleset_applies_defaults_and_order() {
+    // Flow-style YAML, leaving out optional settings such as `description`
+    let yaml = r#"{"rules": [
+        {"id": "low", "name": "Low priority", "enabled": true, "priority": 1,
+         "when": {"extensions": ["txt"]},
+         "then": [{"action": "move", "to": "/archive"}]},
+        {"id": "disabled", "name": "Disabled", "enabled": false, "priority": 9,
+         "when": {}, "then": [{"action": "skip"}]},
+        {"id": "high", "name": "High priority", "enabled": true, "priority": 5,
+         "when": {}, "then": [{"action": "skip"}]}
+    ]}"#;
+    let rules_file: RulesFile = serde_yaml::from_str(yaml).unwrap();
+
+    let resolved = rules_file.resolved().unwrap();
+    let ids: Vec<_> = resolved.rules.iter().map(|r| r.id.as_str()).collect();
+    assert_eq!(ids, vec!["high", "low"]);
+
+    // Settings left out of the source are spelled out in the dump
+    let dumped = serde_yaml::to_string(&resolved).unwrap();
+    assert!(dumped.contains("preserve_structure"));
+    assert!(dumped.contains("description"));
+
+    let reloaded: RulesFile = serde_yaml::from_str(&dumped).unwrap();
+    assert_eq!(reloaded.rules.len(), 2);
+}
+
+#[test]
+fn test_resolved_ruleset_rejects_invalid_rule() {
+    let mut rule = sample_rule("broken", "Broken");
+    rule.then.clear();
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("ok", "Ok"), rule],
+    };
+
+    assert!(rules_file.resolved().is_err());
+}
+
+#[test]
+fn test_ensure_writable_rejects_read_only_rules() {
+    let dir = tempdir().unwrap();
+    let rules_path = dir.path().join("rules.yaml");
+    std::fs::write(&rules_path, "{\"rules\": []}").unwrap();
+    let config = Config {
+        rules_file: rules_path.clone(),
+        ..Config::default()
+    };
+    assert!(RulesFile::ensure_writable(&config).is_ok());
+
+    let flagged = Config {
+        rules_read_only: true,
+        ..config.clone()
+    };
+    let remote = Config {
+        rules_url: Some("https://example.com/rules.yaml".to_string()),
+        ..config.clone()
+    };
+    for config in [&flagged, &remote] {
+        let err = RulesFile::ensure_writable(config).unwrap_err();
+        assert!(matches!(err, TookaError::RulesReadOnly(_)));
+    }
+    let err = RulesFile::ensure_writable(&remote).unwrap_err();
+    assert!(err.to_string().contains("https://example.com/rules.yaml"));
+
+    let mut permissions = std::fs::metadata(&rules_path).unwrap().permissions();
+    permissions.set_readonly(true);
+    std::fs::set_permissions(&rules_path, permissions).unwrap();
+    assert!(matches!(
+        RulesFile::ensure_writable(&config),
+        Err(TookaError::RulesReadOnly(_))
+    ));
+}
+
+#[test]
+fn test_repair_salvages_valid_rules() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let valid = r#"{"id": "keep", "name": "Keep", "enabled": true, "priority": 1, "when": {"extensions": ["txt"]}, "then": [{"action": "skip"}]}"#;
+    let blank_name = valid.replace(
+        r#""id": "keep", "name": "Keep""#,
+        r#""id": "blank", "name": " ""#,
+    );
+    // The last line was left behind by an interrupted write
+    let corrupted = format!(
+        "{{\"rules\": [\n{valid},\n{blank_name},\n{{\"id\": \"partial\", \"name\": \"Cut off\"}},\n{valid}\n]}}\n@@ truncat"
+    );
+    std::fs::write(&path, &corrupted).unwrap();
+
+    let report = RulesFile::repair(&path).unwrap();
+
+    assert_eq!(report.recovered, vec!["keep".to_string()]);
+    let broken: Vec<&str> = report.broken.iter().map(|(id, _)| id.as_str()).collect();
+    assert_eq!(broken, vec!["blank", "partial", "keep"]);
+    assert_eq!(report.discarded_lines, 1);
+
+    let backup = report.backup.unwrap();
+    assert_eq!(std::fs::read_to_string(backup).unwrap(), corrupted);
+    let repaired = RulesFile::load_from(&path).unwrap();
+    assert_eq!(repaired.rules.len(), 1);
+    assert_eq!(repaired.rules[0].id, "keep");
+}
+
+#[test]
+fn test_repair_keeps_toml_rules_files_in_toml() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.toml");
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("keep", "Keep"), sample_rule("blank", " ")],
+    };
+    std::fs::write(&path, FileFormat::Toml.to_string(&rules_file).unwrap()).unwrap();
+
+    let report = RulesFile::repair(&path).unwrap();
+
+    assert_eq!(report.recovered, vec!["keep".to_string()]);
+    assert_eq!(report.broken.len(), 1);
+    assert_eq!(report.broken[0].0, "blank");
+    assert_eq!(report.discarded_lines, 0);
+    let repaired = RulesFile::load_from(&path).unwrap();
+    assert_eq!(repaired.rules.len(), 1);
+    assert_eq!(repaired.rules[0].id, "keep");
+}
+
+#[test]
+fn test_repair_does_not_truncate_toml_rules_files() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.toml");
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("keep", "Keep")],
+    };
+    let corrupted = FileFormat::Toml.to_string(&rules_file).unwrap() + "[[rules\n";
+    std::fs::write(&path, &corrupted).unwrap();
+
+    let err = RulesFile::repair(&path).unwrap_err().to_string();
+
+    assert!(err.contains("only supported for YAML"), "{err}");
+    assert_eq!(std::fs::read_to_string(&path).unwrap(), corrupted);
+    assert!(!dir.path().join("rules.toml.bak").exists());
+}
+
+#[test]
+fn test_repair_leaves_intact_rules_file_alone() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let rules_file = RulesFile {
+        rules: vec![
+            sample_rule("first", "First"),
+            sample_rule("second", "Second"),
+        ],
+    };
+    std::fs::write(&path, serde_yaml::to_string(&rules_file).unwrap()).unwrap();
+
+    let report = RulesFile::repair(&path).unwrap();
+
+    assert_eq!(report.recovered.len(), 2);
+    assert!(report.broken.is_empty());
+    assert!(report.backup.is_none());
+    assert!(!dir.path().join("rules.yaml.bak").exists());
+}
+
+#[test]
+fn test_changes_to_found_rule_are_saved() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let mut rules_file = RulesFile {
+        rules: vec![
+            sample_rule("first", "First"),
+            sample_rule("second", "Second"),
+        ],
+    };
+
+    let rule = rules_file.find_rule_mut("second").unwrap();
+    rule.name = "Renamed".to_string();
+    rule.priority = 7;
+    assert!(rules_file.find_rule_mut("missing").is_none());
+    assert_eq!(rules_file.find_rule("second").unwrap().name, "Renamed");
+
+    rules_file.export_all(path.to_str(), "yaml").unwrap();
+    let saved = RulesFile::load_from(&path).unwrap();
+    let rule = saved.find_rule("second").unwrap();
+    assert_eq!(rule.name, "Renamed");
+    assert_eq!(rule.priority, 7);
+    assert_eq!(saved.find_rule("first").unwrap().name, "First");
+}
+
+fn three_rules() -> RulesFile {
+    RulesFile {
+        rules: vec![
+            sample_rule("first", "First"),
+            sample_rule("second", "Second"),
+            sample_rule("third", "Third"),
+        ],
+    }
+}
+
+fn rule_ids(rules_file: &RulesFile) -> Vec<&str> {
+    rules_file.rules.iter().map(|r| r.id.as_str()).collect()
+}
+
+#[test]
+fn test_replace_rule_keeps_its_position() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let mut rules_file = three_rules();
+
+    rules_file
+        .replace_rule_with("second", sample_rule("renamed", "Renamed"), |rules| {
+            rules.export_all(path.to_str(), "yaml")
+        })
+        .unwrap();
+
+    assert_eq!(rule_ids(&rules_file), vec!["first", "renamed", "third"]);
+    let saved = RulesFile::load_from(&path).unwrap();
+    assert_eq!(rule_ids(&saved), vec!["first", "renamed", "third"]);
+    assert_eq!(saved.rules[1].name, "Renamed");
+}
+
+#[test]
+fn test_replace_rule_keeps_original_on_invalid_rule() {
+    let mut rules_file = three_rules();
+
+    let result = rules_file.replace_rule_with("second", sample_rule("second", "  "), |_| {
+        panic!("an invalid rule must not be saved")
+    });
+
+    assert!(matches!(result, Err(TookaError::RuleValidationError(_))));
+    assert_eq!(rules_file.rules[1].name, "Second");
+}
+
+#[test]
+fn test_replace_rule_rejects_taken_id() {
+    let mut rules_file = three_rules();
+
+    let result = rules_file.replace_rule_with("second", sample_rule("third", "Clash"), |_| {
+        panic!("a clashing rule must not be saved")
+    });
+
+    let err = result.unwrap_err().to_string();
+    assert!(
+        err.contains("'third' already exists"),
+        "unexpected error: {err}"
+    );
+    assert_eq!(rule_ids(&rules_file), vec!["first", "second", "third"]);
+    assert_eq!(rules_file.rules[2].name, "Third");
+}
+
+#[test]
+fn test_replace_rule_rejects_missing_rule() {
+    let mut rules_file = three_rules();
+
+    let result = rules_file.replace_rule_with("missing", sample_rule("missing", "Missing"), |_| {
+        panic!("nothing must be saved")
+    });
+
+    assert!(matches!(result, Err(TookaError::RuleNotFound(_))));
+    assert_eq!(rule_ids(&rules_file), vec!["first", "second", "third"]);
+}
+
+#[test]
+fn test_replace_rule_rolls_back_when_saving_fails() {
+    let mut rules_file = three_rules();
+
+    let result = rules_file.replace_rule_with("second", sample_rule("renamed", "Renamed"), |_| {
+        Err(TookaError::Other("disk full".to_string()))
+    });
+
+    assert!(matches!(result, Err(TookaError::Other(_))));
+    assert_eq!(rule_ids(&rules_file), vec!["first", "second", "third"]);
+    assert_eq!(rules_file.rules[1].name, "Second");
+}
+
+#[test]
+fn test_set_enabled_saves_only_changes() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let mut rules_file = three_rules();
+
+    let changed = rules_file
+        .set_enabled_with("second", false, |rules| {
+            rules.export_all(path.to_str(), "yaml")
+        })
+        .unwrap();
+    assert!(changed);
+    assert!(!RulesFile::load_from(&path).unwrap().rules[1].enabled);
+
+    let changed = rules_file
+        .set_enabled_with("second", false, |_| {
+            panic!("an unchanged rule must not be saved")
+        })
+        .unwrap();
+    assert!(!changed);
+
+    let result = rules_file.set_enabled_with("missing", false, |_| panic!("nothing to save"));
+    assert!(matches!(result, Err(TookaError::RuleNotFound(_))));
+}
+
+#[test]
+fn test_set_enabled_rolls_back_when_saving_fails() {
+    let mut rules_file = three_rules();
+
+    let result = rules_file.set_enabled_with("second", false, |_| {
+        Err(TookaError::Other("disk full".to_string()))
+    });
+
+    assert!(matches!(result, Err(TookaError::Other(_))));
+    assert!(rules_file.rules[1].enabled);
+}
+
+#[test]
+fn test_set_all_enabled_reports_changed_rules() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.yaml");
+    let mut rules_file = three_rules();
+    rules_file.rules[1].enabled = false;
+
+    let changed = rules_file
+        .set_all_enabled_with(true, |rules| rules.export_all(path.to_str(), "yaml"))
+        .unwrap();
+    assert_eq!(changed, vec!["second".to_string()]);
+    let saved = RulesFile::load_from(&path).unwrap();
+    assert!(saved.rules.iter().all(|r| r.enabled));
+
+    let changed = rules_file
+        .set_all_enabled_with(true, |_| panic!("unchanged rules must not be saved"))
+        .unwrap();
+    assert!(changed.is_empty());
+}
+
+#[test]
+fn test_set_all_enabled_rolls_back_when_saving_fails() {
+    let mut rules_file = three_rules();
+    rules_file.rules[1].enabled = false;
+
+    let result =
+        rules_file.set_all_enabled_with(false, |_| Err(TookaError::Other("disk full".to_string())));
+
+    assert!(matches!(result, Err(TookaError::Other(_))));
+    let enabled: Vec<bool> = rules_file.rules.iter().map(|r| r.enabled).collect();
+    assert_eq!(enabled, vec![true, false, true]);
+}
+
+#[test]
+fn test_export_all_writes_loadable_rules_file() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("exported.yaml");
+    let rules_file = RulesFile {
+        rules: vec![
+            sample_rule("first", "First"),
+            sample_rule("second", "Second"),
+        ],
+    };
+
+    rules_file.export_all(path.to_str(), "yaml").unwrap();
+
+    let exported = RulesFile::load_from(&path).unwrap();
+    let ids: Vec<_> = exported.rules.iter().map(|r| r.id.as_str()).collect();
+    assert_eq!(ids, ["first", "second"]);
+
+    let err = rules_file
+        .export_rule("missing", path.to_str(), "yaml")
+        .unwrap_err();
+    assert!(matches!(err, TookaError::RuleNotFound(_)), "{err}");
+}
+
+#[test]
+fn test_export_as_indented_json() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rule.json");
+    let rules_file = RulesFile {
+        rules: vec![sample_rule("first", "First")],
+    };
+
+    rules_file
+        .export_rule("first", path.to_str(), "json")
+        .unwrap();
+    let content = std::fs::read_to_string(&path).unwrap();
+    assert!(content.contains("\n  \"id\": \"first\""), "{content}");
+    let rule: Rule = serde_json::from_str(&content).unwrap();
+    assert_eq!(rule.name, "First");
+
+    rules_file.export_all(path.to_str(), "json").unwrap();
+    let exported: RulesFile =
+        serde_json::from_str(&std::fs::read_to_string(&path).unwrap()).unwrap();
+    assert_eq!(exported.rules.len(), 1);
+
+    assert!(rules_file.export_all(path.to_str(), "toml").is_err());
+}
+
+#[test]
+fn test_conditions_summary() {
+    assert_eq!(Conditions::default().summary(), "any file");
+
+    let conditions = Conditions {
+        extensions: Some(vec!["jpg".to_string(), "png".to_string()]),
+        older_than_days: Some(30),
+        size_kb: Some(Range {
+            min: Some(1),
+            max: None,
+        }),
+        ..Default::default()
+    };
+    assert_eq!(
+        conditions.summary(),
+        "extensions: jpg, png and older_than_days: 30 and size_kb"
+    );
+
+    let any = Conditions {
+        any: Some(true),
+        filename_glob: Some("IMG_*".to_string()),
+        any_of: Some(vec![conditions, Conditions::default()]),
+        ..Default::default()
+    };
+    assert_eq!(
+        any.summary(),
+        "filename_glob: IMG_* or any_of: [extensions: jpg, png and older_than_days: 30 and size_kb | any file]"
+    );
+}
+
+#[test]
+fn test_rules_file_in_toml_round_trips() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.toml");
+    let mut rule = sample_rule("docs", "Documents");
+    rule.then = vec![Action::Move(MoveAction {
+        to: "~/Documents".to_string(),
+        preserve_structure: false,
+        dir_mode: None,
+        path_template: None,
+        on_conflict: ConflictStrategy::Rename,
+    })];
+    let rules_file = RulesFile {
+        rules: vec![rule, sample_rule("notes", "Notes")],
+    };
+
+    let content = FileFormat::from_path(&path).to_string(&rules_file).unwrap();
+    assert!(content.contains("[[rules]]"), "{content}");
+    std::fs::write(&path, content).unwrap();
+
+    let loaded = RulesFile::load_from(&path).unwrap();
+    assert_eq!(
+        serde_yaml::to_string(&loaded).unwrap(),
+        serde_yaml::to_string(&rules_file).unwrap()
+    );
+}
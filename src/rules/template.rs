@@ -1,6 +1,9 @@
 use crate::{
     core::error::TookaError,
-    rules::rule::{Action, Conditions, DateRange, MetadataField, MoveAction, Range, Rule},
+    rules::rule::{
+        Action, Conditions, ConflictStrategy, DateRange, MetadataField, MoveAction, PathTemplate,
+        PathTemplateSource, Range, Rule,
+    },
 };
 
 use serde_yaml;
@@ -13,6 +16,8 @@ pub fn generate_rule_template_yaml() -> Result<String, TookaError> {
         enabled: true,
         description: Some("Describe what this rule does".to_string()),
         priority: 1,
+        max_per_run: None,
+        stop_on_match: true,
         when: Conditions {
             any: Some(false),
             filename: Some(r"^.*\.jpg$".to_string()),
@@ -33,12 +38,90 @@ pub fn generate_rule_template_yaml() -> Result<String, TookaError> {
                 key: "EXIF:DateTime".to_string(),
                 value: None,
             }]),
+            ..Default::default()
         },
         then: vec![Action::Move(MoveAction {
             to: "/path/to/destination".to_string(),
             preserve_structure: false,
+            dir_mode: None,
+            path_template: None,
+            on_conflict: ConflictStrategy::default(),
         })],
     };
 
     Ok(serde_yaml::to_string(&rule)?)
 }
+
+/// Returns the starter rules written by `tooka init-rules`.
+///
+/// Images are sorted into `~/Pictures/<year>/<month>` by their EXIF date and
+/// documents moved to `~/Documents`. The rule trashing files older than a year
+/// is disabled, so nothing is thrown away before the user opts in.
+pub fn starter_rules() -> Vec<Rule> {
+    let move_to = |to: &str, path_template: Option<PathTemplate>| {
+        Action::Move(MoveAction {
+            to: to.to_string(),
+            preserve_structure: false,
+            dir_mode: None,
+            path_template,
+            on_conflict: ConflictStrategy::Rename,
+        })
+    };
+
+    vec![
+        Rule {
+            id: "images_by_date".to_string(),
+            name: "Sort images by date".to_string(),
+            enabled: true,
+            description: Some(
+                "Move images into ~/Pictures, in a folder per year and month they were taken"
+                    .to_string(),
+            ),
+            priority: 3,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                category: Some("image".to_string()),
+                ..Default::default()
+            },
+            then: vec![move_to(
+                "~/Pictures",
+                Some(PathTemplate {
+                    source: PathTemplateSource::ExifDate,
+                    format: "{year}/{month}/".to_string(),
+                }),
+            )],
+        },
+        Rule {
+            id: "documents".to_string(),
+            name: "Move documents".to_string(),
+            enabled: true,
+            description: Some("Move documents, spreadsheets and e-books to ~/Documents".to_string()),
+            priority: 2,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                category: Some("document".to_string()),
+                ..Default::default()
+            },
+            then: vec![move_to("~/Documents", None)],
+        },
+        Rule {
+            id: "old_files_to_trash".to_string(),
+            name: "Trash files older than a year".to_string(),
+            enabled: false,
+            description: Some(
+                "Move files not modified for a year to the trash; enable with `tooka toggle old_files_to_trash`"
+                    .to_string(),
+            ),
+            priority: 1,
+            max_per_run: None,
+            stop_on_match: true,
+            when: Conditions {
+                older_than_days: Some(365),
+                ..Default::default()
+            },
+            then: vec![Action::Trash],
+        },
+    ]
+}
@@ -0,0 +1,23 @@
+//! Rule fixtures shared by the tests.
+
+use super::rule::{Action, Conditions, Rule};
+
+/// Returns an enabled rule with priority 1 that skips files with one of `extensions`.
+///
+/// Tests needing other fields override them with `Rule { .., ..extension_rule(..) }`.
+pub(crate) fn extension_rule(id: &str, extensions: &[&str]) -> Rule {
+    Rule {
+        id: id.to_string(),
+        name: format!("Rule {id}"),
+        enabled: true,
+        description: None,
+        priority: 1,
+        max_per_run: None,
+        stop_on_match: true,
+        when: Conditions {
+            extensions: Some(extensions.iter().map(|e| e.to_string()).collect()),
+            ..Default::default()
+        },
+        then: vec![Action::Skip],
+    }
+}
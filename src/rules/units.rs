@@ -0,0 +1,80 @@
+//! Human-readable sizes and durations for rule conditions.
+//!
+//! Lets rules say `size_greater_than: 1GB` or `older_than: 30d` instead of
+//! counting KB or days. Sizes are binary, so 1 KB is 1024 bytes like in the
+//! `*_kb` conditions.
+
+use std::time::Duration;
+
+/// Seconds in a day
+const SECONDS_PER_DAY: u64 = 86_400;
+
+/// Parses a size such as "500B", "10KB", "200MB", "1GB" or "2TB" into bytes.
+///
+/// Units are case-insensitive and may be separated from the number by spaces;
+/// a number without a unit is in bytes.
+///
+/// # Errors
+/// Returns a message if the number or unit is invalid.
+pub fn parse_size(size_str: &str) -> Result<u64, String> {
+    let (number, unit) = split_number(size_str)
+        .ok_or_else(|| format!("Invalid size: '{size_str}'. Expected e.g. '500KB', '1GB'"))?;
+    let factor: u64 = match unit.to_ascii_lowercase().as_str() {
+        "" | "b" => 1,
+        "kb" => 1 << 10,
+        "mb" => 1 << 20,
+        "gb" => 1 << 30,
+        "tb" => 1 << 40,
+        _ => {
+            return Err(format!(
+                "Invalid size unit in '{size_str}'. Supported units: B, KB, MB, GB, TB"
+            ));
+        }
+    };
+    number
+        .checked_mul(factor)
+        .ok_or_else(|| format!("Size '{size_str}' is too large"))
+}
+
+/// Parses a file age such as "12d", "2w", "6mo" or "1y" (days, weeks, months,
+/// years).
+///
+/// A month counts as 30 days and a year as 365 days. Unlike run durations,
+/// see [`crate::utils::date_parser::parse_duration`], there is no `m` unit,
+/// so minutes and months can't be confused.
+///
+/// # Errors
+/// Returns a message if the number or unit is invalid.
+pub fn parse_duration(duration_str: &str) -> Result<Duration, String> {
+    let (number, unit) = split_number(duration_str).ok_or_else(|| {
+        format!("Invalid duration: '{duration_str}'. Expected e.g. '30d', '2w', '6mo', '1y'")
+    })?;
+    let days = match unit.to_ascii_lowercase().as_str() {
+        "d" => number,
+        "w" => number.saturating_mul(7),
+        "mo" => number.saturating_mul(30),
+        "y" => number.saturating_mul(365),
+        _ => {
+            return Err(format!(
+                "Invalid duration unit in '{duration_str}'. Supported units: d (days), w (weeks), mo (months), y (years)"
+            ));
+        }
+    };
+    Ok(Duration::from_secs(days.saturating_mul(SECONDS_PER_DAY)))
+}
+
+/// Returns the whole days of a duration parsed by [`parse_duration`], at most `u32::MAX`
+pub fn duration_days(duration: Duration) -> u32 {
+    u32::try_from(duration.as_secs() / SECONDS_PER_DAY).unwrap_or(u32::MAX)
+}
+
+/// Splits a string into its leading number and the unit after it, or `None`
+/// if it doesn't start with a number
+fn split_number(value: &str) -> Option<(u64, &str)> {
+    let value = value.trim();
+    let split = value
+        .find(|c: char| !c.is_ascii_digit())
+        .unwrap_or(value.len());
+    let (number, unit) = value.split_at(split);
+    Some((number.parse().ok()?, unit.trim_start()))
+}
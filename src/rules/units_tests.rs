@@ -0,0 +1,41 @@
+use super::units::{duration_days, parse_duration, parse_size};
+use std::time::Duration;
+
+#[test]
+fn test_parse_size() {
+    assert_eq!(parse_size("500"), Ok(500));
+    assert_eq!(parse_size("500B"), Ok(500));
+    assert_eq!(parse_size("10KB"), Ok(10 * 1024));
+    assert_eq!(parse_size("200 mb"), Ok(200 * 1024 * 1024));
+    assert_eq!(parse_size(" 1GB "), Ok(1024 * 1024 * 1024));
+    assert_eq!(parse_size("2Tb"), Ok(2 << 40));
+}
+
+#[test]
+fn test_parse_size_rejects_invalid_sizes() {
+    for size in ["", "GB", "1.5GB", "-1KB", "10 kilobytes", "1PB"] {
+        assert!(parse_size(size).is_err(), "{size}");
+    }
+    assert!(
+        parse_size("99999999999TB")
+            .unwrap_err()
+            .contains("too large")
+    );
+}
+
+#[test]
+fn test_parse_duration() {
+    let days = |d: u64| Duration::from_secs(d * 86_400);
+    assert_eq!(parse_duration("30d"), Ok(days(30)));
+    assert_eq!(parse_duration("2w"), Ok(days(14)));
+    assert_eq!(parse_duration("6mo"), Ok(days(180)));
+    assert_eq!(parse_duration("1 Y"), Ok(days(365)));
+    assert_eq!(duration_days(parse_duration("2w").unwrap()), 14);
+}
+
+#[test]
+fn test_parse_duration_rejects_invalid_durations() {
+    for duration in ["", "30", "d", "30m", "1.5d", "-2w", "3 fortnights"] {
+        assert!(parse_duration(duration).is_err(), "{duration}");
+    }
+}
@@ -0,0 +1,325 @@
+//! Machine-readable validation of rule files.
+//!
+//! Collects every problem found in a rule file as a [`ValidationProblem`], with
+//! the position of the offending rule where it can be determined, so editors
+//! and CI jobs can show them inline instead of parsing human-readable output.
+//!
+//! Where [`Rule::validate`] stops at the first error of a rule, deep
+//! validation here also checks every regex, date range and destination of a
+//! rule on its own, so all of them are reported along with the field.
+
+use crate::common::file_format::FileFormat;
+use crate::rules::rule::{Action, Conditions, Rule};
+use crate::rules::rules_file::RulesFile;
+use crate::rules::units::{parse_duration, parse_size};
+use crate::utils::path_template::{validate_destination, validate_path_template};
+use regex::Regex;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::fs;
+use std::path::Path;
+
+/// How serious a validation problem is.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Severity {
+    /// The file cannot be used as is.
+    Error,
+    /// The file works, but probably not as intended.
+    Warning,
+}
+
+/// A single problem found in a rule file.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ValidationProblem {
+    /// ID of the rule the problem belongs to, or `None` for problems of the whole file.
+    pub rule_id: Option<String>,
+    /// Field of the rule the problem is in, e.g. `when.filename` or `then[0].to`, if known.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub field: Option<String>,
+    pub severity: Severity,
+    pub message: String,
+    /// 1-based line of the problem, if known.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub line: Option<usize>,
+    /// 1-based column of the problem, if known.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub column: Option<usize>,
+}
+
+impl ValidationProblem {
+    fn new(severity: Severity, rule_id: Option<&str>, message: String) -> Self {
+        Self {
+            rule_id: rule_id.map(str::to_string),
+            field: None,
+            severity,
+            message,
+            line: None,
+            column: None,
+        }
+    }
+
+    fn in_field(mut self, field: String) -> Self {
+        self.field = Some(field);
+        self
+    }
+
+    fn at(mut self, position: Option<(usize, usize)>) -> Self {
+        if let Some((line, column)) = position {
+            self.line = Some(line);
+            self.column = Some(column);
+        }
+        self
+    }
+}
+
+/// Validates a rule file, returning all problems found.
+///
+/// With `deep`, the content of each rule is validated as well, not just the
+/// structure of the file.
+pub fn validate_file(path: &Path, deep: bool) -> Vec<ValidationProblem> {
+    match fs::read_to_string(path) {
+        Ok(content) if FileFormat::from_path(path) == FileFormat::Toml => {
+            validate_toml_content(&content, deep)
+        }
+        Ok(content) => validate_content(&content, deep),
+        Err(e) => vec![ValidationProblem::new(
+            Severity::Error,
+            None,
+            format!("Failed to read file: {e}"),
+        )],
+    }
+}
+
+/// Validates the content of a TOML rules file, returning all problems found.
+///
+/// Problems of a rule carry no position, only the parse error does.
+pub fn validate_toml_content(content: &str, deep: bool) -> Vec<ValidationProblem> {
+    match toml::from_str::<RulesFile>(content) {
+        Ok(rules_file) => validate_rules(&rules_file.rules, None, deep),
+        Err(e) => {
+            let position = e.span().map(|span| line_and_column(content, span.start));
+            vec![
+                ValidationProblem::new(
+                    Severity::Error,
+                    None,
+                    format!("TOML parsing failed: {}", e.message()),
+                )
+                .at(position),
+            ]
+        }
+    }
+}
+
+/// Validates the content of a rule file, returning all problems found.
+pub fn validate_content(content: &str, deep: bool) -> Vec<ValidationProblem> {
+    let rules = match Rule::parse_all(content) {
+        Ok(rules) => rules,
+        Err(e) => {
+            let position = e.location().map(|l| (l.line(), l.column()));
+            return vec![
+                ValidationProblem::new(Severity::Error, None, format!("YAML parsing failed: {e}"))
+                    .at(position),
+            ];
+        }
+    };
+
+    validate_rules(&rules, Some(content), deep)
+}
+
+/// Validates parsed rules, locating their problems in the YAML `content` they
+/// were parsed from, if given
+fn validate_rules(rules: &[Rule], content: Option<&str>, deep: bool) -> Vec<ValidationProblem> {
+    let mut problems = Vec::new();
+    let mut seen_ids: HashMap<&str, usize> = HashMap::new();
+    for rule in rules {
+        let occurrence = seen_ids.entry(rule.id.as_str()).or_default();
+        let position = content.and_then(|content| rule_position(content, &rule.id, *occurrence));
+        if !rule.id.is_empty() && *occurrence > 0 {
+            problems.push(
+                ValidationProblem::new(
+                    Severity::Error,
+                    Some(&rule.id),
+                    format!("Duplicate rule ID '{}'; rule IDs must be unique", rule.id),
+                )
+                .in_field("id".to_string())
+                .at(position),
+            );
+        }
+        *occurrence += 1;
+
+        let rule_id = Some(rule.id.as_str()).filter(|id| !id.is_empty());
+        let fields: Vec<_> = if deep {
+            field_problems(rule)
+                .into_iter()
+                .map(|(severity, field, message)| {
+                    ValidationProblem::new(severity, rule_id, message)
+                        .in_field(field)
+                        .at(position)
+                })
+                .collect()
+        } else {
+            Vec::new()
+        };
+        if let Err(e) = rule.validate(deep) {
+            let message = e.to_string();
+            // The first error of the rule may be one of the field problems already
+            if !fields.iter().any(|p| message.ends_with(&p.message)) {
+                problems
+                    .push(ValidationProblem::new(Severity::Error, rule_id, message).at(position));
+            }
+        }
+        problems.extend(fields);
+    }
+    problems
+}
+
+/// Checks the regexes, globs, date ranges and destinations of a rule one by
+/// one, returning the severity, field and message of every problem.
+fn field_problems(rule: &Rule) -> Vec<(Severity, String, String)> {
+    let mut problems = Vec::new();
+    condition_problems(&rule.when, "when", &mut problems);
+
+    for (i, action) in rule.then.iter().enumerate() {
+        let (to, path_template) = match action {
+            Action::Move(inner) => (&inner.to, &inner.path_template),
+            Action::Copy(inner) => (&inner.to, &inner.path_template),
+            Action::Symlink(inner) => (&inner.to, &inner.path_template),
+            _ => continue,
+        };
+        let field = format!("then[{i}].to");
+        if to.trim().is_empty() {
+            problems.push((Severity::Error, field, "Missing destination path".into()));
+        } else if let Err(e) = validate_destination(to) {
+            problems.push((Severity::Error, field, e));
+        } else if !to.starts_with(['/', '~', '.', '$']) {
+            problems.push((
+                Severity::Warning,
+                field,
+                format!(
+                    "Destination '{to}' is taken from the root folder; start it with '~/' for a folder in the home directory"
+                ),
+            ));
+        }
+        if let Some(Err(e)) = path_template
+            .as_ref()
+            .map(|template| validate_path_template(&template.format))
+        {
+            problems.push((Severity::Error, format!("then[{i}].path_template"), e));
+        }
+    }
+    problems
+}
+
+/// Adds the problems of a condition group and the groups nested in it, with
+/// fields below `prefix`
+fn condition_problems(
+    conditions: &Conditions,
+    prefix: &str,
+    problems: &mut Vec<(Severity, String, String)>,
+) {
+    for (label, pattern) in [
+        ("filename", &conditions.filename),
+        ("content_regex", &conditions.content_regex),
+    ] {
+        if let Some(Err(e)) = pattern.as_deref().map(Regex::new) {
+            let pattern = pattern.as_deref().unwrap_or_default();
+            problems.push((
+                Severity::Error,
+                format!("{prefix}.{label}"),
+                format!("Invalid {label} regex '{pattern}': {e}"),
+            ));
+        }
+    }
+    for (label, pattern) in [
+        ("filename_glob", &conditions.filename_glob),
+        ("path", &conditions.path),
+    ] {
+        if let Some(Err(e)) = pattern.as_deref().map(glob::Pattern::new) {
+            problems.push((
+                Severity::Error,
+                format!("{prefix}.{label}"),
+                format!("Invalid {label} glob: {e}"),
+            ));
+        }
+    }
+    for (label, date_range) in [
+        ("created_date", &conditions.created_date),
+        ("modified_date", &conditions.modified_date),
+    ] {
+        let message = match date_range.as_ref().map(|range| range.parse()) {
+            Some(Err(e)) => format!("Invalid {label} range: {e}"),
+            Some(Ok((Some(from), Some(to)))) if from > to => {
+                format!("Invalid {label} range: 'from' ({from}) is after 'to' ({to})")
+            }
+            _ => continue,
+        };
+        problems.push((Severity::Error, format!("{prefix}.{label}"), message));
+    }
+    if let Some(Err(e)) = conditions.size_greater_than.as_deref().map(parse_size) {
+        problems.push((
+            Severity::Error,
+            format!("{prefix}.size_greater_than"),
+            format!("Invalid size_greater_than: {e}"),
+        ));
+    }
+    if let Some(Err(e)) = conditions.older_than.as_deref().map(parse_duration) {
+        problems.push((
+            Severity::Error,
+            format!("{prefix}.older_than"),
+            format!("Invalid older_than: {e}"),
+        ));
+    }
+    if conditions.size_greater_than.is_some() && conditions.size_greater_than_kb.is_some() {
+        problems.push((
+            Severity::Error,
+            format!("{prefix}.size_greater_than"),
+            "size_greater_than and size_greater_than_kb can't be combined; use one of them".into(),
+        ));
+    }
+    if conditions.older_than.is_some() && conditions.older_than_days.is_some() {
+        problems.push((
+            Severity::Error,
+            format!("{prefix}.older_than"),
+            "older_than and older_than_days can't be combined; use one of them".into(),
+        ));
+    }
+
+    for (label, groups) in [
+        ("any_of", &conditions.any_of),
+        ("all_of", &conditions.all_of),
+    ] {
+        for (i, group) in groups.iter().flatten().enumerate() {
+            condition_problems(group, &format!("{prefix}.{label}[{i}]"), problems);
+        }
+    }
+    if let Some(group) = &conditions.not {
+        condition_problems(group, &format!("{prefix}.not"), problems);
+    }
+}
+
+/// Finds the line and column of the `id` key of a rule, where `occurrence`
+/// counts the earlier rules with the same ID.
+fn rule_position(content: &str, rule_id: &str, occurrence: usize) -> Option<(usize, usize)> {
+    if rule_id.is_empty() {
+        return None;
+    }
+    let pattern = format!(
+        r#"(?m)(?:^|[\s{{,"'-])(id)["']?\s*:\s*["']?{}["']?\s*(?:$|[,}}#])"#,
+        regex::escape(rule_id)
+    );
+    let id_key = Regex::new(&pattern)
+        .ok()?
+        .captures_iter(content)
+        .nth(occurrence)?
+        .get(1)?;
+    Some(line_and_column(content, id_key.start()))
+}
+
+/// Returns the 1-based line and column of the byte `offset` in `content`
+fn line_and_column(content: &str, offset: usize) -> (usize, usize) {
+    let before = &content[..offset.min(content.len())];
+    let line = before.matches('\n').count() + 1;
+    let column = before.len() - before.rfind('\n').map_or(0, |i| i + 1) + 1;
+    (line, column)
+}
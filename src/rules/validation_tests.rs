@@ -0,0 +1,170 @@
+use super::validation::{Severity, validate_content, validate_file};
+use serde_json::json;
+use tempfile::tempdir;
+
+/// Flow-style rules file: a valid rule, a rule without a name, and a rule
+/// reusing the first ID without any actions
+const RULES_WITH_PROBLEMS: &str = r#"{"rules": [
+  {"id": "photos", "name": "Photos", "enabled": true, "priority": 1,
+   "when": {"extensions": ["jpg"]}, "then": [{"action": "skip"}]},
+  {"id": "nameless", "name": "", "enabled": true, "priority": 1,
+   "when": {}, "then": [{"action": "skip"}]},
+  {"id": "photos", "name": "Photos again", "enabled": true, "priority": 1,
+   "when": {}, "then": []}
+]}"#;
+
+#[test]
+fn test_validate_reports_all_problems_as_json() {
+    let problems = validate_content(RULES_WITH_PROBLEMS, true);
+
+    assert_eq!(
+        serde_json::to_value(&problems).unwrap(),
+        json!([
+            {
+                "rule_id": "nameless",
+                "severity": "error",
+                "message": "rule nameless: name is required",
+                "line": 4,
+                "column": 5
+            },
+            {
+                "rule_id": "photos",
+                "field": "id",
+                "severity": "error",
+                "message": "Duplicate rule ID 'photos'; rule IDs must be unique",
+                "line": 6,
+                "column": 5
+            },
+            {
+                "rule_id": "photos",
+                "severity": "error",
+                "message": "rule photos: at least one action is required",
+                "line": 6,
+                "column": 5
+            }
+        ])
+    );
+
+    // Without deep validation only the structure is checked
+    let shallow = validate_content(RULES_WITH_PROBLEMS, false);
+    assert_eq!(shallow.len(), 1);
+    assert_eq!(shallow[0].field.as_deref(), Some("id"));
+}
+
+#[test]
+fn test_deep_validation_reports_every_field() {
+    let content = r#"{"rules": [
+  {"id": "broken", "name": "Broken", "enabled": true, "priority": 1,
+   "when": {"filename": "(", "modified_date": {"from": "2024-05-01", "to": "2024-01-01"},
+            "any_of": [{"filename_glob": "[z-a"}]},
+   "then": [{"action": "move", "to": "Documents"},
+            {"action": "copy", "to": "/backup/{year}"}]}
+]}"#;
+
+    let problems = validate_content(content, true);
+    let fields: Vec<_> = problems
+        .iter()
+        .map(|p| (p.field.as_deref(), p.severity))
+        .collect();
+    assert_eq!(
+        fields,
+        vec![
+            (Some("when.filename"), Severity::Error),
+            (Some("when.modified_date"), Severity::Error),
+            (Some("when.any_of[0].filename_glob"), Severity::Error),
+            (Some("then[0].to"), Severity::Warning),
+            (Some("then[1].to"), Severity::Error),
+        ]
+    );
+    assert!(
+        problems
+            .iter()
+            .all(|p| p.rule_id.as_deref() == Some("broken"))
+    );
+    assert!(problems[3].message.contains("'~/'"));
+}
+
+#[test]
+fn test_deep_validation_reports_fields_inside_not() {
+    let content = r#"{"rules": [
+  {"id": "broken", "name": "Broken", "enabled": true, "priority": 1,
+   "when": {"extensions": ["png"],
+            "not": {"filename": "(", "all_of": [{"older_than": "soon"}]}},
+   "then": [{"action": "skip"}]}
+]}"#;
+
+    let fields: Vec<_> = validate_content(content, true)
+        .into_iter()
+        .map(|p| p.field)
+        .collect();
+    assert_eq!(
+        fields,
+        vec![
+            Some("when.not.filename".to_string()),
+            Some("when.not.all_of[0].older_than".to_string()),
+        ]
+    );
+}
+
+#[test]
+fn test_deep_validation_reports_both_forms_of_size_once() {
+    let content = r#"{"rules": [
+  {"id": "big", "name": "Big", "enabled": true, "priority": 1,
+   "when": {"size_greater_than": "1GB", "size_greater_than_kb": 1024},
+   "then": [{"action": "skip"}]}
+]}"#;
+
+    let problems = validate_content(content, true);
+    assert_eq!(problems.len(), 1, "{problems:?}");
+    assert_eq!(problems[0].field.as_deref(), Some("when.size_greater_than"));
+    assert!(problems[0].message.contains("can't be combined"));
+}
+
+#[test]
+fn test_validate_reports_parse_errors_with_position() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("broken.yaml");
+    std::fs::write(&path, "{\"id\": \"broken\",\n  \"name\": }\n").unwrap();
+
+    let problems = validate_file(&path, true);
+    assert_eq!(problems.len(), 1);
+    let problem = &problems[0];
+    assert_eq!(problem.rule_id, None);
+    assert_eq!(problem.severity, Severity::Error);
+    assert!(problem.message.starts_with("YAML parsing failed"));
+    assert_eq!(problem.line, Some(2));
+    assert!(problem.column.is_some());
+
+    let missing = validate_file(&dir.path().join("missing.yaml"), true);
+    assert_eq!(missing.len(), 1);
+    assert_eq!(missing[0].line, None);
+}
+
+#[test]
+fn test_validate_toml_rules_file() {
+    let dir = tempdir().unwrap();
+    let path = dir.path().join("rules.toml");
+    std::fs::write(
+        &path,
+        r#"
+[[rules]]
+id = "photos"
+name = "Photos"
+enabled = true
+priority = 1
+when = { filename = "(" }
+then = [{ action = "skip" }]
+"#,
+    )
+    .unwrap();
+
+    let problems = validate_file(&path, true);
+    assert_eq!(problems.len(), 1);
+    assert_eq!(problems[0].rule_id.as_deref(), Some("photos"));
+    assert_eq!(problems[0].field.as_deref(), Some("when.filename"));
+
+    std::fs::write(&path, "[[rules]]\nid = \n").unwrap();
+    let problems = validate_file(&path, true);
+    assert!(problems[0].message.starts_with("TOML parsing failed"));
+    assert_eq!(problems[0].line, Some(2));
+}
@@ -0,0 +1,78 @@
+//! External classifier support for Tooka.
+//!
+//! Runs a user-provided program on a file and reads the category label it
+//! prints to stdout, so rules can match on classifications Tooka cannot make
+//! itself (e.g. an image tagger). The program is killed if it runs longer than
+//! the configured timeout.
+
+use crate::core::error::TookaError;
+use std::io::Read;
+use std::path::Path;
+use std::process::{Command, Stdio};
+use std::thread;
+use std::time::{Duration, Instant};
+
+/// Interval at which a running classifier is checked for completion
+const POLL_INTERVAL: Duration = Duration::from_millis(10);
+
+/// Runs `command` with `args` and the file path as last argument, returning the
+/// trimmed first line of its output.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the command cannot be started, exceeds the
+/// timeout, or exits with a non-zero status.
+pub(crate) fn classify(
+    file_path: &Path,
+    command: &str,
+    args: &[String],
+    timeout: Duration,
+) -> Result<String, TookaError> {
+    log::debug!(
+        "Classifying file: {} with command: {} {}",
+        file_path.display(),
+        command,
+        args.join(" ")
+    );
+    let mut child = Command::new(command)
+        .args(args)
+        .arg(file_path)
+        .stdin(Stdio::null())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::null())
+        .spawn()
+        .map_err(|e| TookaError::Other(format!("Failed to run classifier '{command}': {e}")))?;
+
+    // Read output on a separate thread so a chatty classifier cannot fill the pipe and stall
+    let mut stdout = child.stdout.take();
+    let reader = thread::spawn(move || {
+        let mut output = String::new();
+        if let Some(stdout) = stdout.as_mut() {
+            let _ = stdout.read_to_string(&mut output);
+        }
+        output
+    });
+
+    let deadline = Instant::now() + timeout;
+    let status = loop {
+        if let Some(status) = child.try_wait()? {
+            break status;
+        }
+        if Instant::now() >= deadline {
+            let _ = child.kill();
+            let _ = child.wait();
+            return Err(TookaError::Other(format!(
+                "Classifier '{command}' timed out after {}s",
+                timeout.as_secs_f64()
+            )));
+        }
+        thread::sleep(POLL_INTERVAL);
+    };
+
+    let output = reader.join().unwrap_or_default();
+    if !status.success() {
+        return Err(TookaError::Other(format!(
+            "Classifier '{command}' failed with status: {status}"
+        )));
+    }
+    Ok(output.lines().next().unwrap_or_default().trim().to_string())
+}
@@ -1,7 +1,7 @@
 //! Date parsing utilities for Tooka.
 //!
 //! Supports both absolute dates (RFC3339 format) and relative dates
-//! like "now", "-7d", "+2w", etc.
+//! like "now", "-7d", "+2w", etc., as well as run durations like "30m".
 
 use chrono::{DateTime, Duration, Utc};
 use std::str::FromStr;
@@ -82,6 +82,37 @@ fn parse_relative_date(date_str: &str) -> Result<DateTime<Utc>, String> {
     Ok(Utc::now() + duration)
 }
 
+/// Parses a duration such as "90s", "30m", "2h", "7d" or "2w" (seconds,
+/// minutes, hours, days, weeks).
+///
+/// Unlike relative dates, `m` means minutes here, since run durations are
+/// measured in minutes rather than months.
+pub fn parse_duration(duration_str: &str) -> Result<std::time::Duration, String> {
+    let duration_str = duration_str.trim();
+    let split = duration_str
+        .find(|c: char| !c.is_ascii_digit())
+        .unwrap_or(duration_str.len());
+    let (number_str, unit) = duration_str.split_at(split);
+
+    let number: u64 = number_str.parse().map_err(|_| {
+        format!("Invalid duration: '{duration_str}'. Expected e.g. '90s', '30m', '2h'")
+    })?;
+    let seconds = match unit.to_ascii_lowercase().as_str() {
+        "s" => number,
+        "m" => number.saturating_mul(60),
+        "h" => number.saturating_mul(3600),
+        "d" => number.saturating_mul(86_400),
+        "w" => number.saturating_mul(604_800),
+        _ => {
+            return Err(format!(
+                "Invalid duration unit in '{duration_str}'. Supported units: s (seconds), m (minutes), h (hours), d (days), w (weeks)"
+            ));
+        }
+    };
+
+    Ok(std::time::Duration::from_secs(seconds))
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -164,4 +195,18 @@ mod tests {
         assert!(parse_date("-").is_err()); // Missing number and unit
         assert!(parse_date("-abc").is_err()); // Invalid number
     }
+
+    #[test]
+    fn test_parse_duration() {
+        use std::time::Duration as StdDuration;
+        assert_eq!(parse_duration("90s"), Ok(StdDuration::from_secs(90)));
+        assert_eq!(parse_duration("30m"), Ok(StdDuration::from_secs(1800)));
+        assert_eq!(parse_duration(" 2H "), Ok(StdDuration::from_secs(7200)));
+        assert!(parse_duration("30").is_err()); // Missing unit
+        assert!(parse_duration("m").is_err()); // Missing number
+        assert!(parse_duration("-5m").is_err()); // Negative
+        assert_eq!(parse_duration("7d"), Ok(StdDuration::from_secs(604_800)));
+        assert_eq!(parse_duration("2w"), Ok(StdDuration::from_secs(1_209_600)));
+        assert!(parse_duration("1y").is_err()); // Unsupported unit
+    }
 }
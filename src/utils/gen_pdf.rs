@@ -308,7 +308,9 @@ impl PDFGenerator {
         let color = match result.action.as_str() {
             "move" => (0.2, 0.4, 0.8),    // Blue-ish
             "copy" => (0.2, 0.7, 0.3),    // Green-ish
+            "symlink" => (0.2, 0.6, 0.6), // Teal-ish
             "delete" => (0.85, 0.3, 0.3), // Red-ish
+            "trash" => (0.85, 0.3, 0.3),  // Red-ish
             "rename" => (0.8, 0.6, 0.2),  // Orange-ish
             "execute" => (0.5, 0.2, 0.7), // Purple-ish
             "skip" => (0.6, 0.6, 0.6),    // Grey
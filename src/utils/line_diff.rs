@@ -0,0 +1,137 @@
+//! Line diffs for Tooka.
+//!
+//! Compares two texts line by line, e.g. a rule before and after editing, using
+//! the longest common subsequence of their lines. Meant for the small texts of
+//! single rules: time and memory grow with the product of the line counts.
+
+/// A line of a diff.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum DiffLine<'a> {
+    /// Line in both texts.
+    Same(&'a str),
+    /// Line only in the old text.
+    Removed(&'a str),
+    /// Line only in the new text.
+    Added(&'a str),
+}
+
+/// Returns the lines of `old` and `new` in order, each marked as unchanged,
+/// removed or added. Removed lines come before the lines added in their place.
+pub fn diff_lines<'a>(old: &'a str, new: &'a str) -> Vec<DiffLine<'a>> {
+    let old: Vec<&str> = old.lines().collect();
+    let new: Vec<&str> = new.lines().collect();
+
+    // common[i][j] is the length of the longest common subsequence of old[i..] and new[j..]
+    let mut common = vec![vec![0usize; new.len() + 1]; old.len() + 1];
+    for i in (0..old.len()).rev() {
+        for j in (0..new.len()).rev() {
+            common[i][j] = if old[i] == new[j] {
+                common[i + 1][j + 1] + 1
+            } else {
+                common[i + 1][j].max(common[i][j + 1])
+            };
+        }
+    }
+
+    let mut diff = Vec::with_capacity(old.len().max(new.len()));
+    let (mut i, mut j) = (0, 0);
+    while i < old.len() && j < new.len() {
+        if old[i] == new[j] {
+            diff.push(DiffLine::Same(old[i]));
+            i += 1;
+            j += 1;
+        } else if common[i + 1][j] >= common[i][j + 1] {
+            diff.push(DiffLine::Removed(old[i]));
+            i += 1;
+        } else {
+            diff.push(DiffLine::Added(new[j]));
+            j += 1;
+        }
+    }
+    diff.extend(old[i..].iter().copied().map(DiffLine::Removed));
+    diff.extend(new[j..].iter().copied().map(DiffLine::Added));
+    diff
+}
+
+/// Returns true if the diff contains any removed or added line.
+pub fn has_changes(diff: &[DiffLine]) -> bool {
+    diff.iter().any(|line| !matches!(line, DiffLine::Same(_)))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_diff_lines_marks_changes() {
+        let old = "id: docs\nname: Documents\npriority: 1\nenabled: true";
+        let new = "id: docs\nname: Papers\npriority: 1\nenabled: true\nmax_per_run: 5";
+
+        assert_eq!(
+            diff_lines(old, new),
+            vec![
+                DiffLine::Same("id: docs"),
+                DiffLine::Removed("name: Documents"),
+                DiffLine::Added("name: Papers"),
+                DiffLine::Same("priority: 1"),
+                DiffLine::Same("enabled: true"),
+                DiffLine::Added("max_per_run: 5"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_diff_lines_of_equal_texts() {
+        assert_eq!(
+            diff_lines("a\nb", "a\nb"),
+            vec![DiffLine::Same("a"), DiffLine::Same("b")]
+        );
+        assert!(diff_lines("", "").is_empty());
+    }
+
+    #[test]
+    fn test_diff_lines_against_empty_text() {
+        assert_eq!(
+            diff_lines("", "a\nb"),
+            vec![DiffLine::Added("a"), DiffLine::Added("b")]
+        );
+        assert_eq!(
+            diff_lines("a\nb", ""),
+            vec![DiffLine::Removed("a"), DiffLine::Removed("b")]
+        );
+    }
+
+    #[test]
+    fn test_diff_lines_keeps_common_lines_around_removals() {
+        assert_eq!(
+            diff_lines("a\nb\nc\nd", "b\nd"),
+            vec![
+                DiffLine::Removed("a"),
+                DiffLine::Same("b"),
+                DiffLine::Removed("c"),
+                DiffLine::Same("d"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_diff_lines_lists_removed_before_added() {
+        assert_eq!(
+            diff_lines("a\nb\nc", "x\ny\nc"),
+            vec![
+                DiffLine::Removed("a"),
+                DiffLine::Removed("b"),
+                DiffLine::Added("x"),
+                DiffLine::Added("y"),
+                DiffLine::Same("c"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_has_changes() {
+        assert!(!has_changes(&diff_lines("a\nb", "a\nb")));
+        assert!(has_changes(&diff_lines("a\nb", "a")));
+        assert!(has_changes(&diff_lines("", "a")));
+    }
+}
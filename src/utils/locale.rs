@@ -0,0 +1,232 @@
+//! Locale-aware month names for Tooka templates.
+//!
+//! Provides full and abbreviated month names for a small set of languages,
+//! selected by their ISO 639-1 code (e.g. `en`, `de`). Region suffixes such as
+//! `de-AT` or `pt_BR` are accepted and resolve to the base language. English is
+//! the default and the fallback for unsupported locales.
+
+/// Locale used when none is given or the requested one is not supported
+pub(crate) const DEFAULT_LOCALE: &str = "en";
+
+/// Full and abbreviated month names, indexed by month (January first)
+struct MonthNames {
+    full: [&'static str; 12],
+    short: [&'static str; 12],
+}
+
+const EN: MonthNames = MonthNames {
+    full: [
+        "January",
+        "February",
+        "March",
+        "April",
+        "May",
+        "June",
+        "July",
+        "August",
+        "September",
+        "October",
+        "November",
+        "December",
+    ],
+    short: [
+        "Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec",
+    ],
+};
+
+const DE: MonthNames = MonthNames {
+    full: [
+        "Januar",
+        "Februar",
+        "März",
+        "April",
+        "Mai",
+        "Juni",
+        "Juli",
+        "August",
+        "September",
+        "Oktober",
+        "November",
+        "Dezember",
+    ],
+    short: [
+        "Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez",
+    ],
+};
+
+const FR: MonthNames = MonthNames {
+    full: [
+        "janvier",
+        "février",
+        "mars",
+        "avril",
+        "mai",
+        "juin",
+        "juillet",
+        "août",
+        "septembre",
+        "octobre",
+        "novembre",
+        "décembre",
+    ],
+    short: [
+        "janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc",
+    ],
+};
+
+const ES: MonthNames = MonthNames {
+    full: [
+        "enero",
+        "febrero",
+        "marzo",
+        "abril",
+        "mayo",
+        "junio",
+        "julio",
+        "agosto",
+        "septiembre",
+        "octubre",
+        "noviembre",
+        "diciembre",
+    ],
+    short: [
+        "ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic",
+    ],
+};
+
+const IT: MonthNames = MonthNames {
+    full: [
+        "gennaio",
+        "febbraio",
+        "marzo",
+        "aprile",
+        "maggio",
+        "giugno",
+        "luglio",
+        "agosto",
+        "settembre",
+        "ottobre",
+        "novembre",
+        "dicembre",
+    ],
+    short: [
+        "gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic",
+    ],
+};
+
+const NL: MonthNames = MonthNames {
+    full: [
+        "januari",
+        "februari",
+        "maart",
+        "april",
+        "mei",
+        "juni",
+        "juli",
+        "augustus",
+        "september",
+        "oktober",
+        "november",
+        "december",
+    ],
+    short: [
+        "jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec",
+    ],
+};
+
+const PT: MonthNames = MonthNames {
+    full: [
+        "janeiro",
+        "fevereiro",
+        "março",
+        "abril",
+        "maio",
+        "junho",
+        "julho",
+        "agosto",
+        "setembro",
+        "outubro",
+        "novembro",
+        "dezembro",
+    ],
+    short: [
+        "jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez",
+    ],
+};
+
+/// Returns the month names for a locale code, falling back to English.
+fn names_for(locale: &str) -> &'static MonthNames {
+    let language = locale
+        .split(['-', '_'])
+        .next()
+        .unwrap_or_default()
+        .to_lowercase();
+
+    match language.as_str() {
+        "en" => &EN,
+        "de" => &DE,
+        "fr" => &FR,
+        "es" => &ES,
+        "it" => &IT,
+        "nl" => &NL,
+        "pt" => &PT,
+        _ => {
+            log::warn!("Unsupported locale '{locale}', using '{DEFAULT_LOCALE}' month names");
+            &EN
+        }
+    }
+}
+
+/// Returns the name of `month` (1-12) in the given locale, abbreviated if `short` is set.
+///
+/// Returns an empty string for months outside 1-12.
+pub(crate) fn month_name(month: u32, locale: &str, short: bool) -> String {
+    let Some(index) = month.checked_sub(1).filter(|i| *i < 12) else {
+        return String::new();
+    };
+    let names = names_for(locale);
+    let table = if short { &names.short } else { &names.full };
+    table[index as usize].to_string()
+}
+
+/// Parses `month_name[:locale]` or `month_short[:locale]` into (short, locale).
+pub(crate) fn parse_month_filter(filter: &str) -> Option<(bool, &str)> {
+    let (name, locale) = filter
+        .split_once(':')
+        .map_or((filter, DEFAULT_LOCALE), |(n, l)| (n, l.trim()));
+    match name.trim() {
+        "month_name" => Some((false, locale)),
+        "month_short" => Some((true, locale)),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_month_name_english() {
+        assert_eq!(month_name(1, "en", false), "January");
+        assert_eq!(month_name(3, "en", false), "March");
+        assert_eq!(month_name(12, "en", true), "Dec");
+    }
+
+    #[test]
+    fn test_month_name_other_locales() {
+        assert_eq!(month_name(3, "de", false), "März");
+        assert_eq!(month_name(8, "fr", false), "août");
+        assert_eq!(month_name(5, "es", true), "may");
+        assert_eq!(month_name(10, "nl", true), "okt");
+        assert_eq!(month_name(2, "pt-BR", false), "fevereiro");
+        assert_eq!(month_name(6, "it_IT", false), "giugno");
+    }
+
+    #[test]
+    fn test_month_name_fallbacks() {
+        assert_eq!(month_name(3, "xx", false), "March");
+        assert_eq!(month_name(3, "", true), "Mar");
+        assert_eq!(month_name(0, "en", false), "");
+        assert_eq!(month_name(13, "en", false), "");
+    }
+}
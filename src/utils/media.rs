@@ -0,0 +1,361 @@
+//! Lightweight media inspection for Tooka.
+//!
+//! Detects obviously broken files without fully decoding them: empty files,
+//! and JPEG, PNG, GIF and MP4/MOV files whose structure ends before the data
+//! they declare. Formats that are not recognized are only checked for being
+//! empty.
+//!
+//! Also probes MP4/MOV videos for their duration and picture size by reading
+//! the movie and track headers, without decoding any media data.
+
+use std::fs::File;
+use std::io::{self, Read, Seek, SeekFrom};
+use std::path::Path;
+
+/// Size of the header read to identify the file format
+const SNIFF_LEN: usize = 16;
+/// Number of trailing bytes inspected for end-of-data markers
+const TAIL_LEN: u64 = 64;
+/// Largest `moov` box read when probing a video; real ones are far smaller
+const MAX_MOOV_LEN: u64 = 64 * 1024 * 1024;
+
+/// Recognized media container formats
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum MediaFormat {
+    Jpeg,
+    Png,
+    Gif,
+    IsoBmff,
+}
+
+/// Duration and picture size of a video file.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub(crate) struct VideoInfo {
+    /// Duration in seconds.
+    pub duration_secs: f64,
+    /// Width of the first video track in pixels.
+    pub width: u32,
+    /// Height of the first video track in pixels.
+    pub height: u32,
+}
+
+/// Returns true if the file is empty or a recognized media file that is truncated.
+///
+/// Returns `None` for files that cannot be opened or read, e.g. for lack of
+/// permissions or because another process holds them; whether they are
+/// corrupt is unknown, and they may well be fine.
+pub(crate) fn is_corrupt_media(file_path: &Path) -> Option<bool> {
+    check_media(file_path)
+        .inspect_err(|e| {
+            log::warn!(
+                "Failed to inspect '{}' for corruption: {}",
+                file_path.display(),
+                e
+            );
+        })
+        .ok()
+}
+
+fn check_media(file_path: &Path) -> io::Result<bool> {
+    let mut file = File::open(file_path)?;
+    let metadata = file.metadata()?;
+    if !metadata.is_file() {
+        return Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            "not a regular file",
+        ));
+    }
+    let len = metadata.len();
+    if len == 0 {
+        log::debug!("File '{}' is empty", file_path.display());
+        return Ok(true);
+    }
+
+    let mut header = [0u8; SNIFF_LEN];
+    let read = read_up_to(&mut file, &mut header)?;
+    let Some(format) = detect_format(&header[..read]) else {
+        return Ok(false);
+    };
+    log::debug!(
+        "Checking '{}' as {:?} ({} bytes)",
+        file_path.display(),
+        format,
+        len
+    );
+
+    let intact = match format {
+        MediaFormat::Jpeg => check_jpeg(&mut file, len)?,
+        MediaFormat::Png => check_png(&mut file, len)?,
+        MediaFormat::Gif => check_gif(&mut file, len)?,
+        MediaFormat::IsoBmff => check_iso_bmff(&mut file, len)?,
+    };
+    Ok(!intact)
+}
+
+fn detect_format(header: &[u8]) -> Option<MediaFormat> {
+    if header.starts_with(&[0xFF, 0xD8, 0xFF]) {
+        Some(MediaFormat::Jpeg)
+    } else if header.starts_with(&[0x89, b'P', b'N', b'G', 0x0D, 0x0A, 0x1A, 0x0A]) {
+        Some(MediaFormat::Png)
+    } else if header.starts_with(b"GIF87a") || header.starts_with(b"GIF89a") {
+        Some(MediaFormat::Gif)
+    } else if header.len() >= 8 && &header[4..8] == b"ftyp" {
+        Some(MediaFormat::IsoBmff)
+    } else {
+        None
+    }
+}
+
+/// Walks the JPEG segments up to the start of scan and checks for the end-of-image marker.
+fn check_jpeg(file: &mut File, len: u64) -> io::Result<bool> {
+    let mut pos = 2;
+    loop {
+        let mut marker = [0u8; 4];
+        file.seek(SeekFrom::Start(pos))?;
+        if read_up_to(file, &mut marker)? < 4 || marker[0] != 0xFF {
+            return Ok(false);
+        }
+        let segment_len = u64::from(u16::from_be_bytes([marker[2], marker[3]]));
+        if segment_len < 2 || pos + 2 + segment_len > len {
+            return Ok(false);
+        }
+        pos += 2 + segment_len;
+        // Start of scan: entropy-coded data follows until the end-of-image marker
+        if marker[1] == 0xDA {
+            break;
+        }
+    }
+
+    let tail = read_tail(file, len)?;
+    let trimmed = trim_trailing_padding(&tail);
+    Ok(trimmed.ends_with(&[0xFF, 0xD9]))
+}
+
+/// Walks the PNG chunks and requires a complete `IEND` chunk.
+fn check_png(file: &mut File, len: u64) -> io::Result<bool> {
+    let mut pos = 8;
+    while pos + 8 <= len {
+        let mut chunk_header = [0u8; 8];
+        file.seek(SeekFrom::Start(pos))?;
+        file.read_exact(&mut chunk_header)?;
+        let data_len = u64::from(u32::from_be_bytes([
+            chunk_header[0],
+            chunk_header[1],
+            chunk_header[2],
+            chunk_header[3],
+        ]));
+        // Chunk header, data and CRC
+        let chunk_end = pos + 8 + data_len + 4;
+        if chunk_end > len {
+            return Ok(false);
+        }
+        if &chunk_header[4..8] == b"IEND" {
+            return Ok(true);
+        }
+        pos = chunk_end;
+    }
+    Ok(false)
+}
+
+/// Requires the GIF trailer byte at the end of the data.
+fn check_gif(file: &mut File, len: u64) -> io::Result<bool> {
+    let tail = read_tail(file, len)?;
+    let trimmed = trim_trailing_padding(&tail);
+    Ok(trimmed.last() == Some(&0x3B))
+}
+
+/// Walks the top-level boxes of an MP4/MOV file and checks none extends past the end.
+fn check_iso_bmff(file: &mut File, len: u64) -> io::Result<bool> {
+    let mut pos = 0;
+    while pos < len {
+        let mut box_header = [0u8; 16];
+        file.seek(SeekFrom::Start(pos))?;
+        let read = read_up_to(file, &mut box_header)?;
+        if read < 8 {
+            return Ok(false);
+        }
+        let size32 =
+            u32::from_be_bytes([box_header[0], box_header[1], box_header[2], box_header[3]]);
+        let box_size = match size32 {
+            // Box extends to the end of the file
+            0 => return Ok(true),
+            1 => {
+                if read < 16 {
+                    return Ok(false);
+                }
+                let mut large = [0u8; 8];
+                large.copy_from_slice(&box_header[8..16]);
+                u64::from_be_bytes(large)
+            }
+            size => u64::from(size),
+        };
+        if box_size < 8 || pos + box_size > len {
+            return Ok(false);
+        }
+        pos += box_size;
+    }
+    Ok(true)
+}
+
+/// Probes an MP4/MOV file for its duration and the picture size of its first video track.
+///
+/// Returns `None` for other formats, files without a video track, and files
+/// whose headers cannot be parsed.
+pub(crate) fn probe_video(file_path: &Path) -> Option<VideoInfo> {
+    let mut file = File::open(file_path).ok()?;
+    let len = file.metadata().ok()?.len();
+    let mut header = [0u8; SNIFF_LEN];
+    let read = read_up_to(&mut file, &mut header).ok()?;
+    if detect_format(&header[..read]) != Some(MediaFormat::IsoBmff) {
+        return None;
+    }
+
+    let moov = read_moov(&mut file, len)?;
+    let info = parse_moov(&moov);
+    if info.is_none() {
+        log::debug!("No video track found in '{}'", file_path.display());
+    }
+    info
+}
+
+/// Finds the top-level `moov` box and reads its contents
+fn read_moov(file: &mut File, len: u64) -> Option<Vec<u8>> {
+    let mut pos = 0;
+    while pos + 8 <= len {
+        let mut box_header = [0u8; 16];
+        file.seek(SeekFrom::Start(pos)).ok()?;
+        let read = read_up_to(file, &mut box_header).ok()?;
+        let (header_len, box_size) = match be_u32(&box_header[..read], 0)? {
+            0 => (8, len - pos),
+            1 => (16, be_u64(&box_header[..read], 8)?),
+            size => (8, u64::from(size)),
+        };
+        if box_size < header_len || pos + box_size > len {
+            return None;
+        }
+        if &box_header[4..8] == b"moov" {
+            let body_len = box_size - header_len;
+            if body_len > MAX_MOOV_LEN {
+                return None;
+            }
+            file.seek(SeekFrom::Start(pos + header_len)).ok()?;
+            let mut body = vec![0u8; usize::try_from(body_len).ok()?];
+            file.read_exact(&mut body).ok()?;
+            return Some(body);
+        }
+        pos += box_size;
+    }
+    None
+}
+
+/// Reads the duration from `mvhd` and the picture size from the first video `tkhd`
+fn parse_moov(moov: &[u8]) -> Option<VideoInfo> {
+    let mut duration_secs = None;
+    let mut size = None;
+
+    for (kind, body) in child_boxes(moov) {
+        match &kind {
+            b"mvhd" => duration_secs = parse_mvhd(body),
+            b"trak" if size.is_none() => {
+                size = child_boxes(body)
+                    .find(|(kind, _)| kind == b"tkhd")
+                    .and_then(|(_, tkhd)| parse_tkhd(tkhd));
+            }
+            _ => {}
+        }
+    }
+
+    let (width, height) = size?;
+    Some(VideoInfo {
+        duration_secs: duration_secs?,
+        width,
+        height,
+    })
+}
+
+/// Returns the movie duration in seconds from an `mvhd` box
+fn parse_mvhd(body: &[u8]) -> Option<f64> {
+    let (timescale, duration) = match body.first()? {
+        0 => (be_u32(body, 12)?, u64::from(be_u32(body, 16)?)),
+        1 => (be_u32(body, 20)?, be_u64(body, 24)?),
+        _ => return None,
+    };
+    if timescale == 0 {
+        return None;
+    }
+    #[allow(clippy::cast_precision_loss)]
+    Some(duration as f64 / f64::from(timescale))
+}
+
+/// Returns the picture size from a `tkhd` box, or `None` for tracks without
+/// one (such as audio tracks)
+fn parse_tkhd(body: &[u8]) -> Option<(u32, u32)> {
+    let offset = match body.first()? {
+        0 => 76,
+        1 => 88,
+        _ => return None,
+    };
+    // Width and height are 16.16 fixed-point numbers
+    let width = be_u32(body, offset)? >> 16;
+    let height = be_u32(body, offset + 4)? >> 16;
+    (width > 0 && height > 0).then_some((width, height))
+}
+
+/// Iterates over the boxes contained in `data` as (type, body) pairs
+fn child_boxes(data: &[u8]) -> impl Iterator<Item = ([u8; 4], &[u8])> {
+    let mut pos = 0usize;
+    std::iter::from_fn(move || {
+        let rest = data.get(pos..)?;
+        let (header_len, box_size) = match be_u32(rest, 0)? {
+            0 => (8, rest.len()),
+            1 => (16, usize::try_from(be_u64(rest, 8)?).ok()?),
+            size => (8, usize::try_from(size).ok()?),
+        };
+        if box_size < header_len || box_size > rest.len() {
+            return None;
+        }
+        let kind = rest[4..8].try_into().ok()?;
+        pos += box_size;
+        Some((kind, &rest[header_len..box_size]))
+    })
+}
+
+fn be_u32(data: &[u8], offset: usize) -> Option<u32> {
+    let bytes = data.get(offset..offset + 4)?;
+    Some(u32::from_be_bytes(bytes.try_into().ok()?))
+}
+
+fn be_u64(data: &[u8], offset: usize) -> Option<u64> {
+    let bytes = data.get(offset..offset + 8)?;
+    Some(u64::from_be_bytes(bytes.try_into().ok()?))
+}
+
+/// Reads the last bytes of the file
+fn read_tail(file: &mut File, len: u64) -> io::Result<Vec<u8>> {
+    let start = len.saturating_sub(TAIL_LEN);
+    file.seek(SeekFrom::Start(start))?;
+    let mut tail = Vec::with_capacity(TAIL_LEN as usize);
+    file.read_to_end(&mut tail)?;
+    Ok(tail)
+}
+
+/// Strips zero and whitespace padding some writers append after the end marker
+fn trim_trailing_padding(data: &[u8]) -> &[u8] {
+    let end = data
+        .iter()
+        .rposition(|b| !matches!(b, 0x00 | b'\n' | b'\r' | b' '))
+        .map_or(0, |i| i + 1);
+    &data[..end]
+}
+
+/// Reads into `buf` until it is full or the end of the file is reached
+fn read_up_to(file: &mut File, buf: &mut [u8]) -> io::Result<usize> {
+    let mut total = 0;
+    while total < buf.len() {
+        match file.read(&mut buf[total..])? {
+            0 => break,
+            n => total += n,
+        }
+    }
+    Ok(total)
+}
@@ -0,0 +1,168 @@
+//! Content-based MIME type detection for Tooka.
+//!
+//! Identifies a file's type from the magic bytes at its start rather than from
+//! its extension, so a PNG saved as `photo.jpg` is still reported as
+//! `image/png`. Only the first 512 bytes are read. Files without a known
+//! signature are reported as `text/plain` if they look like text, and as
+//! unknown otherwise.
+
+use std::fs::File;
+use std::io::{self, Read};
+use std::path::Path;
+
+/// Number of leading bytes inspected
+const SNIFF_LEN: u64 = 512;
+
+/// MIME type detected for ZIP archives, which are also the container of many
+/// document formats (DOCX, ODT, EPUB, JAR, ...)
+pub(crate) const ZIP_MIME: &str = "application/zip";
+/// MIME type detected for files that look like text but have no signature
+pub(crate) const TEXT_MIME: &str = "text/plain";
+
+/// Signatures as (offset, magic bytes, MIME type), checked in order
+const SIGNATURES: &[(usize, &[u8], &str)] = &[
+    (0, b"\x89PNG\r\n\x1a\n", "image/png"),
+    (0, b"\xff\xd8\xff", "image/jpeg"),
+    (0, b"GIF87a", "image/gif"),
+    (0, b"GIF89a", "image/gif"),
+    (0, b"II*\x00", "image/tiff"),
+    (0, b"MM\x00*", "image/tiff"),
+    (0, b"\x00\x00\x01\x00", "image/x-icon"),
+    (0, b"%PDF-", "application/pdf"),
+    (0, b"PK\x03\x04", ZIP_MIME),
+    (0, b"PK\x05\x06", ZIP_MIME),
+    (0, b"\x1f\x8b", "application/gzip"),
+    (0, b"BZh", "application/x-bzip2"),
+    (0, b"\xfd7zXZ\x00", "application/x-xz"),
+    (0, b"7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"),
+    (0, b"Rar!\x1a\x07", "application/vnd.rar"),
+    (0, b"ID3", "audio/mpeg"),
+    (0, b"\xff\xfb", "audio/mpeg"),
+    (0, b"fLaC", "audio/flac"),
+    (0, b"OggS", "audio/ogg"),
+    (0, b"\x1a\x45\xdf\xa3", "video/webm"),
+    (0, b"\x7fELF", "application/x-executable"),
+    (0, b"SQLite format 3\x00", "application/vnd.sqlite3"),
+    (257, b"ustar", "application/x-tar"),
+];
+
+/// Detects the MIME type of a file from its content.
+///
+/// Returns `None` for empty files and binary files without a known signature.
+///
+/// # Errors
+/// Returns an error if the file cannot be opened or read, e.g. for lack of permissions.
+pub(crate) fn detect_mime_type(file_path: &Path) -> io::Result<Option<&'static str>> {
+    let mut header = Vec::new();
+    File::open(file_path)?
+        .take(SNIFF_LEN)
+        .read_to_end(&mut header)?;
+    Ok(sniff(&header))
+}
+
+/// Identifies the MIME type of content starting with `header`
+fn sniff(header: &[u8]) -> Option<&'static str> {
+    if header.is_empty() {
+        return None;
+    }
+    if let Some(mime) = sniff_riff(header).or_else(|| sniff_iso_bmff(header)) {
+        return Some(mime);
+    }
+    if let Some((_, _, mime)) = SIGNATURES
+        .iter()
+        .find(|(offset, magic, _)| header.get(*offset..).is_some_and(|h| h.starts_with(magic)))
+    {
+        return Some(mime);
+    }
+    sniff_text(header)
+}
+
+/// RIFF containers name their format at offset 8
+fn sniff_riff(header: &[u8]) -> Option<&'static str> {
+    if !header.starts_with(b"RIFF") {
+        return None;
+    }
+    match header.get(8..12)? {
+        b"WEBP" => Some("image/webp"),
+        b"WAVE" => Some("audio/wav"),
+        b"AVI " => Some("video/x-msvideo"),
+        _ => None,
+    }
+}
+
+/// MP4, MOV and HEIC files start with an `ftyp` box naming their major brand
+fn sniff_iso_bmff(header: &[u8]) -> Option<&'static str> {
+    if header.get(4..8)? != b"ftyp" {
+        return None;
+    }
+    match header.get(8..12)? {
+        b"qt  " => Some("video/quicktime"),
+        b"heic" | b"heix" | b"mif1" => Some("image/heic"),
+        b"avif" => Some("image/avif"),
+        b"M4A " => Some("audio/mp4"),
+        _ => Some("video/mp4"),
+    }
+}
+
+/// Markup and plain text, recognized by their leading characters
+fn sniff_text(header: &[u8]) -> Option<&'static str> {
+    // A multi-byte character may be cut off at the end of the header
+    let text = match std::str::from_utf8(header) {
+        Ok(text) => text,
+        Err(e) if e.error_len().is_none() => {
+            std::str::from_utf8(&header[..e.valid_up_to()]).ok()?
+        }
+        Err(_) => return None,
+    };
+    if text.contains('\0') {
+        return None;
+    }
+
+    let start = text
+        .trim_start_matches('\u{feff}')
+        .trim_start()
+        .to_lowercase();
+    if start.starts_with("<!doctype html") || start.starts_with("<html") {
+        Some("text/html")
+    } else if start.starts_with("<?xml") {
+        Some("text/xml")
+    } else if start.starts_with("%!ps") {
+        Some("application/postscript")
+    } else {
+        Some(TEXT_MIME)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_sniff_signatures() {
+        assert_eq!(sniff(b"\x89PNG\r\n\x1a\n\0\0\0\rIHDR"), Some("image/png"));
+        assert_eq!(sniff(b"\xff\xd8\xff\xe0\0\x10JFIF"), Some("image/jpeg"));
+        assert_eq!(sniff(b"%PDF-1.7\n"), Some("application/pdf"));
+        assert_eq!(sniff(b"RIFF\0\0\0\0WEBPVP8 "), Some("image/webp"));
+        assert_eq!(
+            sniff(b"\0\0\0\x18ftypqt  \0\0\0\0"),
+            Some("video/quicktime")
+        );
+        assert_eq!(sniff(b"\0\0\0\x18ftypisom\0\0\0\0"), Some("video/mp4"));
+        assert_eq!(sniff(b"PK\x03\x04\x14\0"), Some(ZIP_MIME));
+
+        let mut tar = vec![0u8; 512];
+        tar[257..262].copy_from_slice(b"ustar");
+        assert_eq!(sniff(&tar), Some("application/x-tar"));
+    }
+
+    #[test]
+    fn test_sniff_text_and_unknown() {
+        assert_eq!(sniff(b""), None);
+        assert_eq!(sniff(b"\0\x01\x02\x03binary"), None);
+        assert_eq!(sniff(b"hello, world\n"), Some(TEXT_MIME));
+        assert_eq!(sniff(b"  <!DOCTYPE html><html>"), Some("text/html"));
+        assert_eq!(sniff(b"<?xml version=\"1.0\"?>"), Some("text/xml"));
+        // "é" cut in half by the header limit is still text
+        assert_eq!(sniff(b"caf\xc3"), Some(TEXT_MIME));
+    }
+}
@@ -1,3 +1,9 @@
+pub mod classifier;
 pub mod date_parser;
 pub mod gen_pdf;
+pub mod line_diff;
+pub mod locale;
+pub mod media;
+pub mod mime;
+pub mod path_template;
 pub mod rename_pattern;
@@ -0,0 +1,471 @@
+//! Path templates for Tooka.
+//!
+//! Renders the sub-path a move or copy action places a file at, e.g.
+//! `{year}/{month}/{filename}` places `photo.jpg` modified in March 2024 at
+//! `2024/03/photo.jpg` below the action's destination. A format ending with
+//! `/` names a folder, and the file keeps its name inside it.
+//!
+//! `{month_name}` and `{month_short}` render the month's full or abbreviated
+//! name, in English or the locale given as `{month_name:de}`, so
+//! `{year}/{month_name}/` places the same photo in `2024/March/`.
+//!
+//! `{parent}` is the name of the folder containing the file and `{parent:N}`
+//! the name of its Nth ancestor, counted within the source folder. These two
+//! tokens may also be used in the destination of an action.
+//!
+//! Destinations and formats may refer to environment variables as `$VAR` or
+//! `${VAR}`, which are expanded before the tokens are rendered.
+
+use crate::common::environment::expand_path;
+use crate::core::error::TookaError;
+use crate::rules::rule::{PathTemplate, PathTemplateSource};
+use crate::utils::locale::{month_name, parse_month_filter};
+use crate::utils::rename_pattern::extract_exif_date;
+use chrono::{DateTime, Datelike, Local, NaiveDate};
+use std::fs;
+use std::path::{Component, Path, PathBuf};
+
+/// Tokens a path template may contain, besides `{parent:N}` and the locales
+/// of month names
+const TOKENS: &[&str] = &[
+    "year",
+    "month",
+    "month_name",
+    "month_short",
+    "day",
+    "filename",
+    "basename",
+    "ext",
+    "parent",
+];
+
+/// Token naming the folder containing the file
+const PARENT_TOKEN: &str = "parent";
+
+/// Part of a parsed path template
+#[derive(Debug, PartialEq, Eq)]
+enum Segment<'a> {
+    Literal(&'a str),
+    Token(&'a str),
+    /// Ancestor folder of the file, 1 being the folder containing it
+    Parent(usize),
+}
+
+/// Splits a format into literals and tokens, rejecting unknown tokens.
+///
+/// `${VAR}` environment variable references are kept as literals.
+fn parse(format: &str) -> Result<Vec<Segment<'_>>, String> {
+    let mut segments = Vec::new();
+    let mut rest = format;
+    // Length of the literal text at the start of `rest`
+    let mut literal = 0;
+    while let Some(found) = rest[literal..].find(['{', '}']) {
+        let start = literal + found;
+        if rest[start..].starts_with('}') {
+            return Err(format!("Path template '{format}' has an unmatched '}}'"));
+        }
+        let Some(len) = rest[start + 1..].find('}') else {
+            return Err(format!("Path template '{format}' has an unclosed '{{'"));
+        };
+        if rest[..start].ends_with('$') {
+            literal = start + 2 + len;
+            continue;
+        }
+        let token = &rest[start + 1..start + 1 + len];
+        if start > 0 {
+            segments.push(Segment::Literal(&rest[..start]));
+        }
+        segments.push(parse_token(format, token)?);
+        rest = &rest[start + 2 + len..];
+        literal = 0;
+    }
+    if !rest.is_empty() {
+        segments.push(Segment::Literal(rest));
+    }
+    Ok(segments)
+}
+
+/// Parses the content of a single `{...}` token
+fn parse_token<'a>(format: &str, token: &'a str) -> Result<Segment<'a>, String> {
+    if token == PARENT_TOKEN {
+        return Ok(Segment::Parent(1));
+    }
+    if let Some(index) = token
+        .strip_prefix(PARENT_TOKEN)
+        .and_then(|t| t.strip_prefix(':'))
+    {
+        return match index.trim().parse::<usize>() {
+            Ok(n) if n >= 1 => Ok(Segment::Parent(n)),
+            _ => Err(format!(
+                "Invalid ancestor index in '{{{token}}}' of path template '{format}'; use a number of at least 1, e.g. {{parent:2}} for the grandparent folder"
+            )),
+        };
+    }
+    if TOKENS.contains(&token) || parse_month_filter(token).is_some() {
+        return Ok(Segment::Token(token));
+    }
+    Err(format!(
+        "Unknown token '{{{token}}}' in path template '{format}'; supported tokens are: {}, {{parent:N}}, {{month_name:LOCALE}}",
+        TOKENS
+            .iter()
+            .map(|t| format!("{{{t}}}"))
+            .collect::<Vec<_>>()
+            .join(", ")
+    ))
+}
+
+/// Returns the name of the `n`th ancestor folder of a file below `source_path`
+fn ancestor_name(file_path: &Path, source_path: &Path, n: usize) -> Result<String, TookaError> {
+    let relative_path = file_path.strip_prefix(source_path).unwrap_or(file_path);
+    let folders: Vec<_> = relative_path
+        .parent()
+        .into_iter()
+        .flat_map(Path::components)
+        .filter_map(|c| match c {
+            Component::Normal(name) => Some(name),
+            _ => None,
+        })
+        .collect();
+    folders
+        .len()
+        .checked_sub(n)
+        .and_then(|i| folders[i].to_str())
+        .map(str::to_string)
+        .ok_or_else(|| {
+            TookaError::Other(format!(
+                "Cannot resolve '{{{PARENT_TOKEN}:{n}}}' for '{}': it has {} parent folders below the source folder",
+                relative_path.display(),
+                folders.len()
+            ))
+        })
+}
+
+/// Renders the `{parent}` tokens of an action's destination.
+///
+/// Destinations without tokens are returned unchanged.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the destination contains other tokens, or the
+/// file does not have the requested ancestor below the source folder.
+pub(crate) fn render_destination(
+    to: &str,
+    file_path: &Path,
+    source_path: &Path,
+) -> Result<String, TookaError> {
+    if !to.contains(['{', '}']) {
+        return Ok(to.to_string());
+    }
+    let mut rendered = String::with_capacity(to.len());
+    for segment in parse_destination(to).map_err(TookaError::Other)? {
+        match segment {
+            Segment::Literal(text) => rendered.push_str(text),
+            Segment::Parent(n) => rendered.push_str(&ancestor_name(file_path, source_path, n)?),
+            Segment::Token(token) => {
+                return Err(TookaError::Other(format!(
+                    "Token '{{{token}}}' is not supported in destination '{to}'"
+                )));
+            }
+        }
+    }
+    log::debug!("Rendered destination '{to}' as '{rendered}'");
+    Ok(rendered)
+}
+
+/// Parses a destination, which may only use `{parent}` tokens
+fn parse_destination(to: &str) -> Result<Vec<Segment<'_>>, String> {
+    let segments = parse(to)?;
+    if let Some(Segment::Token(token)) = segments.iter().find(|s| matches!(s, Segment::Token(_))) {
+        return Err(format!(
+            "Token '{{{token}}}' is not supported in destination '{to}'; only {{parent}} and {{parent:N}} are, use path_template for others"
+        ));
+    }
+    Ok(segments)
+}
+
+/// Checks that a destination only uses `{parent}` tokens.
+pub(crate) fn validate_destination(to: &str) -> Result<(), String> {
+    parse_destination(to).map(|_| ())
+}
+
+/// Checks that a path template format only uses known tokens and stays below
+/// the destination.
+pub(crate) fn validate_path_template(format: &str) -> Result<(), String> {
+    parse(format)?;
+    check_relative(format, Path::new(format))
+}
+
+/// Rejects rendered paths that would leave the action's destination
+fn check_relative(format: &str, path: &Path) -> Result<(), String> {
+    if path.as_os_str().is_empty() {
+        return Err(format!("Path template '{format}' renders an empty path"));
+    }
+    if path
+        .components()
+        .any(|c| !matches!(c, Component::Normal(_) | Component::CurDir))
+    {
+        return Err(format!(
+            "Path template '{format}' escapes the destination folder"
+        ));
+    }
+    Ok(())
+}
+
+/// Returns the date the template's date tokens are taken from
+fn template_date(source: PathTemplateSource, file_path: &Path) -> Result<NaiveDate, TookaError> {
+    if source == PathTemplateSource::ExifDate {
+        if let Some(date) = extract_exif_date(file_path) {
+            return Ok(date.date());
+        }
+        log::debug!(
+            "No EXIF capture date in '{}', using its modification time",
+            file_path.display()
+        );
+    }
+    let modified: DateTime<Local> = fs::metadata(file_path)?.modified()?.into();
+    Ok(modified.date_naive())
+}
+
+/// Renders a path template for a file, returning the path relative to the
+/// action's destination.
+///
+/// # Errors
+/// Returns a [`TookaError`] if the format contains an unknown token, the
+/// rendered path would leave the destination, the file's date cannot be read,
+/// or the file does not have a requested ancestor below `source_path`.
+pub(crate) fn render_path_template(
+    template: &PathTemplate,
+    file_path: &Path,
+    source_path: &Path,
+) -> Result<PathBuf, TookaError> {
+    let format = &expand_path(&template.format);
+    let segments = parse(format).map_err(TookaError::Other)?;
+
+    let file_name = file_path
+        .file_name()
+        .and_then(|s| s.to_str())
+        .unwrap_or_default();
+    let base_name = file_path
+        .file_stem()
+        .and_then(|s| s.to_str())
+        .unwrap_or_default();
+    let ext = file_path
+        .extension()
+        .and_then(|s| s.to_str())
+        .unwrap_or_default();
+
+    // Only files whose template uses a date need their metadata read
+    let needs_date = segments.iter().any(|s| match s {
+        Segment::Token(token) => {
+            matches!(*token, "year" | "month" | "day") || parse_month_filter(token).is_some()
+        }
+        _ => false,
+    });
+    let date = if needs_date {
+        Some(template_date(template.source, file_path)?)
+    } else {
+        None
+    };
+
+    let mut rendered = String::with_capacity(format.len());
+    for segment in &segments {
+        match (segment, date) {
+            (Segment::Literal(text), _) => rendered.push_str(text),
+            (Segment::Parent(n), _) => {
+                rendered.push_str(&ancestor_name(file_path, source_path, *n)?);
+            }
+            (Segment::Token("filename"), _) => rendered.push_str(file_name),
+            (Segment::Token("basename"), _) => rendered.push_str(base_name),
+            (Segment::Token("ext"), _) => rendered.push_str(ext),
+            (Segment::Token("year"), Some(date)) => {
+                rendered.push_str(&format!("{:04}", date.year()))
+            }
+            (Segment::Token("month"), Some(date)) => {
+                rendered.push_str(&format!("{:02}", date.month()));
+            }
+            (Segment::Token("day"), Some(date)) => rendered.push_str(&format!("{:02}", date.day())),
+            (Segment::Token(token), date) => match (parse_month_filter(token), date) {
+                (Some((short, locale)), Some(date)) => {
+                    rendered.push_str(&month_name(date.month(), locale, short));
+                }
+                _ => {
+                    return Err(TookaError::Other(format!(
+                        "Unknown token '{{{token}}}' in path template '{format}'"
+                    )));
+                }
+            },
+        }
+    }
+    if rendered.ends_with('/') {
+        rendered.push_str(file_name);
+    }
+
+    let path = PathBuf::from(rendered);
+    check_relative(format, &path).map_err(TookaError::Other)?;
+    log::debug!(
+        "Rendered path template '{format}' for '{}' as '{}'",
+        file_path.display(),
+        path.display()
+    );
+    Ok(path)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::TimeZone;
+    use tempfile::tempdir;
+
+    fn template(format: &str) -> PathTemplate {
+        PathTemplate {
+            source: PathTemplateSource::Mtime,
+            format: format.to_string(),
+        }
+    }
+
+    /// Creates `name` with a modification time of 2024-03-09 noon, local time
+    fn file_with_mtime(dir: &Path, name: &str) -> PathBuf {
+        let path = dir.join(name);
+        let file = fs::File::create(&path).unwrap();
+        let modified = Local.with_ymd_and_hms(2024, 3, 9, 12, 0, 0).unwrap();
+        file.set_modified(modified.into()).unwrap();
+        path
+    }
+
+    #[test]
+    fn test_render_path_template_with_mtime() {
+        let dir = tempdir().unwrap();
+        let file = file_with_mtime(dir.path(), "holiday.tar.gz");
+
+        let cases = [
+            ("{year}/{month}/{filename}", "2024/03/holiday.tar.gz"),
+            (
+                "{year}-{month}-{day}/{basename}.{ext}",
+                "2024-03-09/holiday.tar.gz",
+            ),
+            ("by-type/{ext}/", "by-type/gz/holiday.tar.gz"),
+            ("{basename}", "holiday.tar"),
+        ];
+        for (format, expected) in cases {
+            assert_eq!(
+                render_path_template(&template(format), &file, dir.path()).unwrap(),
+                PathBuf::from(expected),
+                "format: {format}"
+            );
+        }
+
+        // Files without EXIF data fall back to their modification time
+        let exif = PathTemplate {
+            source: PathTemplateSource::ExifDate,
+            format: "{year}/{day}/{filename}".to_string(),
+        };
+        assert_eq!(
+            render_path_template(&exif, &file, dir.path()).unwrap(),
+            PathBuf::from("2024/09/holiday.tar.gz")
+        );
+    }
+
+    #[test]
+    fn test_render_month_names() {
+        let dir = tempdir().unwrap();
+        let file = file_with_mtime(dir.path(), "photo.jpg");
+
+        let cases = [
+            ("{year}/{month_name}/", "2024/March/photo.jpg"),
+            (
+                "{year}/{month}-{month_short}/{filename}",
+                "2024/03-Mar/photo.jpg",
+            ),
+            ("{month_name:de}/{filename}", "März/photo.jpg"),
+        ];
+        for (format, expected) in cases {
+            assert!(validate_path_template(format).is_ok(), "format: {format}");
+            assert_eq!(
+                render_path_template(&template(format), &file, dir.path()).unwrap(),
+                PathBuf::from(expected),
+                "format: {format}"
+            );
+        }
+        assert!(validate_destination("/photos/{month_name}").is_err());
+    }
+
+    #[test]
+    fn test_path_template_errors() {
+        let dir = tempdir().unwrap();
+        let file = file_with_mtime(dir.path(), "photo.jpg");
+
+        let err = render_path_template(&template("{year}/{hour}/{filename}"), &file, dir.path())
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("'{hour}'"), "{err}");
+
+        for format in [
+            "{year",
+            "year}/{filename}",
+            "../{filename}",
+            "/{filename}",
+            "",
+        ] {
+            assert!(validate_path_template(format).is_err(), "format: {format}");
+        }
+        assert!(validate_path_template("{year}/{month}/{filename}").is_ok());
+    }
+
+    #[test]
+    fn test_render_parent_tokens_for_nested_files() {
+        let source = tempdir().unwrap();
+        let nested = source.path().join("projects/website/assets");
+        fs::create_dir_all(&nested).unwrap();
+        let file = file_with_mtime(&nested, "logo.png");
+
+        assert_eq!(
+            render_path_template(&template("{parent}/{filename}"), &file, source.path()).unwrap(),
+            PathBuf::from("assets/logo.png")
+        );
+        assert_eq!(
+            render_path_template(
+                &template("{parent:2}/{year}/{filename}"),
+                &file,
+                source.path()
+            )
+            .unwrap(),
+            PathBuf::from("website/2024/logo.png")
+        );
+        assert_eq!(
+            render_destination("/archive/{parent:3}-{parent}", &file, source.path()).unwrap(),
+            "/archive/projects-assets"
+        );
+        assert_eq!(
+            render_destination("~/plain", &file, source.path()).unwrap(),
+            "~/plain"
+        );
+
+        // The source folder itself is not an ancestor of its files
+        let err = render_destination("/archive/{parent:4}", &file, source.path())
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("3 parent folders"), "{err}");
+        let top_level = file_with_mtime(source.path(), "top.txt");
+        assert!(render_destination("/archive/{parent}", &top_level, source.path()).is_err());
+
+        assert!(validate_path_template("{parent:0}/{filename}").is_err());
+        assert!(validate_path_template("{parent:x}/{filename}").is_err());
+        assert!(validate_destination("/archive/{parent:2}").is_ok());
+        assert!(validate_destination("/archive/{year}").is_err());
+    }
+
+    #[test]
+    fn test_environment_variables_are_not_tokens() {
+        assert!(validate_destination("${CLOUD_DIR}/{parent}").is_ok());
+        assert!(validate_destination("$HOME/${CLOUD_DIR}").is_ok());
+        assert!(validate_path_template("${ARCHIVE}/{year}/").is_ok());
+        assert!(validate_path_template("{CLOUD_DIR}/{year}/").is_err());
+        assert_eq!(
+            parse("${A}/{year}-${B}").unwrap(),
+            vec![
+                Segment::Literal("${A}/"),
+                Segment::Token("year"),
+                Segment::Literal("-${B}"),
+            ]
+        );
+    }
+}
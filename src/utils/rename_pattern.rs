@@ -1,6 +1,8 @@
 use crate::core::error::TookaError;
-use chrono::{DateTime, Local, NaiveDateTime, TimeZone};
-use exif::{In, Reader, Tag};
+use crate::utils::locale::{month_name, parse_month_filter};
+use crate::utils::media::probe_video;
+use chrono::{DateTime, Datelike, Local, NaiveDateTime, TimeZone};
+use exif::{Exif, In, Reader, Tag, Value};
 use regex::Regex;
 use std::collections::HashMap;
 use std::fs;
@@ -23,6 +25,11 @@ pub(crate) fn evaluate_template(
         .and_then(|s| s.to_str())
         .unwrap_or("")
         .to_string();
+    let extension = file_path
+        .extension()
+        .and_then(|s| s.to_str())
+        .map(|ext| format!(".{ext}"))
+        .unwrap_or_default();
 
     let mut result = template.to_string();
 
@@ -34,10 +41,24 @@ pub(crate) fn evaluate_template(
         let key = parts.next().unwrap().trim();
         let filters: Vec<&str> = parts.collect();
 
-        let raw_value = if key == "filename" {
+        let raw_value = if key == "filename" || key == "basename" {
             file_name.clone()
+        } else if key == "ext" {
+            extension.clone()
+        } else if key == "date" {
+            metadata
+                .get("modified")
+                .map(|date| apply_filters(date.clone(), &["date:%Y-%m-%d"]))
+                .unwrap_or_default()
         } else if let Some(metadata_key) = key.strip_prefix("metadata.") {
             metadata.get(metadata_key).cloned().unwrap_or_default()
+        } else if parse_month_filter(key).is_some() {
+            // Month tokens use the capture date for photos, else the file's own dates
+            ["EXIF:DateTime", "created", "modified"]
+                .iter()
+                .find_map(|k| metadata.get(*k))
+                .map(|date| apply_filters(date.clone(), &[key]))
+                .unwrap_or_default()
         } else {
             String::new()
         };
@@ -49,25 +70,163 @@ pub(crate) fn evaluate_template(
     result
 }
 
+/// Template key of the rename counter
+const COUNTER_KEY: &str = "counter";
+
+/// Counter width used when a rename action does not set one
+pub(crate) const DEFAULT_COUNTER_WIDTH: usize = 3;
+
+/// Highest counter tried before giving up on finding a free name
+const MAX_COUNTER: u64 = 1_000_000;
+
+/// Renders a rename template, choosing the lowest `{{counter}}` for which
+/// `is_free` accepts the name.
+///
+/// The counter starts at 1 and is zero-padded to `counter_width` digits.
+/// Templates without a counter are rendered once and not checked.
+///
+/// # Errors
+/// Returns an error if no free name is found.
+pub(crate) fn render_rename_template(
+    template: &str,
+    file_path: &Path,
+    metadata: &HashMap<String, String>,
+    counter_width: usize,
+    is_free: impl Fn(&str) -> bool,
+) -> Result<String, String> {
+    let has_counter = TEMPLATE_REGEX
+        .captures_iter(template)
+        .any(|caps| caps[1].trim() == COUNTER_KEY);
+    if !has_counter {
+        return Ok(evaluate_template(template, file_path, metadata));
+    }
+
+    for counter in 1..=MAX_COUNTER {
+        let numbered = TEMPLATE_REGEX.replace_all(template, |caps: &regex::Captures| {
+            if caps[1].trim() == COUNTER_KEY {
+                format!("{counter:0counter_width$}")
+            } else {
+                caps[0].to_string()
+            }
+        });
+        let name = evaluate_template(&numbered, file_path, metadata);
+        if is_free(&name) {
+            return Ok(name);
+        }
+        log::debug!("Rename target '{name}' is taken, trying the next counter");
+    }
+    Err(format!(
+        "no free file name for template '{template}' after {MAX_COUNTER} attempts"
+    ))
+}
+
+/// Checks a rename template for problems that can be detected before rendering.
+///
+/// Rejects templates whose literal text contains a path separator, that are a
+/// bare `.` or `..`, or that can only ever render an empty name because they
+/// consist solely of unknown placeholders.
+pub(crate) fn validate_template(template: &str) -> Result<(), String> {
+    let literal = TEMPLATE_REGEX.replace_all(template, "");
+    if literal.contains(['/', '\\']) {
+        return Err(format!(
+            "Template '{template}' contains a path separator; rename targets must be a file name"
+        ));
+    }
+    if matches!(template.trim(), "." | "..") {
+        return Err(format!(
+            "Template '{template}' escapes the destination folder"
+        ));
+    }
+    let has_known_key = TEMPLATE_REGEX.captures_iter(template).any(|caps| {
+        let key = caps[1].split('|').next().unwrap_or_default().trim();
+        matches!(key, "filename" | "basename" | "ext" | "date" | COUNTER_KEY)
+            || key.starts_with("metadata.")
+            || parse_month_filter(key).is_some()
+    });
+    if literal.trim().is_empty() && !has_known_key {
+        return Err(format!(
+            "Template '{template}' always renders an empty file name"
+        ));
+    }
+    Ok(())
+}
+
+/// Checks that a rendered file name is a single, non-empty path component.
+pub(crate) fn validate_file_name(name: &str) -> Result<(), String> {
+    if name.trim().is_empty() {
+        return Err("rendered file name is empty".into());
+    }
+    if name.contains(['/', '\\', '\0']) {
+        return Err(format!(
+            "rendered file name '{name}' contains a path separator or NUL byte"
+        ));
+    }
+    if matches!(name, "." | "..") {
+        return Err(format!(
+            "rendered file name '{name}' escapes the destination folder"
+        ));
+    }
+    Ok(())
+}
+
 fn apply_filters(value: String, filters: &[&str]) -> String {
     let mut val = value;
     for filter in filters {
         if let Some(fmt) = filter.strip_prefix("date:") {
-            let parsed = DateTime::parse_from_rfc3339(&val)
-                .map(|dt| dt.with_timezone(&Local))
-                .or_else(|_| {
-                    NaiveDateTime::parse_from_str(&val, "%Y:%m:%d %H:%M:%S")
-                        .map(|dt| Local.from_local_datetime(&dt).unwrap())
-                });
-
-            if let Ok(datetime) = parsed {
+            if let Some(datetime) = parse_template_date(&val) {
                 val = datetime.format(fmt).to_string();
             }
+        } else if let Some((short, locale)) = parse_month_filter(filter) {
+            if let Some(datetime) = parse_template_date(&val) {
+                val = month_name(datetime.month(), locale, short);
+            }
         }
     }
     val
 }
 
+/// Parses an RFC 3339 or EXIF-style date value used in templates.
+fn parse_template_date(value: &str) -> Option<DateTime<Local>> {
+    DateTime::parse_from_rfc3339(value)
+        .map(|dt| dt.with_timezone(&Local))
+        .or_else(|_| {
+            NaiveDateTime::parse_from_str(value, EXIF_DATE_FORMAT)
+                .map(|dt| Local.from_local_datetime(&dt).unwrap())
+        })
+        .ok()
+}
+
+/// Reads the date a photo was taken from its EXIF `DateTimeOriginal` tag.
+///
+/// Supports the containers EXIF is read from: JPEG, TIFF-based RAW formats
+/// (e.g. CR2, NEF, ARW, DNG), HEIF, PNG and WebP. Returns `None` if the file
+/// has no EXIF block, the block is corrupt, or the tag is missing or invalid.
+pub(crate) fn extract_exif_date(file_path: &Path) -> Option<NaiveDateTime> {
+    let file = fs::File::open(file_path).ok()?;
+    let exif = Reader::new()
+        .read_from_container(&mut std::io::BufReader::new(file))
+        .inspect_err(|e| log::debug!("No EXIF data in '{}': {}", file_path.display(), e))
+        .ok()?;
+    exif_capture_date(&exif)
+}
+
+/// Returns the `DateTimeOriginal` of already-read EXIF data
+fn exif_capture_date(exif: &Exif) -> Option<NaiveDateTime> {
+    match &exif.get_field(Tag::DateTimeOriginal, In::PRIMARY)?.value {
+        Value::Ascii(values) => values.first().and_then(|raw| parse_exif_datetime(raw)),
+        _ => None,
+    }
+}
+
+/// Format of EXIF date values, e.g. `2024:06:01 14:30:00`
+const EXIF_DATE_FORMAT: &str = "%Y:%m:%d %H:%M:%S";
+
+/// Parses a raw EXIF date value; cameras without a clock write all zeros.
+fn parse_exif_datetime(raw: &[u8]) -> Option<NaiveDateTime> {
+    let value = std::str::from_utf8(raw).ok()?.trim_end_matches('\0').trim();
+    NaiveDateTime::parse_from_str(value, EXIF_DATE_FORMAT).ok()
+}
+
 /// Returns metadata fields for use in templating
 pub(crate) fn extract_metadata(file_path: &Path) -> Result<HashMap<String, String>, TookaError> {
     let mut map = HashMap::new();
@@ -97,11 +256,206 @@ pub(crate) fn extract_metadata(file_path: &Path) -> Result<HashMap<String, Strin
             }
 
             // Common aliases for convenience
-            if let Some(field) = reader.get_field(Tag::DateTimeOriginal, In::PRIMARY) {
-                map.insert("EXIF:DateTime".into(), field.display_value().to_string());
+            if let Some(date) = exif_capture_date(&reader) {
+                map.insert(
+                    "EXIF:DateTime".into(),
+                    date.format(EXIF_DATE_FORMAT).to_string(),
+                );
             }
         }
     }
 
+    // Capture date for photos, else the modification time
+    let capture_date = map
+        .get("EXIF:DateTime")
+        .and_then(|date| parse_template_date(date))
+        .map(|date| date.to_rfc3339())
+        .or_else(|| map.get("modified").cloned());
+    if let Some(capture_date) = capture_date {
+        map.insert("capture_date".into(), capture_date);
+    }
+
+    // Video duration (whole seconds) and resolution for MP4/MOV files
+    if let Some(video) = probe_video(file_path) {
+        map.insert(
+            "VIDEO:Duration".into(),
+            format!("{:.0}", video.duration_secs),
+        );
+        map.insert("VIDEO:Width".into(), video.width.to_string());
+        map.insert("VIDEO:Height".into(), video.height.to_string());
+        map.insert(
+            "VIDEO:Resolution".into(),
+            format!("{}x{}", video.width, video.height),
+        );
+    }
+
     Ok(map)
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn metadata_with(key: &str, value: &str) -> HashMap<String, String> {
+        HashMap::from([(key.to_string(), value.to_string())])
+    }
+
+    #[test]
+    fn test_month_tokens_default_to_english() {
+        let metadata = metadata_with("modified", "2024-03-15T10:00:00+00:00");
+        let path = Path::new("/photos/img.jpg");
+
+        assert_eq!(
+            evaluate_template("{{month_name}}_{{filename}}", path, &metadata),
+            "March_img"
+        );
+        assert_eq!(evaluate_template("{{month_short}}", path, &metadata), "Mar");
+    }
+
+    #[test]
+    fn test_month_tokens_with_locale() {
+        let path = Path::new("/photos/img.jpg");
+        for (date, locale, expected) in [
+            ("2024:01:10 08:00:00", "de", "Januar"),
+            ("2024:03:10 08:00:00", "de", "März"),
+            ("2024:08:10 08:00:00", "fr", "août"),
+            ("2024:12:10 08:00:00", "es", "diciembre"),
+        ] {
+            let metadata = metadata_with("EXIF:DateTime", date);
+            let template = format!("{{{{month_name:{locale}}}}}");
+            assert_eq!(evaluate_template(&template, path, &metadata), expected);
+        }
+
+        let metadata = metadata_with("EXIF:DateTime", "2024:10:10 08:00:00");
+        assert_eq!(
+            evaluate_template("{{month_short:nl}}", path, &metadata),
+            "okt"
+        );
+    }
+
+    #[test]
+    fn test_month_filters_on_metadata() {
+        let mut metadata = metadata_with("created", "2023-05-10T12:00:00+00:00");
+        metadata.insert("modified".into(), "2024-11-20T12:00:00+00:00".into());
+        let path = Path::new("/photos/img.jpg");
+
+        assert_eq!(
+            evaluate_template(
+                "{{metadata.modified|date:%Y}}/{{metadata.modified|month_name}}",
+                path,
+                &metadata
+            ),
+            "2024/November"
+        );
+        // The bare token prefers the creation date over the modification date
+        assert_eq!(
+            evaluate_template("{{month_name:it}}", path, &metadata),
+            "maggio"
+        );
+    }
+
+    #[test]
+    fn test_validate_template() {
+        assert!(validate_template("{{filename}}_{{metadata.modified|date:%Y}}").is_ok());
+        assert!(validate_template("{{month_short}}-photo").is_ok());
+
+        for template in [
+            "archive/{{filename}}",
+            "..\\{{filename}}",
+            "../{{filename}}",
+            "..",
+            "{{unknown}}",
+            "  {{}}  ",
+        ] {
+            assert!(validate_template(template).is_err(), "{template}");
+        }
+    }
+
+    #[test]
+    fn test_validate_file_name() {
+        assert!(validate_file_name("report_2024.pdf").is_ok());
+        assert!(validate_file_name("..hidden").is_ok());
+
+        for name in ["", "   ", "a/b.txt", "../b.txt", "/etc/passwd", ".", ".."] {
+            assert!(validate_file_name(name).is_err(), "{name:?}");
+        }
+    }
+
+    #[test]
+    fn test_parse_exif_datetime() {
+        let expected = NaiveDateTime::parse_from_str("2024-06-01 14:30:05", "%Y-%m-%d %H:%M:%S");
+        assert_eq!(parse_exif_datetime(b"2024:06:01 14:30:05"), expected.ok());
+        assert_eq!(parse_exif_datetime(b"2024:06:01 14:30:05\0"), expected.ok());
+
+        for raw in [
+            &b"0000:00:00 00:00:00"[..],
+            b"    :  :     :  :  ",
+            b"\xff\xfe",
+            b"",
+        ] {
+            assert_eq!(parse_exif_datetime(raw), None, "{raw:?}");
+        }
+    }
+
+    #[test]
+    fn test_capture_date_falls_back_to_modified() {
+        let file = tempfile::NamedTempFile::new().unwrap();
+        let taken = Local.with_ymd_and_hms(2021, 7, 4, 9, 0, 0).unwrap();
+        file.as_file().set_modified(taken.into()).unwrap();
+
+        assert_eq!(extract_exif_date(file.path()), None);
+        let metadata = extract_metadata(file.path()).unwrap();
+        assert_eq!(metadata["capture_date"], taken.to_rfc3339());
+        assert_eq!(
+            evaluate_template(
+                "{{metadata.capture_date|date:%Y-%m}}",
+                file.path(),
+                &metadata
+            ),
+            "2021-07"
+        );
+    }
+
+    #[test]
+    fn test_rename_template_keys() {
+        let metadata = metadata_with("modified", "2024-03-15T10:00:00+00:00");
+        let path = Path::new("/scans/Scan 12.PDF");
+
+        assert_eq!(
+            evaluate_template("{{date}}_{{basename}}{{ext}}", path, &metadata),
+            "2024-03-15_Scan 12.PDF"
+        );
+        assert_eq!(
+            evaluate_template("{{basename}}{{ext}}", Path::new("/scans/README"), &metadata),
+            "README"
+        );
+    }
+
+    #[test]
+    fn test_rename_counter_skips_taken_names() {
+        let metadata = HashMap::new();
+        let path = Path::new("/photos/img.jpg");
+        let taken = ["img_001.jpg", "img_002.jpg"];
+        let is_free = |name: &str| !taken.contains(&name);
+
+        assert_eq!(
+            render_rename_template(
+                "{{basename}}_{{counter}}{{ext}}",
+                path,
+                &metadata,
+                DEFAULT_COUNTER_WIDTH,
+                is_free
+            ),
+            Ok("img_003.jpg".to_string())
+        );
+        assert_eq!(
+            render_rename_template("{{counter}}-{{basename}}", path, &metadata, 5, is_free),
+            Ok("00001-img".to_string())
+        );
+        // Without a counter the name is used even if taken
+        assert_eq!(
+            render_rename_template("img_001{{ext}}", path, &metadata, 3, is_free),
+            Ok("img_001.jpg".to_string())
+        );
+    }
+}